@@ -2,12 +2,35 @@
 package app
 
 import (
+	"caddae/callout"
+	"caddae/catalog"
+	"caddae/drawing"
 	"caddae/imageproc"
 	"caddae/types"
+	"fmt"
+	"os"
+	"strings"
 
 	"github.com/jroimartin/gocui"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
 )
 
+// New creates and returns a new App
+func New(logger *zerolog.Logger) *App {
+	a := App{
+		Log:       logger.With().Str("module", "app").Logger(),
+		profiles:  drawing.DefaultProfiles(),
+		leader:    callout.DefaultLeader(),
+		font:      callout.DefaultFont(),
+		templates: callout.DefaultTemplates(),
+		catalog:   catalog.DefaultCatalog(),
+	}
+	al := a.Log.With().Str("func", "New").Logger()
+	al.Debug().Msg("Created")
+	return &a
+}
+
 // SetUserInput sets the user input configuration
 func (a *App) SetUserInput(input UserInput) {
 	al := a.Log.With().Str("func", "SetUserInput").Logger()
@@ -15,8 +38,52 @@ func (a *App) SetUserInput(input UserInput) {
 	a.in = input
 }
 
+// SetProfiles sets the color profiles the user input can select from
+func (a *App) SetProfiles(profiles drawing.Profiles) {
+	al := a.Log.With().Str("func", "SetProfiles").Logger()
+	al.Debug().Int("profiles", len(profiles)).Send()
+	a.profiles = profiles
+}
+
+// SetTemplates sets the callout templates the user input can select from
+func (a *App) SetTemplates(templates callout.Templates) {
+	al := a.Log.With().Str("func", "SetTemplates").Logger()
+	al.Debug().Int("templates", len(templates)).Send()
+	a.templates = templates
+}
+
+// SetCatalog sets the catalog of production units the user input gives
+// quantities for
+func (a *App) SetCatalog(c *catalog.Catalog) {
+	al := a.Log.With().Str("func", "SetCatalog").Logger()
+	al.Debug().Int("units", len(c.Units)).Send()
+	a.catalog = c
+}
+
+// Catalog returns the catalog of production units
+func (a *App) Catalog() *catalog.Catalog {
+	return a.catalog
+}
+
+// SetLeader sets the style of the leader arrows drawn from the callouts
+func (a *App) SetLeader(l callout.Leader) {
+	al := a.Log.With().Str("func", "SetLeader").Logger()
+	al.Debug().Interface("leader", l).Send()
+	a.leader = l
+}
+
+// SetFont sets the font of the callout text
+func (a *App) SetFont(f callout.Font) {
+	al := a.Log.With().Str("func", "SetFont").Logger()
+	al.Debug().Float64("size", f.Size).Float64("dpi", f.DPI).Bool("typeface", f.Typeface != nil).Send()
+	a.font = f
+}
+
 // Start starts the application process of validating user input and
 // processing the given images.
+//
+// If u and g are nil, no terminal UI is used and progress messages are
+// written to stdout instead.
 func (a *App) Start(u types.UI, g *gocui.Gui) error {
 	al := a.Log.With().Str("func", "Start").Logger()
 
@@ -29,24 +96,34 @@ func (a *App) Start(u types.UI, g *gocui.Gui) error {
 	}
 
 	// Let the user know the input was good
-	msg := "Input successfully validated!\n"
-	g.Update(func(*gocui.Gui) error {
-		if err := u.Log(msg); err != nil {
-			return err
-		}
-		return nil
-	})
+	a.updateUI(u, g, "Input successfully validated!\n")
 	al.Debug().Msg("valid input")
 	al.Debug().Msg("starting image pre processing")
 
 	// Update the user on what we're doing
-	msg = "Starting image pre processing..\n"
-	g.Update(func(*gocui.Gui) error {
-		if err := u.Log(msg); err != nil {
-			return err
-		}
-		return nil
-	})
+	a.updateUI(u, g, "Starting image pre processing..\n")
+
+	// Open the job's history once for the whole run
+	db, err := a.openJobDB()
+	if err != nil {
+		return err
+	}
+	if db != nil {
+		defer db.Close()
+	}
+
+	// Let the user know if this redline has been done before
+	a.checkApplied(u, g, db, conf)
+
+	// Pick up the job's totals so far, if they're being stamped
+	if err := a.setTotals(db, &conf); err != nil {
+		return err
+	}
+
+	// And what it's saved as
+	if err := a.setFormat(db, &conf); err != nil {
+		return err
+	}
 
 	// Create a new image processor with the given configuration
 	a.Ip = imageproc.New(conf, &a.Log)
@@ -56,5 +133,26 @@ func (a *App) Start(u types.UI, g *gocui.Gui) error {
 		return err
 	}
 
+	// Keep a record of the run in the job's history, and its overlay
+	if err := a.record(db, []recordedPass{{a.in, conf, a.Ip}}, a.Ip.RunningFile()); err != nil {
+		return errors.Wrap(err, "the running asbuilt was saved, but recording it failed")
+	}
+
 	return nil
 }
+
+// updateUI gives the user a message on the application log, or on stdout
+// if we're running without the terminal UI.
+func (a *App) updateUI(u types.UI, g *gocui.Gui, msg string) {
+	if u == nil || g == nil {
+		fmt.Fprintln(os.Stdout, strings.TrimRight(msg, "\n"))
+		return
+	}
+
+	g.Update(func(*gocui.Gui) error {
+		if err := u.Log(msg); err != nil {
+			return err
+		}
+		return nil
+	})
+}
@@ -0,0 +1,233 @@
+package app
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// requiredColumns are the CSV header names every manifest must have. Column
+// names match the UserInput json tags. The running and job_number columns may
+// be left out of replay manifests, since those are given once for the job.
+var requiredColumns = []string{
+	"redline",
+	"wpd",
+}
+
+// inputColumns are the manifest names of the UserInput fields. Any other
+// column or key of a manifest is a production quantity, named by the catalog
+// code or alias of its unit, e.g. "C300-01" or "strand".
+var inputColumns = map[string]bool{
+	"redline":      true,
+	"running":      true,
+	"job_number":   true,
+	"wpd":          true,
+	"profile":      true,
+	"template":     true,
+	"crew":         true,
+	"page":         true,
+	"running_page": true,
+	"quantities":   true,
+}
+
+// LoadManifest reads a batch manifest file and returns one UserInput per entry.
+//
+// The manifest may either be a JSON array of UserInput objects, or a CSV file
+// with a header row using the same names as the UserInput json tags. Other
+// keys and columns are the quantities of the production units. Relative
+// redline and running paths are resolved against the manifest's directory.
+func LoadManifest(path string) ([]UserInput, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "os.Open(%s): failed to open manifest", path)
+	}
+	defer f.Close()
+
+	var inputs []UserInput
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		inputs, err = readJSONManifest(f)
+	case ".csv":
+		inputs, err = readCSVManifest(f)
+	default:
+		return nil, InvFileErr
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "LoadManifest(%s)", path)
+	}
+
+	// Resolve the image paths relative to the manifest, so a manifest can be
+	// kept next to the scans it lists.
+	dir := filepath.Dir(path)
+	for i := range inputs {
+		inputs[i].Rl = resolvePath(dir, inputs[i].Rl)
+		inputs[i].Ra = resolvePath(dir, inputs[i].Ra)
+		inputs[i].Jn = strings.ToUpper(inputs[i].Jn)
+	}
+	return inputs, nil
+}
+
+// readJSONManifest reads a JSON array of UserInput objects.
+func readJSONManifest(r io.Reader) ([]UserInput, error) {
+	var inputs []UserInput
+	if err := json.NewDecoder(r).Decode(&inputs); err != nil {
+		return nil, errors.Wrap(err, "failed to decode JSON manifest")
+	}
+	return inputs, nil
+}
+
+// readCSVManifest reads a CSV manifest with a header row.
+func readCSVManifest(r io.Reader) ([]UserInput, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read CSV manifest")
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	// Map the header names to their column index
+	cols := make(map[string]int, len(records[0]))
+	for i, name := range records[0] {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range requiredColumns {
+		if _, ok := cols[name]; !ok {
+			return nil, fmt.Errorf("CSV manifest is missing the '%s' column", name)
+		}
+	}
+
+	get := func(record []string, name string) string {
+		i, ok := cols[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var inputs []UserInput
+	for i, record := range records[1:] {
+		in := UserInput{
+			Rl:       get(record, "redline"),
+			Ra:       get(record, "running"),
+			Jn:       get(record, "job_number"),
+			Wpd:      get(record, "wpd"),
+			Profile:  get(record, "profile"),
+			Template: get(record, "template"),
+			Crew:     get(record, "crew"),
+		}
+		for name, page := range map[string]*int{"page": &in.Page, "running_page": &in.RunningPage} {
+			if v := get(record, name); v != "" {
+				if *page, err = strconv.Atoi(v); err != nil {
+					return nil, fmt.Errorf("CSV manifest entry %d: %s '%s' must be a number", i+1, name, v)
+				}
+			}
+		}
+		for name := range cols {
+			if qty := get(record, name); !inputColumns[name] && qty != "" {
+				in.SetQuantity(name, qty)
+			}
+		}
+		inputs = append(inputs, in)
+	}
+	return inputs, nil
+}
+
+// UnmarshalJSON decodes a UserInput from a JSON manifest entry. Quantities
+// can be numbers or strings, and can be given in the "quantities" object or
+// as keys of their own, like the "strand" key of older manifests.
+func (in *UserInput) UnmarshalJSON(b []byte) error {
+	type plain UserInput
+	var v struct {
+		plain
+		Quantities map[string]json.RawMessage `json:"quantities"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	if v.Quantities == nil {
+		v.Quantities = make(map[string]json.RawMessage)
+	}
+	for name, raw := range fields {
+		if !inputColumns[name] {
+			v.Quantities[name] = raw
+		}
+	}
+
+	*in = UserInput(v.plain)
+	in.Quantities = nil
+	for name, raw := range v.Quantities {
+		var qty string
+		if err := json.Unmarshal(raw, &qty); err != nil {
+			var n json.Number
+			if err := json.Unmarshal(raw, &n); err != nil {
+				return fmt.Errorf("quantity '%s' must be a number or a string", name)
+			}
+			qty = n.String()
+		}
+		if qty != "" {
+			in.SetQuantity(name, qty)
+		}
+	}
+	return nil
+}
+
+// resolvePath joins a relative path onto dir.
+func resolvePath(dir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// RunBatch validates and processes each of the given inputs in order without
+// the terminal UI. A failed entry does not stop the rest of the batch.
+func (a *App) RunBatch(inputs []UserInput) []BatchResult {
+	al := a.Log.With().Str("func", "RunBatch").Logger()
+	al.Debug().Int("entries", len(inputs)).Send()
+
+	results := make([]BatchResult, 0, len(inputs))
+	for i, in := range inputs {
+		a.updateUI(nil, nil, fmt.Sprintf("[%d/%d] Processing %s ..", i+1, len(inputs), in.Rl))
+
+		a.SetUserInput(in)
+		res := BatchResult{Row: i + 1, Input: in}
+		if err := a.Start(nil, nil); err != nil {
+			al.Debug().Err(err).Int("row", i+1).Msg("batch entry failed")
+			res.Err = err
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+// WriteBatchSummary writes a per-row success/failure summary of the batch and
+// returns the number of failed rows.
+func WriteBatchSummary(w io.Writer, results []BatchResult) int {
+	failed := 0
+	fmt.Fprintf(w, "\nBatch summary\n=============\n")
+	for _, res := range results {
+		if res.Err != nil {
+			failed++
+			fmt.Fprintf(w, "  %3d  FAILED  %s %s (%s): %v\n", res.Row, res.Input.Jn, res.Input.Wpd, res.Input.Rl, res.Err)
+			continue
+		}
+		fmt.Fprintf(w, "  %3d  OK      %s %s (%s)\n", res.Row, res.Input.Jn, res.Input.Wpd, res.Input.Rl)
+	}
+	fmt.Fprintf(w, "%d succeeded, %d failed\n", len(results)-failed, failed)
+	return failed
+}
@@ -0,0 +1,111 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeManifest writes the manifest into a new temporary directory, and
+// returns its path
+func writeManifest(t *testing.T, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadJSONManifest(t *testing.T) {
+	path := writeManifest(t, "jobs.JSON", `[
+		{"redline": "scans/rl.png", "running": "/abs/ra.png", "job_number": "vz_lan_00007054", "wpd": "07/16/2021",
+		 "page": 2, "quantities": {"C300-01": 250, "C300-04": "2"}},
+		{"redline": "rl2.png", "wpd": "07/19/2021", "strand": 100, "anchor": "1"}
+	]`)
+	dir := filepath.Dir(path)
+
+	inputs, err := LoadManifest(path)
+	if err != nil {
+		t.Fatalf("LoadManifest: %v", err)
+	}
+	if len(inputs) != 2 {
+		t.Fatalf("%d entries, want 2", len(inputs))
+	}
+
+	want := UserInput{
+		Rl:         filepath.Join(dir, "scans", "rl.png"),
+		Ra:         "/abs/ra.png",
+		Jn:         "VZ_LAN_00007054",
+		Wpd:        "07/16/2021",
+		Page:       2,
+		Quantities: map[string]string{"C300-01": "250", "C300-04": "2"},
+	}
+	if !reflect.DeepEqual(inputs[0], want) {
+		t.Errorf("entry 1 = %+v, want %+v", inputs[0], want)
+	}
+
+	// The legacy keys of older manifests are quantities of their own
+	if q := inputs[1].Quantities; !reflect.DeepEqual(q, map[string]string{"strand": "100", "anchor": "1"}) {
+		t.Errorf("entry 2 quantities = %v", q)
+	}
+	if inputs[1].Rl != filepath.Join(dir, "rl2.png") || inputs[1].Ra != "" {
+		t.Errorf("entry 2 paths = %s, %s", inputs[1].Rl, inputs[1].Ra)
+	}
+}
+
+func TestLoadCSVManifest(t *testing.T) {
+	path := writeManifest(t, "jobs.csv", strings.Join([]string{
+		" Redline, running ,JOB_NUMBER,wpd,running_page,strand,C300-04",
+		"rl.tif,ra.png,vz_lan_00007054,07/16/2021,3,250,",
+		"rl2.png,ra.png,VZ_LAN_00007054,07/19/2021,,,2",
+	}, "\n"))
+	dir := filepath.Dir(path)
+
+	inputs, err := LoadManifest(path)
+	if err != nil {
+		t.Fatalf("LoadManifest: %v", err)
+	}
+	if len(inputs) != 2 {
+		t.Fatalf("%d entries, want 2", len(inputs))
+	}
+
+	want := UserInput{
+		Rl:          filepath.Join(dir, "rl.tif"),
+		Ra:          filepath.Join(dir, "ra.png"),
+		Jn:          "VZ_LAN_00007054",
+		Wpd:         "07/16/2021",
+		RunningPage: 3,
+		Quantities:  map[string]string{"strand": "250"},
+	}
+	if !reflect.DeepEqual(inputs[0], want) {
+		t.Errorf("entry 1 = %+v, want %+v", inputs[0], want)
+	}
+	if q := inputs[1].Quantities; !reflect.DeepEqual(q, map[string]string{"c300-04": "2"}) {
+		t.Errorf("entry 2 quantities = %v", q)
+	}
+}
+
+func TestLoadManifestErrors(t *testing.T) {
+	if _, err := LoadManifest(writeManifest(t, "jobs.txt", "redline,wpd\n")); err != InvFileErr {
+		t.Errorf("LoadManifest of a .txt = %v, want InvFileErr", err)
+	}
+
+	path := writeManifest(t, "jobs.csv", "running,wpd\nra.png,07/16/2021\n")
+	if _, err := LoadManifest(path); err == nil || !strings.Contains(err.Error(), "'redline' column") {
+		t.Errorf("LoadManifest without a redline column = %v", err)
+	}
+
+	// The bad row is named in the error
+	path = writeManifest(t, "jobs.csv", "redline,wpd,page\nrl.png,07/16/2021,1\nrl.png,07/19/2021,two\n")
+	if _, err := LoadManifest(path); err == nil || !strings.Contains(err.Error(), "entry 2") {
+		t.Errorf("LoadManifest with a bad page = %v, want it to name entry 2", err)
+	}
+
+	path = writeManifest(t, "jobs.json", `[{"redline": "rl.png", "strand": true}]`)
+	if _, err := LoadManifest(path); err == nil || !strings.Contains(err.Error(), "strand") {
+		t.Errorf("LoadManifest with a bad quantity = %v", err)
+	}
+}
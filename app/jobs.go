@@ -0,0 +1,462 @@
+package app
+
+import (
+	"caddae/callout"
+	"caddae/dxf"
+	"caddae/imageproc"
+	"caddae/jobdb"
+	"caddae/pdf"
+	"caddae/report"
+	"caddae/svg"
+	"caddae/types"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	"github.com/jroimartin/gocui"
+	"github.com/pkg/errors"
+)
+
+// SetJobDB sets the job database file each run is recorded in. If path is
+// empty, runs aren't recorded.
+func (a *App) SetJobDB(path string) {
+	al := a.Log.With().Str("func", "SetJobDB").Logger()
+	al.Debug().Str("path", path).Send()
+	a.jobDB = path
+}
+
+// SetUser sets the name recorded in the job database as who did the runs. If
+// it isn't set, the name of the logged in user is used.
+func (a *App) SetUser(name string) {
+	al := a.Log.With().Str("func", "SetUser").Logger()
+	al.Debug().Str("user", name).Send()
+	a.user = name
+}
+
+// SetSVG sets whether an SVG overlay is written next to each running asbuilt
+// saved, with the lines and callouts drawn on it as vectors that can be
+// edited.
+func (a *App) SetSVG(on bool) {
+	al := a.Log.With().Str("func", "SetSVG").Logger()
+	al.Debug().Bool("svg", on).Send()
+	a.svg = on
+}
+
+// SetFormat sets the format the running asbuilt is saved in: png, jpeg, or
+// pdf for a package of the running asbuilt with a cover sheet of the job's
+// production and the redlines drawn onto it, on pages of the page size
+// (ansi-d or 11x17). If format is empty, it's saved as a PNG.
+func (a *App) SetFormat(format, pageSize string) error {
+	al := a.Log.With().Str("func", "SetFormat").Logger()
+	al.Debug().Str("format", format).Str("pageSize", pageSize).Send()
+
+	format = strings.ToLower(format)
+	switch format {
+	case "", imageproc.PNG, imageproc.PDF:
+	case imageproc.JPEG, "jpg":
+		format = imageproc.JPEG
+	default:
+		return fmt.Errorf("a.SetFormat: unknown format '%s', must be png, jpeg or pdf", format)
+	}
+
+	size := pdf.PageSize{}
+	if pageSize != "" {
+		var err error
+		if size, err = pdf.ParsePageSize(pageSize); err != nil {
+			return errors.Wrap(err, "a.SetFormat")
+		}
+	}
+	a.format = format
+	a.pageSize = size
+	return nil
+}
+
+// SetOutput sets the folder the running asbuilt is saved in, and the template
+// its file name is made from, with the {job}, {wpd}, {timestamp} and {sheet}
+// placeholders. If dir is empty, it's saved in the 'edits' folder next to the
+// running asbuilt, and if name is empty, it's named {job}_{timestamp}. If
+// skipDebug is set, the preprocessed redline and the callout drawings aren't
+// saved.
+func (a *App) SetOutput(dir, name string, skipDebug bool) error {
+	al := a.Log.With().Str("func", "SetOutput").Logger()
+	al.Debug().Str("dir", dir).Str("name", name).Bool("skipDebug", skipDebug).Send()
+
+	if name != "" {
+		if err := imageproc.CheckName(name); err != nil {
+			return errors.Wrap(err, "a.SetOutput")
+		}
+	}
+	if dir != "" {
+		dir = filepath.Clean(dir)
+	}
+	a.outputDir = dir
+	a.outputName = name
+	a.skipDebug = skipDebug
+	return nil
+}
+
+// openJobDB opens the job database for a run, which is nil if there isn't
+// one. It's opened once and handed to each step of the run that needs it,
+// and holds the database until it's closed.
+func (a *App) openJobDB() (*jobdb.DB, error) {
+	if a.jobDB == "" {
+		return nil, nil
+	}
+	return jobdb.Open(a.jobDB)
+}
+
+// setFormat sets up the configuration to save the running asbuilt in the
+// format, with the production placed on the job so far for the cover sheet
+// of a PDF package.
+func (a *App) setFormat(db *jobdb.DB, conf *imageproc.Config) error {
+	conf.Format = a.format
+	conf.PageSize = a.pageSize
+	if a.format != imageproc.PDF || db == nil {
+		return nil
+	}
+
+	s, err := db.Totals(conf.Jn)
+	if err != nil {
+		return err
+	}
+	conf.Placed = &s
+	return nil
+}
+
+// SetTotals stamps the production placed on the job so far, against its
+// design quantities, in the corner of the running asbuilt. If corner is
+// empty, there's no stamp.
+func (a *App) SetTotals(corner string) error {
+	al := a.Log.With().Str("func", "SetTotals").Logger()
+	al.Debug().Str("corner", corner).Send()
+	if corner != "" {
+		if err := callout.ValidCorner(corner); err != nil {
+			return errors.Wrap(err, "a.SetTotals")
+		}
+	}
+	a.totalsCorner = corner
+	return nil
+}
+
+// setTotals sets up the configuration to stamp the job totals, if they're
+// wanted, starting from the runs recorded for the job. Without a job database
+// the totals are only what's processed now.
+func (a *App) setTotals(db *jobdb.DB, conf *imageproc.Config) error {
+	if a.totalsCorner == "" {
+		return nil
+	}
+
+	tmpl, err := a.templates.Get(callout.TOTALS_TEMPLATE)
+	if err != nil {
+		return errors.Wrap(err, "a.setTotals")
+	}
+	conf.TotalsTemplate = tmpl
+	conf.TotalsCorner = a.totalsCorner
+
+	if db == nil {
+		s := jobdb.Summarize(conf.Jn, nil)
+		conf.Totals = &s
+		return nil
+	}
+
+	s, err := db.Totals(conf.Jn)
+	if err != nil {
+		return err
+	}
+	conf.Totals = &s
+	return nil
+}
+
+// checkApplied warns the user if the redline has already been processed onto
+// the job. It's only a warning, so problems with the job database are just
+// logged.
+func (a *App) checkApplied(u types.UI, g *gocui.Gui, db *jobdb.DB, conf imageproc.Config) {
+	al := a.Log.With().Str("func", "checkApplied").Logger()
+	if db == nil {
+		return
+	}
+
+	rl, err := jobdb.HashFile(conf.Rl)
+	if err != nil {
+		al.Debug().Err(err).Send()
+		return
+	}
+
+	prev, err := db.FindRedline(conf.Jn, rl.SHA256, conf.Page)
+	if err != nil {
+		al.Debug().Err(err).Send()
+		return
+	}
+	if prev != nil {
+		a.updateUI(u, g, fmt.Sprintf("Warning: this redline was already processed onto %s for %s, by %s on %s (run %d)",
+			prev.Job, prev.Wpd, prev.User, prev.Time.Format("01/02/2006 15:04"), prev.ID))
+	}
+}
+
+// record keeps a record of the runs of the redlines processed onto the
+// running asbuilt saved as output: in the job database, if there is one, and
+// as an SVG overlay next to output, if one's wanted.
+func (a *App) record(db *jobdb.DB, passes []recordedPass, output string) error {
+	al := a.Log.With().Str("func", "record").Logger()
+	if db == nil && !a.svg {
+		return nil
+	}
+
+	runs := make([]jobdb.Run, 0, len(passes))
+	for _, p := range passes {
+		run, err := a.newRun(p, output)
+		if err != nil {
+			return err
+		}
+		runs = append(runs, run)
+	}
+
+	if a.svg && output != "" {
+		path := svg.Path(output)
+		if err := svg.Save(path, runs, svg.Options{}); err != nil {
+			return err
+		}
+		al.Debug().Str("path", path).Msg("wrote SVG overlay")
+	}
+
+	if db == nil {
+		return nil
+	}
+
+	for i := range runs {
+		if err := db.Add(&runs[i]); err != nil {
+			return err
+		}
+		al.Debug().Str("job", runs[i].Job).Uint64("run", runs[i].ID).Msg("recorded run")
+	}
+	return nil
+}
+
+// recordedPass is a redline processed onto the running asbuilt, to be
+// recorded in the job database
+type recordedPass struct {
+	in   UserInput
+	conf imageproc.Config
+	ip   *imageproc.ImageProc
+}
+
+// newRun makes the job database run of a processed redline
+func (a *App) newRun(p recordedPass, output string) (jobdb.Run, error) {
+	conf, ip := p.conf, p.ip
+	run := jobdb.Run{
+		Job:        conf.Jn,
+		Wpd:        conf.Wpd,
+		Output:     output,
+		Quantities: conf.Quantities,
+		Lines:      jobdb.Lines(ip.Lines()),
+		Profile:    p.in.Profile,
+		Template:   p.in.Template,
+		Crew:       conf.Crew,
+		User:       a.user,
+	}
+
+	var err error
+	if run.Redline, err = jobdb.HashFile(conf.Rl); err != nil {
+		return run, errors.Wrap(err, "a.newRun: failed to hash the redline")
+	}
+	if conf.Page > 1 {
+		run.Redline.Page = conf.Page
+	}
+	if run.Running, err = jobdb.HashFile(conf.Ra); err != nil {
+		return run, errors.Wrap(err, "a.newRun: failed to hash the running asbuilt")
+	}
+	if conf.RunningPage > 1 {
+		run.Running.Page = conf.RunningPage
+	}
+	if prod := ip.Production(); prod != nil {
+		run.Units = prod.Units
+		run.Footage = prod.Footage()
+	}
+	if c := ip.Callout(); c != nil {
+		run.Callout = jobdb.Callout{Box: c.Box(), Text: c.Text(), Size: c.TextSize()}
+	}
+	if img := ip.Running(); img != nil {
+		run.Size = img.Bounds().Size()
+		run.DPI = ip.DPI()
+	}
+	if run.User == "" {
+		run.User = currentUser()
+	}
+	return run, nil
+}
+
+// currentUser returns the name of the logged in user
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return "unknown"
+}
+
+// ExportReport writes the production report of the runs in the job database
+// the filter picks to the file, as CSV or XLSX by its extension. Returns the
+// number of rows written.
+func (a *App) ExportReport(path string, f report.Filter) (int, error) {
+	al := a.Log.With().Str("func", "ExportReport").Logger()
+	if a.jobDB == "" {
+		return 0, errors.New("a.ExportReport: there's no job database to report on")
+	}
+	if _, err := report.FormatOf(path); err != nil {
+		return 0, err
+	}
+
+	db, err := jobdb.Open(a.jobDB)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	rows, err := report.Load(db, f, a.catalog)
+	if err != nil {
+		return 0, err
+	}
+	if err := report.Write(path, rows); err != nil {
+		return 0, err
+	}
+	al.Debug().Str("path", path).Int("rows", len(rows)).Msg("exported report")
+	return len(rows), nil
+}
+
+// ExportDXF writes the work recorded for the job in the job database to a DXF
+// file for CAD: the lines and callouts of each run in sheet units, on a layer
+// for each work performed date, over the running asbuilt. Returns the number
+// of runs written.
+func (a *App) ExportDXF(job, path string, o dxf.Options) (int, error) {
+	al := a.Log.With().Str("func", "ExportDXF").Logger()
+	if a.jobDB == "" {
+		return 0, errors.New("a.ExportDXF: there's no job database to export from")
+	}
+
+	db, err := jobdb.Open(a.jobDB)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	runs, err := db.Runs(job)
+	if err != nil {
+		return 0, err
+	}
+	d, err := dxf.FromRuns(runs, o)
+	if err != nil {
+		return 0, errors.Wrapf(err, "a.ExportDXF(%s)", job)
+	}
+	if err := d.Save(path); err != nil {
+		return 0, err
+	}
+	al.Debug().Str("job", job).Str("path", path).Int("runs", len(runs)).Msg("exported DXF")
+	return len(runs), nil
+}
+
+// ExportSVG writes the work recorded for the job in the job database to an SVG
+// overlay: the running asbuilt the job's first run was drawn on, with the
+// lines and callouts of every run on a layer for each work performed date.
+// Returns the number of runs written.
+func (a *App) ExportSVG(job, path string, o svg.Options) (int, error) {
+	al := a.Log.With().Str("func", "ExportSVG").Logger()
+	if a.jobDB == "" {
+		return 0, errors.New("a.ExportSVG: there's no job database to export from")
+	}
+
+	db, err := jobdb.Open(a.jobDB)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	runs, err := db.Runs(job)
+	if err != nil {
+		return 0, err
+	}
+	if len(runs) == 0 {
+		return 0, errors.Wrapf(jobdb.ErrNoJob, "a.ExportSVG(%s)", job)
+	}
+	if err := svg.Save(path, runs, o); err != nil {
+		return 0, err
+	}
+	al.Debug().Str("job", job).Str("path", path).Int("runs", len(runs)).Msg("exported SVG")
+	return len(runs), nil
+}
+
+// ExportPackage writes a PDF package of the job from the job database, on
+// pages of the page size: a cover sheet with the production placed on the
+// job, each running asbuilt the job's runs were last saved to, and the
+// redlines of the runs in work performed date order. Returns the number of
+// pages written.
+func (a *App) ExportPackage(job, path, pageSize string) (int, error) {
+	al := a.Log.With().Str("func", "ExportPackage").Logger()
+	if a.jobDB == "" {
+		return 0, errors.New("a.ExportPackage: there's no job database to export from")
+	}
+	size := pdf.TABLOID
+	if pageSize != "" {
+		var err error
+		if size, err = pdf.ParsePageSize(pageSize); err != nil {
+			return 0, errors.Wrap(err, "a.ExportPackage")
+		}
+	}
+
+	db, err := jobdb.Open(a.jobDB)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	runs, err := db.Runs(job)
+	if err != nil {
+		return 0, err
+	}
+	if len(runs) == 0 {
+		return 0, errors.Wrapf(jobdb.ErrNoJob, "a.ExportPackage(%s)", job)
+	}
+	totals, err := db.Totals(job)
+	if err != nil {
+		return 0, err
+	}
+
+	p := pdf.Package{Job: totals.Job, Totals: totals, Catalog: a.catalog}
+	for _, r := range jobdb.Sheets(runs) {
+		p.Sheets = append(p.Sheets, openSheet(r.Output, 1, r.DPI,
+			fmt.Sprintf("%s running asbuilt, updated for WPD %s: %s", r.Job, r.Wpd, r.Output)))
+	}
+	for _, r := range jobdb.ByWpd(runs) {
+		caption := fmt.Sprintf("Redline for WPD %s: %s", r.Wpd, r.Redline.Path)
+		if r.Redline.Page > 1 {
+			caption += fmt.Sprintf(", page %d", r.Redline.Page)
+		}
+		p.Redlines = append(p.Redlines, openSheet(r.Redline.Path, r.Redline.Page, 0, caption))
+	}
+
+	d := p.Document(size)
+	if err := d.Save(path); err != nil {
+		return 0, err
+	}
+	al.Debug().Str("job", job).Str("path", path).Int("pages", d.Pages()).Msg("exported package")
+	return d.Pages(), nil
+}
+
+// openSheet opens the page of a scan for a PDF package, taking the DPI from
+// its width if it isn't known. If it can't be opened, the sheet is only noted
+// as missing, as are running asbuilts that were saved as PDF packages
+// themselves.
+func openSheet(path string, page int, dpi float64, caption string) pdf.Sheet {
+	s := pdf.Sheet{DPI: dpi, Caption: caption}
+	var err error
+	if s.Image, err = imageproc.OpenPage(path, page); err != nil {
+		return s
+	}
+	if s.DPI == 0 {
+		s.DPI = callout.Font{}.ScanDPI(s.Image.Bounds().Dx())
+	}
+	return s
+}
@@ -0,0 +1,65 @@
+package app
+
+import (
+	"caddae/jobdb"
+	"caddae/pdf"
+	"caddae/synth"
+	"path/filepath"
+	"testing"
+)
+
+// TestRecordRunningPage processes a redline onto the second page of a PDF
+// running asbuilt, and checks the page is recorded with the run.
+func TestRecordRunningPage(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping processing a redline in short mode")
+	}
+
+	asbuilt := sampleAsbuilt(t)
+	dir := t.TempDir()
+	d := pdf.New(pdf.TABLOID)
+	d.AddText([]pdf.Line{{Text: "Cover"}})
+	d.AddImage(asbuilt, 100, "")
+	running := filepath.Join(dir, "VZ_LAN_00007054.pdf")
+	if err := d.Save(running); err != nil {
+		t.Fatal(err)
+	}
+	redline := writePNG(t, filepath.Join(dir, "redline.png"), synthRedline(asbuilt, synth.Polyline{{300, 400}, {1200, 420}}))
+
+	a := testApp()
+	a.SetJobDB(filepath.Join(dir, "jobs.db"))
+	if err := a.SetOutput(filepath.Join(dir, "out"), "", true); err != nil {
+		t.Fatal(err)
+	}
+	a.SetUserInput(UserInput{
+		Rl:          redline,
+		Ra:          running,
+		RunningPage: 2,
+		Jn:          "VZ_LAN_00007054",
+		Wpd:         "07/16/2021",
+		Quantities:  map[string]string{"C300-01": "100"},
+	})
+	if err := a.Start(nil, nil); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	db, err := jobdb.Open(filepath.Join(dir, "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	runs, err := db.Runs("VZ_LAN_00007054")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 {
+		t.Fatalf("%d runs recorded, want 1", len(runs))
+	}
+	r := runs[0]
+	if r.Running.Page != 2 || r.Running.SHA256 == "" {
+		t.Errorf("running asbuilt recorded as %+v, want page 2 with its hash", r.Running)
+	}
+	if r.Redline.Page != 0 {
+		t.Errorf("redline recorded as page %d, want 0 for the only page", r.Redline.Page)
+	}
+}
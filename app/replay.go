@@ -0,0 +1,113 @@
+package app
+
+import (
+	"caddae/imageproc"
+	"caddae/types"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jroimartin/gocui"
+	"github.com/pkg/errors"
+)
+
+// Replay applies several redlines for one job onto the same running asbuilt,
+// in the order the work was performed. Each pass draws on the result of the
+// previous one and adds its own callout, and only the final running asbuilt
+// is saved. The running and job values given override those of the entries.
+//
+// Returns the file the final running asbuilt was saved to.
+func (a *App) Replay(u types.UI, g *gocui.Gui, running, job string, entries []UserInput) (string, error) {
+	al := a.Log.With().Str("func", "Replay").Logger()
+	al.Debug().Int("entries", len(entries)).Str("running", running).Str("job", job).Send()
+
+	if len(entries) == 0 {
+		return "", errors.New("a.Replay: no redlines given to replay")
+	}
+
+	// Validate every entry before we start, so we don't fail part way through
+	// the job's history.
+	passes := make([]replayPass, 0, len(entries))
+	for i, in := range entries {
+		in.Ra = running
+		in.Jn = job
+		a.SetUserInput(in)
+
+		conf, err := a.ValidateInput()
+		if err != nil {
+			return "", errors.Wrapf(err, "entry %d (%s)", i+1, in.Rl)
+		}
+
+		// ValidateInput has already made sure the date parses.
+		date, _ := time.Parse("01/02/2006", conf.Wpd)
+		passes = append(passes, replayPass{date: date, in: in, conf: conf})
+	}
+	a.updateUI(u, g, "Input successfully validated!\n")
+
+	// Put the passes in the order the work was performed.
+	sort.SliceStable(passes, func(i, j int) bool {
+		return passes[i].date.Before(passes[j].date)
+	})
+
+	// Open the job's history once for every pass
+	db, err := a.openJobDB()
+	if err != nil {
+		return "", err
+	}
+	if db != nil {
+		defer db.Close()
+	}
+
+	// Each pass adds its production to the same job totals, so the stamp on
+	// the final running asbuilt has all of them. They share the format it's
+	// saved in too, since it's the last pass that saves it.
+	var totals imageproc.Config
+	totals.Jn = job
+	if err := a.setTotals(db, &totals); err != nil {
+		return "", err
+	}
+	if err := a.setFormat(db, &totals); err != nil {
+		return "", err
+	}
+
+	var prev *imageproc.ImageProc
+	recorded := make([]recordedPass, 0, len(passes))
+	for i, p := range passes {
+		a.updateUI(u, g, fmt.Sprintf("[%d/%d] Applying redline for %s ..", i+1, len(passes), p.conf.Wpd))
+
+		// Only save the running asbuilt once every pass has been drawn on it.
+		p.conf.KeepInMemory = i < len(passes)-1
+		p.conf.Totals = totals.Totals
+		p.conf.TotalsCorner = totals.TotalsCorner
+		p.conf.TotalsTemplate = totals.TotalsTemplate
+		p.conf.Format = totals.Format
+		p.conf.PageSize = totals.PageSize
+		p.conf.Placed = totals.Placed
+
+		a.checkApplied(u, g, db, p.conf)
+		ip := imageproc.New(p.conf, &a.Log)
+		if prev != nil {
+			ip.ContinueFrom(prev)
+		}
+		if err := ip.ProcessImages(u, g); err != nil {
+			return "", errors.Wrapf(err, "replaying %s (%s)", p.conf.Wpd, p.conf.Rl)
+		}
+		prev = ip
+		recorded = append(recorded, recordedPass{p.in, p.conf, ip})
+	}
+
+	a.Ip = prev
+
+	// Keep a record of each pass in the job's history, and their overlay
+	if err := a.record(db, recorded, prev.RunningFile()); err != nil {
+		return prev.RunningFile(), errors.Wrap(err, "the running asbuilt was saved, but recording it failed")
+	}
+	return prev.RunningFile(), nil
+}
+
+// replayPass is a single validated redline in a replay, with its parsed date
+type replayPass struct {
+	date time.Time
+	in   UserInput
+	conf imageproc.Config
+}
@@ -0,0 +1,166 @@
+package app
+
+import (
+	"caddae/jobdb"
+	"caddae/synth"
+	"image"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func testApp() *App {
+	l := zerolog.Nop()
+	return New(&l)
+}
+
+func readPNG(t *testing.T, path string) image.Image {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func writePNG(t *testing.T, path string, img image.Image) string {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// sampleAsbuilt returns a corner of the sample asbuilt, which is plenty to
+// process and much quicker than the whole sheet
+func sampleAsbuilt(t *testing.T) *image.RGBA {
+	t.Helper()
+	sample := readPNG(t, filepath.Join("..", "testfiles", "VZ_LAN_00007054.png"))
+	asbuilt := image.NewRGBA(image.Rect(0, 0, 1800, 1300))
+	draw.Draw(asbuilt, asbuilt.Bounds(), sample, image.Point{}, draw.Src)
+	return asbuilt
+}
+
+// synthRedline highlights the lines on a straight, clean scan of the asbuilt
+func synthRedline(asbuilt image.Image, lines ...synth.Polyline) image.Image {
+	opts := synth.DefaultOptions()
+	opts.Scan = synth.Scan{Scale: 1}
+	opts.Jitter, opts.Noise, opts.Blur = 0, 0, 0
+	redline, _ := synth.Generate(asbuilt, lines, opts)
+	return redline
+}
+
+// TestReplay replays two synthetic redlines of the sample asbuilt, given out
+// of order, and checks they're applied in the order the work was performed
+// onto one running asbuilt, with a callout each.
+func TestReplay(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping replaying synthetic redlines in short mode")
+	}
+
+	asbuilt := sampleAsbuilt(t)
+	early := synthRedline(asbuilt, synth.Polyline{{300, 400}, {1200, 420}})
+	late := synthRedline(asbuilt, synth.Polyline{{500, 900}, {1400, 1000}})
+
+	dir := t.TempDir()
+	running := writePNG(t, filepath.Join(dir, "VZ_LAN_00007054.png"), asbuilt)
+	entries := []UserInput{
+		{Rl: writePNG(t, filepath.Join(dir, "late.png"), late), Wpd: "07/19/2021", Quantities: map[string]string{"C300-01": "200"}},
+		{Rl: writePNG(t, filepath.Join(dir, "early.png"), early), Wpd: "07/16/2021", Quantities: map[string]string{"C300-01": "100"}},
+	}
+
+	a := testApp()
+	a.SetJobDB(filepath.Join(dir, "jobs.db"))
+	if err := a.SetOutput(filepath.Join(dir, "out"), "", true); err != nil {
+		t.Fatal(err)
+	}
+	out, err := a.Replay(nil, nil, running, "VZ_LAN_00007054", entries)
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+
+	// Only the final running asbuilt is saved
+	saved, err := os.ReadDir(filepath.Join(dir, "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 1 || filepath.Join(dir, "out", saved[0].Name()) != out {
+		t.Errorf("saved %v, want only %s", saved, out)
+	}
+
+	db, err := jobdb.Open(filepath.Join(dir, "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	runs, err := db.Runs("VZ_LAN_00007054")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 {
+		t.Fatalf("%d runs recorded, want 2", len(runs))
+	}
+	for i, want := range []string{"07/16/2021", "07/19/2021"} {
+		r := runs[i]
+		if r.Wpd != want {
+			t.Errorf("run %d is for %s, want %s", i+1, r.Wpd, want)
+		}
+		if r.Output != out {
+			t.Errorf("run %d output = %s, want %s", i+1, r.Output, out)
+		}
+		if r.Callout.Box.Empty() || len(r.Lines) == 0 {
+			t.Errorf("run %d has callout %v and %d lines, want one callout for its lines", i+1, r.Callout.Box, len(r.Lines))
+		}
+	}
+	if runs[0].Callout.Box.Overlaps(runs[1].Callout.Box) {
+		t.Errorf("callouts %v and %v overlap", runs[0].Callout.Box, runs[1].Callout.Box)
+	}
+
+	// Each pass only draws its own redline's lines, the early one's at the
+	// top of the sheet and the late one's below it
+	for i, r := range runs {
+		for _, l := range r.Lines {
+			for _, p := range l {
+				if top := p.Y < 650; top != (i == 0) {
+					t.Fatalf("run %d (%s) has a line at %d, %d, from the other redline", i+1, r.Wpd, p.X, p.Y)
+				}
+			}
+		}
+	}
+}
+
+func TestReplayBadDate(t *testing.T) {
+	dir := t.TempDir()
+	img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	running := writePNG(t, filepath.Join(dir, "VZ_LAN_00007054.png"), img)
+	rl := writePNG(t, filepath.Join(dir, "redline.png"), img)
+
+	entries := []UserInput{
+		{Rl: rl, Wpd: "07/16/2021", Quantities: map[string]string{"C300-01": "100"}},
+		{Rl: rl, Wpd: "19/07/2021", Quantities: map[string]string{"C300-01": "100"}},
+	}
+	_, err := testApp().Replay(nil, nil, running, "VZ_LAN_00007054", entries)
+	if err == nil || !strings.Contains(err.Error(), "entry 2") || !strings.Contains(err.Error(), "workdate") {
+		t.Errorf("Replay with a bad date = %v, want an error naming entry 2's date", err)
+	}
+
+	if _, err := testApp().Replay(nil, nil, running, "VZ_LAN_00007054", nil); err == nil {
+		t.Errorf("Replay of no entries succeeded")
+	}
+}
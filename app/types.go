@@ -1,7 +1,11 @@
 package app
 
 import (
+	"caddae/callout"
+	"caddae/catalog"
+	"caddae/drawing"
 	"caddae/imageproc"
+	"caddae/pdf"
 	"errors"
 
 	"github.com/rs/zerolog"
@@ -9,9 +13,34 @@ import (
 
 // App object to hold the user input and image processor
 type App struct {
-	Log zerolog.Logger
-	Ip  *imageproc.ImageProc
-	in  UserInput
+	Log       zerolog.Logger
+	Ip        *imageproc.ImageProc
+	in        UserInput
+	profiles  drawing.Profiles
+	leader    callout.Leader
+	font      callout.Font
+	templates callout.Templates
+	catalog   *catalog.Catalog
+	jobDB     string
+	user      string
+
+	// Corner of the running asbuilt the job totals are stamped in, or empty
+	// for no stamp
+	totalsCorner string
+
+	// Whether to write an SVG overlay next to each running asbuilt saved
+	svg bool
+
+	// Format the running asbuilt is saved in, and the page size of PDF
+	// packages
+	format   string
+	pageSize pdf.PageSize
+
+	// Folder and name template the running asbuilt is saved with, and
+	// whether to skip saving the debug images
+	outputDir  string
+	outputName string
+	skipDebug  bool
 }
 
 // UserInput object to hold input from the UI
@@ -20,11 +49,36 @@ type UserInput struct {
 	Ra       string `json:"running"`
 	Jn       string `json:"job_number"`
 	Wpd      string `json:"wpd"`
-	Strand   string `json:"strand"`
-	Cable    string `json:"cable"`
-	Overlash string `json:"overlash"`
-	Anchors  string `json:"anchors"`
+	Profile  string `json:"profile"`
+	Template string `json:"template"`
+	Crew     string `json:"crew"`
+
+	// Pages of the redline scan and the running asbuilt to use, counting
+	// from 1, for TIFF and PDF scans with several pages. If they're 0, the
+	// first page is used.
+	Page        int `json:"page"`
+	RunningPage int `json:"running_page"`
+
+	// Quantities of the production units, by catalog code or alias, e.g.
+	// "C300-01" or "strand"
+	Quantities map[string]string `json:"quantities"`
+}
+
+// SetQuantity sets the quantity of the production unit with the given code or
+// alias
+func (in *UserInput) SetQuantity(unit, qty string) {
+	if in.Quantities == nil {
+		in.Quantities = make(map[string]string)
+	}
+	in.Quantities[unit] = qty
+}
+
+// BatchResult is the outcome of processing one manifest entry
+type BatchResult struct {
+	Row   int
+	Input UserInput
+	Err   error
 }
 
 // InvFileErr is the error we'll throw if the user gave us an invalid file type
-var InvFileErr error = errors.New("provided file type is not allowed. allowed types are .JSON")
+var InvFileErr error = errors.New("provided file type is not allowed. allowed types are .JSON, .CSV")
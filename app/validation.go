@@ -5,11 +5,22 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"strconv"
+	"path/filepath"
 	"strings"
 	"time"
 )
 
+// scanTypes are the file extensions of the scans we can read, for the
+// redline and the running asbuilt
+var scanTypes = map[string]bool{
+	"png":  true,
+	"jpg":  true,
+	"jpeg": true,
+	"tif":  true,
+	"tiff": true,
+	"pdf":  true,
+}
+
 // ValidateInput validates the users input values
 func (a *App) ValidateInput() (imageproc.Config, error) {
 	al := a.Log.With().Str("func", "ValidateInput").Logger()
@@ -24,15 +35,21 @@ func (a *App) ValidateInput() (imageproc.Config, error) {
 	}
 
 	// Check the file extension
-	fp := strings.Split(a.in.Rl, ".")
-	ext := fp[1]
-	if ext != "png" {
-		e := fmt.Sprintf("a.ValidateInput: incorrect redline file type given! Only .png is allowed, you provided '.%s'", ext)
+	if err := scanType(a.in.Rl); err != nil {
+		e := fmt.Sprintf("a.ValidateInput: incorrect redline file type given! %v", err)
 		return conf, errors.New(e)
 	}
 
-	// No issues with the input. Set the confguration value
+	// Check the page of the redline scan is in it
+	page, err := scanPage(a.in.Rl, a.in.Page)
+	if err != nil {
+		e := fmt.Sprintf("a.ValidateInput: invalid redline page given! %v", err)
+		return conf, errors.New(e)
+	}
+
+	// No issues with the input. Set the confguration values
 	conf.Rl = a.in.Rl
+	conf.Page = page
 
 	// Check running asbuilt file path actually exists
 	if _, err := os.Stat(a.in.Ra); errors.Is(err, os.ErrNotExist) {
@@ -41,15 +58,21 @@ func (a *App) ValidateInput() (imageproc.Config, error) {
 	}
 
 	// Check the file extension
-	fp = strings.Split(a.in.Ra, ".")
-	ext = fp[1]
-	if ext != "png" {
-		e := fmt.Sprintf("a.ValidateInput: incorrect running file type given! Only .png is allowed, you provided '.%s'", ext)
+	if err := scanType(a.in.Ra); err != nil {
+		e := fmt.Sprintf("a.ValidateInput: incorrect running file type given! %v", err)
 		return conf, errors.New(e)
 	}
 
-	// No issues with the input. Set the confguration value
+	// Check the page of the running asbuilt is in it
+	page, err = scanPage(a.in.Ra, a.in.RunningPage)
+	if err != nil {
+		e := fmt.Sprintf("a.ValidateInput: invalid running page given! %v", err)
+		return conf, errors.New(e)
+	}
+
+	// No issues with the input. Set the confguration values
 	conf.Ra = a.in.Ra
+	conf.RunningPage = page
 
 	// Check thes job number
 	jn := strings.Split(a.in.Jn, "_")
@@ -68,7 +91,7 @@ func (a *App) ValidateInput() (imageproc.Config, error) {
 	conf.Jn = a.in.Jn
 
 	// Check the work performed date
-	_, err := time.Parse("01/02/2006", a.in.Wpd)
+	_, err = time.Parse("01/02/2006", a.in.Wpd)
 	if err != nil {
 		e := fmt.Sprintf("a.ValidateInput: error parsing workdate!\ntime.Parse('01/02/2006', '%s'): %v", a.in.Wpd, err)
 		return conf, errors.New(e)
@@ -77,42 +100,72 @@ func (a *App) ValidateInput() (imageproc.Config, error) {
 	// No issues with the input. Set the confguration value
 	conf.Wpd = a.in.Wpd
 
-	// Now let's check the unit values
-	if a.in.Strand != "" {
-		strand, err := strconv.ParseFloat(a.in.Strand, 64)
-		if err != nil {
-			e := fmt.Sprintf("a.ValidateInput: invalid quantity given for C300-01! '%s'", a.in.Strand)
-			return conf, errors.New(e)
-		}
-		conf.Strand = strand
+	// Check the color profile
+	prof, err := a.profiles.Get(a.in.Profile)
+	if err != nil {
+		e := fmt.Sprintf("a.ValidateInput: %v", err)
+		return conf, errors.New(e)
 	}
 
-	if a.in.Cable != "" {
-		cable, err := strconv.ParseFloat(a.in.Cable, 64)
-		if err != nil {
-			e := fmt.Sprintf("a.ValidateInput: invalid quantity given for C300-02! '%s'", a.in.Cable)
-			return conf, errors.New(e)
-		}
-		conf.Cable = cable
-	}
+	// No issues with the input. Set the confguration value
+	conf.Ranges = prof.Ranges
+	conf.Leader = a.leader
+	conf.Font = a.font
 
-	if a.in.Overlash != "" {
-		overlash, err := strconv.ParseFloat(a.in.Overlash, 64)
-		if err != nil {
-			e := fmt.Sprintf("a.ValidateInput: invalid quantity given for C300-03! '%s'", a.in.Overlash)
-			return conf, errors.New(e)
-		}
-		conf.Overlash = overlash
+	// Check the callout template
+	tmpl, err := a.templates.Get(a.in.Template)
+	if err != nil {
+		e := fmt.Sprintf("a.ValidateInput: %v", err)
+		return conf, errors.New(e)
 	}
 
-	if a.in.Anchors != "" {
-		anchors, err := strconv.ParseFloat(a.in.Anchors, 64)
-		if err != nil {
-			e := fmt.Sprintf("a.ValidateInput: invalid quantity given for C300-04! '%s'", a.in.Anchors)
-			return conf, errors.New(e)
-		}
-		conf.Anchors = anchors
+	// No issues with the input. Set the confguration values
+	conf.Template = tmpl
+	conf.Crew = a.in.Crew
+
+	// Now let's check the unit values against the catalog
+	qty, err := a.catalog.ParseQuantities(a.in.Quantities)
+	if err != nil {
+		e := fmt.Sprintf("a.ValidateInput: %v", err)
+		return conf, errors.New(e)
 	}
 
+	// No issues with the input. Set the confguration values
+	conf.Quantities = qty
+	conf.Catalog = a.catalog
+
+	// And where the running asbuilt is saved
+	conf.OutputDir = a.outputDir
+	conf.OutputName = a.outputName
+	conf.SkipDebug = a.skipDebug
+
 	return conf, nil
 }
+
+// scanType checks the file has the extension of a scan we can read.
+func scanType(file string) error {
+	ext := filepath.Ext(file)
+	if ext == "" {
+		return fmt.Errorf("'%s' has no file extension, only .png, .jpg, .tif and .pdf are allowed", filepath.Base(file))
+	}
+	if !scanTypes[strings.ToLower(ext[1:])] {
+		return fmt.Errorf("only .png, .jpg, .tif and .pdf are allowed, you provided '%s'", ext)
+	}
+	return nil
+}
+
+// scanPage returns the page of the scan to use, counting from 1, after
+// checking the scan has it. A page of 0 is the first page.
+func scanPage(file string, page int) (int, error) {
+	pages, err := imageproc.PageCount(file)
+	if err != nil {
+		return 0, fmt.Errorf("unable to read '%s': %v", file, err)
+	}
+	if page == 0 {
+		page = 1
+	}
+	if page < 1 || page > pages {
+		return 0, fmt.Errorf("'%s' has %d page(s), there's no page %d", file, pages, page)
+	}
+	return page, nil
+}
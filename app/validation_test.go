@@ -0,0 +1,76 @@
+package app
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScanType(t *testing.T) {
+	for _, file := range []string{
+		"x.png",
+		"./scans/a.b/x.png",
+		"scans/VZ_LAN_00007054.07.16.21.jpeg",
+		"X.PNG",
+		"x.Tif",
+		"x.PDF",
+	} {
+		if err := scanType(file); err != nil {
+			t.Errorf("scanType(%s): %v", file, err)
+		}
+	}
+
+	for file, want := range map[string]string{
+		"./scans/a.b/x":   "no file extension",
+		"x":               "no file extension",
+		"scans/x.png/raw": "no file extension",
+		"x.gif":           "'.gif'",
+		"x.png.bak":       "'.bak'",
+	} {
+		if err := scanType(file); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("scanType(%s) = %v, want an error with %s", file, err, want)
+		}
+	}
+}
+
+func TestValidateInputPaths(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "a.b")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	img := image.NewGray(image.Rect(0, 0, 4, 4))
+	redline := writePNG(t, filepath.Join(dir, "x.png"), img)
+	running := writePNG(t, filepath.Join(dir, "VZ_LAN_00007054.PNG"), img)
+	noExt := writePNG(t, filepath.Join(dir, "running"), img)
+
+	input := func(rl, ra string) UserInput {
+		return UserInput{
+			Rl:         rl,
+			Ra:         ra,
+			Jn:         "VZ_LAN_00007054",
+			Wpd:        "07/16/2021",
+			Quantities: map[string]string{"C300-01": "100"},
+		}
+	}
+
+	a := testApp()
+	a.SetUserInput(input(redline, running))
+	conf, err := a.ValidateInput()
+	if err != nil {
+		t.Fatalf("ValidateInput with a dot in the folder and an upper case extension: %v", err)
+	}
+	if conf.Rl != redline || conf.Ra != running || conf.Page != 1 || conf.RunningPage != 1 {
+		t.Errorf("conf = %s page %d, %s page %d", conf.Rl, conf.Page, conf.Ra, conf.RunningPage)
+	}
+
+	a.SetUserInput(input(redline, noExt))
+	if _, err := a.ValidateInput(); err == nil || !strings.Contains(err.Error(), "running") || !strings.Contains(err.Error(), "no file extension") {
+		t.Errorf("ValidateInput of a running asbuilt without an extension = %v", err)
+	}
+	a.SetUserInput(input(noExt, running))
+	if _, err := a.ValidateInput(); err == nil || !strings.Contains(err.Error(), "redline") || !strings.Contains(err.Error(), "no file extension") {
+		t.Errorf("ValidateInput of a redline without an extension = %v", err)
+	}
+}
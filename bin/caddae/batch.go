@@ -0,0 +1,53 @@
+package main
+
+import (
+	"caddae/app"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// batch processes every entry of a manifest file without the terminal UI,
+// prints a per-row summary and returns the exit code for the process.
+func batch(args []string) int {
+	fs := flag.NewFlagSet("batch", flag.ContinueOnError)
+	manifest := fs.String("manifest", "", "path to the JSON or CSV manifest `file`")
+	profile := fs.String("profile", "", "color profile to use for entries that don't name one")
+	template := fs.String("template", "", "callout template to use for entries that don't name one")
+	debug := fs.Bool("debug", false, "write debug logs to stderr")
+	newApp := appFlags(fs)
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if *manifest == "" {
+		fmt.Fprintf(os.Stderr, "caddae batch: -manifest is required\n")
+		fs.Usage()
+		return 2
+	}
+
+	logger := cliLogger(*debug)
+	a, code, err := newApp(&logger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "caddae batch: %v\n", err)
+		return code
+	}
+
+	inputs, err := app.LoadManifest(*manifest)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "caddae batch: %v\n", err)
+		return 1
+	}
+
+	defaultProfile(inputs, *profile)
+	defaultTemplate(inputs, *template)
+
+	results := a.RunBatch(inputs)
+	if failed := app.WriteBatchSummary(os.Stdout, results); failed > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"caddae/app"
+	"caddae/catalog"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// create runs the redline -> running asbuilt process without the terminal UI
+// and returns the exit code for the process.
+func create(args []string) int {
+	fs := flag.NewFlagSet("create", flag.ContinueOnError)
+	redline := fs.String("redline", "", "path to the redline `file` (.png, .jpg, .tif, .pdf)")
+	page := fs.Int("page", 1, "`page` of the redline scan to use, for TIFF and PDF scans with several")
+	running := fs.String("running", "", "path to the running asbuilt `file` (.png, .jpg, .tif, .pdf)")
+	runningPage := fs.Int("running-page", 1, "`page` of the running asbuilt to use, for TIFF and PDF files with several")
+	job := fs.String("job", "", "DYEA/VZ job number, e.g. VZ_LAN_00007054")
+	wpd := fs.String("wpd", "", "work performed date, MM/DD/YYYY")
+	qty := quantities{}
+	fs.Var(qty, "qty", "production quantity of a catalog unit, as `CODE=QTY` (may be repeated)")
+
+	// Shorthand flags for the units of the default catalog, e.g. -c300-01
+	short := make(map[string]*string)
+	for _, u := range catalog.DefaultCatalog().Inputs() {
+		short[u.Code] = fs.String(strings.ToLower(u.Code), "", fmt.Sprintf("%s (%s) quantity", u.Code, strings.ToLower(u.Description)))
+	}
+	profile := fs.String("profile", "", "name of the color profile to use")
+	template := fs.String("template", "", "name of the callout template to use")
+	crew := fs.String("crew", "", "name of the crew that did the work, for callout templates")
+	debug := fs.Bool("debug", false, "write debug logs to stderr")
+	newApp := appFlags(fs)
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	logger := cliLogger(*debug)
+	a, code, err := newApp(&logger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "caddae create: %v\n", err)
+		return code
+	}
+
+	in := app.UserInput{
+		Rl:       *redline,
+		Ra:       *running,
+		Jn:       strings.ToUpper(*job),
+		Wpd:      *wpd,
+		Profile:  *profile,
+		Template: *template,
+		Crew:     *crew,
+
+		Page:        *page,
+		RunningPage: *runningPage,
+	}
+	for code, q := range short {
+		if *q != "" {
+			in.SetQuantity(code, *q)
+		}
+	}
+	for code, q := range qty {
+		in.SetQuantity(code, q)
+	}
+	a.SetUserInput(in)
+
+	if err := a.Start(nil, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "caddae create: %v\n", err)
+		return 1
+	}
+	return 0
+}
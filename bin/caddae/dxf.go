@@ -0,0 +1,60 @@
+package main
+
+import (
+	"caddae/app"
+	"caddae/dxf"
+	"caddae/jobdb"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// cad writes the work recorded for a job in the job database to a DXF file
+// for CAD, and returns the exit code for the process.
+func cad(args []string) int {
+	fs := flag.NewFlagSet("dxf", flag.ContinueOnError)
+	out := fs.String("o", "", "DXF `file` to write")
+	path := fs.String("db", jobdb.DefaultPath(), "job database `file`")
+	job := fs.String("job", "", "job `number` to export, e.g. VZ_LAN_00007054")
+	units := fs.String("units", dxf.INCHES, "sheet `units`, in or mm")
+	dpi := fs.Float64("dpi", 0, "`DPI` the running asbuilt was scanned at, for runs recorded without one")
+	underlay := fs.String("underlay", "", "PNG or JPEG image `file` to reference under the work (default the last running asbuilt saved as one)")
+	noUnderlay := fs.Bool("no-underlay", false, "don't reference an image under the work")
+	debug := fs.Bool("debug", false, "write debug logs to stderr")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if *out == "" || *job == "" {
+		fmt.Fprintf(os.Stderr, "caddae dxf: -o and -job are required\n")
+		fs.Usage()
+		return 2
+	}
+	if *units != dxf.INCHES && *units != dxf.MILLIMETERS {
+		fmt.Fprintf(os.Stderr, "caddae dxf: -units must be %s or %s\n", dxf.INCHES, dxf.MILLIMETERS)
+		return 2
+	}
+	if _, err := os.Stat(*path); err != nil {
+		fmt.Fprintf(os.Stderr, "caddae dxf: no job database at %s\n", *path)
+		return 1
+	}
+
+	logger := cliLogger(*debug)
+	a := app.New(&logger)
+	a.SetJobDB(*path)
+
+	n, err := a.ExportDXF(*job, *out, dxf.Options{
+		Units:      *units,
+		Underlay:   *underlay,
+		NoUnderlay: *noUnderlay,
+		DPI:        *dpi,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "caddae dxf: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Wrote %d runs of %s to %s\n", n, *job, *out)
+	return 0
+}
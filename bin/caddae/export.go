@@ -0,0 +1,71 @@
+package main
+
+import (
+	"caddae/app"
+	"caddae/jobdb"
+	"caddae/report"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// export writes the production report of the job database to a CSV or XLSX
+// file and returns the exit code for the process.
+func export(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	out := fs.String("o", "", "report `file` to write, .csv or .xlsx")
+	path := fs.String("db", jobdb.DefaultPath(), "job database `file`")
+	jobs := fs.String("job", "", "comma separated job `numbers` to report on (default every job)")
+	from := fs.String("from", "", "first work performed `date` to report on, MM/DD/YYYY")
+	to := fs.String("to", "", "last work performed `date` to report on, MM/DD/YYYY")
+	units := fs.String("units", "", "unit catalog `file` (.json, .yaml) for the units of measure")
+	debug := fs.Bool("debug", false, "write debug logs to stderr")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if *out == "" {
+		fmt.Fprintf(os.Stderr, "caddae export: -o is required\n")
+		fs.Usage()
+		return 2
+	}
+
+	var f report.Filter
+	for _, job := range strings.Split(*jobs, ",") {
+		if job = strings.TrimSpace(job); job != "" {
+			f.Jobs = append(f.Jobs, job)
+		}
+	}
+	var err error
+	if f.From, err = report.ParseDate(*from); err != nil {
+		fmt.Fprintf(os.Stderr, "caddae export: -from: %v\n", err)
+		return 2
+	}
+	if f.To, err = report.ParseDate(*to); err != nil {
+		fmt.Fprintf(os.Stderr, "caddae export: -to: %v\n", err)
+		return 2
+	}
+	if _, err := os.Stat(*path); err != nil {
+		fmt.Fprintf(os.Stderr, "caddae export: no job database at %s\n", *path)
+		return 1
+	}
+
+	logger := cliLogger(*debug)
+	a := app.New(&logger)
+	if err := loadCatalog(a, *units); err != nil {
+		fmt.Fprintf(os.Stderr, "caddae export: %v\n", err)
+		return 1
+	}
+	a.SetJobDB(*path)
+
+	n, err := a.ExportReport(*out, f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "caddae export: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Wrote %d rows to %s\n", n, *out)
+	return 0
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"caddae/catalog"
+	"caddae/jobdb"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+// jobs prints what's recorded in the job database: every job with the footage
+// placed on it, or the run history and production totals of a single job,
+// against its design quantities. It also sets the design quantities of a job.
+func jobs(args []string) int {
+	fs := flag.NewFlagSet("jobs", flag.ContinueOnError)
+	path := fs.String("db", jobdb.DefaultPath(), "job database `file`")
+	job := fs.String("job", "", "job `number` to show the history of, e.g. VZ_LAN_00007054")
+	units := fs.String("units", "", "unit catalog `file` (.json, .yaml) used to show quantities")
+	design := quantities{}
+	fs.Var(design, "design", "design quantity of a catalog unit for the -job, as `CODE=QTY` (may be repeated)")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if len(design) > 0 && *job == "" {
+		fmt.Fprintf(os.Stderr, "caddae jobs: -design needs a -job\n")
+		return 2
+	}
+
+	cat := catalog.DefaultCatalog()
+	if *units != "" {
+		var err error
+		if cat, err = catalog.LoadCatalog(*units); err != nil {
+			fmt.Fprintf(os.Stderr, "caddae jobs: %v\n", err)
+			return 1
+		}
+	}
+
+	if len(design) > 0 {
+		return setDesign(*path, *job, design, cat)
+	}
+
+	if _, err := os.Stat(*path); err != nil {
+		fmt.Fprintf(os.Stderr, "caddae jobs: no job database at %s\n", *path)
+		return 1
+	}
+	db, err := jobdb.Open(*path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "caddae jobs: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	if *job == "" {
+		err = listJobs(os.Stdout, db)
+	} else {
+		err = jobHistory(os.Stdout, db, *job, cat)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "caddae jobs: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// listJobs writes every job in the database with its number of runs, work
+// performed dates and the footage placed on it so far.
+func listJobs(w io.Writer, db *jobdb.DB) error {
+	names, err := db.Jobs()
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		fmt.Fprintf(w, "No jobs recorded in %s\n", db.Path())
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintf(tw, "JOB\tRUNS\tFIRST WPD\tLAST WPD\tFOOTAGE\n")
+	for _, name := range names {
+		s, err := db.Summarize(name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s'\n", s.Job, s.Runs, s.First, s.Last, formatFeet(s.Footage))
+	}
+	return tw.Flush()
+}
+
+// setDesign sets the design quantities of the job in the database, replacing
+// any it had, and returns the exit code for the process. Derived units can be
+// given a design quantity, since they're billed like any other.
+func setDesign(path, job string, design quantities, cat *catalog.Catalog) int {
+	qty := make(map[string]float64, len(design))
+	for name, s := range design {
+		u, err := cat.Get(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "caddae jobs: %v\n", err)
+			return 2
+		}
+		if qty[u.Code], err = u.ParseQty(s); err != nil {
+			fmt.Fprintf(os.Stderr, "caddae jobs: %v\n", err)
+			return 2
+		}
+	}
+
+	db, err := jobdb.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "caddae jobs: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+	if err := db.SetDesign(job, qty); err != nil {
+		fmt.Fprintf(os.Stderr, "caddae jobs: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Design quantities of %s set\n", strings.ToUpper(job))
+	return 0
+}
+
+// jobHistory writes every run recorded for the job, followed by the totals of
+// the production placed on it so far against its design quantities.
+func jobHistory(w io.Writer, db *jobdb.DB, job string, cat *catalog.Catalog) error {
+	runs, err := db.Runs(job)
+	if err != nil {
+		return err
+	}
+	if len(runs) == 0 {
+		return fmt.Errorf("%s: %v", job, jobdb.ErrNoJob)
+	}
+	s, err := db.Summarize(job)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "%s\n\n", s.Job)
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintf(tw, "RUN\tWPD\tFOOTAGE\tREDLINE\tOUTPUT\tUSER\tWHEN\n")
+	for _, r := range runs {
+		fmt.Fprintf(tw, "%d\t%s\t%s'\t%s\t%s\t%s\t%s\n", r.ID, r.Wpd, formatFeet(r.Footage),
+			r.Redline.Name(), filepath.Base(r.Output), r.User, r.Time.Format("01/02/2006 15:04"))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\nTotals so far, over %d runs (%s - %s), footage %s'\n\n", s.Runs, s.First, s.Last, formatFeet(s.Footage))
+	return writeTotals(w, s, cat)
+}
+
+// writeTotals writes the total of each production unit placed on the job,
+// against its design quantity and what's left to place.
+func writeTotals(w io.Writer, s jobdb.Summary, cat *catalog.Catalog) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "UNIT\tDESCRIPTION\tPLACED\tDESIGN\tREMAINING\tPLACED %%\t\n")
+	for _, u := range cat.Totals(s.Quantities, s.Design) {
+		remaining := ""
+		if unit, err := cat.Get(u.Name); err == nil && u.Design != "" {
+			remaining = unit.FormatQty(s.Design[u.Name] - s.Quantities[u.Name])
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t\n", u.Name, u.Description, u.Qty, u.Design, remaining, u.Percent)
+	}
+	return tw.Flush()
+}
+
+// formatFeet formats feet to two decimal places, leaving off the decimals of
+// whole numbers.
+func formatFeet(ft float64) string {
+	u := catalog.Unit{Measure: catalog.FEET, Decimals: 2}
+	return u.FormatQty(ft)
+}
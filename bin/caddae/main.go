@@ -0,0 +1,379 @@
+// Command caddae starts the CADDAE terminal UI, or runs one of its headless
+// subcommands when one is given.
+//
+// Usage:
+//
+//	caddae [flags]         start the terminal UI
+//	caddae create [flags]  create a running asbuilt without the terminal UI
+//	caddae batch [flags]   process every entry in a JSON or CSV manifest
+//	caddae replay [flags]  apply a job's redlines onto one running asbuilt in date order
+//	caddae jobs [flags]    show the history and production placed on jobs
+//	caddae export [flags]  write the production report of jobs to a CSV or XLSX file
+//	caddae dxf [flags]     write the work recorded for a job to a DXF file for CAD
+//	caddae svg [flags]     write the work recorded for a job to an SVG overlay
+//	caddae package [flags] write a PDF package of a job for the client
+//	caddae synth [flags]   make a synthetic redline and its ground truth from a clean asbuilt
+//	caddae score [flags]   score a running asbuilt against a synthetic redline's ground truth
+package main
+
+import (
+	"caddae/app"
+	"caddae/callout"
+	"caddae/catalog"
+	"caddae/drawing"
+	"caddae/imageproc"
+	"caddae/jobdb"
+	"caddae/ui"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// logFile is where we write the application log while the terminal UI is
+// running, since the UI owns stdout.
+const logFile = "caddae.log"
+
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "create":
+			os.Exit(create(os.Args[2:]))
+		case "batch":
+			os.Exit(batch(os.Args[2:]))
+		case "replay":
+			os.Exit(replay(os.Args[2:]))
+		case "jobs":
+			os.Exit(jobs(os.Args[2:]))
+		case "export":
+			os.Exit(export(os.Args[2:]))
+		case "dxf":
+			os.Exit(cad(os.Args[2:]))
+		case "svg":
+			os.Exit(overlay(os.Args[2:]))
+		case "package":
+			os.Exit(pdfPackage(os.Args[2:]))
+		case "synth":
+			os.Exit(synthesize(os.Args[2:]))
+		case "score":
+			os.Exit(score(os.Args[2:]))
+		case "help", "-h", "-help", "--help":
+			usage()
+			os.Exit(0)
+		default:
+			if strings.HasPrefix(os.Args[1], "-") {
+				os.Exit(startUI(os.Args[1:]))
+			}
+			fmt.Fprintf(os.Stderr, "caddae: unknown command '%s'\n\n", os.Args[1])
+			usage()
+			os.Exit(2)
+		}
+	}
+
+	os.Exit(startUI(nil))
+}
+
+// startUI starts the terminal UI, logging to logFile.
+func startUI(args []string) int {
+	fs := flag.NewFlagSet("caddae", flag.ContinueOnError)
+	profile := fs.String("profile", "", "name of the color profile to use")
+	template := fs.String("template", "", "name of the callout template to use")
+	crew := fs.String("crew", "", "name of the crew that did the work, for callout templates")
+	newApp := appFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	f, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "caddae: error opening log file (%s): %v\n", logFile, err)
+		return 1
+	}
+	defer f.Close()
+
+	logger := zerolog.New(f).With().Timestamp().Logger()
+
+	a, code, err := newApp(&logger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "caddae: %v\n", err)
+		return code
+	}
+	u := ui.New(a, &logger)
+	defer u.Close()
+	u.SetDefaults(app.UserInput{Profile: *profile, Template: *template, Crew: *crew})
+
+	u.StartUI()
+	return 0
+}
+
+// usage prints the available commands.
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage:
+  caddae [flags]         start the terminal UI
+  caddae create [flags]  create a running asbuilt without the terminal UI
+  caddae batch [flags]   process every entry in a JSON or CSV manifest
+  caddae replay [flags]  apply a job's redlines onto one running asbuilt in date order
+  caddae jobs [flags]    show the history and production placed on jobs
+  caddae export [flags]  write the production report of jobs to a CSV or XLSX file
+  caddae dxf [flags]     write the work recorded for a job to a DXF file for CAD
+  caddae svg [flags]     write the work recorded for a job to an SVG overlay
+  caddae package [flags] write a PDF package of a job for the client
+  caddae synth [flags]   make a synthetic redline and its ground truth from a clean asbuilt
+  caddae score [flags]   score a running asbuilt against a synthetic redline's ground truth
+
+Run 'caddae <command> -h' for the command's flags.
+`)
+}
+
+// cliLogger returns the logger used by the headless commands, which writes
+// to stderr so it doesn't mix with the progress messages on stdout.
+func cliLogger(debug bool) zerolog.Logger {
+	level := zerolog.WarnLevel
+	if debug {
+		level = zerolog.DebugLevel
+	}
+	return zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr}).Level(level).With().Timestamp().Logger()
+}
+
+// appFlags adds the flags every command that processes redlines shares to the
+// flag set: the unit catalog, color profiles, callout templates and styles,
+// job database and output. It returns a function that makes the app with
+// them, once the flags have been parsed. If it can't, it returns the exit
+// code for the process too, 1 if a file couldn't be loaded and 2 if a flag
+// is wrong.
+func appFlags(fs *flag.FlagSet) func(logger *zerolog.Logger) (*app.App, int, error) {
+	units := fs.String("units", "", "unit catalog `file` (.json, .yaml)")
+	profiles := fs.String("profiles", "", "color profiles `file` (.json, .yaml)")
+	templates := fs.String("templates", "", "callout templates `file` (.json, .yaml)")
+	setCallout := calloutFlags(fs)
+	setJobDB := jobDBFlags(fs)
+	setOutput := outputFlags(fs)
+
+	return func(logger *zerolog.Logger) (*app.App, int, error) {
+		a := app.New(logger)
+		if err := loadProfiles(a, *profiles); err != nil {
+			return nil, 1, err
+		}
+		if err := loadTemplates(a, *templates); err != nil {
+			return nil, 1, err
+		}
+		if err := loadCatalog(a, *units); err != nil {
+			return nil, 1, err
+		}
+		for _, set := range []func(*app.App) error{setCallout, setJobDB, setOutput} {
+			if err := set(a); err != nil {
+				return nil, 2, err
+			}
+		}
+		return a, 0, nil
+	}
+}
+
+// loadProfiles loads the color profiles file, if one was given, into the app.
+func loadProfiles(a *app.App, path string) error {
+	if path == "" {
+		return nil
+	}
+	profiles, err := drawing.LoadProfiles(path)
+	if err != nil {
+		return err
+	}
+	a.SetProfiles(profiles)
+	return nil
+}
+
+// loadTemplates loads the callout templates file, if one was given, into the
+// app.
+func loadTemplates(a *app.App, path string) error {
+	if path == "" {
+		return nil
+	}
+	templates, err := callout.LoadTemplates(path)
+	if err != nil {
+		return err
+	}
+	a.SetTemplates(templates)
+	return nil
+}
+
+// loadCatalog loads the unit catalog file, if one was given, into the app.
+func loadCatalog(a *app.App, path string) error {
+	if path == "" {
+		return nil
+	}
+	c, err := catalog.LoadCatalog(path)
+	if err != nil {
+		return err
+	}
+	a.SetCatalog(c)
+	return nil
+}
+
+// quantities is a repeatable flag of production quantities, given as
+// CODE=QTY.
+type quantities map[string]string
+
+func (q quantities) String() string {
+	var s []string
+	for unit, qty := range q {
+		s = append(s, unit+"="+qty)
+	}
+	sort.Strings(s)
+	return strings.Join(s, ",")
+}
+
+func (q quantities) Set(v string) error {
+	i := strings.Index(v, "=")
+	if i <= 0 {
+		return fmt.Errorf("quantities must be given as CODE=QTY, not '%s'", v)
+	}
+	q[strings.TrimSpace(v[:i])] = strings.TrimSpace(v[i+1:])
+	return nil
+}
+
+// outputFlags adds the flags for what's written alongside the running
+// asbuilt to the flag set. It returns a function that sets them on the app,
+// once the flags have been parsed.
+func outputFlags(fs *flag.FlagSet) func(a *app.App) error {
+	format := fs.String("format", "png", "`format` to save the running asbuilt in: png, jpeg, or pdf for a package with a cover sheet and the redlines")
+	pageSize := fs.String("page-size", "11x17", "page `size` of a pdf package: ansi-d or 11x17")
+	overlay := fs.Bool("svg", false, "write an SVG overlay next to the running asbuilt, with the lines and callouts as editable vectors")
+	dir := fs.String("output-dir", "", "`folder` to save the running asbuilt in, created if it isn't there (default the 'edits' folder next to the running asbuilt)")
+	name := fs.String("output-name", imageproc.DEFAULT_NAME, "`template` of the running asbuilt's file name, with {job}, {wpd}, {timestamp} and {sheet} filled in")
+	skipDebug := fs.Bool("skip-debug", false, "don't save the preprocessed redline and callout drawings next to the running asbuilt")
+
+	return func(a *app.App) error {
+		if err := a.SetFormat(*format, *pageSize); err != nil {
+			return err
+		}
+		a.SetSVG(*overlay)
+		return a.SetOutput(*dir, *name, *skipDebug)
+	}
+}
+
+// jobDBFlags adds the flags for the job database, and the job totals stamped
+// from it, to the flag set. It returns a function that sets them on the app,
+// once the flags have been parsed.
+func jobDBFlags(fs *flag.FlagSet) func(a *app.App) error {
+	path := fs.String("db", jobdb.DefaultPath(), "job database `file` each run is recorded in")
+	noDB := fs.Bool("no-db", false, "don't record runs in the job database")
+	name := fs.String("user", "", "`name` recorded as who did the run (default the logged in user)")
+	totals := fs.String("totals", "", "stamp the job's totals so far in this `corner`: top-left, top-right, bottom-left or bottom-right")
+
+	return func(a *app.App) error {
+		if !*noDB {
+			a.SetJobDB(*path)
+		}
+		a.SetUser(*name)
+		return a.SetTotals(*totals)
+	}
+}
+
+// calloutFlags adds the flags for the callout font and leader arrow style to
+// the flag set. It returns a function that sets the parsed styles on the app,
+// once the flags have been parsed.
+func calloutFlags(fs *flag.FlagSet) func(a *app.App) error {
+	defFont := callout.DefaultFont()
+	fontFile := fs.String("font", "", "TrueType or OpenType font `file` for the callout text (default Go Regular)")
+	fontSize := fs.Float64("font-size", defFont.Size, "size of the callout text, in `points`")
+	dpi := fs.Float64("dpi", 0, "`DPI` of the scans, for sizing the callout text (default the image width over 17 inches)")
+
+	def := callout.DefaultLeader()
+	hide := fs.Bool("no-leader", false, "don't draw leader arrows from the callouts to their lines")
+	head := fs.String("leader-head", def.Head, "leader arrowhead `style`: filled, open, dot or none")
+	size := fs.Int("leader-head-size", def.HeadSize, "length of the leader arrowhead, in `pixels`")
+	col := fs.String("leader-color", hexColor(def.Color), "leader `color`")
+	weight := fs.Int("leader-weight", def.Weight, "width of the leader line, in `pixels`")
+	target := fs.String("leader-target", def.Target, "what the leader points to: nearest or centroid")
+
+	return func(a *app.App) error {
+		f := callout.Font{Size: *fontSize, DPI: *dpi}
+		if *fontFile != "" {
+			var err error
+			if f.Typeface, err = callout.LoadFont(*fontFile); err != nil {
+				return fmt.Errorf("-font: %v", err)
+			}
+		}
+		if err := f.Validate(); err != nil {
+			return err
+		}
+		a.SetFont(f)
+
+		l := callout.Leader{
+			Hide:     *hide,
+			Head:     *head,
+			HeadSize: *size,
+			Weight:   *weight,
+			Target:   *target,
+		}
+		var err error
+		if l.Color, err = drawing.ParseHex(*col); err != nil {
+			return fmt.Errorf("-leader-color: %v", err)
+		}
+		if err := l.Validate(); err != nil {
+			return err
+		}
+		a.SetLeader(l)
+		return nil
+	}
+}
+
+// hexColor formats the color like "#f5f86c"
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// defaultTemplate sets the callout template of any inputs that don't have one.
+func defaultTemplate(inputs []app.UserInput, template string) {
+	for i := range inputs {
+		if inputs[i].Template == "" {
+			inputs[i].Template = template
+		}
+	}
+}
+
+// defaultProfile sets the color profile of any inputs that don't have one.
+func defaultProfile(inputs []app.UserInput, profile string) {
+	for i := range inputs {
+		if inputs[i].Profile == "" {
+			inputs[i].Profile = profile
+		}
+	}
+}
+
+// openImage decodes the image in the file
+func openImage(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("image.Decode(%s): %v", path, err)
+	}
+	return img, nil
+}
+
+// savePNG encodes the image to the file as a PNG
+func savePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return fmt.Errorf("png.Encode(%s): %v", path, err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"caddae/app"
+	"caddae/jobdb"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// pdfPackage writes a PDF package of a job from the job database: a cover
+// sheet with its production, its running asbuilts and its redlines. Returns
+// the exit code for the process.
+func pdfPackage(args []string) int {
+	fs := flag.NewFlagSet("package", flag.ContinueOnError)
+	out := fs.String("o", "", "PDF `file` to write")
+	path := fs.String("db", jobdb.DefaultPath(), "job database `file`")
+	job := fs.String("job", "", "job `number` to package, e.g. VZ_LAN_00007054")
+	pageSize := fs.String("page-size", "11x17", "page `size`: ansi-d or 11x17")
+	units := fs.String("units", "", "unit catalog `file` (.json, .yaml) for the production on the cover sheet")
+	debug := fs.Bool("debug", false, "write debug logs to stderr")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if *out == "" || *job == "" {
+		fmt.Fprintf(os.Stderr, "caddae package: -o and -job are required\n")
+		fs.Usage()
+		return 2
+	}
+	if _, err := os.Stat(*path); err != nil {
+		fmt.Fprintf(os.Stderr, "caddae package: no job database at %s\n", *path)
+		return 1
+	}
+
+	logger := cliLogger(*debug)
+	a := app.New(&logger)
+	if err := loadCatalog(a, *units); err != nil {
+		fmt.Fprintf(os.Stderr, "caddae package: %v\n", err)
+		return 1
+	}
+	a.SetJobDB(*path)
+
+	n, err := a.ExportPackage(*job, *out, *pageSize)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "caddae package: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Wrote %d pages of %s to %s\n", n, *job, *out)
+	return 0
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"caddae/app"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// replay applies every redline in a manifest onto one running asbuilt, in
+// work performed date order, and returns the exit code for the process.
+func replay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	manifest := fs.String("manifest", "", "path to the JSON or CSV manifest `file` of redlines")
+	running := fs.String("running", "", "path to the running asbuilt `file` (.png, .jpg, .tif, .pdf)")
+	runningPage := fs.Int("running-page", 1, "`page` of the running asbuilt to use, for TIFF and PDF files with several")
+	job := fs.String("job", "", "DYEA/VZ job number, e.g. VZ_LAN_00007054")
+	profile := fs.String("profile", "", "color profile to use for entries that don't name one")
+	template := fs.String("template", "", "callout template to use for entries that don't name one")
+	debug := fs.Bool("debug", false, "write debug logs to stderr")
+	newApp := appFlags(fs)
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if *manifest == "" || *running == "" || *job == "" {
+		fmt.Fprintf(os.Stderr, "caddae replay: -manifest, -running and -job are required\n")
+		fs.Usage()
+		return 2
+	}
+
+	logger := cliLogger(*debug)
+	a, code, err := newApp(&logger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "caddae replay: %v\n", err)
+		return code
+	}
+
+	inputs, err := app.LoadManifest(*manifest)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "caddae replay: %v\n", err)
+		return 1
+	}
+
+	defaultProfile(inputs, *profile)
+	defaultTemplate(inputs, *template)
+
+	// The running asbuilt is given once for the job, and so is its page
+	for i := range inputs {
+		inputs[i].RunningPage = *runningPage
+	}
+
+	if _, err := a.Replay(nil, nil, *running, strings.ToUpper(*job), inputs); err != nil {
+		fmt.Fprintf(os.Stderr, "caddae replay: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"caddae/synth"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// score compares the lines drawn on a running asbuilt against the ground
+// truth of a synthetic redline, and returns the exit code for the process.
+func score(args []string) int {
+	fs := flag.NewFlagSet("score", flag.ContinueOnError)
+	truth := fs.String("truth", "", "path to the ground truth `file` (.json) written by synth")
+	running := fs.String("running", "", "path to the running asbuilt `file` the redline was applied to")
+	tolerance := fs.Float64("tolerance", 5, "how far, in `pixels`, a drawn pixel may be from the ground truth")
+	minF1 := fs.Float64("min-f1", 0, "exit with an error if the F1 score is below this")
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if *truth == "" || *running == "" {
+		fmt.Fprintf(os.Stderr, "caddae score: -truth and -running are required\n")
+		fs.Usage()
+		return 2
+	}
+
+	gt, err := synth.LoadTruth(*truth)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "caddae score: %v\n", err)
+		return 1
+	}
+	img, err := openImage(*running)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "caddae score: %v\n", err)
+		return 1
+	}
+
+	s := synth.Compare(img, gt, *tolerance)
+	fmt.Printf("precision %.3f (%d of %d drawn pixels on a line)\n", s.Precision, s.Correct, s.Drawn)
+	fmt.Printf("recall    %.3f (%d of %d line pixels drawn)\n", s.Recall, s.Found, s.Truth)
+	fmt.Printf("f1        %.3f\n", s.F1)
+
+	if s.F1 < *minF1 {
+		fmt.Fprintf(os.Stderr, "caddae score: F1 %.3f is below %.3f\n", s.F1, *minF1)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"caddae/app"
+	"caddae/jobdb"
+	"caddae/svg"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// overlay writes the work recorded for a job in the job database to an SVG
+// overlay, and returns the exit code for the process.
+func overlay(args []string) int {
+	fs := flag.NewFlagSet("svg", flag.ContinueOnError)
+	out := fs.String("o", "", "SVG `file` to write")
+	path := fs.String("db", jobdb.DefaultPath(), "job database `file`")
+	job := fs.String("job", "", "job `number` to export, e.g. VZ_LAN_00007054")
+	underlay := fs.String("underlay", "", "image `file` to embed under the work (default the running asbuilt the first run was drawn on)")
+	noUnderlay := fs.Bool("no-underlay", false, "don't embed an image under the work")
+	debug := fs.Bool("debug", false, "write debug logs to stderr")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if *out == "" || *job == "" {
+		fmt.Fprintf(os.Stderr, "caddae svg: -o and -job are required\n")
+		fs.Usage()
+		return 2
+	}
+	if _, err := os.Stat(*path); err != nil {
+		fmt.Fprintf(os.Stderr, "caddae svg: no job database at %s\n", *path)
+		return 1
+	}
+
+	logger := cliLogger(*debug)
+	a := app.New(&logger)
+	a.SetJobDB(*path)
+
+	n, err := a.ExportSVG(*job, *out, svg.Options{Underlay: *underlay, NoUnderlay: *noUnderlay})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "caddae svg: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Wrote %d runs of %s to %s\n", n, *job, *out)
+	return 0
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"caddae/drawing"
+	"caddae/synth"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// synthesize makes a synthetic redline from a clean asbuilt and a lines file,
+// and writes it with its ground truth. It returns the exit code for the
+// process.
+func synthesize(args []string) int {
+	def := synth.DefaultOptions()
+
+	fs := flag.NewFlagSet("synth", flag.ContinueOnError)
+	asbuilt := fs.String("asbuilt", "", "path to the clean asbuilt `file` (.png)")
+	lines := fs.String("lines", "", "path to the JSON `file` of lines to highlight")
+	out := fs.String("out", "", "path to write the synthetic redline `file` (.png)")
+	truth := fs.String("truth", "", "path to write the ground truth `file` (.json), defaults to -out with a .json extension")
+	hl := fs.String("color", hexColor(def.Color), "highlighter `color`")
+	opacity := fs.Float64("opacity", def.Opacity, "how strongly the highlighter shows, 0 to 1")
+	width := fs.Float64("width", def.StrokeWidth, "width of the highlighter strokes, in `pixels`")
+	jitter := fs.Float64("jitter", def.Jitter, "how far the strokes wander from the lines, in `pixels`")
+	rotation := fs.Float64("rotation", def.Scan.Rotation, "rotation of the scan, in `degrees`")
+	scale := fs.Float64("scale", def.Scan.Scale, "scale of the scan")
+	shiftX := fs.Float64("shift-x", def.Scan.ShiftX, "horizontal shift of the scan, in `pixels`")
+	shiftY := fs.Float64("shift-y", def.Scan.ShiftY, "vertical shift of the scan, in `pixels`")
+	noise := fs.Float64("noise", def.Noise, "standard deviation of the scan noise, in 8 bit `levels`")
+	blur := fs.Int("blur", def.Blur, "radius of the scan blur, in `pixels`")
+	tint := fs.String("tint", hexColor(def.Tint), "paper `color`")
+	seed := fs.Int64("seed", def.Seed, "random seed")
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if *asbuilt == "" || *lines == "" || *out == "" {
+		fmt.Fprintf(os.Stderr, "caddae synth: -asbuilt, -lines and -out are required\n")
+		fs.Usage()
+		return 2
+	}
+	if *truth == "" {
+		*truth = strings.TrimSuffix(*out, filepath.Ext(*out)) + ".json"
+	}
+
+	opts := synth.Options{
+		Opacity:     *opacity,
+		StrokeWidth: *width,
+		Jitter:      *jitter,
+		Scan:        synth.Scan{Scale: *scale, Rotation: *rotation, ShiftX: *shiftX, ShiftY: *shiftY},
+		Noise:       *noise,
+		Blur:        *blur,
+		Seed:        *seed,
+	}
+	var err error
+	if opts.Color, err = drawing.ParseHex(*hl); err != nil {
+		fmt.Fprintf(os.Stderr, "caddae synth: -color: %v\n", err)
+		return 2
+	}
+	if opts.Tint, err = drawing.ParseHex(*tint); err != nil {
+		fmt.Fprintf(os.Stderr, "caddae synth: -tint: %v\n", err)
+		return 2
+	}
+
+	img, err := openImage(*asbuilt)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "caddae synth: %v\n", err)
+		return 1
+	}
+	in, err := synth.LoadTruth(*lines)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "caddae synth: %v\n", err)
+		return 1
+	}
+
+	redline, gt := synth.Generate(img, in.Lines, opts)
+	gt.Asbuilt, gt.Redline = *asbuilt, *out
+
+	if err := savePNG(*out, redline); err != nil {
+		fmt.Fprintf(os.Stderr, "caddae synth: %v\n", err)
+		return 1
+	}
+	if err := synth.SaveTruth(*truth, gt); err != nil {
+		fmt.Fprintf(os.Stderr, "caddae synth: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Wrote %s and %s\n", *out, *truth)
+	return 0
+}
@@ -2,117 +2,169 @@
 package callout
 
 import (
-	"caddae/drawing"
 	"caddae/types"
 	"errors"
 	"fmt"
+	"golang.org/x/image/font"
 	"image"
 	"image/color"
 	"image/draw"
 	"image/png"
 	"math"
 	"os"
+	"strings"
 )
 
-// New creates and returns a new callout
+// New creates and returns a new callout, using the default template and font.
 func New(prod *types.Production, img image.Image) *Callout {
 	// Initialize the callout.
 	var c Callout
 	c.prod = prod
+	c.bounds = img.Bounds()
+	c.template = DefaultTemplate()
 
-	// Resize the callout based on image dimensions
-	bnds := img.Bounds()
-	c.Resize(bnds.Max.X, bnds.Max.Y)
-
-	// Determine how many production units we have to see if we need to resize.
-	numUnits := len(prod.Units)
-	if numUnits > 1 {
-		numUnits--
-		addtnlHeight := numUnits * addtlnProdHeight
-		c.dim.y2 = c.dim.y2 + addtnlHeight
-		canvasHeight = canvasHeight + addtnlHeight
-	}
-
-	c.canvas = image.NewRGBA(image.Rect(0, 0, canvasWidth, canvasHeight))
+	// Size the callout for the image and the production
+	c.SetFont(DefaultFont())
 
 	return &c
 }
 
-// Resize resizes the callout and production canvas dimensions and text dimensions
-// based on the provides image bounds
-func (c *Callout) Resize(xMax, yMax int) {
-	cw := math.Round(float64(xMax) * 0.05)
-	ch := math.Round(float64(yMax) * 0.05)
-	canvasWidth = int(cw)
-	canvasHeight = int(ch)
-
-	// Create a Dimension for the dimensions of the callout.
-	var dim Dimensions
-	dim.x1 = 0
-	dim.y1 = 0
-	dim.x2 = canvasWidth - 1
-	dim.y2 = canvasHeight - 1
-
-	// Create a Text for the location of the date.
-	var txt Text
-	x := math.Round(float64(canvasWidth) * 0.3)
-	y := math.Round(float64(canvasHeight) * 0.28125)
-
-	txt.x = int(x)
-	txt.y = int(y)
-
-	c.dim = dim
-	c.date = txt
-
-	pw := math.Round(float64(canvasWidth) * 0.875)
-	ph := math.Round(float64(canvasHeight) * 0.333)
-
-	prodWidth = int(pw)
-	prodHeight = int(ph)
-
-	ap := math.Round(float64(prodHeight) * 1.15)
-	ag := math.Round(float64(prodHeight) * 1.25)
-	addtlnProdHeight = int(ap)
-	prodGap = int(ag)
-
-	px := math.Round(float64(canvasWidth) * 0.0625)
-	py := math.Round(float64(canvasHeight) * 0.4167)
-
-	prodDims.x1 = int(px)
-	prodDims.y1 = int(py)
-	prodDims.x2 = prodDims.x1 + prodWidth
-	prodDims.y2 = prodDims.y1 + prodHeight
-
-	ptx := math.Round(float64(prodDims.x1) * 1.1429)
-	pty := math.Round(float64(prodDims.y1) * 1.525)
-	prodText.x = int(ptx)
-	prodText.y = int(pty)
+// SetTemplate sets the design of the callout. The callout is laid out again,
+// so it must be set before CreateCallout.
+func (c *Callout) SetTemplate(t *Template) {
+	c.template = t
+	c.layOut()
 }
 
-// CreateCallout creates the callout canvas, adds the date and production boxes to the canvas.
-func (c *Callout) CreateCallout() error {
-	// Make a white mask over the callout image.
-	draw.DrawMask(c.canvas.(draw.Image), image.Rect(c.dim.x1, c.dim.y1, c.dim.x2, c.dim.y2), &image.Uniform{drawing.White}, image.ZP, nil, image.ZP, draw.Src)
+// layOut fills in the template's rows from the production, and works out
+// where each one goes and how big the callout canvas needs to be for them.
+func (c *Callout) layOut() {
+	t := c.template
+	c.face = c.font.newFace(c.bounds.Dx())
+
+	// Everything is sized from the width of the callout
+	width := int(math.Round(float64(c.bounds.Dx()) * t.Width))
+	px := func(f float64) int { return int(math.Round(float64(width) * f)) }
+	margin, gap := px(t.Margin), px(t.Gap)
+	l := layout{padding: px(t.Padding)}
+
+	// The template's font, if it has one, in each size the rows need
+	faces := map[float64]font.Face{}
+	faceFor := func(size float64) font.Face {
+		if face, ok := faces[size]; ok {
+			return face
+		}
+		f := c.font
+		if t.Font.Typeface != nil {
+			f.Typeface = t.Font.Typeface
+		}
+		if t.Font.Size != 0 {
+			f.Size = t.Font.Size
+		}
+		if t.Font.DPI != 0 {
+			f.DPI = t.Font.DPI
+		}
+		if size != 0 {
+			f.Size = size
+		}
+		faces[size] = f.newFace(c.bounds.Dx())
+		return faces[size]
+	}
 
-	// Add a rectange outlining the canvas.
-	c.Rectangle(c.dim.x1, c.dim.y1, c.dim.x2, c.dim.y2, c.canvas, drawing.Black)
-	c.Rectangle(c.dim.x1+1, c.dim.y1+1, c.dim.x2-1, c.dim.y2-1, c.canvas, drawing.Black)
+	y := margin
+	for i := range t.Rows {
+		r := &t.Rows[i]
+		face := faceFor(r.Size)
+
+		// Unit rows are repeated for each unit, in its color
+		data := []interface{}{*c.prod}
+		fills := []color.RGBA{r.Fill}
+		if r.Kind == ROW_UNITS {
+			data, fills = nil, nil
+			for _, u := range c.prod.Units {
+				data = append(data, u)
+				if r.Fill.A == 0 {
+					fills = append(fills, u.Color)
+				} else {
+					fills = append(fills, r.Fill)
+				}
+			}
+		}
+
+		for j := range data {
+			text, err := r.execute(data[j])
+			if err != nil && l.err == nil {
+				l.err = errors.New(fmt.Sprintf("filling in callout template '%s': %v", t.Name, err))
+			}
+			if strings.TrimSpace(text) == "" {
+				// Nothing to show, e.g. no crew was given
+				continue
+			}
+
+			lines := wrap(face, text, width-2*margin-2*l.padding)
+			h := len(lines)*lineHeight(face) + 2*l.padding
+			if min := px(r.Height); h < min {
+				h = min
+			}
+			l.cells = append(l.cells, cell{
+				rect:  image.Rect(margin, y, width-margin, y+h),
+				lines: lines,
+				row:   r,
+				fill:  fills[j],
+				face:  face,
+			})
+			y += h + gap
+		}
+	}
+	if len(l.cells) > 0 {
+		y -= gap
+	}
 
-	// Add the date to the canvas.
-	c.AddText(c.canvas, c.date.x, c.date.y, c.prod.Date, drawing.Black)
+	l.canvasWidth, l.canvasHeight = width, y+margin
+	c.layout = l
+	c.canvas = image.NewRGBA(image.Rect(0, 0, l.canvasWidth, l.canvasHeight))
+}
+
+// CreateCallout draws the callout's template on the callout canvas. It
+// returns an error if the template couldn't be filled in from the
+// production.
+func (c *Callout) CreateCallout() error {
+	t := c.template
+	canvas := c.canvas.(draw.Image)
 
-	// For each production, create a prodbox.
-	for _, u := range c.prod.Units {
-		c.AddProdBox(u.Text, u.Color)
+	// Fill in the background
+	if t.Background.A != 0 {
+		draw.Draw(canvas, canvas.Bounds(), &image.Uniform{t.Background}, image.ZP, draw.Src)
 	}
 
-	// Save our drawing of the canvas for review.
-	c.SaveDrawing("/Users/sabra/go/src/caddae/edits/draw.png", c.canvas)
-	return nil
+	// Then each row
+	for _, cl := range c.layout.cells {
+		if cl.fill.A != 0 {
+			draw.Draw(canvas, cl.rect, &image.Uniform{cl.fill}, image.ZP, draw.Src)
+		}
+		c.Border(canvas, cl.rect, cl.row.Border, cl.row.Color)
+		c.addLines(canvas, cl.face, cl.rect.Inset(c.layout.padding), cl.lines, cl.row.Align, cl.row.Color)
+	}
+
+	// And the border around the callout last, so rows without a margin
+	// don't cover it
+	c.Border(canvas, canvas.Bounds(), t.Border, t.BorderColor)
+
+	return c.layout.err
+}
+
+// Drawing returns our drawing of the callout, once it's been created.
+func (c *Callout) Drawing() image.Image {
+	return c.canvas
 }
 
 // AddCallout adds the callout to the running asbuilt image.
 func (c *Callout) AddCallout(img image.Image) {
+	c.AddCalloutAt(img, c.Position(img))
+}
+
+// Position returns the default top left position of the callout on the image.
+func (c *Callout) Position(img image.Image) image.Point {
 	// Get the bounds of the image
 	bnds := img.Bounds()
 
@@ -125,61 +177,39 @@ func (c *Callout) AddCallout(img image.Image) {
 	// the time being lol.)
 	x := int(xMax/2) + int(xMax/4)
 	y := int(yMax / 2)
+	return image.Pt(x, y)
+}
 
-	// Draw the callout onto the image
-	draw.DrawMask(img.(draw.Image), image.Rect(x, y, xMax, yMax), c.canvas.(draw.Image), image.ZP, nil, image.ZP, draw.Src)
+// Size returns the width and height of the callout canvas.
+func (c *Callout) Size() image.Point {
+	return c.canvas.Bounds().Size()
 }
 
-// AddProdBox adds a new production box to the callout
-//
-// For each new prod box, shift y2 down by 25.
-// If more than 6 prod boxes, need to resize canvas
-// Each prod box needs it's texts y value shifted down 30
-// Each prod box need it's y1 & y2 values shifted down 30
-func (c *Callout) AddProdBox(text string, col color.Color) {
-	// Create a new canvas image for the production box
-	canvas := image.NewRGBA(image.Rect(0, 0, prodWidth, prodHeight))
-
-	// Do we already have a prod box?
-	if numProd > 0 {
-		// Yes, so let's shift this one down
-		prodDims.y1 = prodDims.y1 + prodGap
-		prodDims.y2 = prodDims.y2 + prodGap
-		prodText.y = prodText.y + prodGap
-	}
+// Box returns where the callout was added to the running asbuilt, or an empty
+// rectangle if it hasn't been.
+func (c *Callout) Box() image.Rectangle {
+	return c.box
+}
 
-	// Now let's go ahead and position the text inside the box
-	if len(text) <= 11 {
-		addWidth := 10 - len(text)
-		prodText.x = prodText.x + addWidth
-	} else if len(text) < 15 {
-		addWidth := 25 - len(text)
-		prodText.x = prodText.x + addWidth
-	} else if len(text) < 17 {
-		addWidth := 35 - len(text)
-		prodText.x = prodText.x + addWidth
-	} else if len(text) < 25 {
-		addWidth := 30 - len(text)
-		prodText.x = prodText.x + addWidth
-	} else {
-		math.Round(float64(prodDims.x1) * 1.1429)
+// Text returns the lines of text on the callout, top to bottom.
+func (c *Callout) Text() []string {
+	var lines []string
+	for _, cl := range c.layout.cells {
+		lines = append(lines, cl.lines...)
 	}
+	return lines
+}
 
-	// Create a blue mask over the canvas
-	draw.DrawMask(canvas, canvas.Bounds(), &image.Uniform{col}, image.ZP, nil, image.ZP, draw.Src)
-
-	// Now, add our blue box to the callout canvas
-	draw.DrawMask(c.canvas.(draw.Image), image.Rect(prodDims.x1, prodDims.y1, prodDims.x2, prodDims.y2), canvas, image.ZP, nil, image.ZP, draw.Src)
-
-	// Draw a rectangle around the blue canvas
-	c.Rectangle(prodDims.x1, prodDims.y1, prodDims.x2, prodDims.y2, c.canvas, drawing.Black)
-	c.Rectangle(prodDims.x1+1, prodDims.y1+1, prodDims.x2-1, prodDims.y2-1, c.canvas, drawing.Black)
+// AddCalloutAt adds the callout to the running asbuilt image with its top
+// left corner at pt.
+func (c *Callout) AddCalloutAt(img image.Image, pt image.Point) {
+	// Get the bounds of the image
+	bnds := img.Bounds()
 
-	// Add the production boxes text to the canvas
-	c.AddText(c.canvas, prodText.x, prodText.y, text, drawing.Black)
-	c.AddText(c.canvas, prodText.x, prodText.y, text, drawing.Black)
-	// Increment the amount of production boxes we have
-	numProd++
+	// Draw the callout onto the image, leaving anything under a transparent
+	// background showing through
+	draw.Draw(img.(draw.Image), image.Rect(pt.X, pt.Y, bnds.Max.X, bnds.Max.Y), c.canvas, image.ZP, draw.Over)
+	c.box = image.Rectangle{Min: pt, Max: pt.Add(c.Size())}.Intersect(bnds)
 }
 
 // SaveDrawing saves our callout drawing as a png.
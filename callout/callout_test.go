@@ -0,0 +1,178 @@
+package callout
+
+import (
+	"bytes"
+	"caddae/drawing"
+	"caddae/types"
+	"image"
+	"image/draw"
+	"sync"
+	"testing"
+)
+
+// testProduction returns a production with the given number of units
+func testProduction(n int) *types.Production {
+	p := types.Production{Date: "07/16/2021"}
+	for i := 0; i < n; i++ {
+		p.Units = append(p.Units, types.Unit{Name: "C300-01", Qty: "100", Text: "C300-01 = 100'", Color: drawing.Blue})
+	}
+	return &p
+}
+
+// testRunning returns a white image the size of the sample asbuilts
+func testRunning() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 3400, 2200))
+	draw.Draw(img, img.Bounds(), &image.Uniform{drawing.White}, image.Point{}, draw.Src)
+	return img
+}
+
+func TestNewSize(t *testing.T) {
+	img := testRunning()
+
+	one := New(testProduction(1), img).Size()
+	if want := (image.Point{170, 110}); one != want {
+		t.Errorf("Size with 1 unit = %v, want %v (5%% of the image)", one, want)
+	}
+
+	three := New(testProduction(3), img).Size()
+	if three.X != one.X {
+		t.Errorf("width with 3 units = %d, want %d", three.X, one.X)
+	}
+	if three.Y <= one.Y {
+		t.Errorf("height with 3 units = %d, want more than %d", three.Y, one.Y)
+	}
+}
+
+func TestPosition(t *testing.T) {
+	img := testRunning()
+	c := New(testProduction(1), img)
+
+	if got, want := c.Position(img), (image.Point{2550, 1100}); got != want {
+		t.Errorf("Position = %v, want %v", got, want)
+	}
+}
+
+func TestCreateCallout(t *testing.T) {
+	img := testRunning()
+	c := New(testProduction(2), img)
+	if err := c.CreateCallout(); err != nil {
+		t.Fatalf("CreateCallout: %v", err)
+	}
+
+	canvas := c.canvas.(*image.RGBA)
+	size := c.Size()
+
+	// Double black border around the outside
+	for _, p := range []image.Point{{0, 0}, {1, 1}, {size.X - 2, 0}, {0, size.Y - 2}} {
+		if got := canvas.RGBAAt(p.X, p.Y); got != drawing.Black {
+			t.Errorf("border pixel %v = %v, want %v", p, got, drawing.Black)
+		}
+	}
+
+	// Each production box is filled with the unit's color
+	found := 0
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			if canvas.RGBAAt(x, y) == drawing.Blue {
+				found++
+			}
+		}
+	}
+	if found == 0 {
+		t.Errorf("callout has no %v production boxes", drawing.Blue)
+	}
+}
+
+func TestAddCalloutAt(t *testing.T) {
+	img := testRunning()
+	c := New(testProduction(1), img)
+	if err := c.CreateCallout(); err != nil {
+		t.Fatalf("CreateCallout: %v", err)
+	}
+
+	pt := image.Pt(100, 200)
+	c.AddCalloutAt(img, pt)
+
+	if got := img.RGBAAt(pt.X, pt.Y); got != drawing.Black {
+		t.Errorf("top left of the callout = %v, want %v", got, drawing.Black)
+	}
+	if got := img.RGBAAt(pt.X-1, pt.Y-1); got != drawing.White {
+		t.Errorf("pixel outside the callout = %v, want %v", got, drawing.White)
+	}
+	end := pt.Add(c.Size())
+	if got := img.RGBAAt(end.X, end.Y); got != drawing.White {
+		t.Errorf("pixel past the callout = %v, want %v", got, drawing.White)
+	}
+}
+
+func TestCalloutsIndependent(t *testing.T) {
+	img := testRunning()
+	build := func(n int) *Callout {
+		c := New(testProduction(n), img)
+		if err := c.CreateCallout(); err != nil {
+			t.Fatalf("CreateCallout: %v", err)
+		}
+		return c
+	}
+
+	// Building other callouts in between shouldn't change the next one
+	first := build(2)
+	build(3)
+	build(1)
+	again := build(2)
+
+	if first.Size() != again.Size() {
+		t.Errorf("second callout size = %v, want %v like the first", again.Size(), first.Size())
+	}
+	if !bytes.Equal(first.canvas.(*image.RGBA).Pix, again.canvas.(*image.RGBA).Pix) {
+		t.Error("second callout drawn differently to the first")
+	}
+	for _, n := range []int{1, 2, 3} {
+		if got := countBoxes(build(n)); got != n {
+			t.Errorf("callout with %d units shows %d production boxes", n, got)
+		}
+	}
+}
+
+// countBoxes returns how many production boxes can be seen down the
+// callout, just inside their left edge where there's no text
+func countBoxes(c *Callout) int {
+	canvas := c.canvas.(*image.RGBA)
+	x := c.layout.cells[0].rect.Min.X + 3
+	n, inBox := 0, false
+	for y := 0; y < c.Size().Y; y++ {
+		blue := canvas.RGBAAt(x, y) == drawing.Blue
+		if blue && !inBox {
+			n++
+		}
+		inBox = blue
+	}
+	return n
+}
+
+func TestCalloutsConcurrent(t *testing.T) {
+	img := testRunning()
+	want := New(testProduction(3), img)
+	if err := want.CreateCallout(); err != nil {
+		t.Fatalf("CreateCallout: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	callouts := make([]*Callout, 8)
+	for i := range callouts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c := New(testProduction(3), img)
+			c.CreateCallout()
+			callouts[i] = c
+		}(i)
+	}
+	wg.Wait()
+
+	for i, c := range callouts {
+		if c.Size() != want.Size() || !bytes.Equal(c.canvas.(*image.RGBA).Pix, want.canvas.(*image.RGBA).Pix) {
+			t.Errorf("callout %d built concurrently differs from one built alone", i)
+		}
+	}
+}
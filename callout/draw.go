@@ -7,23 +7,49 @@ import (
 	"golang.org/x/image/math/fixed"
 	"image"
 	"image/color"
+	"image/draw"
+	"math"
 )
 
-// AddText adds text to the provided image.
+// AddText adds text to the provided image, with its baseline starting at
+// (x, y).
 func (c *Callout) AddText(img image.Image, x, y int, text string, col color.RGBA) {
+	face := c.face
+	if face == nil {
+		face = basicfont.Face7x13
+	}
+	drawText(img, face, x, y, text, col)
+}
+
+// drawText draws the text on the image in the face, with its baseline
+// starting at (x, y).
+func drawText(img image.Image, face font.Face, x, y int, text string, col color.RGBA) {
 	point := fixed.Point26_6{
 		X: fixed.Int26_6(x * 64),
 		Y: fixed.Int26_6(y * 64),
 	}
 	d := &font.Drawer{
-		Dst:  img.(*image.RGBA),
+		Dst:  img.(draw.Image),
 		Src:  image.NewUniform(col),
-		Face: basicfont.Face7x13,
+		Face: face,
 		Dot:  point,
 	}
 	d.DrawString(text)
 }
 
+// Border draws a BORDER_SINGLE or BORDER_DOUBLE line just inside the edge of
+// the rectangle.
+func (c *Callout) Border(img image.Image, r image.Rectangle, style string, col color.RGBA) {
+	x1, y1, x2, y2 := r.Min.X, r.Min.Y, r.Max.X-1, r.Max.Y-1
+	switch style {
+	case BORDER_DOUBLE:
+		c.Rectangle(x1, y1, x2, y2, img, col)
+		c.Rectangle(x1+1, y1+1, x2-1, y2-1, img, col)
+	case BORDER_SINGLE:
+		c.Rectangle(x1, y1, x2, y2, img, col)
+	}
+}
+
 // HorizontalLine draws a horizontal line on the image.
 func (c *Callout) HorizontalLine(x1, y, x2 int, img image.Image, col color.RGBA) {
 	for ; x1 <= x2; x1++ {
@@ -49,3 +75,66 @@ func (c *Callout) Rectangle(x1, y1, x2, y2 int, img image.Image, border color.RG
 	c.VerticalLine(x1, y1, y2, img, border)
 	c.VerticalLine(x2, y1, y2, img, border)
 }
+
+// ThickLine draws a line of the given width, in pixels, from (x1, y1) to
+// (x2, y2) on the image.
+func (c *Callout) ThickLine(img image.Image, x1, y1, x2, y2 float64, width int, col color.RGBA) {
+	r := float64(width) / 2
+	length := math.Hypot(x2-x1, y2-y1)
+	steps := int(math.Ceil(length * 2))
+	for i := 0; i <= steps; i++ {
+		t := 0.0
+		if steps > 0 {
+			t = float64(i) / float64(steps)
+		}
+		c.FillCircle(img, x1+t*(x2-x1), y1+t*(y2-y1), r, col)
+	}
+}
+
+// FillCircle fills a circle with the given radius around (x, y) on the image.
+// A radius under 1 fills the single pixel.
+func (c *Callout) FillCircle(img image.Image, x, y, radius float64, col color.RGBA) {
+	canSet, ok := img.(drawing.CanSet)
+	if !ok {
+		return
+	}
+	if radius < 1 {
+		canSet.Set(int(math.Round(x)), int(math.Round(y)), col)
+		return
+	}
+	for py := int(math.Floor(y - radius)); py <= int(math.Ceil(y+radius)); py++ {
+		for px := int(math.Floor(x - radius)); px <= int(math.Ceil(x+radius)); px++ {
+			if math.Hypot(float64(px)-x, float64(py)-y) <= radius {
+				canSet.Set(px, py, col)
+			}
+		}
+	}
+}
+
+// FillTriangle fills the triangle with the given corners on the image.
+func (c *Callout) FillTriangle(img image.Image, pts [3][2]float64, col color.RGBA) {
+	canSet, ok := img.(drawing.CanSet)
+	if !ok {
+		return
+	}
+	minX := math.Min(pts[0][0], math.Min(pts[1][0], pts[2][0]))
+	maxX := math.Max(pts[0][0], math.Max(pts[1][0], pts[2][0]))
+	minY := math.Min(pts[0][1], math.Min(pts[1][1], pts[2][1]))
+	maxY := math.Max(pts[0][1], math.Max(pts[1][1], pts[2][1]))
+
+	// Which side of the edge from a to b the point is on
+	side := func(a, b [2]float64, x, y float64) float64 {
+		return (b[0]-a[0])*(y-a[1]) - (b[1]-a[1])*(x-a[0])
+	}
+	for py := int(math.Floor(minY)); py <= int(math.Ceil(maxY)); py++ {
+		for px := int(math.Floor(minX)); px <= int(math.Ceil(maxX)); px++ {
+			x, y := float64(px), float64(py)
+			d1, d2, d3 := side(pts[0], pts[1], x, y), side(pts[1], pts[2], x, y), side(pts[2], pts[0], x, y)
+			neg := d1 < 0 || d2 < 0 || d3 < 0
+			pos := d1 > 0 || d2 > 0 || d3 > 0
+			if !(neg && pos) {
+				canSet.Set(px, py, col)
+			}
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package callout
+
+import (
+	"fmt"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"strings"
+)
+
+// SheetWidth is the width, in inches, of the sheets the asbuilts are drawn
+// on (11x17, landscape). It's used to work out the DPI of a scan when we
+// aren't told it.
+const SheetWidth = 17.0
+
+// goRegular is the font used when no other is loaded
+var goRegular *opentype.Font
+
+func init() {
+	var err error
+	if goRegular, err = opentype.Parse(goregular.TTF); err != nil {
+		panic(err)
+	}
+}
+
+// DefaultFont returns the default callout font: Go Regular at 5 points,
+// sized for the DPI of the scan.
+func DefaultFont() Font {
+	return Font{Size: 5}
+}
+
+// LoadFont reads a TrueType or OpenType font file, for the Typeface of a
+// Font.
+func LoadFont(path string) (*opentype.Font, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading font: %v", err)
+	}
+	f, err := opentype.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing font %s: %v", path, err)
+	}
+	return f, nil
+}
+
+// Validate checks the font sizes make sense
+func (f Font) Validate() error {
+	if f.Size < 0 || f.DPI < 0 {
+		return fmt.Errorf("font size and DPI can't be negative")
+	}
+	return nil
+}
+
+// withDefaults returns the font with any empty fields set from the default
+func (f Font) withDefaults() Font {
+	def := DefaultFont()
+	if f.Typeface == nil {
+		f.Typeface = goRegular
+	}
+	if f.Size == 0 {
+		f.Size = def.Size
+	}
+	return f
+}
+
+// ScanDPI returns the DPI of a scan of the given width in pixels: the font's
+// DPI if it's set, or else worked out taking the scan to be SheetWidth inches
+// wide.
+func (f Font) ScanDPI(width int) float64 {
+	if f.DPI != 0 {
+		return f.DPI
+	}
+	return float64(width) / SheetWidth
+}
+
+// newFace makes the face to draw text with on an image of the given width,
+// falling back to a fixed size font if the font can't be used.
+func (f Font) newFace(width int) font.Face {
+	f = f.withDefaults()
+	face, err := opentype.NewFace(f.Typeface, &opentype.FaceOptions{
+		Size:    f.Size,
+		DPI:     f.ScanDPI(width),
+		Hinting: font.HintingFull,
+	})
+	if err != nil {
+		return basicfont.Face7x13
+	}
+	return face
+}
+
+// SetFont sets the font of the text in the callout. The callout is laid out
+// again, so it must be set before CreateCallout.
+func (c *Callout) SetFont(f Font) {
+	c.font = f
+	c.layOut()
+}
+
+// TextSize returns the size of the callout text in points: the template's
+// font size if it has one, or else the callout's.
+func (c *Callout) TextSize() float64 {
+	if c.template.Font.Size != 0 {
+		return c.template.Font.Size
+	}
+	return c.font.withDefaults().Size
+}
+
+// textWidth returns the width in pixels of the text
+func textWidth(face font.Face, text string) int {
+	return font.MeasureString(face, text).Ceil()
+}
+
+// lineHeight returns the distance in pixels between lines of text
+func lineHeight(face font.Face) int {
+	return face.Metrics().Height.Ceil()
+}
+
+// wrap breaks the text into lines that fit in the width, breaking between
+// words. A word too long for a line on its own gets a line to itself.
+func wrap(face font.Face, text string, width int) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		if line == "" {
+			line = word
+			continue
+		}
+		if textWidth(face, line+" "+word) <= width {
+			line += " " + word
+			continue
+		}
+		lines = append(lines, line)
+		line = word
+	}
+	return append(lines, line)
+}
+
+// AddTextCentered adds the lines of text to the image, each one centered
+// across r and the block of them centered down it.
+func (c *Callout) AddTextCentered(img image.Image, r image.Rectangle, lines []string, col color.RGBA) {
+	c.addLines(img, c.face, r, lines, ALIGN_CENTER, col)
+}
+
+// addLines adds the lines of text to the image in the face, aligned across r
+// and centered down it.
+func (c *Callout) addLines(img image.Image, face font.Face, r image.Rectangle, lines []string, align string, col color.RGBA) {
+	height := len(lines) * lineHeight(face)
+	y := r.Min.Y + (r.Dy()-height)/2 + face.Metrics().Ascent.Ceil()
+	for _, line := range lines {
+		var x int
+		switch align {
+		case ALIGN_LEFT:
+			x = r.Min.X
+		case ALIGN_RIGHT:
+			x = r.Max.X - textWidth(face, line)
+		default:
+			x = r.Min.X + (r.Dx()-textWidth(face, line))/2
+		}
+		drawText(img, face, x, y, line, col)
+		y += lineHeight(face)
+	}
+}
@@ -0,0 +1,156 @@
+package callout
+
+import (
+	"caddae/drawing"
+	"caddae/types"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/font/gofont/goregular"
+	"image"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// longProduction returns a production with a unit description too long for
+// one line
+func longProduction() *types.Production {
+	p := testProduction(1)
+	p.Units = append(p.Units, types.Unit{
+		Name:  "C300-02",
+		Qty:   "250",
+		Text:  "C300-02 = 250' of 144 count fiber lashed to the existing strand",
+		Color: drawing.Blue,
+	})
+	return p
+}
+
+func TestWrap(t *testing.T) {
+	c := New(longProduction(), testRunning())
+	width := c.layout.cells[0].rect.Dx() - 2*c.layout.padding
+
+	lines := wrap(c.face, longProduction().Units[1].Text, width)
+	if len(lines) < 2 {
+		t.Fatalf("wrapped into %d lines, want more than one: %q", len(lines), lines)
+	}
+	for _, line := range lines {
+		if w := textWidth(c.face, line); w > width {
+			t.Errorf("line %q is %d pixels wide, want at most %d", line, w, width)
+		}
+	}
+
+	if lines := wrap(c.face, "C300-01 = 100'", width); len(lines) != 1 {
+		t.Errorf("short text wrapped into %q, want one line", lines)
+	}
+	if lines := wrap(c.face, "a C300-01C300-01C300-01C300-01C300-01 b", width); len(lines) != 3 {
+		t.Errorf("text with a long word wrapped into %q, want the word on its own line", lines)
+	}
+}
+
+func TestLongUnitText(t *testing.T) {
+	img := testRunning()
+	short := New(testProduction(2), img)
+	long := New(longProduction(), img)
+	if long.Size().Y <= short.Size().Y {
+		t.Errorf("callout with long text is %d pixels tall, want more than %d", long.Size().Y, short.Size().Y)
+	}
+
+	if err := long.CreateCallout(); err != nil {
+		t.Fatalf("CreateCallout: %v", err)
+	}
+	// The last box should fit on the canvas, with its border inside it
+	if bottom := long.layout.cells[len(long.layout.cells)-1].rect.Max.Y; bottom >= long.Size().Y-2 {
+		t.Errorf("last box ends at %d, past the bottom of the %d pixel canvas", bottom, long.Size().Y)
+	}
+	if got := countBoxes(long); got != 2 {
+		t.Errorf("callout shows %d production boxes, want 2", got)
+	}
+}
+
+func TestFontScales(t *testing.T) {
+	small := New(testProduction(1), testRunning())
+	big := New(testProduction(1), image.NewRGBA(image.Rect(0, 0, 7000, 4530)))
+
+	// Twice the DPI should be about twice the size
+	ratio := float64(lineHeight(big.face)) / float64(lineHeight(small.face))
+	if ratio < 1.8 || ratio > 2.3 {
+		t.Errorf("line height %d on the big scan, %d on the small one, want about twice", lineHeight(big.face), lineHeight(small.face))
+	}
+
+	// Giving the DPI overrides the width of the image
+	small.SetFont(Font{Size: 5, DPI: 7000 / SheetWidth})
+	if lineHeight(small.face) != lineHeight(big.face) {
+		t.Errorf("line height at the big scan's DPI = %d, want %d", lineHeight(small.face), lineHeight(big.face))
+	}
+
+	// Bigger text needs a bigger callout
+	before := small.Size()
+	small.SetFont(Font{Size: 20})
+	if after := small.Size(); after.Y <= before.Y {
+		t.Errorf("callout with 20 point text is %v, want taller than %v", after, before)
+	}
+}
+
+func TestAddTextCentered(t *testing.T) {
+	img := testRunning()
+	c := New(testProduction(1), img)
+	r := image.Rect(100, 100, 400, 200)
+	c.AddTextCentered(img, r, []string{"07/16/2021"}, drawing.Black)
+
+	// Find the ink of the text
+	ink := image.Rectangle{}
+	for y := 0; y < 300; y++ {
+		for x := 0; x < 500; x++ {
+			if img.RGBAAt(x, y) != drawing.White {
+				ink = ink.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	if !ink.In(r) {
+		t.Fatalf("text drawn at %v, want it inside %v", ink, r)
+	}
+	if left, right := ink.Min.X-r.Min.X, r.Max.X-ink.Max.X; abs(left-right) > 3 {
+		t.Errorf("text is %d pixels from the left and %d from the right, want it centered", left, right)
+	}
+	if top, bottom := ink.Min.Y-r.Min.Y, r.Max.Y-ink.Max.Y; abs(top-bottom) > 4 {
+		t.Errorf("text is %d pixels from the top and %d from the bottom, want it centered", top, bottom)
+	}
+}
+
+func TestLoadFont(t *testing.T) {
+	dir := t.TempDir()
+	ttf := filepath.Join(dir, "goregular.ttf")
+	if err := ioutil.WriteFile(ttf, goregular.TTF, 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := LoadFont(ttf)
+	if err != nil {
+		t.Fatalf("LoadFont: %v", err)
+	}
+
+	img := testRunning()
+	c := New(testProduction(1), img)
+	c.SetFont(Font{Typeface: f})
+	if c.face == basicfont.Face7x13 {
+		t.Error("loaded font couldn't be used")
+	}
+	if err := c.CreateCallout(); err != nil {
+		t.Fatalf("CreateCallout: %v", err)
+	}
+
+	notFont := filepath.Join(dir, "notes.txt")
+	if err := ioutil.WriteFile(notFont, []byte("not a font"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{notFont, filepath.Join(dir, "missing.ttf")} {
+		if _, err := LoadFont(path); err == nil {
+			t.Errorf("LoadFont(%s) succeeded, want an error", filepath.Base(path))
+		}
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,128 @@
+package callout
+
+import (
+	"caddae/drawing"
+	"fmt"
+	"image"
+	"math"
+)
+
+// DefaultLeader returns the default leader style: a black, filled arrow to
+// the nearest point of the work.
+func DefaultLeader() Leader {
+	return Leader{
+		Head:     HEAD_FILLED,
+		HeadSize: 16,
+		Color:    drawing.Black,
+		Weight:   2,
+		Target:   TO_NEAREST,
+	}
+}
+
+// withDefaults returns the leader with any empty fields set from the default
+func (l Leader) withDefaults() Leader {
+	def := DefaultLeader()
+	if l.Head == "" {
+		l.Head = def.Head
+	}
+	if l.HeadSize == 0 {
+		l.HeadSize = def.HeadSize
+	}
+	if l.Color.A == 0 {
+		l.Color = def.Color
+	}
+	if l.Weight == 0 {
+		l.Weight = def.Weight
+	}
+	if l.Target == "" {
+		l.Target = def.Target
+	}
+	return l
+}
+
+// Validate checks the leader style is one we can draw
+func (l Leader) Validate() error {
+	switch l.Head {
+	case "", HEAD_FILLED, HEAD_OPEN, HEAD_DOT, HEAD_NONE:
+	default:
+		return fmt.Errorf("unknown arrowhead '%s', want %s, %s, %s or %s", l.Head, HEAD_FILLED, HEAD_OPEN, HEAD_DOT, HEAD_NONE)
+	}
+	switch l.Target {
+	case "", TO_NEAREST, TO_CENTROID:
+	default:
+		return fmt.Errorf("unknown leader target '%s', want %s or %s", l.Target, TO_NEAREST, TO_CENTROID)
+	}
+	if l.Weight < 0 || l.HeadSize < 0 {
+		return fmt.Errorf("leader weight and head size can't be negative")
+	}
+	return nil
+}
+
+// SetLeader sets the style of the leader arrow
+func (c *Callout) SetLeader(l Leader) {
+	c.arrow = l
+}
+
+// AddLeader draws an arrow on the image from the nearest edge of the callout
+// to the work it describes, once the callout has been added. The work is the
+// points along the lines drawn for the callout's production.
+func (c *Callout) AddLeader(img image.Image, work []image.Point) {
+	l := c.arrow.withDefaults()
+	if l.Hide || len(work) == 0 || c.box.Empty() {
+		return
+	}
+
+	// Where the arrow points
+	var tipX, tipY float64
+	if l.Target == TO_CENTROID {
+		for _, p := range work {
+			tipX += float64(p.X)
+			tipY += float64(p.Y)
+		}
+		tipX, tipY = tipX/float64(len(work)), tipY/float64(len(work))
+	} else {
+		best := math.Inf(1)
+		for _, p := range work {
+			if d := distance(c.box, []image.Point{p}); d < best {
+				best, tipX, tipY = d, float64(p.X), float64(p.Y)
+			}
+		}
+	}
+
+	// The arrow starts from the closest point on the edge of the callout
+	startX := math.Max(float64(c.box.Min.X), math.Min(tipX, float64(c.box.Max.X-1)))
+	startY := math.Max(float64(c.box.Min.Y), math.Min(tipY, float64(c.box.Max.Y-1)))
+
+	dx, dy := tipX-startX, tipY-startY
+	length := math.Hypot(dx, dy)
+	if length < float64(l.HeadSize) {
+		// Too close to be worth an arrow
+		return
+	}
+	// Unit vectors along the arrow and across it
+	ux, uy := dx/length, dy/length
+	nx, ny := -uy, ux
+
+	size := float64(l.HeadSize)
+	half := size / 3
+	baseX, baseY := tipX-ux*size, tipY-uy*size
+
+	switch l.Head {
+	case HEAD_FILLED:
+		c.ThickLine(img, startX, startY, baseX, baseY, l.Weight, l.Color)
+		c.FillTriangle(img, [3][2]float64{
+			{tipX, tipY},
+			{baseX + nx*half, baseY + ny*half},
+			{baseX - nx*half, baseY - ny*half},
+		}, l.Color)
+	case HEAD_OPEN:
+		c.ThickLine(img, startX, startY, tipX, tipY, l.Weight, l.Color)
+		c.ThickLine(img, tipX, tipY, baseX+nx*half, baseY+ny*half, l.Weight, l.Color)
+		c.ThickLine(img, tipX, tipY, baseX-nx*half, baseY-ny*half, l.Weight, l.Color)
+	case HEAD_DOT:
+		c.ThickLine(img, startX, startY, tipX, tipY, l.Weight, l.Color)
+		c.FillCircle(img, tipX, tipY, half, l.Color)
+	default:
+		c.ThickLine(img, startX, startY, tipX, tipY, l.Weight, l.Color)
+	}
+}
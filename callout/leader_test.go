@@ -0,0 +1,130 @@
+package callout
+
+import (
+	"caddae/drawing"
+	"image"
+	"testing"
+)
+
+// placedCallout returns a callout added to a blank image at (100, 200)
+func placedCallout(t *testing.T, l Leader) (*Callout, *image.RGBA) {
+	img := testRunning()
+	c := New(testProduction(1), img)
+	c.SetLeader(l)
+	if err := c.CreateCallout(); err != nil {
+		t.Fatalf("CreateCallout: %v", err)
+	}
+	c.AddCalloutAt(img, image.Pt(100, 200))
+	return c, img
+}
+
+func TestAddLeader(t *testing.T) {
+	for _, head := range []string{HEAD_FILLED, HEAD_OPEN, HEAD_DOT, HEAD_NONE} {
+		l := DefaultLeader()
+		l.Head = head
+		l.Color = drawing.Red
+		c, img := placedCallout(t, l)
+
+		// Work off to the right of the callout, level with its middle
+		box := image.Rectangle{Min: image.Pt(100, 200), Max: image.Pt(100, 200).Add(c.Size())}
+		mid := (box.Min.Y + box.Max.Y) / 2
+		tip := image.Pt(box.Max.X+200, mid)
+		c.AddLeader(img, []image.Point{tip, {box.Max.X + 400, mid + 300}})
+
+		if got := img.RGBAAt(box.Max.X+100, mid); got != drawing.Red {
+			t.Errorf("%s: pixel halfway along the leader = %v, want %v", head, got, drawing.Red)
+		}
+		if got := img.RGBAAt(tip.X-1, tip.Y); got != drawing.Red {
+			t.Errorf("%s: pixel at the tip = %v, want %v", head, got, drawing.Red)
+		}
+		if got := img.RGBAAt(tip.X+20, tip.Y); got != drawing.White {
+			t.Errorf("%s: pixel past the tip = %v, want %v", head, got, drawing.White)
+		}
+
+		// Only the arrowheads are wider than the line
+		wide := img.RGBAAt(tip.X-14, tip.Y-4) == drawing.Red || img.RGBAAt(tip.X-2, tip.Y-4) == drawing.Red
+		if want := head != HEAD_NONE; wide != want {
+			t.Errorf("%s: drew an arrowhead = %v, want %v", head, wide, want)
+		}
+	}
+}
+
+func TestAddLeaderCentroid(t *testing.T) {
+	l := DefaultLeader()
+	l.Target = TO_CENTROID
+	c, img := placedCallout(t, l)
+
+	// Work above and below the middle of the callout, off to the right
+	mid := 200 + c.Size().Y/2
+	c.AddLeader(img, []image.Point{{1000, mid - 200}, {1000, mid + 200}})
+	if got := img.RGBAAt(999, mid); got != l.Color {
+		t.Errorf("pixel at the centroid = %v, want %v", got, l.Color)
+	}
+	if got := img.RGBAAt(999, mid-200); got != drawing.White {
+		t.Errorf("pixel at the nearest point = %v, want %v", got, drawing.White)
+	}
+}
+
+func TestAddLeaderNothing(t *testing.T) {
+	white := func(img *image.RGBA, r image.Rectangle) bool {
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				if img.RGBAAt(x, y) != drawing.White {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	right := image.Rect(800, 0, 3400, 2200)
+
+	c, img := placedCallout(t, Leader{Hide: true})
+	c.AddLeader(img, []image.Point{{1500, 300}})
+	if !white(img, right) {
+		t.Error("drew a leader when it's hidden")
+	}
+
+	c, img = placedCallout(t, Leader{})
+	c.AddLeader(img, nil)
+	if !white(img, right) {
+		t.Error("drew a leader without any work")
+	}
+
+	// Not added to the image yet, so there's nowhere to start from
+	img = testRunning()
+	c = New(testProduction(1), img)
+	c.AddLeader(img, []image.Point{{1500, 300}})
+	if !white(img, img.Bounds()) {
+		t.Error("drew a leader before the callout was added")
+	}
+}
+
+func TestLeaderValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		l       Leader
+		wantErr bool
+	}{
+		{"empty", Leader{}, false},
+		{"default", DefaultLeader(), false},
+		{"open", Leader{Head: HEAD_OPEN, Target: TO_CENTROID}, false},
+		{"head", Leader{Head: "star"}, true},
+		{"target", Leader{Target: "furthest"}, true},
+		{"weight", Leader{Weight: -1}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.l.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLeaderDefaults(t *testing.T) {
+	if got, want := (Leader{}).withDefaults(), DefaultLeader(); got != want {
+		t.Errorf("empty leader = %+v, want %+v", got, want)
+	}
+	l := Leader{Head: HEAD_DOT, Weight: 5}
+	if got := l.withDefaults(); got.Head != HEAD_DOT || got.Weight != 5 || got.HeadSize != DefaultLeader().HeadSize {
+		t.Errorf("leader with some fields set = %+v, want the rest from the default", got)
+	}
+}
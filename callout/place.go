@@ -0,0 +1,292 @@
+package callout
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// inkCell is the size, in pixels, of the square cells we count ink in when
+// looking for somewhere to put the callout. Candidate positions are on a grid
+// of these, two cells apart.
+const inkCell = 4
+
+// inkLevel is the brightest a channel can be for the pixel to count as ink,
+// so black linework and colored notes both count.
+const inkLevel = 0xc8
+
+// clearance is the space, in pixels, around the callout that we'd like to
+// keep clear of linework.
+const clearance = 8
+
+// distanceCost is how much we care about the callout being near the work
+// compared to how much it covers up: each pixel further from the work costs
+// the same as covering this many pixels of ink. So a callout would rather
+// move a few hundred pixels than cover a line, but would rather cover a bit
+// of text than end up on the other side of the sheet.
+const distanceCost = 1.0
+
+// searchRadius is how far, in pixels, from the work we first look for
+// somewhere to put the callout. It's doubled each time nothing near enough
+// is found.
+const searchRadius = 256
+
+// frameLength is the fraction of the sheet a row or column of ink has to
+// cover to count as the sheet border, and frameSearch is how far in from the
+// edge of the image we look for it.
+const (
+	frameLength = 0.5
+	frameSearch = 0.15
+)
+
+// inkMap counts the ink on an image, so we can quickly tell how much of it a
+// callout would cover.
+type inkMap struct {
+	// Summed area table of the ink pixels in each cell, with an extra row
+	// and column of zeros at the top and left.
+	sum  []int
+	w, h int
+
+	// The inside of the sheet border, in pixels
+	frame image.Rectangle
+}
+
+// Place returns the top left position for the callout on the image: the
+// emptiest spot inside the sheet border that is near the work.
+//
+// The work is the points along the lines drawn for the callout's production,
+// which the callout won't cover. It won't overlap any of the avoid rectangles
+// either, like the callouts added by earlier passes. If there's no work, the
+// callout is placed near its default Position. If it doesn't fit anywhere, ok
+// is false.
+//
+// Rather than trying every spot on the sheet, we start with the ones within
+// searchRadius of the work's bounding box. A spot further out than that costs
+// at least as much as the distance alone, so if we've found one cheaper than
+// the radius, nothing outside could beat it. Otherwise the radius is doubled
+// and we look again, until the window covers the whole sheet.
+func (c *Callout) Place(img image.Image, work []image.Point, avoid []image.Rectangle) (pt image.Point, ok bool) {
+	size := c.Size()
+	target := work
+	if len(work) == 0 {
+		target = []image.Point{c.Position(img).Add(size.Div(2))}
+	}
+
+	m := newInkMap(img)
+
+	// The spots the top left of the callout can go, inside the border
+	spots := image.Rect(m.frame.Min.X, m.frame.Min.Y, m.frame.Max.X-size.X+1, m.frame.Max.Y-size.Y+1)
+	if spots.Empty() {
+		return pt, false
+	}
+
+	box := bounds(target)
+	for radius := searchRadius; ; radius *= 2 {
+		// The spots whose clearance comes within the radius of the work
+		pad := clearance + radius
+		window := image.Rect(box.Min.X-size.X-pad, box.Min.Y-size.Y-pad, box.Max.X+pad, box.Max.Y+pad).Intersect(spots)
+
+		var cost float64
+		pt, cost, ok = c.search(m, window, target, len(work) > 0, avoid)
+		if (ok && cost < float64(radius)) || window == spots {
+			return pt, ok
+		}
+	}
+}
+
+// search returns the cheapest top left position for the callout within the
+// window, on the grid of candidate positions across the sheet, and what it
+// costs: the ink it covers plus its distance from the target points. If
+// covering is set, positions covering one of the points are skipped.
+func (c *Callout) search(m *inkMap, window image.Rectangle, target []image.Point, covering bool, avoid []image.Rectangle) (pt image.Point, best float64, ok bool) {
+	size := c.Size()
+	best = math.Inf(1)
+
+	// Line the window up with the grid, so every window tries the same spots
+	step := 2 * inkCell
+	x0 := m.frame.Min.X + (window.Min.X-m.frame.Min.X+step-1)/step*step
+	y0 := m.frame.Min.Y + (window.Min.Y-m.frame.Min.Y+step-1)/step*step
+
+	for y := y0; y < window.Max.Y; y += step {
+		for x := x0; x < window.Max.X; x += step {
+			r := image.Rectangle{Min: image.Pt(x, y), Max: image.Pt(x+size.X, y+size.Y)}
+			if overlapsAny(r, avoid) {
+				continue
+			}
+
+			// Never cover the work itself
+			clear := r.Inset(-clearance)
+			d := distance(clear, target)
+			if d == 0 && covering {
+				continue
+			}
+
+			cost := float64(m.ink(clear)) + distanceCost*d
+			if cost < best {
+				best, pt, ok = cost, r.Min, true
+			}
+		}
+	}
+	return pt, best, ok
+}
+
+// Corner returns the top left position for the callout in a corner of the
+// image, just inside the sheet border. A stamp put in the same corner every
+// time covers up the one before it, as long as it's at least as big.
+func (c *Callout) Corner(img image.Image, corner string) (image.Point, error) {
+	if err := ValidCorner(corner); err != nil {
+		return image.Point{}, err
+	}
+
+	frame := newInkMap(img).frame.Inset(clearance)
+	size := c.Size()
+	switch corner {
+	case CORNER_TOP_LEFT:
+		return frame.Min, nil
+	case CORNER_TOP_RIGHT:
+		return image.Pt(frame.Max.X-size.X, frame.Min.Y), nil
+	case CORNER_BOTTOM_LEFT:
+		return image.Pt(frame.Min.X, frame.Max.Y-size.Y), nil
+	default:
+		return frame.Max.Sub(size), nil
+	}
+}
+
+// ValidCorner checks the corner is one a stamp can go in
+func ValidCorner(corner string) error {
+	switch corner {
+	case CORNER_TOP_LEFT, CORNER_TOP_RIGHT, CORNER_BOTTOM_LEFT, CORNER_BOTTOM_RIGHT:
+		return nil
+	}
+	return fmt.Errorf("unknown corner '%s', must be one of %s, %s, %s or %s",
+		corner, CORNER_TOP_LEFT, CORNER_TOP_RIGHT, CORNER_BOTTOM_LEFT, CORNER_BOTTOM_RIGHT)
+}
+
+// newInkMap counts the ink in the image, and finds the sheet border.
+func newInkMap(img image.Image) *inkMap {
+	bnds := img.Bounds()
+	m := inkMap{
+		w: (bnds.Dx() + inkCell - 1) / inkCell,
+		h: (bnds.Dy() + inkCell - 1) / inkCell,
+	}
+	cells := make([]int, m.w*m.h)
+	rows, cols := make([]int, bnds.Dy()), make([]int, bnds.Dx())
+
+	rgba, isRGBA := img.(*image.RGBA)
+	for y := 0; y < bnds.Dy(); y++ {
+		for x := 0; x < bnds.Dx(); x++ {
+			var c color.RGBA
+			if isRGBA {
+				c = rgba.RGBAAt(bnds.Min.X+x, bnds.Min.Y+y)
+			} else {
+				c = color.RGBAModel.Convert(img.At(bnds.Min.X+x, bnds.Min.Y+y)).(color.RGBA)
+			}
+			if c.R < inkLevel || c.G < inkLevel || c.B < inkLevel {
+				cells[(y/inkCell)*m.w+x/inkCell]++
+				rows[y]++
+				cols[x]++
+			}
+		}
+	}
+
+	// Summed area table, so the ink in any block of cells is four lookups
+	m.sum = make([]int, (m.w+1)*(m.h+1))
+	for y := 0; y < m.h; y++ {
+		for x := 0; x < m.w; x++ {
+			m.sum[(y+1)*(m.w+1)+x+1] = cells[y*m.w+x] + m.sum[y*(m.w+1)+x+1] + m.sum[(y+1)*(m.w+1)+x] - m.sum[y*(m.w+1)+x]
+		}
+	}
+
+	top, bottom := border(rows, bnds.Dx())
+	left, right := border(cols, bnds.Dy())
+	m.frame = image.Rect(left, top, right, bottom).Add(bnds.Min)
+	return &m
+}
+
+// border finds the sheet border in the ink counts of each row (or column),
+// where length is the length of a row. It returns the first and last rows
+// inside the border, or the whole image if there isn't one.
+func border(counts []int, length int) (int, int) {
+	long := func(i int) bool { return float64(counts[i]) >= frameLength*float64(length) }
+	n := len(counts)
+	search := int(float64(n) * frameSearch)
+
+	start, end := 0, n
+	for i := 0; i < search; i++ {
+		if long(i) {
+			// Skip past the thickness of the border line
+			for i < search && long(i) {
+				i++
+			}
+			start = i
+			break
+		}
+	}
+	for i := n - 1; i >= n-search; i-- {
+		if long(i) {
+			for i >= n-search && long(i) {
+				i--
+			}
+			end = i + 1
+			break
+		}
+	}
+	return start, end
+}
+
+// ink returns the number of ink pixels in the rectangle. Parts of the
+// rectangle outside the image count as ink.
+func (m *inkMap) ink(r image.Rectangle) int {
+	// Round out to whole cells
+	x0, y0 := floorDiv(r.Min.X, inkCell), floorDiv(r.Min.Y, inkCell)
+	x1, y1 := floorDiv(r.Max.X+inkCell-1, inkCell), floorDiv(r.Max.Y+inkCell-1, inkCell)
+	cells := (x1 - x0) * (y1 - y0)
+
+	inside := image.Rect(x0, y0, x1, y1).Intersect(image.Rect(0, 0, m.w, m.h))
+	ink := (cells - inside.Dx()*inside.Dy()) * inkCell * inkCell
+	if !inside.Empty() {
+		at := func(x, y int) int { return m.sum[y*(m.w+1)+x] }
+		ink += at(inside.Max.X, inside.Max.Y) - at(inside.Min.X, inside.Max.Y) - at(inside.Max.X, inside.Min.Y) + at(inside.Min.X, inside.Min.Y)
+	}
+	return ink
+}
+
+// distance returns how far the rectangle is from the closest point, or 0 if
+// one of the points is inside it.
+func distance(r image.Rectangle, points []image.Point) float64 {
+	best := math.Inf(1)
+	for _, p := range points {
+		dx := math.Max(0, math.Max(float64(r.Min.X-p.X), float64(p.X-r.Max.X)))
+		dy := math.Max(0, math.Max(float64(r.Min.Y-p.Y), float64(p.Y-r.Max.Y)))
+		best = math.Min(best, math.Hypot(dx, dy))
+	}
+	return best
+}
+
+// bounds returns the smallest rectangle holding all of the points
+func bounds(points []image.Point) image.Rectangle {
+	var r image.Rectangle
+	for _, p := range points {
+		r = r.Union(image.Rectangle{Min: p, Max: p.Add(image.Pt(1, 1))})
+	}
+	return r
+}
+
+// overlapsAny checks if the rectangle overlaps any of the others
+func overlapsAny(r image.Rectangle, others []image.Rectangle) bool {
+	for _, o := range others {
+		if r.Overlaps(o) {
+			return true
+		}
+	}
+	return false
+}
+
+// floorDiv divides, rounding down rather than towards zero
+func floorDiv(a, b int) int {
+	if a < 0 {
+		return -((-a + b - 1) / b)
+	}
+	return a / b
+}
@@ -0,0 +1,154 @@
+package callout
+
+import (
+	"caddae/drawing"
+	"image"
+	"image/draw"
+	"testing"
+)
+
+// testSheet returns a white image the size of the sample asbuilts, with a
+// sheet border 20 pixels in and a title block along the bottom.
+func testSheet() *image.RGBA {
+	img := testRunning()
+	black := &image.Uniform{drawing.Black}
+	for _, r := range []image.Rectangle{
+		image.Rect(20, 20, 3380, 24),
+		image.Rect(20, 2176, 3380, 2180),
+		image.Rect(20, 20, 24, 2180),
+		image.Rect(3376, 20, 3380, 2180),
+		// Title block
+		image.Rect(24, 1900, 3376, 2176),
+	} {
+		draw.Draw(img, r, black, image.Point{}, draw.Src)
+	}
+	return img
+}
+
+func TestPlaceFindsTheGap(t *testing.T) {
+	img := testSheet()
+	// Linework everywhere around the work, except for a gap below it
+	draw.Draw(img, image.Rect(400, 300, 2000, 1500), &image.Uniform{drawing.Black}, image.Point{}, draw.Src)
+	gap := image.Rect(900, 800, 1300, 1100)
+	draw.Draw(img, gap, &image.Uniform{drawing.White}, image.Point{}, draw.Src)
+
+	c := New(testProduction(1), img)
+	pt, ok := c.Place(img, []image.Point{{1100, 700}}, nil)
+	if !ok {
+		t.Fatal("Place found nowhere for the callout")
+	}
+	if r := (image.Rectangle{Min: pt, Max: pt.Add(c.Size())}); !r.In(gap) {
+		t.Errorf("callout placed at %v, want it in the gap %v", r, gap)
+	}
+}
+
+func TestPlaceInsideBorder(t *testing.T) {
+	img := testSheet()
+	c := New(testProduction(1), img)
+
+	// Work in the corner, right by the border
+	pt, ok := c.Place(img, []image.Point{{30, 30}}, nil)
+	if !ok {
+		t.Fatal("Place found nowhere for the callout")
+	}
+	frame := image.Rect(24, 24, 3376, 2176)
+	if r := (image.Rectangle{Min: pt, Max: pt.Add(c.Size())}); !r.In(frame) {
+		t.Errorf("callout placed at %v, want it inside the border %v", r, frame)
+	}
+
+	// Work in the title block, which the callout should stay out of
+	pt, _ = c.Place(img, []image.Point{{1700, 2000}}, nil)
+	if pt.Y+c.Size().Y > 1900 {
+		t.Errorf("callout placed at %v, over the title block", pt)
+	}
+}
+
+func TestPlaceAvoids(t *testing.T) {
+	img := testSheet()
+	c := New(testProduction(1), img)
+	work := []image.Point{{1700, 1000}}
+
+	first, _ := c.Place(img, work, nil)
+	prev := image.Rectangle{Min: first, Max: first.Add(c.Size())}
+	second, ok := c.Place(img, work, []image.Rectangle{prev})
+	if !ok {
+		t.Fatal("Place found nowhere for the second callout")
+	}
+	if r := (image.Rectangle{Min: second, Max: second.Add(c.Size())}); r.Overlaps(prev) {
+		t.Errorf("second callout %v overlaps the first %v", r, prev)
+	}
+
+	if _, ok := c.Place(img, work, []image.Rectangle{img.Bounds()}); ok {
+		t.Error("Place found room when everything is to be avoided")
+	}
+}
+
+// TestPlaceWindow checks searching near the work first finds the same spot
+// as searching the whole sheet
+func TestPlaceWindow(t *testing.T) {
+	img := testSheet()
+	draw.Draw(img, image.Rect(400, 300, 2000, 1500), &image.Uniform{drawing.Black}, image.Point{}, draw.Src)
+	c := New(testProduction(1), img)
+	m := newInkMap(img)
+	size := c.Size()
+	spots := image.Rect(m.frame.Min.X, m.frame.Min.Y, m.frame.Max.X-size.X+1, m.frame.Max.Y-size.Y+1)
+
+	for _, work := range [][]image.Point{
+		{{1100, 700}},
+		{{30, 30}},
+		{{1700, 2000}},
+		{{500, 400}, {1900, 1400}},
+	} {
+		got, ok := c.Place(img, work, nil)
+		want, _, wantOK := c.search(m, spots, work, true, nil)
+		if got != want || ok != wantOK {
+			t.Errorf("Place near %v = %v, %t, want %v, %t", work, got, ok, want, wantOK)
+		}
+	}
+}
+
+func TestBorder(t *testing.T) {
+	counts := make([]int, 100)
+	for _, i := range []int{5, 6, 93} {
+		counts[i] = 80
+	}
+	// A long row in the middle isn't the border
+	counts[50] = 100
+
+	if start, end := border(counts, 100); start != 7 || end != 93 {
+		t.Errorf("border = %d, %d, want 7, 93", start, end)
+	}
+	if start, end := border(make([]int, 100), 100); start != 0 || end != 100 {
+		t.Errorf("border without one = %d, %d, want 0, 100", start, end)
+	}
+}
+
+func TestCorner(t *testing.T) {
+	img := testSheet()
+	c := New(testProduction(2), img)
+	c.SetTemplate(TotalsTemplate())
+	size := c.Size()
+
+	// Just inside the border, which is 24 pixels in on each side, and above
+	// the title block
+	inside := image.Rect(24, 24, 3376, 1900).Inset(clearance)
+	for corner, want := range map[string]image.Point{
+		CORNER_TOP_LEFT:     inside.Min,
+		CORNER_TOP_RIGHT:    {inside.Max.X - size.X, inside.Min.Y},
+		CORNER_BOTTOM_LEFT:  {inside.Min.X, inside.Max.Y - size.Y},
+		CORNER_BOTTOM_RIGHT: inside.Max.Sub(size),
+	} {
+		pt, err := c.Corner(img, corner)
+		if err != nil {
+			t.Errorf("Corner(%s): %v", corner, err)
+			continue
+		}
+		if pt != want {
+			t.Errorf("Corner(%s) = %v, want %v", corner, pt, want)
+		}
+	}
+
+	if _, err := c.Corner(img, "middle"); err == nil {
+		t.Errorf("Corner(middle) succeeded")
+	}
+}
@@ -0,0 +1,437 @@
+package callout
+
+import (
+	"bytes"
+	"caddae/drawing"
+	"caddae/types"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// DEFAULT_TEMPLATE is the name of the built in callout template: the date,
+// then a box for each production unit.
+const DEFAULT_TEMPLATE = "default"
+
+// TOTALS_TEMPLATE is the name of the built in template for the job totals
+// stamp: the job, then a box for each production unit's total so far.
+const TOTALS_TEMPLATE = "totals"
+
+// Kinds of template row
+const (
+	ROW_TEXT  = "text"
+	ROW_UNITS = "units"
+)
+
+// Border styles, around the callout or a row
+const (
+	BORDER_DOUBLE = "double"
+	BORDER_SINGLE = "single"
+	BORDER_NONE   = "none"
+)
+
+// Text alignment in a row
+const (
+	ALIGN_LEFT   = "left"
+	ALIGN_CENTER = "center"
+	ALIGN_RIGHT  = "right"
+)
+
+// Template describes the design of a callout: rows of text, stacked top to
+// bottom inside a border.
+//
+// Sizes are fractions of the width of the callout, which is itself a fraction
+// of the width of the running asbuilt, so callouts look the same on any size
+// of scan.
+type Template struct {
+	Name        string
+	Description string
+
+	// Width of the callout, as a fraction of the image width
+	Width float64
+
+	// Space around the rows, between them, and between the edge of a row
+	// and its text
+	Margin  float64
+	Gap     float64
+	Padding float64
+
+	// Style and color of the border around the callout, and its background
+	Border      string
+	BorderColor color.RGBA
+	Background  color.RGBA
+
+	// Font of the text. Fields left empty use the callout's font.
+	Font Font
+
+	Rows []Row
+}
+
+// Row is one row of a callout template.
+type Row struct {
+	// ROW_TEXT (the default) for a single row of text, or ROW_UNITS for a
+	// row for each of the production units
+	Kind string
+
+	// Text of the row, as a Go template. Text rows are given the
+	// types.Production, e.g. "{{.Job}} - {{.Crew}}", and unit rows each
+	// types.Unit, e.g. "{{.Name}} = {{.Qty}}". It's wrapped onto more lines
+	// if it doesn't fit.
+	Text string
+
+	// Background color of the row, none if it's transparent. Unit rows use
+	// the unit's color if it isn't set.
+	Fill color.RGBA
+
+	// Color of the text and the border around the row
+	Color  color.RGBA
+	Border string
+
+	// ALIGN_LEFT, ALIGN_CENTER (the default) or ALIGN_RIGHT
+	Align string
+
+	// Size of the text in points, if it's different to the template's
+	Size float64
+
+	// Smallest height of the row
+	Height float64
+
+	text *template.Template
+}
+
+// Templates is a map of callout templates by name
+type Templates map[string]*Template
+
+// DefaultTemplate returns the built in callout template.
+func DefaultTemplate() *Template {
+	t := Template{
+		Name:        DEFAULT_TEMPLATE,
+		Description: "Work performed date, and a box for each production unit",
+		Width:       0.05,
+		Margin:      0.0625,
+		Gap:         0.055,
+		Padding:     0.045,
+		Border:      BORDER_DOUBLE,
+		BorderColor: drawing.Black,
+		Background:  drawing.White,
+		Rows: []Row{
+			{Kind: ROW_TEXT, Text: "{{.Date}}", Color: drawing.Black, Align: ALIGN_CENTER, Height: 0.245},
+			{Kind: ROW_UNITS, Text: "{{.Text}}", Color: drawing.Black, Border: BORDER_DOUBLE, Align: ALIGN_CENTER, Height: 0.215},
+		},
+	}
+	if err := t.compile(); err != nil {
+		panic(err)
+	}
+	return &t
+}
+
+// TotalsTemplate returns the built in template for the job totals stamp. It's
+// given the totals as a types.Production, with Date being the latest work
+// performed date, and each unit's Design and Percent set.
+func TotalsTemplate() *Template {
+	t := Template{
+		Name:        TOTALS_TEMPLATE,
+		Description: "Job totals so far against the design quantities",
+		Width:       0.09,
+		Margin:      0.035,
+		Gap:         0.03,
+		Padding:     0.025,
+		Border:      BORDER_DOUBLE,
+		BorderColor: drawing.Black,
+		Background:  drawing.White,
+		Rows: []Row{
+			{Kind: ROW_TEXT, Text: "{{.Job}}", Color: drawing.Black, Align: ALIGN_CENTER, Height: 0.12},
+			{Kind: ROW_TEXT, Text: "Totals to {{.Date}}", Color: drawing.Black, Align: ALIGN_CENTER, Height: 0.12},
+			{Kind: ROW_UNITS, Text: "{{.Text}}", Color: drawing.Black, Border: BORDER_SINGLE, Align: ALIGN_LEFT, Height: 0.11},
+		},
+	}
+	if err := t.compile(); err != nil {
+		panic(err)
+	}
+	return &t
+}
+
+// DefaultTemplates returns the templates with only the built in ones: the
+// default callout and the job totals stamp.
+func DefaultTemplates() Templates {
+	return Templates{
+		DEFAULT_TEMPLATE: DefaultTemplate(),
+		TOTALS_TEMPLATE:  TotalsTemplate(),
+	}
+}
+
+// Get returns the named template, or the default template if name is empty.
+func (t Templates) Get(name string) (*Template, error) {
+	if name == "" {
+		name = DEFAULT_TEMPLATE
+	}
+	if tmpl, ok := t[name]; ok {
+		return tmpl, nil
+	}
+	return nil, fmt.Errorf("unknown callout template '%s'", name)
+}
+
+// templateFile is the layout of a callout template file.
+//
+// For example, in YAML:
+//
+//	templates:
+//	  - name: vz
+//	    width: 0.06
+//	    border: single
+//	    rows:
+//	      - text: "{{.Job}}"
+//	        size: 6
+//	      - text: "{{.Date}} - {{.Crew}}"
+//	      - kind: units
+//	        text: "{{.Name}}: {{.Qty}}"
+//	        border: single
+//	        align: left
+type templateFile struct {
+	Templates []templateConfig `json:"templates" yaml:"templates"`
+}
+
+// templateConfig is a template in a template file. Sizes and colors left out
+// are taken from the default template.
+type templateConfig struct {
+	Name        string      `json:"name" yaml:"name"`
+	Description string      `json:"description" yaml:"description"`
+	Width       float64     `json:"width" yaml:"width"`
+	Margin      *float64    `json:"margin" yaml:"margin"`
+	Gap         *float64    `json:"gap" yaml:"gap"`
+	Padding     *float64    `json:"padding" yaml:"padding"`
+	Border      string      `json:"border" yaml:"border"`
+	BorderColor string      `json:"border_color" yaml:"border_color"`
+	Background  string      `json:"background" yaml:"background"`
+	Font        string      `json:"font" yaml:"font"`
+	FontSize    float64     `json:"font_size" yaml:"font_size"`
+	Rows        []rowConfig `json:"rows" yaml:"rows"`
+}
+
+// rowConfig is a row of a template in a template file
+type rowConfig struct {
+	Kind   string  `json:"kind" yaml:"kind"`
+	Text   string  `json:"text" yaml:"text"`
+	Fill   string  `json:"fill" yaml:"fill"`
+	Color  string  `json:"color" yaml:"color"`
+	Border string  `json:"border" yaml:"border"`
+	Align  string  `json:"align" yaml:"align"`
+	Size   float64 `json:"size" yaml:"size"`
+	Height float64 `json:"height" yaml:"height"`
+}
+
+// LoadTemplates loads the callout templates in the given JSON or YAML file.
+// The built in templates are always included, unless the file replaces them.
+// Font files are relative to the template file.
+func LoadTemplates(path string) (Templates, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "os.ReadFile(%s): failed to read callout templates", path)
+	}
+
+	var tf templateFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(b, &tf)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &tf)
+	default:
+		return nil, fmt.Errorf("LoadTemplates(%s): callout templates must be .json, .yaml or .yml", path)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "LoadTemplates(%s): failed to decode callout templates", path)
+	}
+
+	templates := DefaultTemplates()
+	for _, tc := range tf.Templates {
+		tmpl, err := tc.template(filepath.Dir(path))
+		if err != nil {
+			return nil, errors.Wrapf(err, "LoadTemplates(%s)", path)
+		}
+		templates[tmpl.Name] = tmpl
+	}
+	return templates, nil
+}
+
+// template converts the template config into a Template. dir is the folder
+// font files are relative to.
+func (tc templateConfig) template(dir string) (*Template, error) {
+	if tc.Name == "" {
+		return nil, errors.New("callout template is missing a name")
+	}
+
+	def := DefaultTemplate()
+	t := Template{
+		Name:        tc.Name,
+		Description: tc.Description,
+		Width:       def.Width,
+		Margin:      def.Margin,
+		Gap:         def.Gap,
+		Padding:     def.Padding,
+		Border:      def.Border,
+		Font:        Font{Size: tc.FontSize},
+	}
+	if tc.Width != 0 {
+		t.Width = tc.Width
+	}
+	if tc.Margin != nil {
+		t.Margin = *tc.Margin
+	}
+	if tc.Gap != nil {
+		t.Gap = *tc.Gap
+	}
+	if tc.Padding != nil {
+		t.Padding = *tc.Padding
+	}
+	if tc.Border != "" {
+		t.Border = tc.Border
+	}
+
+	var err error
+	if t.BorderColor, err = hexOr(tc.BorderColor, def.BorderColor); err != nil {
+		return nil, errors.Wrapf(err, "template '%s' border_color", tc.Name)
+	}
+	if t.Background, err = hexOr(tc.Background, def.Background); err != nil {
+		return nil, errors.Wrapf(err, "template '%s' background", tc.Name)
+	}
+	if tc.Font != "" {
+		font := tc.Font
+		if !filepath.IsAbs(font) {
+			font = filepath.Join(dir, font)
+		}
+		if t.Font.Typeface, err = LoadFont(font); err != nil {
+			return nil, errors.Wrapf(err, "template '%s'", tc.Name)
+		}
+	}
+
+	for i, rc := range tc.Rows {
+		r := Row{
+			Kind:   rc.Kind,
+			Text:   rc.Text,
+			Border: rc.Border,
+			Align:  rc.Align,
+			Size:   rc.Size,
+			Height: rc.Height,
+		}
+		if r.Kind == "" {
+			r.Kind = ROW_TEXT
+		}
+		if r.Align == "" {
+			r.Align = ALIGN_CENTER
+		}
+		if r.Fill, err = hexOr(rc.Fill, color.RGBA{}); err != nil {
+			return nil, errors.Wrapf(err, "template '%s' row %d fill", tc.Name, i+1)
+		}
+		if r.Color, err = hexOr(rc.Color, drawing.Black); err != nil {
+			return nil, errors.Wrapf(err, "template '%s' row %d color", tc.Name, i+1)
+		}
+		t.Rows = append(t.Rows, r)
+	}
+
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	if err := t.compile(); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Validate checks the template is one we can draw
+func (t *Template) Validate() error {
+	if t.Width <= 0 || t.Width > 1 {
+		return fmt.Errorf("template '%s' width must be more than 0 and at most 1", t.Name)
+	}
+	if t.Margin < 0 || t.Gap < 0 || t.Padding < 0 {
+		return fmt.Errorf("template '%s' margin, gap and padding can't be negative", t.Name)
+	}
+	if err := validBorder(t.Border); err != nil {
+		return fmt.Errorf("template '%s': %v", t.Name, err)
+	}
+	if err := t.Font.Validate(); err != nil {
+		return fmt.Errorf("template '%s': %v", t.Name, err)
+	}
+	if len(t.Rows) == 0 {
+		return fmt.Errorf("template '%s' has no rows", t.Name)
+	}
+	for i, r := range t.Rows {
+		switch r.Kind {
+		case "", ROW_TEXT, ROW_UNITS:
+		default:
+			return fmt.Errorf("template '%s' row %d: unknown kind '%s', want %s or %s", t.Name, i+1, r.Kind, ROW_TEXT, ROW_UNITS)
+		}
+		switch r.Align {
+		case "", ALIGN_LEFT, ALIGN_CENTER, ALIGN_RIGHT:
+		default:
+			return fmt.Errorf("template '%s' row %d: unknown alignment '%s', want %s, %s or %s", t.Name, i+1, r.Align, ALIGN_LEFT, ALIGN_CENTER, ALIGN_RIGHT)
+		}
+		if err := validBorder(r.Border); err != nil {
+			return fmt.Errorf("template '%s' row %d: %v", t.Name, i+1, err)
+		}
+		if r.Size < 0 || r.Height < 0 {
+			return fmt.Errorf("template '%s' row %d: size and height can't be negative", t.Name, i+1)
+		}
+	}
+	return nil
+}
+
+// compile parses the text of each row, and checks it can be filled in from a
+// production.
+func (t *Template) compile() error {
+	sample := types.Production{
+		Date:  "01/02/2006",
+		Job:   "VZ_LAN_00000000",
+		Crew:  "Crew",
+		Units: []types.Unit{{Name: "C300-01", Description: "Strand", Qty: "100", Text: "C300-01 = 100'", Footage: true}},
+	}
+	for i := range t.Rows {
+		r := &t.Rows[i]
+		text, err := template.New(fmt.Sprintf("%s row %d", t.Name, i+1)).Option("missingkey=error").Parse(r.Text)
+		if err != nil {
+			return errors.Wrapf(err, "template '%s' row %d", t.Name, i+1)
+		}
+		r.text = text
+
+		var data interface{} = sample
+		if r.Kind == ROW_UNITS {
+			data = sample.Units[0]
+		}
+		if _, err := r.execute(data); err != nil {
+			return errors.Wrapf(err, "template '%s' row %d", t.Name, i+1)
+		}
+	}
+	return nil
+}
+
+// execute fills in the text of the row
+func (r Row) execute(data interface{}) (string, error) {
+	var b bytes.Buffer
+	if err := r.text.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// validBorder checks the border style is one we know
+func validBorder(style string) error {
+	switch style {
+	case "", BORDER_DOUBLE, BORDER_SINGLE, BORDER_NONE:
+		return nil
+	}
+	return fmt.Errorf("unknown border '%s', want %s, %s or %s", style, BORDER_DOUBLE, BORDER_SINGLE, BORDER_NONE)
+}
+
+// hexOr parses the hex color, or returns def if it's empty
+func hexOr(s string, def color.RGBA) (color.RGBA, error) {
+	if s == "" {
+		return def, nil
+	}
+	return drawing.ParseHex(s)
+}
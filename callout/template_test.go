@@ -0,0 +1,145 @@
+package callout
+
+import (
+	"caddae/drawing"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadTemplatesExample(t *testing.T) {
+	templates, err := LoadTemplates(filepath.Join("..", "templates.example.yaml"))
+	if err != nil {
+		t.Fatalf("LoadTemplates: %v", err)
+	}
+
+	img := testRunning()
+	for _, name := range []string{DEFAULT_TEMPLATE, "dyea", "vz"} {
+		tmpl, err := templates.Get(name)
+		if err != nil {
+			t.Errorf("Get(%s): %v", name, err)
+			continue
+		}
+
+		p := testProduction(2)
+		p.Job, p.Crew = "VZ_LAN_00007054", "Bravo"
+		c := New(p, img)
+		c.SetTemplate(tmpl)
+		if err := c.CreateCallout(); err != nil {
+			t.Errorf("%s: CreateCallout: %v", name, err)
+		}
+		if got := countBoxes(c); name != "vz" && got != 2 {
+			t.Errorf("%s: callout shows %d production boxes, want 2", name, got)
+		}
+	}
+
+	if _, err := templates.Get("dyae"); err == nil {
+		t.Error("Get of a template that doesn't exist succeeded")
+	}
+}
+
+func TestTemplateFields(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "templates.json")
+	data := `{"templates": [{
+		"name": "fields",
+		"rows": [
+			{"text": "{{.Job}}"},
+			{"text": "{{.Crew}}"},
+			{"text": "{{.Footage}}'"},
+			{"kind": "units", "text": "{{.Name}} x {{.Qty}}", "fill": "#f23704", "align": "left"}
+		]
+	}]}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	templates, err := LoadTemplates(path)
+	if err != nil {
+		t.Fatalf("LoadTemplates: %v", err)
+	}
+	tmpl, _ := templates.Get("fields")
+
+	// No crew, so that row is left out
+	p := testProduction(2)
+	p.Units[0].Footage = true
+	p.Units[1].Footage = true
+	p.Job = "VZ_LAN_00007054"
+	c := New(p, testRunning())
+	c.SetTemplate(tmpl)
+	if err := c.CreateCallout(); err != nil {
+		t.Fatalf("CreateCallout: %v", err)
+	}
+
+	var got []string
+	for _, cl := range c.layout.cells {
+		got = append(got, strings.Join(cl.lines, " "))
+	}
+	want := []string{"VZ_LAN_00007054", "200'", "C300-01 x 100", "C300-01 x 100"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("rows = %q, want %q", got, want)
+	}
+
+	// The fill overrides the unit's color
+	last := c.layout.cells[len(c.layout.cells)-1]
+	mid := last.rect.Min.Add(image.Pt(4, last.rect.Dy()/2))
+	if got := c.canvas.(*image.RGBA).RGBAAt(mid.X, mid.Y); got != drawing.Red {
+		t.Errorf("unit row color = %v, want %v", got, drawing.Red)
+	}
+}
+
+func TestTemplateSizes(t *testing.T) {
+	img := testRunning()
+	def := New(testProduction(1), img)
+
+	wide := *DefaultTemplate()
+	wide.Width = 0.1
+	c := New(testProduction(1), img)
+	c.SetTemplate(&wide)
+	if got, want := c.Size().X, 2*def.Size().X; got != want {
+		t.Errorf("callout width with a template twice as wide = %d, want %d", got, want)
+	}
+
+	// Bigger text on the date row makes the callout taller
+	big := *DefaultTemplate()
+	big.Rows = append([]Row(nil), big.Rows...)
+	big.Rows[0].Size = 15
+	c = New(testProduction(1), img)
+	c.SetTemplate(&big)
+	if c.Size().Y <= def.Size().Y {
+		t.Errorf("callout with a big date is %v, want taller than %v", c.Size(), def.Size())
+	}
+}
+
+func TestLoadTemplatesErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		data  string
+		error string
+	}{
+		{"bad extension", "templates.txt", "", "must be .json, .yaml or .yml"},
+		{"no name", "t.yaml", "templates: [{rows: [{text: hi}]}]", "missing a name"},
+		{"no rows", "t.yaml", "templates: [{name: x}]", "has no rows"},
+		{"bad kind", "t.yaml", "templates: [{name: x, rows: [{kind: table, text: hi}]}]", "unknown kind"},
+		{"bad align", "t.yaml", "templates: [{name: x, rows: [{align: middle, text: hi}]}]", "unknown alignment"},
+		{"bad border", "t.yaml", "templates: [{name: x, border: dotted, rows: [{text: hi}]}]", "unknown border"},
+		{"bad width", "t.yaml", "templates: [{name: x, width: 2, rows: [{text: hi}]}]", "width must be"},
+		{"bad hex", "t.yaml", `templates: [{name: x, rows: [{text: hi, fill: "#00"}]}]`, "invalid hex color"},
+		{"bad text", "t.yaml", `templates: [{name: x, rows: [{text: "{{.Job"}]}]`, "row 1"},
+		{"bad field", "t.yaml", `templates: [{name: x, rows: [{text: "{{.Foreman}}"}]}]`, "Foreman"},
+		{"unit field", "t.yaml", `templates: [{name: x, rows: [{kind: units, text: "{{.Job}}"}]}]`, "Job"},
+		{"missing font", "t.yaml", `templates: [{name: x, font: nope.ttf, rows: [{text: hi}]}]`, "reading font"},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), tt.file)
+		if err := os.WriteFile(path, []byte(tt.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := LoadTemplates(path)
+		if err == nil || !strings.Contains(err.Error(), tt.error) {
+			t.Errorf("%s: LoadTemplates error = %v, want it to contain %q", tt.name, err, tt.error)
+		}
+	}
+}
@@ -2,57 +2,115 @@ package callout
 
 import (
 	"caddae/types"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
 	"image"
+	"image/color"
 )
 
-// Width and height of our callout canvas.
-var canvasWidth int = 161
-var canvasHeight int = 61
+// Arrowhead styles for the leader
+const (
+	HEAD_FILLED = "filled"
+	HEAD_OPEN   = "open"
+	HEAD_DOT    = "dot"
+	HEAD_NONE   = "none"
+)
+
+// Where on the work the leader points
+const (
+	TO_NEAREST  = "nearest"
+	TO_CENTROID = "centroid"
+)
+
+// Corners of the sheet a stamp can go in
+const (
+	CORNER_TOP_LEFT     = "top-left"
+	CORNER_TOP_RIGHT    = "top-right"
+	CORNER_BOTTOM_LEFT  = "bottom-left"
+	CORNER_BOTTOM_RIGHT = "bottom-right"
+)
+
+// Callout that lists the work that was done that day, using production units
+type Callout struct {
+	prod   *types.Production
+	canvas image.Image
+
+	// Sizes and positions of everything on the canvas
+	layout layout
+
+	// Bounds of the image the callout is for
+	bounds image.Rectangle
 
-// Additional height we need on the callout canvas per prod box.
-var addtlnProdHeight int = 20
+	// Design of the callout
+	template *Template
 
-// Gap between the starting y values of each prod box.
-var prodGap int = 20
+	// Font of the text, and the face made from it for the image's DPI
+	font Font
+	face font.Face
 
-// Width and height of the production box.
-var prodWidth int = 140
-var prodHeight int = 20
+	// Where the callout was added to the running asbuilt
+	box image.Rectangle
 
-// Starting dimensions of the production boxes.
-var prodDims = Dimensions{
-	x1: 10,
-	y1: 25,
-	x2: 150,
-	y2: 45,
+	// Style of the leader arrow from the callout to its work
+	arrow Leader
 }
 
-// Starting x & y values of the production text.
-var prodText = Text{
-	x: 20,
-	y: 40,
+// Leader is the style of the arrow drawn from a callout to the work it
+// describes. Any fields left empty use the DefaultLeader style.
+type Leader struct {
+	// Don't draw the leader at all
+	Hide bool
+
+	// Arrowhead style (HEAD_FILLED, HEAD_OPEN, HEAD_DOT or HEAD_NONE), and
+	// its length in pixels
+	Head     string
+	HeadSize int
+
+	// Color and width in pixels of the line
+	Color  color.RGBA
+	Weight int
+
+	// Whether to point at the nearest point of the work (TO_NEAREST), or
+	// its middle (TO_CENTROID)
+	Target string
 }
 
-// Number of production boxes currently made.
-var numProd int = 0
+// layout holds the size of the callout canvas, and where each row of the
+// template goes on it, worked out from the size of the image and the
+// production. Each callout has its own, so callouts don't affect each other.
+type layout struct {
+	// Width and height of our callout canvas.
+	canvasWidth, canvasHeight int
 
-// Callout that lists the work that was done that day, using production units
-type Callout struct {
-	date   Text
-	prod   *types.Production
-	dim    Dimensions
-	canvas image.Image
-	box    image.Image
-	arrow  image.Image
+	// Space between the edge of a row and its text
+	padding int
+
+	// The rows of the template, filled in from the production
+	cells []cell
+
+	// Error filling in the template, if there was one
+	err error
 }
 
-// Dimenstions of each box
-type Dimensions struct {
-	x1, y1 int
-	x2, y2 int
+// cell is a row of a callout template, filled in and laid out on the canvas
+type cell struct {
+	rect  image.Rectangle
+	lines []string
+	row   *Row
+	fill  color.RGBA
+	face  font.Face
 }
 
-// Text is the location of text in the boxes.
-type Text struct {
-	x, y int
+// Font is the typeface and size of the text in callouts. Any fields left
+// empty use the DefaultFont.
+type Font struct {
+	// TrueType or OpenType font from LoadFont. If nil, Go Regular is used.
+	Typeface *opentype.Font
+
+	// Size of the text in points
+	Size float64
+
+	// Dots per inch of the scan. If 0, it's worked out from the width of
+	// the image, taking it to be SheetWidth inches wide.
+	DPI float64
 }
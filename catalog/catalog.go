@@ -0,0 +1,432 @@
+// Package catalog provides the production unit catalog: the pay items the
+// crews are paid for, how their quantities are measured, rounded and shown on
+// the callouts, and the units worked out from other units.
+package catalog
+
+import (
+	"caddae/drawing"
+	"caddae/types"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Units of measure
+const (
+	FEET = "ft"
+	EACH = "ea"
+)
+
+// Unit is a production unit in the catalog, e.g. C300-01, feet of new strand.
+type Unit struct {
+	// Code of the unit, e.g. "C300-01"
+	Code string
+
+	// Description of the unit, e.g. "Strand"
+	Description string
+
+	// Measure is the unit of measure, FEET or EACH
+	Measure string
+
+	// Color of the unit's box on the callout
+	Color color.RGBA
+
+	// Decimals is the number of decimal places quantities are rounded to.
+	// Whole numbers are always shown without decimals.
+	Decimals int
+
+	// Footage is whether the unit is feet of new plant, counting towards the
+	// production's total footage. Labor units for the same feet (like C400)
+	// don't.
+	Footage bool
+
+	// Aliases are other names the quantity can be given under, e.g. the
+	// "strand" column of a manifest for C300-01.
+	Aliases []string
+
+	// DerivedFrom are the codes of the units whose quantities are added up to
+	// make this one, e.g. C400 is C300-02 + C300-03. Derived units can't be
+	// given a quantity of their own.
+	DerivedFrom []string
+}
+
+// Derived returns whether the unit's quantity is worked out from other units
+func (u *Unit) Derived() bool {
+	return len(u.DerivedFrom) > 0
+}
+
+// Round rounds the quantity to the unit's decimal places
+func (u *Unit) Round(qty float64) float64 {
+	p := math.Pow(10, float64(u.Decimals))
+	return math.Round(qty*p) / p
+}
+
+// ParseQty parses a quantity given for the unit
+func (u *Unit) ParseQty(s string) (float64, error) {
+	q, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || q < 0 || math.IsInf(q, 0) || math.IsNaN(q) {
+		return 0, fmt.Errorf("invalid quantity given for %s! '%s'", u.Code, s)
+	}
+	return q, nil
+}
+
+// FormatQty formats the quantity rounded to the unit's decimal places, e.g.
+// "75.50", leaving off the decimals of whole numbers, e.g. "100".
+func (u *Unit) FormatQty(qty float64) string {
+	s := strconv.FormatFloat(u.Round(qty), 'f', u.Decimals, 64)
+	if i := strings.IndexByte(s, '.'); i >= 0 && strings.Trim(s[i+1:], "0") == "" {
+		s = s[:i]
+	}
+	return s
+}
+
+// Text returns the callout text of the quantity, e.g. "C300-01 = 100'" for
+// feet or "C300-04 = 2" for each.
+func (u *Unit) Text(qty float64) string {
+	txt := u.Code + " = " + u.FormatQty(qty)
+	switch u.Measure {
+	case FEET:
+		txt += "'"
+	case EACH:
+	default:
+		txt += " " + u.Measure
+	}
+	return txt
+}
+
+// Catalog is the production units, in the order they're shown on callouts.
+type Catalog struct {
+	Units []*Unit
+}
+
+// DefaultCatalog returns the built in catalog of aerial units: strand, cable,
+// overlash and anchors, and the C400 labor for lashing cable and overlash.
+func DefaultCatalog() *Catalog {
+	return &Catalog{Units: []*Unit{
+		{
+			Code:        "C300-01",
+			Description: "Strand",
+			Measure:     FEET,
+			Color:       drawing.Blue,
+			Decimals:    2,
+			Footage:     true,
+			Aliases:     []string{"strand"},
+		},
+		{
+			Code:        "C300-02",
+			Description: "Cable",
+			Measure:     FEET,
+			Color:       drawing.Blue,
+			Decimals:    2,
+			Footage:     true,
+			Aliases:     []string{"cable"},
+		},
+		{
+			Code:        "C300-03",
+			Description: "Overlash",
+			Measure:     FEET,
+			Color:       drawing.Blue,
+			Decimals:    2,
+			Footage:     true,
+			Aliases:     []string{"overlash"},
+		},
+		{
+			Code:        "C300-04",
+			Description: "Anchors",
+			Measure:     EACH,
+			Color:       drawing.Coral,
+			Aliases:     []string{"anchors"},
+		},
+		{
+			Code:        "C400",
+			Description: "Lashing",
+			Measure:     FEET,
+			Color:       drawing.Blue,
+			Decimals:    2,
+			DerivedFrom: []string{"C300-02", "C300-03"},
+		},
+	}}
+}
+
+// Get returns the unit with the given code or alias, ignoring case.
+func (c *Catalog) Get(name string) (*Unit, error) {
+	name = strings.TrimSpace(name)
+	for _, u := range c.Units {
+		if strings.EqualFold(u.Code, name) {
+			return u, nil
+		}
+		for _, alias := range u.Aliases {
+			if strings.EqualFold(alias, name) {
+				return u, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("unknown production unit '%s'", name)
+}
+
+// Inputs returns the units that are given a quantity, rather than derived
+// from other units.
+func (c *Catalog) Inputs() []*Unit {
+	var units []*Unit
+	for _, u := range c.Units {
+		if !u.Derived() {
+			units = append(units, u)
+		}
+	}
+	return units
+}
+
+// ParseQuantities parses the quantities given for the units, by code or
+// alias, into quantities by code. Empty quantities are skipped.
+func (c *Catalog) ParseQuantities(given map[string]string) (map[string]float64, error) {
+	qty := make(map[string]float64, len(given))
+	for name, s := range given {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		u, err := c.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		if u.Derived() {
+			return nil, fmt.Errorf("%s is worked out from %s and can't be given", u.Code, strings.Join(u.DerivedFrom, " + "))
+		}
+		if _, ok := qty[u.Code]; ok {
+			return nil, fmt.Errorf("quantity for %s given more than once", u.Code)
+		}
+		q, err := u.ParseQty(s)
+		if err != nil {
+			return nil, err
+		}
+		qty[u.Code] = q
+	}
+	return qty, nil
+}
+
+// Production returns the production units for the quantities given by code,
+// in catalog order, with the derived units added. Units that come to zero
+// are left out.
+func (c *Catalog) Production(qty map[string]float64) []types.Unit {
+	var units []types.Unit
+	for _, u := range c.Units {
+		q := qty[u.Code]
+		if u.Derived() {
+			q = 0
+			for _, code := range u.DerivedFrom {
+				q += qty[code]
+			}
+		}
+		if u.Round(q) == 0 {
+			continue
+		}
+		units = append(units, types.Unit{
+			Name:        u.Code,
+			Description: u.Description,
+			Qty:         u.FormatQty(q),
+			Text:        u.Text(q),
+			Color:       u.Color,
+			Footage:     u.Footage,
+		})
+	}
+	return units
+}
+
+// Totals returns the production units for the totals placed on a job so far,
+// compared against the job's design quantities, both by code. Units are in
+// catalog order, followed by any placed units the catalog doesn't have, and
+// units with nothing placed or designed are left out.
+//
+// Their text reads like "C300-01 = 425' of 5000' (9%)", or "C300-01 = 425'"
+// when there's no design quantity.
+func (c *Catalog) Totals(placed, design map[string]float64) []types.Unit {
+	var units []types.Unit
+	known := make(map[string]bool)
+	for _, u := range c.Units {
+		known[u.Code] = true
+		q, d := u.Round(placed[u.Code]), u.Round(design[u.Code])
+		if q == 0 && d == 0 {
+			continue
+		}
+
+		unit := types.Unit{
+			Name:        u.Code,
+			Description: u.Description,
+			Qty:         u.FormatQty(q),
+			Text:        u.Text(q),
+			Color:       u.Color,
+			Footage:     u.Footage,
+		}
+		if d != 0 {
+			unit.Design = u.FormatQty(d)
+			// Rounded down, so a unit is only 100% once it's all placed
+			unit.Percent = fmt.Sprintf("%.0f%%", math.Floor(100*q/d))
+			unit.Text += " of " + strings.TrimPrefix(u.Text(d), u.Code+" = ") + " (" + unit.Percent + ")"
+		}
+		units = append(units, unit)
+	}
+
+	// Units that were dropped from the catalog since they were placed
+	var other []string
+	for code, q := range placed {
+		if !known[code] && q != 0 {
+			other = append(other, code)
+		}
+	}
+	sort.Strings(other)
+	for _, code := range other {
+		qty := strconv.FormatFloat(placed[code], 'f', -1, 64)
+		units = append(units, types.Unit{Name: code, Qty: qty, Text: code + " = " + qty, Color: drawing.Blue})
+	}
+	return units
+}
+
+// Validate checks the units of the catalog make sense
+func (c *Catalog) Validate() error {
+	if len(c.Units) == 0 {
+		return errors.New("catalog has no units")
+	}
+
+	codes := make(map[string]*Unit)
+	for _, u := range c.Units {
+		if u.Code == "" {
+			return errors.New("unit is missing a code")
+		}
+		for _, name := range append([]string{u.Code}, u.Aliases...) {
+			key := strings.ToLower(name)
+			if _, ok := codes[key]; ok {
+				return fmt.Errorf("unit '%s': code or alias '%s' is used more than once", u.Code, name)
+			}
+			codes[key] = u
+		}
+		if u.Measure == "" {
+			return fmt.Errorf("unit '%s' is missing a unit of measure", u.Code)
+		}
+		if u.Decimals < 0 || u.Decimals > 6 {
+			return fmt.Errorf("unit '%s': decimals must be between 0 and 6", u.Code)
+		}
+	}
+
+	// Derived units add up units that are given, so there's no order to work
+	// them out in and no loops.
+	for _, u := range c.Units {
+		for _, code := range u.DerivedFrom {
+			from, ok := codes[strings.ToLower(code)]
+			if !ok || from.Code != code {
+				return fmt.Errorf("unit '%s' is derived from unknown unit '%s'", u.Code, code)
+			}
+			if from.Derived() {
+				return fmt.Errorf("unit '%s' is derived from '%s', which is derived itself", u.Code, code)
+			}
+		}
+	}
+	return nil
+}
+
+// catalogFile is the layout of a unit catalog file.
+//
+// For example, in YAML:
+//
+//	units:
+//	  - code: C300-01
+//	    description: Strand
+//	    measure: ft
+//	    color: "#2c95ed"
+//	    decimals: 2
+//	    footage: true
+//	    aliases: [strand]
+//	  - code: C400
+//	    description: Lashing
+//	    measure: ft
+//	    derived_from: [C300-02, C300-03]
+type catalogFile struct {
+	Units []unitConfig `json:"units" yaml:"units"`
+}
+
+// unitConfig is a single unit in a catalog file
+type unitConfig struct {
+	Code        string   `json:"code" yaml:"code"`
+	Description string   `json:"description" yaml:"description"`
+	Measure     string   `json:"measure" yaml:"measure"`
+	Color       string   `json:"color" yaml:"color"`
+	Decimals    *int     `json:"decimals" yaml:"decimals"`
+	Footage     bool     `json:"footage" yaml:"footage"`
+	Aliases     []string `json:"aliases" yaml:"aliases"`
+	DerivedFrom []string `json:"derived_from" yaml:"derived_from"`
+}
+
+// LoadCatalog loads the unit catalog in the given JSON or YAML file. The file
+// replaces the built in catalog.
+func LoadCatalog(path string) (*Catalog, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "os.ReadFile(%s): failed to read unit catalog", path)
+	}
+
+	var cf catalogFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(b, &cf)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &cf)
+	default:
+		return nil, fmt.Errorf("LoadCatalog(%s): unit catalogs must be .json, .yaml or .yml", path)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "LoadCatalog(%s): failed to decode unit catalog", path)
+	}
+
+	var c Catalog
+	for i, uc := range cf.Units {
+		u, err := uc.unit()
+		if err != nil {
+			return nil, errors.Wrapf(err, "LoadCatalog(%s): unit %d", path, i+1)
+		}
+		c.Units = append(c.Units, u)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "LoadCatalog(%s)", path)
+	}
+	return &c, nil
+}
+
+// unit converts the unit config into a Unit. Feet are rounded to two decimal
+// places and everything else to whole numbers, unless decimals are given.
+func (uc unitConfig) unit() (*Unit, error) {
+	u := Unit{
+		Code:        strings.TrimSpace(uc.Code),
+		Description: uc.Description,
+		Measure:     strings.ToLower(strings.TrimSpace(uc.Measure)),
+		Color:       drawing.Blue,
+		Footage:     uc.Footage,
+		Aliases:     uc.Aliases,
+		DerivedFrom: uc.DerivedFrom,
+	}
+	if u.Measure == "" {
+		u.Measure = EACH
+	}
+
+	if uc.Decimals != nil {
+		u.Decimals = *uc.Decimals
+	} else if u.Measure == FEET {
+		u.Decimals = 2
+	}
+
+	if uc.Color != "" {
+		col, err := drawing.ParseHex(uc.Color)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unit '%s' color", u.Code)
+		}
+		u.Color = col
+	}
+	return &u, nil
+}
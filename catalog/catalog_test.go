@@ -0,0 +1,148 @@
+package catalog
+
+import (
+	"caddae/drawing"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadCatalogExample(t *testing.T) {
+	c, err := LoadCatalog(filepath.Join("..", "units.example.yaml"))
+	if err != nil {
+		t.Fatalf("LoadCatalog: %v", err)
+	}
+
+	// The example has the built in units
+	for _, want := range DefaultCatalog().Units {
+		got, err := c.Get(want.Code)
+		if err != nil {
+			t.Errorf("Get(%s): %v", want.Code, err)
+			continue
+		}
+		if got.Code != want.Code || got.Measure != want.Measure || got.Color != want.Color || got.Decimals != want.Decimals || got.Footage != want.Footage {
+			t.Errorf("unit %s = %+v, want %+v", want.Code, got, want)
+		}
+	}
+
+	riser, err := c.Get("riser")
+	if err != nil {
+		t.Fatalf("Get(riser): %v", err)
+	}
+	if riser.Decimals != 0 || riser.Text(12.6) != "C300-06 = 13'" {
+		t.Errorf("riser = %+v with text %q, want whole feet", riser, riser.Text(12.6))
+	}
+}
+
+func TestProduction(t *testing.T) {
+	c := DefaultCatalog()
+	qty, err := c.ParseQuantities(map[string]string{
+		"strand":  "100",
+		"C300-02": "50.25",
+		"c300-03": "25",
+		"anchors": "2",
+		"cable ":  "",
+	})
+	if err != nil {
+		t.Fatalf("ParseQuantities: %v", err)
+	}
+
+	units := c.Production(qty)
+	want := []string{"C300-01 = 100'", "C300-02 = 50.25'", "C300-03 = 25'", "C300-04 = 2", "C400 = 75.25'"}
+	var got []string
+	for _, u := range units {
+		got = append(got, u.Text)
+	}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("units = %q, want %q", got, want)
+	}
+	if units[3].Color != drawing.Coral || units[3].Description != "Anchors" {
+		t.Errorf("anchors = %+v, want coral and described", units[3])
+	}
+	if units[0].Qty != "100" || !units[0].Footage || units[4].Footage {
+		t.Errorf("units = %+v, want strand to count as footage and C400 not to", units)
+	}
+
+	if units := c.Production(nil); len(units) != 0 {
+		t.Errorf("production of nothing = %+v, want no units", units)
+	}
+}
+
+func TestParseQuantitiesErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		given map[string]string
+		error string
+	}{
+		{"not a number", map[string]string{"C300-01": "ten"}, "invalid quantity given for C300-01"},
+		{"negative", map[string]string{"anchors": "-1"}, "invalid quantity given for C300-04"},
+		{"unknown", map[string]string{"C999": "1"}, "unknown production unit 'C999'"},
+		{"derived", map[string]string{"C400": "1"}, "worked out from C300-02 + C300-03"},
+		{"twice", map[string]string{"strand": "1", "C300-01": "2"}, "more than once"},
+	}
+
+	c := DefaultCatalog()
+	for _, tt := range tests {
+		_, err := c.ParseQuantities(tt.given)
+		if err == nil || !strings.Contains(err.Error(), tt.error) {
+			t.Errorf("%s: ParseQuantities error = %v, want it to contain %q", tt.name, err, tt.error)
+		}
+	}
+}
+
+func TestLoadCatalogErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		data  string
+		error string
+	}{
+		{"bad extension", "units.txt", "", "must be .json, .yaml or .yml"},
+		{"empty", "u.yaml", "units: []", "has no units"},
+		{"no code", "u.yaml", "units: [{measure: ft}]", "missing a code"},
+		{"same code", "u.yaml", "units: [{code: A}, {code: B, aliases: [a]}]", "more than once"},
+		{"bad hex", "u.yaml", `units: [{code: A, color: "#00"}]`, "invalid hex color"},
+		{"bad decimals", "u.yaml", "units: [{code: A, decimals: -1}]", "decimals must be"},
+		{"unknown derived", "u.yaml", "units: [{code: A, derived_from: [B]}]", "unknown unit 'B'"},
+		{"derived derived", "u.yaml", "units: [{code: A}, {code: B, derived_from: [A]}, {code: C, derived_from: [B]}]", "derived itself"},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), tt.file)
+		if err := os.WriteFile(path, []byte(tt.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := LoadCatalog(path)
+		if err == nil || !strings.Contains(err.Error(), tt.error) {
+			t.Errorf("%s: LoadCatalog error = %v, want it to contain %q", tt.name, err, tt.error)
+		}
+	}
+}
+
+func TestTotals(t *testing.T) {
+	c := DefaultCatalog()
+	units := c.Totals(
+		map[string]float64{"C300-01": 429.9, "C300-02": 85.5, "C400": 85.5, "C300-09": 3},
+		map[string]float64{"C300-01": 1000, "C300-04": 4},
+	)
+
+	want := []string{
+		"C300-01 = 429.90' of 1000' (42%)",
+		"C300-02 = 85.50'",
+		"C300-04 = 0 of 4 (0%)",
+		"C400 = 85.50'",
+		"C300-09 = 3",
+	}
+	if len(units) != len(want) {
+		t.Fatalf("got %d units, want %d: %+v", len(units), len(want), units)
+	}
+	for i, u := range units {
+		if u.Text != want[i] {
+			t.Errorf("unit %d = %q, want %q", i, u.Text, want[i])
+		}
+	}
+	if units[0].Design != "1000" || units[0].Percent != "42%" || units[1].Design != "" {
+		t.Errorf("design = %q %q and %q, want 1000 42%% and none", units[0].Design, units[0].Percent, units[1].Design)
+	}
+}
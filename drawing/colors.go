@@ -3,167 +3,364 @@ package drawing
 import (
 	"image"
 	"image/color"
+	"math"
+	"runtime"
+	"sync"
 )
 
+// bandHeight is the number of image rows each worker processes at a time.
+const bandHeight = 64
+
 // GetColors gets (and if change is set, changes) the colors in the provided image.
 //
-// Note that this is *not* efficent, as a better method would be to get the actual image.Image type and iterate
-// over the pixels directly, saving a whole lot of conversion.
-//
-// Why? This was done quickly more as a proof of concept, so performance is not a consideration.
-// Also this assumes the image provided is no higher then 24-bit color depth, and will happily fail if otherwise.
-//
-// This is simply because we "convert" the 32-bit RGB values to 8-bit values without any real checking or conversion to account for it.
-// Probably should use RGBA64, which would handle 48-bit color depth, if you actually want to do something besides a proof of concept here.
+// Any pixel whose color falls in a range with Replace set is changed to the
+// range's Make color. Where they were isn't kept, nobody needs to know which
+// paper or linework pixels were changed, so use ChangeColors for that.
 //
-// I believe GIF only supports a max of 24-bit color depth, where as PNG and JPEG XT supports 48-bit.
+// The image is split into bands of rows which are classified in parallel, see
+// classify for the details.
+func (c *Canvas) GetColors(in image.Image, change bool) ColorMap {
+	cm, _ := c.classify(in, nil, func(r *ColorRange) bool {
+		return change && r.Replace
+	}, "")
+	return cm
+}
+
+// ChangeColors changes the pixels in the image that are in a range with the
+// given meaning to the range's Make color, i.e. the yellow pixels to blue,
+// and returns where they were in the ChangeMap under that meaning.
 //
-// For more details, see - https://en.wikipedia.org/wiki/Color_depth
+// The provided ColorMap is used to look up the ranges of colors we've seen
+// before, and any new colors found are added to it, counted over the whole
+// image. The counts of the colors it already has are left alone.
+func (c *Canvas) ChangeColors(cm ColorMap, in image.Image, meaning string) (ColorMap, ChangeMap) {
+	return c.classify(in, cm, func(r *ColorRange) bool {
+		return r.Meaning == meaning
+	}, meaning)
+}
+
+// classify counts the colors in the image, and changes the pixels whose range
+// is accepted by the change function. The changed pixels of the ranges with
+// the record meaning are kept in the ChangeMap, none are if it's empty.
 //
-// This should be considered a known bug.
+// Rather than going through image.Image's At().RGBA() for every pixel, we read
+// the pixel buffers of the common image types directly (see readRow), and
+// convert 16-bit channels down to 8-bit properly by keeping the high byte.
 //
-// Again, more proof of concept then anything I'd actually recommend using in production.
-func (c *Canvas) GetColors(in image.Image, change bool) (ColorMap, ChangeMap) {
-	var col color.RGBA
-	var r, g, b, a uint32
-	cm := make(ColorMap, 1)
-	chm := make(ChangeMap, 3)
+// The image is split into bands of bandHeight rows that are handed out to a
+// pool of workers, each keeping their own color counts and changed pixels.
+// Once every band is done we merge them together in row order, and put the
+// changed pixels into the column by column order the rest of the pipeline
+// expects (see columnOrder).
+func (c *Canvas) classify(in image.Image, known ColorMap, change func(*ColorRange) bool, record string) (ColorMap, ChangeMap) {
+	bnds := in.Bounds()
+	pal := palette(in)
 
-	var bPixels, wPixels, yPixels []*Pixel
+	// Split the image into bands of rows
+	var bands []image.Rectangle
+	for y := bnds.Min.Y; y < bnds.Max.Y; y += bandHeight {
+		y1 := y + bandHeight
+		if y1 > bnds.Max.Y {
+			y1 = bnds.Max.Y
+		}
+		bands = append(bands, image.Rect(bnds.Min.X, y, bnds.Max.X, y1))
+	}
 
-	// Get the X, Y bounds of the image
-	bnds := in.Bounds()
+	results := make([]bandResult, len(bands))
+	jobs := make(chan int)
 
-	// Now lets loop through it.
-	for x := bnds.Min.X; x < bnds.Max.X; x++ {
-		for y := bnds.Min.Y; y < bnds.Max.Y; y++ {
-			// This? Yeah, this is a performance killer, all the conversion done in these functions.
-			r, g, b, a = in.At(x, y).RGBA()
-
-			// And here? This is a bug waiting to bite some unsuspecting image.
-			//
-			// We just chop off 3 bytes from the colors and hope they were really 8-bit values to begin with.
-			col.R, col.G, col.B, col.A = uint8(r), uint8(g), uint8(b), uint8(a)
-
-			// fmt.Printf("At %d x %d, color %#v\n", x, y, col)
-
-			if v, ok := cm[col]; ok {
-				// This color has already been looked up.
-				//
-				// First, update the count.
-				cm[col] = &ColorCount{v.Count + 1, v.Range}
-
-				// Now we need to check if it has a range, and if that range wants us to change the color of the
-				// current pixel or not?
-				if change && v.Range != nil && v.Range.Replace {
-					// Yep, change the pixel.
-					//
-					// Note that image.Image interface doesn't have a Set() function, but the types that typically make it up do.
-					//
-					// So we see if it supports the Set() function via our canSetImage interface, which lets us know and provides us
-					// the interface to call Set() with.
-					//
-					// Note this will fail for JPEGs, as those are typically image.YCbCr, which does not have a Set() function.
-					if canSet, ok := in.(CanSet); ok {
-						canSet.Set(x, y, v.Range.Make)
-
-						/*fmt.Printf("At %d x %d, changed pixel from #%02x%02x%02x to #%02x%02x%02x\n", x, y,
-						col.R, col.G, col.B, v.Range.Make.R, v.Range.Make.G, v.Range.Make.B )*/
-					}
-					pc := Pixel{
-						X: x,
-						Y: y,
-					}
-					if v.Range.Name == YELLOWISH {
-						yPixels = append(yPixels, &pc)
-					} else if v.Range.Name == BLACKISH {
-						bPixels = append(bPixels, &pc)
-					} else {
-						wPixels = append(wPixels, &pc)
-					}
-				}
-			} else {
-				//fmt.Printf("First seen color: #%02x%02x%02x, %x\n", col.R, col.G, col.B, col.A)
-				cm[col] = &ColorCount{1, c.GetRange(col)}
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = c.classifyBand(in, bands[i], pal, known, change, record)
+			}
+		}()
+	}
+	for i := range bands {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	// Merge the results of each band together.
+	cm := known
+	if cm == nil {
+		cm = make(ColorMap)
+	}
+	chm := make(ChangeMap, 1)
+	var changed []*Pixel
+	added := make(map[color.RGBA]bool)
+	for _, res := range results {
+		for col, cc := range res.cm {
+			v, ok := cm[col]
+			if !ok {
+				cm[col] = cc
+				added[col] = true
+				continue
+			}
+			// Add up the counts of the colors found in this image, from every
+			// band. The colors of the known map were counted when it was made,
+			// so they aren't counted again, or we'd be counting the pixels twice.
+			if added[col] {
+				v.Count += cc.Count
 			}
 		}
+		changed = append(changed, res.changed...)
+	}
+
+	if record != "" {
+		chm[record] = columnOrder(changed, bnds)
 	}
-	chm[BLACKISH] = bPixels
-	chm[WHITEISH] = wPixels
-	chm[YELLOWISH] = yPixels
 	return cm, chm
 }
 
-// ChangeColors changes the yellow pixels in the image to blue.
-func (c *Canvas) ChangeColors(cm ColorMap, in image.Image, rName string) (ColorMap, ChangeMap) {
-	var col color.RGBA
-	var r, g, b, a uint32
-	chm := make(ChangeMap, 1)
+// columnOrder puts the pixels, which are in row by row order, into column by
+// column order.
+//
+// The pixels are counted into a bucket for each column of the image and
+// handed out in the order they came in, so each column stays top to bottom.
+// That's a single pass over them, rather than sorting the lot.
+func columnOrder(pixels []*Pixel, bnds image.Rectangle) []*Pixel {
+	start := make([]int, bnds.Dx()+1)
+	for _, p := range pixels {
+		start[p.X-bnds.Min.X+1]++
+	}
+	for i := 1; i < len(start); i++ {
+		start[i] += start[i-1]
+	}
 
-	var bPixels, wPixels, yPixels []*Pixel
+	out := make([]*Pixel, len(pixels))
+	for _, p := range pixels {
+		i := p.X - bnds.Min.X
+		out[start[i]] = p
+		start[i]++
+	}
+	return out
+}
 
-	// Get the X, Y bounds of the image
-	bnds := in.Bounds()
+// bandResult is the color counts and changed pixels of a single band
+type bandResult struct {
+	cm      ColorMap
+	changed []*Pixel
+}
+
+// classifyBand counts and changes the colors of the pixels within one band of
+// the image.
+func (c *Canvas) classifyBand(in image.Image, band image.Rectangle, pal []color.RGBA, known ColorMap, change func(*ColorRange) bool, record string) bandResult {
+	res := bandResult{
+		cm: make(ColorMap),
+	}
+	row := make([]color.RGBA, band.Dx())
 
-	// Now lets loop through it.
-	for x := bnds.Min.X; x < bnds.Max.X; x++ {
-		for y := bnds.Min.Y; y < bnds.Max.Y; y++ {
-			r, g, b, a = in.At(x, y).RGBA()
-			col.R, col.G, col.B, col.A = uint8(r), uint8(g), uint8(b), uint8(a)
-
-			// fmt.Printf("At %d x %d, color %#v\n", x, y, col)
-
-			if v, ok := cm[col]; ok {
-				if v.Range != nil && v.Range.Name == rName {
-					// Yep, change the pixel.
-					if canSet, ok := in.(CanSet); ok {
-						canSet.Set(x, y, v.Range.Make)
-					}
-					pc := Pixel{
-						X: x,
-						Y: y,
-					}
-
-					if v.Range.Name == YELLOWISH {
-						yPixels = append(yPixels, &pc)
-					} else if v.Range.Name == BLACKISH {
-						bPixels = append(bPixels, &pc)
-					} else {
-						wPixels = append(wPixels, &pc)
-					}
+	for y := band.Min.Y; y < band.Max.Y; y++ {
+		readRow(in, y, row, pal)
+
+		for i, col := range row {
+			v, ok := res.cm[col]
+			if !ok {
+				// First time this band has seen the color, so look up its range.
+				var r *ColorRange
+				if k, ok := known[col]; ok {
+					r = k.Range
+				} else {
+					r = c.GetRange(col)
 				}
+				v = &ColorCount{0, r}
+				res.cm[col] = v
+			}
+			v.Count++
+
+			if v.Range == nil || !change(v.Range) {
+				continue
+			}
+
+			// Yep, change the pixel.
+			x := band.Min.X + i
+			setPixel(in, x, y, v.Range.Make)
+			if record != "" && v.Range.Meaning == record {
+				res.changed = append(res.changed, &Pixel{X: x, Y: y})
+			}
+		}
+	}
+	return res
+}
+
+// palette returns the colors of a paletted image converted to color.RGBA, so
+// we only have to convert each palette entry once.
+func palette(in image.Image) []color.RGBA {
+	p, ok := in.(*image.Paletted)
+	if !ok {
+		return nil
+	}
+	pal := make([]color.RGBA, len(p.Palette))
+	for i, col := range p.Palette {
+		pal[i] = toRGBA(col)
+	}
+	return pal
+}
+
+// readRow reads row y of the image into row as 8-bit color.RGBA values.
+//
+// The common image types are read straight from their pixel buffers, and
+// anything else (like the image.YCbCr JPEGs decode to) falls back to At().
+func readRow(in image.Image, y int, row []color.RGBA, pal []color.RGBA) {
+	x0 := in.Bounds().Min.X
+
+	switch img := in.(type) {
+	case *image.RGBA:
+		p := img.Pix[img.PixOffset(x0, y):]
+		for i := range row {
+			row[i] = color.RGBA{p[i*4], p[i*4+1], p[i*4+2], p[i*4+3]}
+		}
+	case *image.NRGBA:
+		p := img.Pix[img.PixOffset(x0, y):]
+		for i := range row {
+			col := color.NRGBA{p[i*4], p[i*4+1], p[i*4+2], p[i*4+3]}
+			if col.A == 0xff {
+				row[i] = color.RGBA{col.R, col.G, col.B, col.A}
+				continue
+			}
+			row[i] = toRGBA(col)
+		}
+	case *image.RGBA64:
+		// 16-bit channels are big endian, so the high byte comes first.
+		p := img.Pix[img.PixOffset(x0, y):]
+		for i := range row {
+			row[i] = color.RGBA{p[i*8], p[i*8+2], p[i*8+4], p[i*8+6]}
+		}
+	case *image.NRGBA64:
+		p := img.Pix[img.PixOffset(x0, y):]
+		for i := range row {
+			if p[i*8+6] == 0xff && p[i*8+7] == 0xff {
+				row[i] = color.RGBA{p[i*8], p[i*8+2], p[i*8+4], 0xff}
+				continue
+			}
+			row[i] = toRGBA(img.NRGBA64At(x0+i, y))
+		}
+	case *image.Gray:
+		p := img.Pix[img.PixOffset(x0, y):]
+		for i := range row {
+			row[i] = color.RGBA{p[i], p[i], p[i], 0xff}
+		}
+	case *image.Gray16:
+		p := img.Pix[img.PixOffset(x0, y):]
+		for i := range row {
+			row[i] = color.RGBA{p[i*2], p[i*2], p[i*2], 0xff}
+		}
+	case *image.Paletted:
+		p := img.Pix[img.PixOffset(x0, y):]
+		for i := range row {
+			if int(p[i]) < len(pal) {
+				row[i] = pal[p[i]]
 			} else {
-				//fmt.Printf("First seen color: #%02x%02x%02x, %x\n", col.R, col.G, col.B, col.A)
-				cm[col] = &ColorCount{1, c.GetRange(col)}
+				row[i] = Black
 			}
 		}
+	default:
+		for i := range row {
+			row[i] = toRGBA(in.At(x0+i, y))
+		}
+	}
+}
+
+// toRGBA converts any color to an 8-bit, alpha premultiplied color.RGBA.
+func toRGBA(col color.Color) color.RGBA {
+	r, g, b, a := col.RGBA()
+	return color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), uint8(a >> 8)}
+}
+
+// setPixel sets the pixel at (x, y) to the given color.
+//
+// Note that image.Image interface doesn't have a Set() function, but the types
+// that typically make it up do, so we fall back to our CanSet interface for
+// anything we don't write to directly. This will do nothing for JPEGs, as
+// those are typically image.YCbCr, which does not have a Set() function.
+func setPixel(in image.Image, x, y int, col color.RGBA) {
+	if img, ok := in.(*image.RGBA); ok {
+		i := img.PixOffset(x, y)
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = col.R, col.G, col.B, col.A
+		return
+	}
+	if canSet, ok := in.(CanSet); ok {
+		canSet.Set(x, y, col)
 	}
-	chm[BLACKISH] = bPixels
-	chm[WHITEISH] = wPixels
-	chm[YELLOWISH] = yPixels
-	return cm, chm
 }
 
 // GetRange checks if a range is found for this specific color, return it.
 func (c *Canvas) GetRange(in color.RGBA) *ColorRange {
 	// Lets see if the provided color has a range or not.
-	for _, cr := range Ranges {
-		// red match
-		if in.R > cr.RMax || in.R <= cr.RMin {
-			continue
-		}
+	for i := range c.ranges {
+		cr := &c.ranges[i]
 
-		if in.G > cr.GMax || in.G <= cr.GMin {
-			continue
+		if cr.Matches(in) {
+			// If we are here, that means the range matches, so return it.
+			return cr
 		}
+	}
 
-		if in.B > cr.BMax || in.B <= cr.BMin {
-			continue
+	return nil
+}
+
+// Matches checks if the color falls within the range.
+func (cr *ColorRange) Matches(in color.RGBA) bool {
+	if cr.Kind == PERCEPTUAL {
+		return cr.Distance(in) <= cr.Tolerance
+	}
+
+	if cr.Space == HSV {
+		h, s, v := toHSV(in)
+		if cr.HMin <= cr.HMax {
+			if h < cr.HMin || h > cr.HMax {
+				return false
+			}
+		} else if h < cr.HMin && h > cr.HMax {
+			// The hue range wraps around 0
+			return false
 		}
+		return s >= cr.SMin && s <= cr.SMax && v >= cr.VMin && v <= cr.VMax
+	}
 
-		// If we are here, that means the range matches, so return it.
-		return &cr
+	// red match
+	if in.R > cr.RMax || in.R < cr.RMin {
+		return false
 	}
 
-	return nil
+	if in.G > cr.GMax || in.G < cr.GMin {
+		return false
+	}
+
+	if in.B > cr.BMax || in.B < cr.BMin {
+		return false
+	}
+	return true
+}
+
+// toHSV converts a color to hue (degrees, 0-360), saturation and value (0-1).
+func toHSV(in color.RGBA) (float64, float64, float64) {
+	r, g, b := float64(in.R)/0xff, float64(in.G)/0xff, float64(in.B)/0xff
+	max := math.Max(r, math.Max(g, b))
+	min := math.Min(r, math.Min(g, b))
+	d := max - min
+
+	var h, s float64
+	if max > 0 {
+		s = d / max
+	}
+	switch {
+	case d == 0:
+		h = 0
+	case max == r:
+		h = 60 * math.Mod((g-b)/d, 6)
+	case max == g:
+		h = 60 * ((b-r)/d + 2)
+	default:
+		h = 60 * ((r-g)/d + 4)
+	}
+	if h < 0 {
+		h += 360
+	}
+	return h, s, max
 }
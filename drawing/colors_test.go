@@ -0,0 +1,316 @@
+package drawing
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+// yellow is a highlighter yellow the default yellowish range matches
+var yellow = color.RGBA{0xfa, 0xfd, 0x67, 0xff}
+
+func testCanvas() *Canvas {
+	l := zerolog.Nop()
+	return New(&l)
+}
+
+func TestMatchesRGB(t *testing.T) {
+	cr := ColorRange{RMin: 10, RMax: 20, GMin: 10, GMax: 20, BMin: 10, BMax: 20}
+
+	tests := []struct {
+		name string
+		in   color.RGBA
+		want bool
+	}{
+		{"inside", color.RGBA{15, 15, 15, 0xff}, true},
+		{"min is included", color.RGBA{10, 10, 10, 0xff}, true},
+		{"max is included", color.RGBA{20, 20, 20, 0xff}, true},
+		{"below min", color.RGBA{9, 15, 15, 0xff}, false},
+		{"above max", color.RGBA{15, 15, 21, 0xff}, false},
+	}
+	for _, tt := range tests {
+		if got := cr.Matches(tt.in); got != tt.want {
+			t.Errorf("%s: Matches(%v) = %v, want %v", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultRangesMatchPureColors(t *testing.T) {
+	c := testCanvas()
+
+	tests := []struct {
+		in      color.RGBA
+		meaning string
+	}{
+		{Black, LINEWORK},
+		{White, PAPER},
+		{yellow, NEW_STRAND},
+	}
+	for _, tt := range tests {
+		r := c.GetRange(tt.in)
+		if r == nil {
+			t.Errorf("GetRange(%v) = nil, want a %s range", tt.in, tt.meaning)
+			continue
+		}
+		if r.Meaning != tt.meaning {
+			t.Errorf("GetRange(%v) = %s, want %s", tt.in, r.Meaning, tt.meaning)
+		}
+	}
+}
+
+func TestMatchesHSV(t *testing.T) {
+	// A red range, which wraps around a hue of 0
+	cr := ColorRange{Space: HSV, HMin: 340, HMax: 20, SMin: 0.35, SMax: 1, VMin: 0.4, VMax: 1}
+
+	tests := []struct {
+		name string
+		in   color.RGBA
+		want bool
+	}{
+		{"red", color.RGBA{0xe0, 0x20, 0x20, 0xff}, true},
+		{"pinkish red", color.RGBA{0xe0, 0x20, 0x40, 0xff}, true},
+		{"orangeish red", color.RGBA{0xe0, 0x40, 0x20, 0xff}, true},
+		{"green", color.RGBA{0x20, 0xe0, 0x20, 0xff}, false},
+		{"too dark", color.RGBA{0x40, 0x05, 0x05, 0xff}, false},
+		{"too pale", color.RGBA{0xf0, 0xe0, 0xe0, 0xff}, false},
+	}
+	for _, tt := range tests {
+		if got := cr.Matches(tt.in); got != tt.want {
+			t.Errorf("%s: Matches(%v) = %v, want %v", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMatchesPerceptual(t *testing.T) {
+	ref := color.RGBA{0xf2, 0xf0, 0x6e, 0xff}
+
+	tests := []struct {
+		name string
+		cr   ColorRange
+		in   color.RGBA
+		want bool
+	}{
+		{"lab same color", ColorRange{Kind: PERCEPTUAL, Space: LAB, Ref: ref, Tolerance: 1}, ref, true},
+		{"lab darker scan", ColorRange{Kind: PERCEPTUAL, Space: LAB, Ref: ref, Tolerance: 30}, color.RGBA{0xd8, 0xd4, 0x60, 0xff}, true},
+		{"lab white paper", ColorRange{Kind: PERCEPTUAL, Space: LAB, Ref: ref, Tolerance: 30}, White, false},
+		{"lab blue", ColorRange{Kind: PERCEPTUAL, Space: LAB, Ref: ref, Tolerance: 30}, Blue, false},
+		{"hsv darker scan", ColorRange{Kind: PERCEPTUAL, Space: HSV, Ref: ref, Tolerance: 0.25}, color.RGBA{0xd8, 0xd4, 0x60, 0xff}, true},
+		{"hsv white paper", ColorRange{Kind: PERCEPTUAL, Space: HSV, Ref: ref, Tolerance: 0.25}, White, false},
+	}
+	for _, tt := range tests {
+		if got := tt.cr.Matches(tt.in); got != tt.want {
+			t.Errorf("%s: Matches(%v) = %v (distance %.2f), want %v", tt.name, tt.in, got, tt.cr.Distance(tt.in), tt.want)
+		}
+	}
+}
+
+func TestLightnessWeight(t *testing.T) {
+	ref := color.RGBA{0xf2, 0xf0, 0x6e, 0xff}
+	darker := color.RGBA{0xb0, 0xae, 0x50, 0xff}
+
+	cr := ColorRange{Kind: PERCEPTUAL, Space: LAB, Ref: ref}
+	d1 := cr.Distance(darker)
+	cr.LightnessWeight = 3
+	d3 := cr.Distance(darker)
+	if d3 >= d1 {
+		t.Errorf("Distance with a lightness weight of 3 = %.2f, want less than %.2f", d3, d1)
+	}
+}
+
+func TestDeltaE(t *testing.T) {
+	if d := DeltaE(White, White); d != 0 {
+		t.Errorf("DeltaE(white, white) = %v, want 0", d)
+	}
+	// Black to white is the full lightness range of 100
+	if d := DeltaE(Black, White); d < 99.9 || d > 100.1 {
+		t.Errorf("DeltaE(black, white) = %v, want 100", d)
+	}
+}
+
+// testImage returns a white image with black linework along the top row, and a
+// yellow square in the middle.
+func testImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), &image.Uniform{White}, image.Point{}, draw.Src)
+	for x := 0; x < w; x++ {
+		img.SetRGBA(x, 0, Black)
+	}
+	for y := h/2 - 2; y < h/2+2; y++ {
+		for x := w/2 - 2; x < w/2+2; x++ {
+			img.SetRGBA(x, y, yellow)
+		}
+	}
+	return img
+}
+
+func TestGetColors(t *testing.T) {
+	c := testCanvas()
+	img := testImage(200, 150)
+
+	cm := c.GetColors(img, false)
+
+	counts := map[color.RGBA]uint32{White: 200*150 - 200 - 16, Black: 200, yellow: 16}
+	if len(cm) != len(counts) {
+		t.Errorf("GetColors found %d colors, want %d", len(cm), len(counts))
+	}
+	for col, want := range counts {
+		cc, ok := cm[col]
+		if !ok {
+			t.Errorf("GetColors didn't find %v", col)
+			continue
+		}
+		if cc.Count != want {
+			t.Errorf("count of %v = %d, want %d", col, cc.Count, want)
+		}
+	}
+}
+
+func TestChangeColors(t *testing.T) {
+	c := testCanvas()
+	img := testImage(200, 150)
+
+	cm := c.GetColors(img, false)
+	_, chm := c.ChangeColors(cm, img, NEW_STRAND)
+
+	pixels := chm[NEW_STRAND]
+	if len(pixels) != 16 {
+		t.Fatalf("ChangeColors changed %d pixels, want 16", len(pixels))
+	}
+
+	// The changed pixels should be in column order, and changed to the
+	// range's make color.
+	want := c.GetRange(yellow).Make
+	for i, p := range pixels {
+		if i > 0 {
+			prev := pixels[i-1]
+			if p.X < prev.X || (p.X == prev.X && p.Y <= prev.Y) {
+				t.Errorf("pixel %d %v comes after %v, want column order", i, *p, *prev)
+			}
+		}
+		if got := img.RGBAAt(p.X, p.Y); got != want {
+			t.Errorf("pixel %v = %v, want %v", *p, got, want)
+		}
+	}
+
+	// Nothing else should have changed.
+	if got := img.RGBAAt(0, 0); got != Black {
+		t.Errorf("linework pixel = %v, want %v", got, Black)
+	}
+}
+
+func TestChangeColorsKnownCounts(t *testing.T) {
+	c := testCanvas()
+
+	// The known colors are only the paper's, from another scan
+	known := c.GetColors(testImage(10, 10), false)
+	delete(known, Black)
+	delete(known, yellow)
+	paper := known[White].Count
+
+	// A yellow line down the sheet, through every band
+	img := testImage(50, 5*bandHeight+7)
+	for y := 0; y < img.Bounds().Dy(); y++ {
+		img.SetRGBA(3, y, yellow)
+	}
+
+	// Count the pixels one at a time, in a single pass
+	serial := make(map[color.RGBA]uint32)
+	for y := 0; y < img.Bounds().Dy(); y++ {
+		for x := 0; x < img.Bounds().Dx(); x++ {
+			serial[img.RGBAAt(x, y)]++
+		}
+	}
+
+	cm, chm := c.ChangeColors(known, img, NEW_STRAND)
+	for _, col := range []color.RGBA{Black, yellow} {
+		if cm[col] == nil || cm[col].Count != serial[col] {
+			t.Errorf("count of new color %v = %v, want %d", col, cm[col], serial[col])
+		}
+	}
+	if cm[White].Count != paper {
+		t.Errorf("count of known color %v = %d, want it left at %d", White, cm[White].Count, paper)
+	}
+
+	// Only the new strand is recorded, and its pixels are in column order
+	// across the bands
+	if len(chm) != 1 {
+		t.Errorf("ChangeColors recorded %d meanings, want only %s", len(chm), NEW_STRAND)
+	}
+	pixels := chm[NEW_STRAND]
+	if want := int(serial[yellow]); len(pixels) != want {
+		t.Fatalf("ChangeColors changed %d pixels, want %d", len(pixels), want)
+	}
+	for i := 1; i < len(pixels); i++ {
+		p, prev := pixels[i], pixels[i-1]
+		if p.X < prev.X || (p.X == prev.X && p.Y <= prev.Y) {
+			t.Fatalf("pixel %d %v comes after %v, want column order", i, *p, *prev)
+		}
+	}
+}
+
+func TestGetColorsImageTypes(t *testing.T) {
+	c := testCanvas()
+	src := testImage(130, 140)
+	want := c.GetColors(src, false)
+
+	convert := func(dst draw.Image) image.Image {
+		draw.Draw(dst, dst.Bounds(), src, image.Point{}, draw.Src)
+		return dst
+	}
+	imgs := map[string]image.Image{
+		"NRGBA":    convert(image.NewNRGBA(src.Bounds())),
+		"RGBA64":   convert(image.NewRGBA64(src.Bounds())),
+		"NRGBA64":  convert(image.NewNRGBA64(src.Bounds())),
+		"Paletted": convert(image.NewPaletted(src.Bounds(), color.Palette{White, Black, yellow})),
+		"Gray":     convert(image.NewGray(src.Bounds())),
+		"Gray16":   convert(image.NewGray16(src.Bounds())),
+	}
+
+	for name, img := range imgs {
+		got := c.GetColors(img, false)
+		if name == "Gray" || name == "Gray16" {
+			// Yellow turns grey, so only check the linework & paper survive.
+			if got[Black] == nil || got[White] == nil {
+				t.Errorf("%s: GetColors = %v, want black and white", name, got)
+			}
+			continue
+		}
+		if len(got) != len(want) {
+			t.Errorf("%s: GetColors found %d colors, want %d", name, len(got), len(want))
+		}
+		for col, cc := range want {
+			if got[col] == nil || got[col].Count != cc.Count {
+				t.Errorf("%s: count of %v = %v, want %d", name, col, got[col], cc.Count)
+			}
+		}
+	}
+}
+
+// TestReadRow checks reading the pixel buffers directly gives the same colors
+// as going through At()
+func TestReadRow(t *testing.T) {
+	gray := image.NewGray(image.Rect(0, 0, 3, 1))
+	gray.Pix = []uint8{0, 0x80, 0xff}
+	gray16 := image.NewGray16(image.Rect(0, 0, 3, 1))
+	gray16.SetGray16(1, 0, color.Gray16{0x80ff})
+	gray16.SetGray16(2, 0, color.Gray16{0xffff})
+
+	// Nearly, but not quite, opaque
+	nrgba64 := image.NewNRGBA64(image.Rect(0, 0, 3, 1))
+	nrgba64.SetNRGBA64(0, 0, color.NRGBA64{0xffff, 0x8000, 0, 0xffff})
+	nrgba64.SetNRGBA64(1, 0, color.NRGBA64{0xffff, 0x8000, 0, 0xff00})
+	nrgba64.SetNRGBA64(2, 0, color.NRGBA64{0xffff, 0xffff, 0xffff, 0x8000})
+
+	for name, img := range map[string]image.Image{"Gray": gray, "Gray16": gray16, "NRGBA64": nrgba64} {
+		row := make([]color.RGBA, 3)
+		readRow(img, 0, row, nil)
+		for x, got := range row {
+			if want := toRGBA(img.At(x, 0)); got != want {
+				t.Errorf("%s: pixel %d = %v, want %v", name, x, got, want)
+			}
+		}
+	}
+}
@@ -14,39 +14,52 @@ func New(l *zerolog.Logger) *Canvas {
 	var c Canvas
 
 	c.log = l.With().Str("module", "canvas").Logger()
+	c.SetRanges(Ranges)
 	cl := c.log.With().Str("func", "New").Logger()
 	cl.Debug().Msg("Created")
 
 	return &c
 }
 
+// SetRanges sets the color ranges the canvas will be using, i.e. those of the
+// selected color profile. The canvas keeps its own copy of the ranges.
+func (c *Canvas) SetRanges(ranges ColorRanges) {
+	c.ranges = make(ColorRanges, len(ranges))
+	copy(c.ranges, ranges)
+}
+
+// Ranges returns the color ranges the canvas is using. Changes made to the
+// returned ranges, like setting Replace, are used by the canvas.
+func (c *Canvas) Ranges() ColorRanges {
+	return c.ranges
+}
+
 // SetImage sets the image the canvas will be using
 func (c *Canvas) SetImage(img image.Image) {
 	c.img = img
 }
 
-// DrawLines takes the approximate changes retrieved from the redline and
-// shifts them closer to the correct location, splits them into separate
-// straight lines, and then draws an antialiaed line
-func (c *Canvas) DrawLines(approxChanges []*Pixel, firstRlBlack, firstRaBlack *Pixel) image.Image {
+// DrawLines takes the approximate changes retrieved from the redline, traces
+// them into polylines (see Vectorize), moves the polylines onto the running
+// asbuilt using the given transform, and then draws them as antialiased lines.
+// It returns the image along with the lines as they were drawn on it.
+func (c *Canvas) DrawLines(approxChanges []*Pixel, t Transform) (image.Image, Lines) {
 	cl := c.log.With().Str("func", "DrawLines").Logger()
-	cl.Debug().Interface("firstRlBlack", firstRlBlack).Msg("First black pixel in the redline")
-	cl.Debug().Interface("firstRaBlack", firstRaBlack).Msg("First black pixel in the running")
-
-	difX := firstRaBlack.X - firstRlBlack.X
-	difY := firstRaBlack.Y - firstRlBlack.Y
+	cl.Debug().Interface("transform", t).Msg("Redline to running transform")
 
-	// Shift the pixels
-	shifted := c.ShiftPixels(approxChanges, difX, difY)
+	var drawn Lines
+	lines := c.ConvertLines(approxChanges)
+	for _, line := range lines {
+		// Shift the line's points onto the running asbuilt
+		shifted := c.ShiftPixels(line, t)
+		cl.Debug().Interface("line", shifted).Msg("next line")
 
-	lines := c.ConvertLines(shifted)
-	for i, line := range lines {
-		cl.Debug().Interface("line", line).Msg("next line")
-		if i > 5 {
-			c.DrawAntialiased(*line[0], *line[len(line)-1], Blue)
+		for i := 1; i < len(shifted); i++ {
+			c.DrawAntialiased(*shifted[i-1], *shifted[i], Blue)
 		}
+		drawn = append(drawn, shifted)
 	}
-	return c.img
+	return c.img, drawn
 }
 
 // GetColor gets the color of the pixel at (x,y)
@@ -57,23 +70,23 @@ func (c *Canvas) GetColor(x, y int) color.RGBA {
 var avgX, avgY, stdY, stdX float64
 var xPlus, xMinus, yPlus, yMinus float64
 
-// ShiftPixels shifts the pixels in the approximate changes
-func (c *Canvas) ShiftPixels(approxChanges []*Pixel, shiftX, shiftY int) []*Pixel {
+// ShiftPixels moves the pixels in the approximate changes onto the running
+// asbuilt using the given transform
+func (c *Canvas) ShiftPixels(approxChanges []*Pixel, t Transform) []*Pixel {
 	cl := c.log.With().Str("func", "ShiftPixels").Logger()
 	var pixels []*Pixel
 
 	bnds := c.img.Bounds()
-	xMax := bnds.Max.X
-	yMax := bnds.Max.Y
-	shiftX = 60
-	shiftY = 45
+	xMax := bnds.Max.X - 1
+	yMax := bnds.Max.Y - 1
 
 	var sumX, sumY int
 
 	for _, pixel := range approxChanges {
-		newX := math.Min(float64(pixel.X+shiftX), float64(xMax))
-		newY := math.Min(float64(pixel.Y-shiftY), float64(yMax))
-		x,y := c.GetNearestBlack(int(newX), int(newY))
+		newX, newY := t.Apply(*pixel)
+		newX = math.Max(float64(bnds.Min.X), math.Min(math.Round(newX), float64(xMax)))
+		newY = math.Max(float64(bnds.Min.Y), math.Min(math.Round(newY), float64(yMax)))
+		x, y := c.GetNearestBlack(int(newX), int(newY))
 		newP := &Pixel{X: x, Y: y}
 		pixels = append(pixels, newP)
 
@@ -127,76 +140,15 @@ func (c *Canvas) stdDev(pixels []*Pixel) {
 	stdX, stdY = math.Sqrt(sumX/n), math.Sqrt(sumY/n)
 }
 
-// ConvertLines converts an array of pixels to individual lines
+// ConvertLines converts an array of pixels to individual polylines, each made
+// up of the points where the line changes direction.
 func (c *Canvas) ConvertLines(pixels []*Pixel) Lines {
 	cl := c.log.With().Str("func", "ConvertLines").Logger()
 	cl.Debug().Msg("Started")
 
-	var lines Lines
-	lines = make(Lines, 1)
+	lines := c.Vectorize(pixels)
 
-	var line Line
-	var weight float64 = 0.5
-
-	for _, pixel := range pixels {
-		x, y := c.GetNearestBlack(pixel.X, pixel.Y)
-		if x == -1 {
-			continue
-		}
-
-		// Create a new pixel at the location on the canvas
-		cPixel := &Pixel{X: x, Y: y}
-
-		// If we have no pixels in the line, let's just add it to the line
-		if len(line) == 0 || len(line) == 1 {
-			line = append(line, cPixel)
-			continue
-		}
-
-		// We have a pixel in the line, but do we have any other lines?
-		if len(lines) == 0 {
-			// No, we don't, so let's check if this pixel is on the current line
-			if c.OnLine(line, cPixel, &weight) {
-				cl.Debug().Interface("pixel", cPixel).Msg("on line lines == 0")
-				// It is, so let's add it to the line and continue
-				line = append(line, cPixel)
-				continue
-			}
-			cl.Debug().Interface("pixel", cPixel).Msg("not on line lines == 0")
-			// It wasn't on the line, so let's add the line to lines and create
-			// a new line to append the pixel to
-			lines = append(lines, line)
-
-			var newline Line
-			line = newline
-			line = append(line, cPixel)
-			continue
-		}
-
-		if c.OnLine(line, cPixel, &weight) {
-			cl.Debug().Interface("pixel", cPixel).Msg("on line")
-			line = append(line, cPixel)
-			continue
-		}
-
-		idx := c.FindLine(lines, cPixel, &weight)
-		if idx != -1 {
-			cl.Debug().Interface("pixel", cPixel).Msg("on another line")
-			cl.Debug().Int("onLine", idx).Msg("line pixel was found to be on")
-			lines[idx] = append(lines[idx], cPixel)
-			continue
-		}
-
-		cl.Debug().Interface("pixel", cPixel).Msg("couldn't find a line")
-		lines = append(lines, line)
-
-		var newline Line
-		line = newline
-		line = append(line, cPixel)
-	}
-	lines = append(lines, line)
-
-	cl.Debug().Msg("Finished")
+	cl.Debug().Int("lines", len(lines)).Msg("Finished")
 	return lines
 }
 
@@ -258,55 +210,6 @@ func (c *Canvas) IntAbs(x int) int {
 	return x
 }
 
-// OnLine checks to see if a given point is on the current line
-func (c *Canvas) OnLine(line Line, pixel *Pixel, weight *float64) bool {
-	if len(line) == 0 || len(line) == 1 {
-		return true
-	}
-
-	x1, y1 := line[len(line)-1].X, line[len(line)-1].Y
-	x2, y2 := pixel.X, pixel.Y
-	difX := c.IntAbs(x2-x1)
-	difY := c.IntAbs(y2-y1)
-	if difX == difY {
-		return true
-	}
-	return false
-}
-
-// FindLine finds which line the pixel is on
-func (c *Canvas) FindLine(lines Lines, pixel *Pixel, weight *float64) int {
-	for i, line := range lines {
-		if c.OnLine(line, pixel, weight) {
-			return i
-		}
-	}
-	return -1
-}
-
-// ComparePixels compares two pixels to see if they're on the same line
-//
-// Return values -
-//    -1 : Pixel is *very* far away from previous one
-//     1 : Pixel is more than the standard distance from the last one,
-//          it's probably on the previous line
-//     0 : Pixel is on the same line as the current one
-func (c *Canvas) ComparePixels(curr, prev *Pixel) int {
-	currFx, prevFx := float64(curr.X), float64(prev.X)
-	currFy, prevFy := float64(curr.Y), float64(prev.Y)
-
-	deltaX := math.Abs(currFx - prevFx)
-	deltaY := math.Abs(currFy - prevFy)
-	if deltaX > xPlus || deltaX < xMinus || deltaY > yPlus || deltaY < yMinus {
-		return -1
-	}
-
-	if deltaY > 10 {
-		return 1
-	}
-	return 0
-}
-
 // DrawAntialiased draws an antialiaed line using Xiaolin Wu's line algorithm
 // https://en.wikipedia.org/wiki/Xiaolin_Wu%27s_line_algorithm
 func (c *Canvas) DrawAntialiased(start, end Pixel, clr color.RGBA) {
@@ -324,9 +227,9 @@ func (c *Canvas) DrawAntialiased(start, end Pixel, clr color.RGBA) {
 	// Check if the line is more vertical than horizontal
 	steep := math.Abs(y2-y1) > math.Abs(x2-x1)
 	if steep {
-		// Switch quadrants
-		x1, x2 = c.SwapValues(x1, x2)
-		y1, y2 = c.SwapValues(y1, y2)
+		// Draw it along y instead, by swapping x and y
+		x1, y1 = c.SwapValues(x1, y1)
+		x2, y2 = c.SwapValues(x2, y2)
 	}
 
 	// Check if we need to switch quadrants based on the horizontal direction
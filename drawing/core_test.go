@@ -0,0 +1,39 @@
+package drawing
+
+import (
+	"image"
+	"image/draw"
+	"testing"
+)
+
+func TestDrawAntialiased(t *testing.T) {
+	tests := []struct {
+		name       string
+		start, end Pixel
+	}{
+		{"horizontal", Pixel{10, 50}, Pixel{190, 50}},
+		{"vertical", Pixel{100, 10}, Pixel{100, 190}},
+		{"steep", Pixel{90, 10}, Pixel{110, 190}},
+		{"steep backwards", Pixel{110, 190}, Pixel{90, 10}},
+		{"diagonal", Pixel{10, 10}, Pixel{190, 190}},
+	}
+
+	for _, tt := range tests {
+		img := image.NewRGBA(image.Rect(0, 0, 200, 200))
+		draw.Draw(img, img.Bounds(), &image.Uniform{White}, image.Point{}, draw.Src)
+		c := testCanvas()
+		c.SetImage(img)
+		c.DrawAntialiased(tt.start, tt.end, Blue)
+
+		// The line should be solid along its longer side
+		n := 0
+		for i := 0; i < len(img.Pix); i += 4 {
+			if img.Pix[i] == Blue.R && img.Pix[i+1] == Blue.G && img.Pix[i+2] == Blue.B {
+				n++
+			}
+		}
+		if want := 180; n < want {
+			t.Errorf("%s: drew %d pixels, want at least %d", tt.name, n, want)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package drawing
+
+import (
+	"image/color"
+	"math"
+)
+
+// Distance returns how far the color is from the range's reference color in
+// the range's color space, taking the lightness weight into account.
+//
+// For LAB this is the CIE76 delta E, where a difference of about 2.3 is just
+// noticeable. For HSV it's the distance between the colors in the HSV cone,
+// from 0 to about 2.2.
+func (cr *ColorRange) Distance(in color.RGBA) float64 {
+	kL := cr.LightnessWeight
+	if kL <= 0 {
+		kL = 1
+	}
+
+	if cr.Space == HSV {
+		x1, y1, z1 := hsvCone(in)
+		x2, y2, z2 := hsvCone(cr.Ref)
+		dz := (z1 - z2) / kL
+		return math.Sqrt((x1-x2)*(x1-x2) + (y1-y2)*(y1-y2) + dz*dz)
+	}
+
+	l1, a1, b1 := toLab(in)
+	l2, a2, b2 := toLab(cr.Ref)
+	dl := (l1 - l2) / kL
+	return math.Sqrt(dl*dl + (a1-a2)*(a1-a2) + (b1-b2)*(b1-b2))
+}
+
+// DeltaE returns the CIE76 color difference between two colors, where about
+// 2.3 is just noticeable.
+func DeltaE(c1, c2 color.RGBA) float64 {
+	l1, a1, b1 := toLab(c1)
+	l2, a2, b2 := toLab(c2)
+	return math.Sqrt((l1-l2)*(l1-l2) + (a1-a2)*(a1-a2) + (b1-b2)*(b1-b2))
+}
+
+// hsvCone returns the color's position in the HSV cone, where the hue is the
+// angle, saturation * value the radius, and value the height.
+func hsvCone(in color.RGBA) (float64, float64, float64) {
+	h, s, v := toHSV(in)
+	sin, cos := math.Sincos(h * math.Pi / 180)
+	return s * v * cos, s * v * sin, v
+}
+
+// toLab converts an sRGB color to CIELAB, using the D65 white point.
+//
+// For details, see - https://en.wikipedia.org/wiki/CIELAB_color_space
+func toLab(in color.RGBA) (float64, float64, float64) {
+	// sRGB to linear RGB
+	linear := func(c uint8) float64 {
+		v := float64(c) / 0xff
+		if v <= 0.04045 {
+			return v / 12.92
+		}
+		return math.Pow((v+0.055)/1.055, 2.4)
+	}
+	r, g, b := linear(in.R), linear(in.G), linear(in.B)
+
+	// Linear RGB to XYZ, relative to the D65 white point
+	x := (0.4124*r + 0.3576*g + 0.1805*b) / 0.95047
+	y := (0.2126*r + 0.7152*g + 0.0722*b) / 1.0
+	z := (0.0193*r + 0.1192*g + 0.9505*b) / 1.08883
+
+	f := func(t float64) float64 {
+		if t > 216.0/24389.0 {
+			return math.Cbrt(t)
+		}
+		return (24389.0/27.0*t + 16) / 116
+	}
+	fx, fy, fz := f(x), f(y), f(z)
+	return 116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)
+}
@@ -0,0 +1,253 @@
+package drawing
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// DEFAULT_PROFILE is the name of the built in color profile, made from Ranges.
+const DEFAULT_PROFILE = "default"
+
+// Profile is a named set of color ranges, e.g. for a foreman who marks their
+// redlines with red pen rather than yellow highlighter.
+type Profile struct {
+	Name        string
+	Description string
+	Ranges      ColorRanges
+}
+
+// Profiles is a map of color profiles by name
+type Profiles map[string]*Profile
+
+// DefaultProfiles returns the profiles with only the built in default profile.
+func DefaultProfiles() Profiles {
+	return Profiles{
+		DEFAULT_PROFILE: {
+			Name:        DEFAULT_PROFILE,
+			Description: "Yellow highlighter on black and white asbuilts",
+			Ranges:      Ranges,
+		},
+	}
+}
+
+// Get returns the named profile, or the default profile if name is empty.
+func (p Profiles) Get(name string) (*Profile, error) {
+	if name == "" {
+		name = DEFAULT_PROFILE
+	}
+	if prof, ok := p[name]; ok {
+		return prof, nil
+	}
+	return nil, fmt.Errorf("unknown color profile '%s'", name)
+}
+
+// profileFile is the layout of a color profile file.
+//
+// For example, in YAML:
+//
+//	profiles:
+//	  - name: red-pen
+//	    description: Red pen on black and white asbuilts
+//	    ranges:
+//	      - name: whiteish
+//	        meaning: paper
+//	        rgb: {min: "#dfe3e2", max: "#ffffff"}
+//	        make: "#ffffff"
+//	      - name: reddish
+//	        meaning: new
+//	        hsv: {min: [340, 0.35, 0.4], max: [20, 1, 1]}
+//	        make: "#6495ed"
+//	      - name: bluish
+//	        meaning: note
+//	        perceptual: {space: lab, ref: "#2a4fb0", tolerance: 35, lightness_weight: 2}
+//	        make: "#2a4fb0"
+type profileFile struct {
+	Profiles []profileConfig `json:"profiles" yaml:"profiles"`
+}
+
+// profileConfig is a single profile in a profile file
+type profileConfig struct {
+	Name        string        `json:"name" yaml:"name"`
+	Description string        `json:"description" yaml:"description"`
+	Ranges      []rangeConfig `json:"ranges" yaml:"ranges"`
+}
+
+// rangeConfig is a single color range in a profile file. Only one of RGB, HSV
+// and Perceptual may be given.
+type rangeConfig struct {
+	Name       string            `json:"name" yaml:"name"`
+	Meaning    string            `json:"meaning" yaml:"meaning"`
+	RGB        *rgbConfig        `json:"rgb" yaml:"rgb"`
+	HSV        *hsvConfig        `json:"hsv" yaml:"hsv"`
+	Perceptual *perceptualConfig `json:"perceptual" yaml:"perceptual"`
+	Make       string            `json:"make" yaml:"make"`
+}
+
+// rgbConfig is the min and max colors of an RGB range, as hex colors
+type rgbConfig struct {
+	Min string `json:"min" yaml:"min"`
+	Max string `json:"max" yaml:"max"`
+}
+
+// hsvConfig is the min and max [hue, saturation, value] of an HSV range
+type hsvConfig struct {
+	Min [3]float64 `json:"min" yaml:"min"`
+	Max [3]float64 `json:"max" yaml:"max"`
+}
+
+// perceptualConfig is the reference color (as a hex color) and tolerance of a
+// perceptual range, matched in the lab or hsv color space.
+type perceptualConfig struct {
+	Space           string  `json:"space" yaml:"space"`
+	Ref             string  `json:"ref" yaml:"ref"`
+	Tolerance       float64 `json:"tolerance" yaml:"tolerance"`
+	LightnessWeight float64 `json:"lightness_weight" yaml:"lightness_weight"`
+}
+
+// LoadProfiles loads the color profiles in the given JSON or YAML file. The
+// built in default profile is always included, unless the file replaces it.
+func LoadProfiles(path string) (Profiles, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "os.ReadFile(%s): failed to read color profiles", path)
+	}
+
+	var pf profileFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(b, &pf)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &pf)
+	default:
+		return nil, fmt.Errorf("LoadProfiles(%s): color profiles must be .json, .yaml or .yml", path)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "LoadProfiles(%s): failed to decode color profiles", path)
+	}
+
+	profiles := DefaultProfiles()
+	for _, pc := range pf.Profiles {
+		prof, err := pc.profile()
+		if err != nil {
+			return nil, errors.Wrapf(err, "LoadProfiles(%s)", path)
+		}
+		profiles[prof.Name] = prof
+	}
+	return profiles, nil
+}
+
+// profile converts the profile config into a Profile
+func (pc profileConfig) profile() (*Profile, error) {
+	if pc.Name == "" {
+		return nil, errors.New("color profile is missing a name")
+	}
+
+	prof := Profile{
+		Name:        pc.Name,
+		Description: pc.Description,
+	}
+	for i, rc := range pc.Ranges {
+		cr, err := rc.colorRange()
+		if err != nil {
+			return nil, errors.Wrapf(err, "profile '%s' range %d", pc.Name, i+1)
+		}
+		prof.Ranges = append(prof.Ranges, cr)
+	}
+	return &prof, nil
+}
+
+// colorRange converts the range config into a ColorRange
+func (rc rangeConfig) colorRange() (ColorRange, error) {
+	cr := ColorRange{
+		Name:    rc.Name,
+		Meaning: rc.Meaning,
+	}
+
+	switch rc.Meaning {
+	case PAPER, LINEWORK, NEW_STRAND, REMOVED, NOTE:
+	default:
+		return cr, fmt.Errorf("unknown meaning '%s'", rc.Meaning)
+	}
+
+	var err error
+	if cr.Make, err = ParseHex(rc.Make); err != nil {
+		return cr, errors.Wrap(err, "make")
+	}
+
+	given := 0
+	for _, ok := range []bool{rc.RGB != nil, rc.HSV != nil, rc.Perceptual != nil} {
+		if ok {
+			given++
+		}
+	}
+	if given > 1 {
+		return cr, errors.New("only one of rgb, hsv and perceptual can be given")
+	}
+
+	switch {
+	case rc.RGB != nil:
+		cr.Kind = BOX
+		cr.Space = RGB
+		min, err := ParseHex(rc.RGB.Min)
+		if err != nil {
+			return cr, errors.Wrap(err, "rgb min")
+		}
+		max, err := ParseHex(rc.RGB.Max)
+		if err != nil {
+			return cr, errors.Wrap(err, "rgb max")
+		}
+		cr.RMin, cr.GMin, cr.BMin = min.R, min.G, min.B
+		cr.RMax, cr.GMax, cr.BMax = max.R, max.G, max.B
+	case rc.HSV != nil:
+		cr.Kind = BOX
+		cr.Space = HSV
+		cr.HMin, cr.SMin, cr.VMin = rc.HSV.Min[0], rc.HSV.Min[1], rc.HSV.Min[2]
+		cr.HMax, cr.SMax, cr.VMax = rc.HSV.Max[0], rc.HSV.Max[1], rc.HSV.Max[2]
+	case rc.Perceptual != nil:
+		pc := rc.Perceptual
+		cr.Kind = PERCEPTUAL
+		switch pc.Space {
+		case LAB, HSV:
+			cr.Space = pc.Space
+		case "":
+			cr.Space = LAB
+		default:
+			return cr, fmt.Errorf("perceptual ranges must use the lab or hsv space, not '%s'", pc.Space)
+		}
+		if cr.Ref, err = ParseHex(pc.Ref); err != nil {
+			return cr, errors.Wrap(err, "perceptual ref")
+		}
+		if pc.Tolerance <= 0 {
+			return cr, errors.New("perceptual tolerance must be greater than 0")
+		}
+		if pc.LightnessWeight < 0 {
+			return cr, errors.New("perceptual lightness_weight can't be negative")
+		}
+		cr.Tolerance = pc.Tolerance
+		cr.LightnessWeight = pc.LightnessWeight
+	default:
+		return cr, errors.New("one of rgb, hsv or perceptual must be given")
+	}
+	return cr, nil
+}
+
+// ParseHex parses a hex color like "#6495ed" into a color.RGBA
+func ParseHex(s string) (color.RGBA, error) {
+	h := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(h) != 6 {
+		return color.RGBA{}, fmt.Errorf("invalid hex color '%s'", s)
+	}
+	v, err := strconv.ParseUint(h, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid hex color '%s'", s)
+	}
+	return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 0xff}, nil
+}
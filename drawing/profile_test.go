@@ -0,0 +1,114 @@
+package drawing
+
+import (
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadProfilesExample(t *testing.T) {
+	profiles, err := LoadProfiles(filepath.Join("..", "profiles.example.yaml"))
+	if err != nil {
+		t.Fatalf("LoadProfiles: %v", err)
+	}
+
+	for _, name := range []string{DEFAULT_PROFILE, "red-pen", "green-marker", "yellow-highlighter", "scanned-highlighter"} {
+		prof, err := profiles.Get(name)
+		if err != nil {
+			t.Errorf("Get(%s): %v", name, err)
+			continue
+		}
+		if len(prof.Ranges) == 0 {
+			t.Errorf("profile %s has no ranges", name)
+		}
+	}
+
+	red, _ := profiles.Get("red-pen")
+	c := testCanvas()
+	c.SetRanges(red.Ranges)
+	r := c.GetRange(color.RGBA{0xd0, 0x20, 0x20, 0xff})
+	if r == nil || r.Meaning != NEW_STRAND {
+		t.Errorf("red-pen GetRange(red) = %v, want a %s range", r, NEW_STRAND)
+	}
+}
+
+func TestLoadProfilesJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	data := `{"profiles": [{
+		"name": "blue-pen",
+		"ranges": [
+			{"name": "bluish", "meaning": "new", "perceptual": {"ref": "#2a4fb0", "tolerance": 20}, "make": "#6495ed"}
+		]
+	}]}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	profiles, err := LoadProfiles(path)
+	if err != nil {
+		t.Fatalf("LoadProfiles: %v", err)
+	}
+	prof, err := profiles.Get("blue-pen")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	cr := prof.Ranges[0]
+	if cr.Kind != PERCEPTUAL || cr.Space != LAB || cr.Tolerance != 20 {
+		t.Errorf("range = %+v, want a perceptual lab range with a tolerance of 20", cr)
+	}
+	if want := (color.RGBA{0x2a, 0x4f, 0xb0, 0xff}); cr.Ref != want {
+		t.Errorf("ref = %v, want %v", cr.Ref, want)
+	}
+
+	// The default profile is still there
+	if _, err := profiles.Get(""); err != nil {
+		t.Errorf("Get(\"\"): %v", err)
+	}
+}
+
+func TestLoadProfilesErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		data  string
+		error string
+	}{
+		{"bad extension", "profiles.txt", "", "must be .json, .yaml or .yml"},
+		{"no name", "p.yaml", "profiles: [{ranges: []}]", "missing a name"},
+		{"bad meaning", "p.yaml", `profiles: [{name: x, ranges: [{meaning: foo, rgb: {min: "#000000", max: "#ffffff"}, make: "#000000"}]}]`, "unknown meaning"},
+		{"bad hex", "p.yaml", `profiles: [{name: x, ranges: [{meaning: new, rgb: {min: "#00", max: "#ffffff"}, make: "#000000"}]}]`, "invalid hex color"},
+		{"no bounds", "p.yaml", `profiles: [{name: x, ranges: [{meaning: new, make: "#000000"}]}]`, "one of rgb, hsv or perceptual"},
+		{"two bounds", "p.yaml", `profiles: [{name: x, ranges: [{meaning: new, rgb: {min: "#000000", max: "#ffffff"}, hsv: {min: [0, 0, 0], max: [1, 1, 1]}, make: "#000000"}]}]`, "only one of"},
+		{"no tolerance", "p.yaml", `profiles: [{name: x, ranges: [{meaning: new, perceptual: {ref: "#ffffff"}, make: "#000000"}]}]`, "tolerance must be greater than 0"},
+		{"rgb perceptual", "p.yaml", `profiles: [{name: x, ranges: [{meaning: new, perceptual: {space: rgb, ref: "#ffffff", tolerance: 1}, make: "#000000"}]}]`, "lab or hsv"},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), tt.file)
+		if err := os.WriteFile(path, []byte(tt.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := LoadProfiles(path)
+		if err == nil || !strings.Contains(err.Error(), tt.error) {
+			t.Errorf("%s: LoadProfiles error = %v, want it to contain %q", tt.name, err, tt.error)
+		}
+	}
+}
+
+func TestParseHex(t *testing.T) {
+	got, err := ParseHex(" #6495ED ")
+	if err != nil {
+		t.Fatalf("ParseHex: %v", err)
+	}
+	if want := (color.RGBA{0x64, 0x95, 0xed, 0xff}); got != want {
+		t.Errorf("ParseHex = %v, want %v", got, want)
+	}
+
+	for _, s := range []string{"", "#fff", "#gggggg", "#12345678"} {
+		if _, err := ParseHex(s); err == nil {
+			t.Errorf("ParseHex(%q) didn't return an error", s)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package drawing
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"math/cmplx"
+)
+
+// registerSize is the width & height of the downsampled images used for
+// registration. It must be a power of 2 for our FFT.
+const registerSize = 512
+
+// minConfidence is the lowest phase correlation peak we'll accept as a match.
+// Unrelated images peak around 0.02, while a redline and its asbuilt are
+// usually above 0.1.
+const minConfidence = 0.05
+
+// Maximum rotation (radians) and scale difference we expect between a scanned
+// redline and the original asbuilt.
+const (
+	maxRotation = 15 * math.Pi / 180
+	maxScale    = 1.3
+)
+
+// darkLevel is the brightest 16-bit channel value a pixel can have and still
+// count as linework.
+const darkLevel = 0x8000
+
+// ErrNoRegistration is returned when the redline and running asbuilt could not
+// be confidently aligned.
+var ErrNoRegistration = errors.New("could not align the redline with the running asbuilt")
+
+// Register estimates the transform that maps pixels on the redline onto the
+// running asbuilt, using the black linework both images share.
+//
+// Both images are downsampled, then the rotation and scale are found by phase
+// correlating the log-polar magnitude spectra of the two images (the
+// Fourier-Mellin method). Once the redline has been rotated and scaled to
+// match, a second phase correlation finds the translation.
+//
+// For details, see - https://en.wikipedia.org/wiki/Phase_correlation
+func (c *Canvas) Register(redline, running image.Image) (Transform, error) {
+	cl := c.log.With().Str("func", "Register").Logger()
+	n := registerSize
+
+	// Use the same downsampling factor for both images, so any difference in
+	// scan DPI shows up as a difference in scale.
+	rb, ab := redline.Bounds(), running.Bounds()
+	maxDim := maxInt(maxInt(rb.Dx(), rb.Dy()), maxInt(ab.Dx(), ab.Dy()))
+	f := int(math.Ceil(float64(maxDim) / float64(n)))
+	if f < 1 {
+		f = 1
+	}
+
+	rl := darkMask(redline, f, n)
+	ra := darkMask(running, f, n)
+
+	// Find the rotation and scale from the magnitude spectra, which don't
+	// change with translation.
+	lp1 := logPolar(spectrum(rl, n), n)
+	lp2 := logPolar(spectrum(ra, n), n)
+	step := math.Log(float64(n)/2) / float64(n)
+	maxRho := int(math.Ceil(math.Log(maxScale)/step)) + 1
+	maxTheta := int(math.Ceil(maxRotation/(math.Pi/float64(n)))) + 1
+	dRho, dTheta, _ := correlationPeak(correlate(lp1, lp2, n), n, maxRho, maxTheta)
+
+	theta := dTheta * math.Pi / float64(n)
+	scale := math.Exp(-dRho * step)
+	cl.Debug().Float64("rotation", theta*180/math.Pi).Float64("scale", scale).Msg("rotation and scale estimate")
+
+	// The magnitude spectrum can't tell apart a rotation of theta and one of
+	// theta+pi, so try both and keep whichever translation matches best.
+	best := Transform{}
+	center := float64(n) / 2
+	for _, rot := range []float64{theta, theta + math.Pi} {
+		warped := warp(rl, n, scale, rot, center)
+		dx, dy, peak := correlationPeak(correlate(warped, ra, n), n, n/2, n/2)
+		if peak <= best.Confidence {
+			continue
+		}
+
+		// Convert from the downsampled grid back to full size pixels.
+		ff := float64(f)
+		o := (ff - 1) / 2
+		fc := ff*center + o
+		sin, cos := math.Sincos(rot)
+		best = Transform{
+			Scale:      scale,
+			Rotation:   rot,
+			TX:         ff*center + ff*dx + o - scale*(cos*fc-sin*fc),
+			TY:         ff*center + ff*dy + o - scale*(sin*fc+cos*fc),
+			Confidence: peak,
+		}
+	}
+	cl.Debug().Interface("transform", best).Msg("registration result")
+
+	if best.Confidence < minConfidence {
+		return best, fmt.Errorf("%w: best match %.4f is below %.4f", ErrNoRegistration, best.Confidence, minConfidence)
+	}
+	return best, nil
+}
+
+// darkMask downsamples the image by f into an n x n grid, where each cell is
+// the fraction of its pixels that are dark linework. A pixel only counts if
+// all of its channels are dark, so colored ink like the yellow highlighter is
+// ignored and we only match on the linework both images share.
+func darkMask(img image.Image, f, n int) []float64 {
+	mask := make([]float64, n*n)
+	bnds := img.Bounds()
+	area := float64(f * f)
+
+	for y := bnds.Min.Y; y < bnds.Max.Y; y++ {
+		gy := (y - bnds.Min.Y) / f
+		if gy >= n {
+			break
+		}
+		for x := bnds.Min.X; x < bnds.Max.X; x++ {
+			gx := (x - bnds.Min.X) / f
+			if gx >= n {
+				break
+			}
+			r, g, b, _ := img.At(x, y).RGBA()
+			if maxInt(maxInt(int(r), int(g)), int(b)) < darkLevel {
+				mask[gy*n+gx] += 1 / area
+			}
+		}
+	}
+	return mask
+}
+
+// spectrum returns the centered, high-pass filtered magnitude spectrum of the
+// mask after applying a Hann window to soften the edges of the image.
+func spectrum(mask []float64, n int) []float64 {
+	buf := make([]complex128, n*n)
+	for y := 0; y < n; y++ {
+		wy := 0.5 - 0.5*math.Cos(2*math.Pi*float64(y)/float64(n-1))
+		for x := 0; x < n; x++ {
+			wx := 0.5 - 0.5*math.Cos(2*math.Pi*float64(x)/float64(n-1))
+			buf[y*n+x] = complex(mask[y*n+x]*wx*wy, 0)
+		}
+	}
+	fft2(buf, n, false)
+
+	mag := make([]float64, n*n)
+	half := n / 2
+	for y := 0; y < n; y++ {
+		// Shift the zero frequency to the center.
+		sy := (y + half) % n
+		ey := float64(y-half) / float64(n)
+		for x := 0; x < n; x++ {
+			sx := (x + half) % n
+			ex := float64(x-half) / float64(n)
+
+			// High-pass filter to emphasise the linework over the low frequencies
+			// the window and page shape add.
+			h := math.Cos(math.Pi*ex) * math.Cos(math.Pi*ey)
+			mag[y*n+x] = math.Log1p(cmplx.Abs(buf[sy*n+sx])) * (1 - h) * (2 - h)
+		}
+	}
+	return mag
+}
+
+// logPolar resamples a centered magnitude spectrum onto a log-polar grid, where
+// rows are angles over [0, pi) and columns are the log of the radius.
+func logPolar(mag []float64, n int) []float64 {
+	out := make([]float64, n*n)
+	center := float64(n) / 2
+	step := math.Log(center) / float64(n)
+
+	for row := 0; row < n; row++ {
+		sin, cos := math.Sincos(float64(row) * math.Pi / float64(n))
+		for col := 0; col < n; col++ {
+			r := math.Exp(float64(col) * step)
+			out[row*n+col] = bilinear(mag, n, center+r*cos, center+r*sin)
+		}
+	}
+	return out
+}
+
+// warp scales and rotates the mask about center, returning a mask where
+// out(v) = mask(A^-1 (v - center) + center) for A = scale * R(rotation).
+func warp(mask []float64, n int, scale, rotation, center float64) []float64 {
+	out := make([]float64, n*n)
+	sin, cos := math.Sincos(-rotation)
+	for y := 0; y < n; y++ {
+		vy := float64(y) - center
+		for x := 0; x < n; x++ {
+			vx := float64(x) - center
+			ux := (cos*vx-sin*vy)/scale + center
+			uy := (sin*vx+cos*vy)/scale + center
+			out[y*n+x] = bilinear(mask, n, ux, uy)
+		}
+	}
+	return out
+}
+
+// bilinear samples the grid at (x, y), treating anything outside it as 0.
+func bilinear(grid []float64, n int, x, y float64) float64 {
+	x0, y0 := int(math.Floor(x)), int(math.Floor(y))
+	fx, fy := x-float64(x0), y-float64(y0)
+
+	at := func(x, y int) float64 {
+		if x < 0 || y < 0 || x >= n || y >= n {
+			return 0
+		}
+		return grid[y*n+x]
+	}
+	top := at(x0, y0)*(1-fx) + at(x0+1, y0)*fx
+	bottom := at(x0, y0+1)*(1-fx) + at(x0+1, y0+1)*fx
+	return top*(1-fy) + bottom*fy
+}
+
+// correlate returns the phase correlation surface of a and b. If b is a
+// shifted by (dx, dy), the surface peaks at (dx, dy), wrapped around n.
+func correlate(a, b []float64, n int) []float64 {
+	fa := make([]complex128, n*n)
+	fb := make([]complex128, n*n)
+	for i := range a {
+		fa[i] = complex(a[i], 0)
+		fb[i] = complex(b[i], 0)
+	}
+	fft2(fa, n, false)
+	fft2(fb, n, false)
+
+	// Normalized cross-power spectrum
+	for i := range fa {
+		p := fb[i] * cmplx.Conj(fa[i])
+		if m := cmplx.Abs(p); m > 1e-12 {
+			fa[i] = p / complex(m, 0)
+		} else {
+			fa[i] = 0
+		}
+	}
+	fft2(fa, n, true)
+
+	out := make([]float64, n*n)
+	for i, v := range fa {
+		out[i] = real(v)
+	}
+	return out
+}
+
+// correlationPeak finds the highest point of the correlation surface within
+// maxDX/maxDY of the origin, and returns its sub-pixel position and value.
+func correlationPeak(surface []float64, n, maxDX, maxDY int) (float64, float64, float64) {
+	bx, by, best := 0, 0, math.Inf(-1)
+	for dy := -maxDY; dy <= maxDY; dy++ {
+		for dx := -maxDX; dx <= maxDX; dx++ {
+			v := surface[wrap(dy, n)*n+wrap(dx, n)]
+			if v > best {
+				bx, by, best = dx, dy, v
+			}
+		}
+	}
+
+	// Fit a parabola through the peak and its neighbours for sub-pixel accuracy.
+	sub := func(l, c, r float64) float64 {
+		d := l - 2*c + r
+		if d >= 0 {
+			return 0
+		}
+		return 0.5 * (l - r) / d
+	}
+	at := func(dx, dy int) float64 { return surface[wrap(dy, n)*n+wrap(dx, n)] }
+	x := float64(bx) + sub(at(bx-1, by), best, at(bx+1, by))
+	y := float64(by) + sub(at(bx, by-1), best, at(bx, by+1))
+	return x, y, best
+}
+
+// wrap wraps i into [0, n)
+func wrap(i, n int) int {
+	return ((i % n) + n) % n
+}
+
+// fft2 performs an in place 2D FFT (or inverse FFT) on an n x n grid.
+func fft2(buf []complex128, n int, invert bool) {
+	for y := 0; y < n; y++ {
+		fft(buf[y*n:(y+1)*n], invert)
+	}
+	col := make([]complex128, n)
+	for x := 0; x < n; x++ {
+		for y := 0; y < n; y++ {
+			col[y] = buf[y*n+x]
+		}
+		fft(col, invert)
+		for y := 0; y < n; y++ {
+			buf[y*n+x] = col[y]
+		}
+	}
+}
+
+// fft performs an in place iterative radix-2 FFT. len(a) must be a power of 2.
+// The inverse is scaled by 1/len(a).
+func fft(a []complex128, invert bool) {
+	n := len(a)
+
+	// Bit reversal permutation
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			a[i], a[j] = a[j], a[i]
+		}
+	}
+
+	for length := 2; length <= n; length <<= 1 {
+		ang := 2 * math.Pi / float64(length)
+		if !invert {
+			ang = -ang
+		}
+		wl := cmplx.Rect(1, ang)
+		for i := 0; i < n; i += length {
+			w := complex(1, 0)
+			for j := 0; j < length/2; j++ {
+				u, v := a[i+j], a[i+j+length/2]*w
+				a[i+j] = u + v
+				a[i+j+length/2] = u - v
+				w *= wl
+			}
+		}
+	}
+
+	if invert {
+		for i := range a {
+			a[i] /= complex(float64(n), 0)
+		}
+	}
+}
+
+// maxInt returns the larger of two integers
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,109 @@
+package drawing
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// testMap returns a white image with random black linework, a bit like an
+// asbuilt.
+func testMap(w, h int, seed int64) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), &image.Uniform{White}, image.Point{}, draw.Src)
+
+	c := testCanvas()
+	c.SetImage(img)
+	r := rand.New(rand.NewSource(seed))
+	for i := 0; i < 60; i++ {
+		x1, y1 := r.Intn(w-200)+100, r.Intn(h-200)+100
+		x2, y2 := x1+r.Intn(400)-200, y1+r.Intn(400)-200
+		for t := 0; t < 3; t++ {
+			c.DrawAntialiased(Pixel{X: x1 + t, Y: y1}, Pixel{X: x2 + t, Y: y2}, Black)
+		}
+	}
+	return img
+}
+
+// transformed returns the image transformed by t, so a pixel p of src ends up
+// at t.Apply(p).
+func transformed(src *image.RGBA, t Transform) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(b)
+	draw.Draw(dst, b, &image.Uniform{White}, image.Point{}, draw.Src)
+
+	sin, cos := math.Sincos(-t.Rotation)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			// Invert the transform to find the source pixel
+			vx, vy := (float64(x)-t.TX)/t.Scale, (float64(y)-t.TY)/t.Scale
+			sx, sy := int(math.Round(cos*vx-sin*vy)), int(math.Round(sin*vx+cos*vy))
+			if (image.Point{sx, sy}).In(b) {
+				dst.SetRGBA(x, y, src.RGBAAt(sx, sy))
+			}
+		}
+	}
+	return dst
+}
+
+func TestRegister(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping registration in short mode")
+	}
+	redline := testMap(1400, 1000, 1)
+
+	tests := []struct {
+		name string
+		t    Transform
+	}{
+		{"translation", Translation(37, -22)},
+		{"rotation", Transform{Scale: 1, Rotation: 2 * math.Pi / 180, TX: 30, TY: -10}},
+		{"scale", Transform{Scale: 1.04, TX: -20, TY: -15}},
+	}
+
+	c := testCanvas()
+	for _, tt := range tests {
+		running := transformed(redline, tt.t)
+		got, err := c.Register(redline, running)
+		if err != nil {
+			t.Errorf("%s: Register: %v", tt.name, err)
+			continue
+		}
+
+		// Check where a few points across the image end up.
+		for _, p := range []Pixel{{200, 200}, {1200, 200}, {700, 500}, {200, 800}, {1200, 800}} {
+			wx, wy := tt.t.Apply(p)
+			gx, gy := got.Apply(p)
+			if d := math.Hypot(wx-gx, wy-gy); d > 5 {
+				t.Errorf("%s: %v lands at (%.1f, %.1f), want (%.1f, %.1f)", tt.name, p, gx, gy, wx, wy)
+			}
+		}
+	}
+}
+
+func TestRegisterUnrelated(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping registration in short mode")
+	}
+	c := testCanvas()
+	_, err := c.Register(testMap(800, 600, 1), testMap(800, 600, 2))
+	if !errors.Is(err, ErrNoRegistration) {
+		t.Errorf("Register of unrelated images = %v, want %v", err, ErrNoRegistration)
+	}
+}
+
+func TestTransformApply(t *testing.T) {
+	tr := Transform{Scale: 2, Rotation: math.Pi / 2, TX: 10, TY: 20}
+	x, y := tr.Apply(Pixel{X: 1, Y: 0})
+	if math.Abs(x-10) > 1e-9 || math.Abs(y-22) > 1e-9 {
+		t.Errorf("Apply = (%v, %v), want (10, 22)", x, y)
+	}
+
+	x, y = Translation(3, -4).Apply(Pixel{X: 5, Y: 5})
+	if x != 8 || y != 1 {
+		t.Errorf("Translation Apply = (%v, %v), want (8, 1)", x, y)
+	}
+}
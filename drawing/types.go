@@ -4,12 +4,14 @@ import (
 	"github.com/rs/zerolog"
 	"image"
 	"image/color"
+	"math"
 )
 
 // Canvas to draw on
 type Canvas struct {
-	img image.Image
-	log zerolog.Logger
+	img    image.Image
+	log    zerolog.Logger
+	ranges ColorRanges
 }
 
 // Pixel is an x,y point on the image
@@ -34,7 +36,7 @@ type ColorCount struct {
 	Range *ColorRange
 }
 
-// ChangeMap is the map of changes we made by named range
+// ChangeMap is the map of changes we made by the meaning of the range
 type ChangeMap map[string][]*Pixel
 
 // ColorMap is a map of colors to their color counts
@@ -64,8 +66,17 @@ type RangeItem struct{}
 // RangeList is a nicer way of declaring an array of RangeItems
 type RangeList []RangeItem
 
-// ColorRange holds min/max values for colors
+// ColorRange holds min/max values for colors, or a reference color and a
+// tolerance for perceptual matching.
 type ColorRange struct {
+	// How the range is matched, BOX or PERCEPTUAL. An empty kind is treated
+	// as BOX.
+	Kind string
+
+	// The color space the range is matched in. Box ranges use RGB or HSV, and
+	// perceptual ranges use LAB or HSV. An empty space is treated as RGB.
+	Space string
+
 	// The R, G, B minimum and maximum range to
 	// match this color.
 	RMin uint8
@@ -75,9 +86,29 @@ type ColorRange struct {
 	BMin uint8
 	BMax uint8
 
+	// The hue (degrees, 0-360), saturation and value (0-1) minimum and
+	// maximum range to match this color. If HMin is larger than HMax, the hue
+	// range wraps around 0, e.g. 340 to 20 for reds.
+	HMin, HMax float64
+	SMin, SMax float64
+	VMin, VMax float64
+
+	// The reference color of a perceptual range, and how far away (in the
+	// range's color space) a color can be and still match it.
+	Ref       color.RGBA
+	Tolerance float64
+
+	// How much less a difference in lightness counts than a difference in
+	// hue or saturation for perceptual ranges, so lighting and paper tone
+	// matter less. 0 is treated as 1, i.e. lightness counts the same.
+	LightnessWeight float64
+
 	// The name given to this range
 	Name string
 
+	// What pixels in this range mean on the drawing, e.g. NEW_STRAND
+	Meaning string
+
 	// If we replace this color with another
 	Replace bool
 
@@ -87,3 +118,29 @@ type ColorRange struct {
 
 // ColorRanges is a nicer way of declaring an array of ColorRange
 type ColorRanges []ColorRange
+
+// Transform is a similarity transform that maps pixels on the redline onto
+// the running asbuilt:
+//
+//	x' = Scale * (cos(Rotation)*x - sin(Rotation)*y) + TX
+//	y' = Scale * (sin(Rotation)*x + cos(Rotation)*y) + TY
+type Transform struct {
+	Scale    float64
+	Rotation float64 // radians
+	TX, TY   float64
+
+	// How well the images matched, from the phase correlation peak.
+	Confidence float64
+}
+
+// Translation returns a transform that only shifts pixels by dx, dy.
+func Translation(dx, dy int) Transform {
+	return Transform{Scale: 1, TX: float64(dx), TY: float64(dy), Confidence: 1}
+}
+
+// Apply returns where the given redline pixel falls on the running asbuilt.
+func (t Transform) Apply(p Pixel) (float64, float64) {
+	sin, cos := math.Sincos(t.Rotation)
+	x, y := float64(p.X), float64(p.Y)
+	return t.Scale*(cos*x-sin*y) + t.TX, t.Scale*(sin*x+cos*y) + t.TY
+}
@@ -31,12 +31,48 @@ const (
 	YELLOWISH = "yellowish"
 )
 
-// Ranges is the ranges we're going to check during preprocesing
+// Meanings a color range can have on a drawing.
+const (
+	// PAPER is the background of the scan, which we clean up to white
+	PAPER = "paper"
+	// LINEWORK is the black linework of the asbuilt, which we clean up to black
+	LINEWORK = "linework"
+	// NEW_STRAND is new work marked on the redline, which we draw on the running
+	NEW_STRAND = "new"
+	// REMOVED is work marked on the redline as removed
+	REMOVED = "removed"
+	// NOTE is a note written on the redline
+	NOTE = "note"
+)
+
+// Kinds of color range matching.
+const (
+	// BOX ranges match colors within min/max bounds on each channel
+	BOX = "box"
+	// PERCEPTUAL ranges match colors within a tolerance of a reference color
+	PERCEPTUAL = "perceptual"
+)
+
+// Color spaces a color range can be matched in.
+const (
+	// RGB ranges are min/max boxes on the red, green and blue channels
+	RGB = "rgb"
+	// HSV ranges are min/max boxes on hue, saturation and value, or the
+	// distance between colors in the HSV cone
+	HSV = "hsv"
+	// LAB ranges are the CIELAB color difference (delta E) between colors
+	LAB = "lab"
+)
+
+// Ranges is the default ranges we're going to check during preprocesing, used
+// when no other color profile is selected.
 var Ranges = ColorRanges{
 	{
 		// Because this isn't really "white", its colors
 		// we want to identify as white-ish, like greys and such
-		Name: WHITEISH,
+		Name:    WHITEISH,
+		Meaning: PAPER,
+		Space:   RGB,
 		// Pure white, #ffffff
 		RMax: 0xff, GMax: 0xff, BMax: 0xff,
 		// Minimum to fit our "white" is really a grew, #e0e0e0
@@ -45,7 +81,9 @@ var Ranges = ColorRanges{
 		Make:    color.RGBA{0xff, 0xff, 0xff, 0xff},
 	},
 	{
-		Name: YELLOWISH,
+		Name:    YELLOWISH,
+		Meaning: NEW_STRAND,
+		Space:   RGB,
 		// "pure" (?) yellow, #ffff00
 		RMax: 0xfe, GMax: 0xff, BMax: 0xaf,
 		// Minimum to fit our "yellow"
@@ -54,7 +92,9 @@ var Ranges = ColorRanges{
 		Make:    color.RGBA{0x64, 0x95, 0xed, 0xff}, // change it to blue?
 	},
 	{
-		Name: BLACKISH,
+		Name:    BLACKISH,
+		Meaning: LINEWORK,
+		Space:   RGB,
 		// Maximum to fit our "black"
 		RMax: 0x39, GMax: 0x39, BMax: 0x39,
 		// Pure black, #000000
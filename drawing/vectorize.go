@@ -0,0 +1,517 @@
+package drawing
+
+import (
+	"image"
+	"math"
+)
+
+// simplifyTolerance is how far (in pixels) a traced polyline may stray from
+// its simplified version, see simplify.
+const simplifyTolerance = 2.0
+
+// closeRadius is the radius (in pixels) of the closing applied to the mask
+// before thinning, which bridges gaps up to twice as wide.
+const closeRadius = 2
+
+// maxHole is the largest area (in pixels) of a hole inside a stroke that gets
+// filled in before thinning. Holes would otherwise thin into loops.
+const maxHole = 400
+
+// junctionGap is how far apart (in pixels) junction pixels can be and still
+// be part of the same junction.
+const junctionGap = 2
+
+// spurLength is the length (in pixels) below which a polyline with a loose end
+// is thrown away. Thinning a thick highlighter stroke leaves short spurs at its
+// corners and ends, and stray specks of color trace into tiny lines too.
+const spurLength = 20
+
+// Vectorize turns a set of changed pixels, like a highlighter stroke, into
+// polylines following the middle of the stroke.
+//
+// The pixels are put in a mask, which is closed to bridge small gaps, has its
+// small holes filled in, and is then thinned down to a one pixel wide
+// skeleton. The skeleton is traced into polylines that run between its end
+// points and junctions, short spurs are pruned, and each polyline is
+// simplified with the Douglas-Peucker algorithm.
+func (c *Canvas) Vectorize(pixels []*Pixel) Lines {
+	cl := c.log.With().Str("func", "Vectorize").Logger()
+	if len(pixels) == 0 {
+		return nil
+	}
+
+	m := newMask(pixels)
+	m.close(closeRadius)
+	m.fillHoles(maxHole)
+	m.thin()
+	m.pruneCorners()
+
+	// Prune the short spurs thinning leaves sticking out of junctions and
+	// corners, the specks, and the tiny loops left around junctions. A spur has
+	// a loose end, which is a skeleton pixel with only one neighbour.
+	loose := func(p *Pixel) bool {
+		return m.at(p.X, p.Y) && m.degree(p) == 1
+	}
+	var lines Lines
+	for _, line := range m.trace() {
+		first, last := line[0], line[len(line)-1]
+		if len(line) < spurLength && (*first == *last || loose(first) || loose(last)) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	lines = joinLines(lines)
+
+	for i, line := range lines {
+		lines[i] = simplify(line, simplifyTolerance)
+	}
+	cl.Debug().Int("pixels", len(pixels)).Int("lines", len(lines)).Msg("vectorized")
+	return lines
+}
+
+// mask is a binary image covering the bounding box of a set of pixels, with a
+// one pixel border so we never have to bounds check a pixel's neighbours.
+type mask struct {
+	bits []bool
+	rect image.Rectangle
+	w    int
+}
+
+// newMask creates a mask with the given pixels set
+func newMask(pixels []*Pixel) *mask {
+	var rect image.Rectangle
+	for i, p := range pixels {
+		r := image.Rect(p.X, p.Y, p.X+1, p.Y+1)
+		if i == 0 {
+			rect = r
+			continue
+		}
+		rect = rect.Union(r)
+	}
+	// Leave room for the border, and for closing to grow into.
+	rect = rect.Inset(-closeRadius - 1)
+
+	m := &mask{
+		bits: make([]bool, rect.Dx()*rect.Dy()),
+		rect: rect,
+		w:    rect.Dx(),
+	}
+	for _, p := range pixels {
+		m.set(p.X, p.Y, true)
+	}
+	return m
+}
+
+// at returns whether the pixel at (x, y) is set, anything outside the mask is not
+func (m *mask) at(x, y int) bool {
+	if !(image.Point{x, y}.In(m.rect)) {
+		return false
+	}
+	return m.bits[(y-m.rect.Min.Y)*m.w+x-m.rect.Min.X]
+}
+
+// set sets the pixel at (x, y)
+func (m *mask) set(x, y int, v bool) {
+	m.bits[(y-m.rect.Min.Y)*m.w+x-m.rect.Min.X] = v
+}
+
+// neighbours of a pixel, clockwise from north. The order matters for thin.
+var neighbours = [8]image.Point{
+	{0, -1}, {1, -1}, {1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}, {-1, -1},
+}
+
+// close performs a morphological closing (dilations, then erosions) with a
+// square of the given radius, which fills the pinholes and small gaps scanning
+// leaves in a stroke.
+func (m *mask) close(radius int) {
+	grow := func(v bool) {
+		out := make([]bool, len(m.bits))
+		copy(out, m.bits)
+		for y := m.rect.Min.Y + 1; y < m.rect.Max.Y-1; y++ {
+			for x := m.rect.Min.X + 1; x < m.rect.Max.X-1; x++ {
+				if m.at(x, y) == v {
+					continue
+				}
+				for _, n := range neighbours {
+					if m.at(x+n.X, y+n.Y) == v {
+						out[(y-m.rect.Min.Y)*m.w+x-m.rect.Min.X] = v
+						break
+					}
+				}
+			}
+		}
+		m.bits = out
+	}
+	for i := 0; i < radius; i++ {
+		grow(true)
+	}
+	for i := 0; i < radius; i++ {
+		grow(false)
+	}
+}
+
+// fillHoles fills in the unset areas of the mask that are enclosed by set
+// pixels, and no larger than maxArea.
+func (m *mask) fillHoles(maxArea int) {
+	seen := make([]bool, len(m.bits))
+	var area []image.Point
+	for i := range m.bits {
+		if m.bits[i] || seen[i] {
+			continue
+		}
+
+		// Flood fill the unset area, checking if it reaches the edge of the mask.
+		area = append(area[:0], image.Point{m.rect.Min.X + i%m.w, m.rect.Min.Y + i/m.w})
+		seen[i] = true
+		enclosed := true
+		for j := 0; j < len(area); j++ {
+			p := area[j]
+			if p.X == m.rect.Min.X || p.Y == m.rect.Min.Y || p.X == m.rect.Max.X-1 || p.Y == m.rect.Max.Y-1 {
+				enclosed = false
+			}
+			for k := 0; k < 8; k += 2 {
+				q := p.Add(neighbours[k])
+				if !q.In(m.rect) || m.at(q.X, q.Y) {
+					continue
+				}
+				if qi := (q.Y-m.rect.Min.Y)*m.w + q.X - m.rect.Min.X; !seen[qi] {
+					seen[qi] = true
+					area = append(area, q)
+				}
+			}
+		}
+
+		if enclosed && len(area) <= maxArea {
+			for _, p := range area {
+				m.set(p.X, p.Y, true)
+			}
+		}
+	}
+}
+
+// thin thins the mask down to a one pixel wide skeleton using the Zhang-Suen
+// thinning algorithm.
+//
+// For details, see - https://rosettacode.org/wiki/Zhang-Suen_thinning_algorithm
+func (m *mask) thin() {
+	var remove []image.Point
+	for changed := true; changed; {
+		changed = false
+		for step := 0; step < 2; step++ {
+			remove = remove[:0]
+			for y := m.rect.Min.Y + 1; y < m.rect.Max.Y-1; y++ {
+				for x := m.rect.Min.X + 1; x < m.rect.Max.X-1; x++ {
+					if m.at(x, y) && m.thinnable(x, y, step) {
+						remove = append(remove, image.Point{x, y})
+					}
+				}
+			}
+			for _, p := range remove {
+				m.set(p.X, p.Y, false)
+			}
+			changed = changed || len(remove) > 0
+		}
+	}
+}
+
+// thinnable checks if the pixel can be removed in the given Zhang-Suen step
+func (m *mask) thinnable(x, y, step int) bool {
+	var p [8]bool
+	count := 0
+	for i, n := range neighbours {
+		p[i] = m.at(x+n.X, y+n.Y)
+		if p[i] {
+			count++
+		}
+	}
+	if count < 2 || count > 6 {
+		return false
+	}
+
+	// The number of set to unset transitions around the pixel must be exactly
+	// one, otherwise removing it would split the stroke.
+	transitions := 0
+	for i := range p {
+		if !p[i] && p[(i+1)%8] {
+			transitions++
+		}
+	}
+	if transitions != 1 {
+		return false
+	}
+
+	north, east, south, west := p[0], p[2], p[4], p[6]
+	if step == 0 {
+		return !(north && east && south) && !(east && south && west)
+	}
+	return !(north && east && west) && !(north && south && west)
+}
+
+// pruneCorners removes the corner pixels of the staircases thinning leaves,
+// where two of a pixel's orthogonal neighbours are already diagonally
+// connected, so every skeleton pixel along a line has exactly two neighbours.
+func (m *mask) pruneCorners() {
+	for y := m.rect.Min.Y + 1; y < m.rect.Max.Y-1; y++ {
+		for x := m.rect.Min.X + 1; x < m.rect.Max.X-1; x++ {
+			if !m.at(x, y) {
+				continue
+			}
+			// Check each pair of orthogonal neighbours, e.g. north and east.
+			for i := 0; i < 8; i += 2 {
+				a, b := neighbours[i], neighbours[(i+2)%8]
+				if !m.at(x+a.X, y+a.Y) || !m.at(x+b.X, y+b.Y) {
+					continue
+				}
+				// The other three neighbours on the far side must be unset, or
+				// the corner is holding something else on.
+				clear := true
+				for j := 4; j <= 6; j++ {
+					n := neighbours[(i+j)%8]
+					if m.at(x+n.X, y+n.Y) {
+						clear = false
+						break
+					}
+				}
+				if clear {
+					m.set(x, y, false)
+					break
+				}
+			}
+		}
+	}
+}
+
+// degree returns the number of set neighbours the pixel has
+func (m *mask) degree(p *Pixel) int {
+	d := 0
+	for _, n := range neighbours {
+		if m.at(p.X+n.X, p.Y+n.Y) {
+			d++
+		}
+	}
+	return d
+}
+
+// trace walks the skeleton and returns the polylines running between its nodes,
+// which are the end points (one neighbour) and junctions (three or more). Any
+// closed loops without nodes are returned as polylines that start and end on
+// the same pixel.
+//
+// Thinning leaves junctions as small clusters of pixels, so junction pixels
+// within junctionGap of each other are treated as a single junction, and the
+// polylines meeting there all end at its center.
+func (m *mask) trace() Lines {
+	idx := func(p image.Point) int { return (p.Y-m.rect.Min.Y)*m.w + p.X - m.rect.Min.X }
+	visited := make([]bool, len(m.bits))
+	isNode := func(p image.Point) bool {
+		return m.degree(&Pixel{X: p.X, Y: p.Y}) != 2
+	}
+
+	// Group the junction pixels into clusters, and find the center of each.
+	junction := make(map[int]*Pixel)
+	for y := m.rect.Min.Y; y < m.rect.Max.Y; y++ {
+		for x := m.rect.Min.X; x < m.rect.Max.X; x++ {
+			p := image.Point{x, y}
+			if _, ok := junction[idx(p)]; ok || !m.at(x, y) || m.degree(&Pixel{X: x, Y: y}) < 3 {
+				continue
+			}
+			cluster := []image.Point{p}
+			center := &Pixel{}
+			junction[idx(p)] = center
+			for i := 0; i < len(cluster); i++ {
+				for dy := -junctionGap; dy <= junctionGap; dy++ {
+					for dx := -junctionGap; dx <= junctionGap; dx++ {
+						q := cluster[i].Add(image.Point{dx, dy})
+						if !m.at(q.X, q.Y) || m.degree(&Pixel{X: q.X, Y: q.Y}) < 3 {
+							continue
+						}
+						if _, ok := junction[idx(q)]; ok {
+							continue
+						}
+						junction[idx(q)] = center
+						cluster = append(cluster, q)
+					}
+				}
+			}
+			var sx, sy int
+			for _, q := range cluster {
+				sx += q.X
+				sy += q.Y
+			}
+			center.X, center.Y = sx/len(cluster), sy/len(cluster)
+		}
+	}
+
+	// end returns the pixel a polyline ending on the node should end at.
+	end := func(p image.Point) *Pixel {
+		if center, ok := junction[idx(p)]; ok {
+			return &Pixel{X: center.X, Y: center.Y}
+		}
+		return &Pixel{X: p.X, Y: p.Y}
+	}
+
+	// walk follows the skeleton from the node start through next until it
+	// reaches a node, or comes back around to start.
+	walk := func(start, next image.Point) Line {
+		line := Line{end(start)}
+		prev, cur := start, next
+		for {
+			if cur == start || isNode(cur) {
+				return append(line, end(cur))
+			}
+			line = append(line, &Pixel{X: cur.X, Y: cur.Y})
+			visited[idx(cur)] = true
+
+			// Prefer stepping onto a node, then an unvisited pixel.
+			var step *image.Point
+			for _, n := range neighbours {
+				p := cur.Add(n)
+				if p == prev || !m.at(p.X, p.Y) {
+					continue
+				}
+				if isNode(p) || p == start {
+					step = &p
+					break
+				}
+				if !visited[idx(p)] && step == nil {
+					pp := p
+					step = &pp
+				}
+			}
+			if step == nil {
+				return line
+			}
+			prev, cur = cur, *step
+		}
+	}
+
+	var lines Lines
+	for y := m.rect.Min.Y; y < m.rect.Max.Y; y++ {
+		for x := m.rect.Min.X; x < m.rect.Max.X; x++ {
+			start := image.Point{x, y}
+			if !m.at(x, y) || !isNode(start) {
+				continue
+			}
+			// Follow each path leaving the node. Neighbouring nodes are either
+			// part of the same junction, or a spur too short to keep, and the
+			// pixels walk visits are marked so we won't walk the same path back
+			// from the node at the other end.
+			for _, n := range neighbours {
+				next := start.Add(n)
+				if !m.at(next.X, next.Y) || isNode(next) || visited[idx(next)] {
+					continue
+				}
+				lines = append(lines, walk(start, next))
+			}
+		}
+	}
+
+	// Anything left over is a loop with no nodes on it.
+	for y := m.rect.Min.Y; y < m.rect.Max.Y; y++ {
+		for x := m.rect.Min.X; x < m.rect.Max.X; x++ {
+			start := image.Point{x, y}
+			if !m.at(x, y) || visited[idx(start)] || isNode(start) {
+				continue
+			}
+			visited[idx(start)] = true
+			for _, n := range neighbours {
+				next := start.Add(n)
+				if m.at(next.X, next.Y) {
+					lines = append(lines, walk(start, next))
+					break
+				}
+			}
+		}
+	}
+	return lines
+}
+
+// joinLines joins polylines that meet end to end at a point no other polyline
+// touches, which happens where a spur was pruned off a junction.
+func joinLines(lines Lines) Lines {
+	for joined := true; joined; {
+		joined = false
+
+		ends := make(map[Pixel][]int)
+		for i, l := range lines {
+			ends[*l[0]] = append(ends[*l[0]], i)
+			if *l[0] != *l[len(l)-1] {
+				ends[*l[len(l)-1]] = append(ends[*l[len(l)-1]], i)
+			}
+		}
+
+		// Go through the lines in order, so the result doesn't depend on the
+		// map's order.
+		for _, l := range lines {
+			for _, p := range []Pixel{*l[0], *l[len(l)-1]} {
+				idx := ends[p]
+				if len(idx) != 2 || idx[0] == idx[1] {
+					continue
+				}
+				a, b := lines[idx[0]], lines[idx[1]]
+				// Orient the lines so a ends and b starts at p.
+				if *a[len(a)-1] != p {
+					a = reverse(a)
+				}
+				if *b[0] != p {
+					b = reverse(b)
+				}
+				lines[idx[0]] = append(a, b[1:]...)
+				lines = append(lines[:idx[1]], lines[idx[1]+1:]...)
+				joined = true
+				break
+			}
+			if joined {
+				break
+			}
+		}
+	}
+	return lines
+}
+
+// reverse returns a reversed copy of the line
+func reverse(line Line) Line {
+	out := make(Line, len(line))
+	for i, p := range line {
+		out[len(line)-1-i] = p
+	}
+	return out
+}
+
+// simplify reduces the polyline to the fewest points that keep it within
+// tolerance pixels of the original, using the Douglas-Peucker algorithm.
+//
+// For details, see - https://en.wikipedia.org/wiki/Ramer%E2%80%93Douglas%E2%80%93Peucker_algorithm
+func simplify(line Line, tolerance float64) Line {
+	if len(line) < 3 {
+		return line
+	}
+
+	first, last := line[0], line[len(line)-1]
+	idx, max := 0, 0.0
+	for i := 1; i < len(line)-1; i++ {
+		if d := segmentDistance(line[i], first, last); d > max {
+			idx, max = i, d
+		}
+	}
+	if max <= tolerance {
+		return Line{first, last}
+	}
+
+	left := simplify(line[:idx+1], tolerance)
+	right := simplify(line[idx:], tolerance)
+	return append(left[:len(left)-1:len(left)-1], right...)
+}
+
+// segmentDistance returns the distance from p to the line segment a-b
+func segmentDistance(p, a, b *Pixel) float64 {
+	px, py := float64(p.X), float64(p.Y)
+	ax, ay := float64(a.X), float64(a.Y)
+	dx, dy := float64(b.X)-ax, float64(b.Y)-ay
+
+	t := 0.0
+	if l := dx*dx + dy*dy; l > 0 {
+		t = math.Max(0, math.Min(1, ((px-ax)*dx+(py-ay)*dy)/l))
+	}
+	return math.Hypot(px-(ax+t*dx), py-(ay+t*dy))
+}
@@ -0,0 +1,166 @@
+package drawing
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+// stroke returns the pixels of a stroke of the given width along the line
+// from (x1, y1) to (x2, y2), like a highlighter would leave.
+func stroke(x1, y1, x2, y2 int, width float64) []*Pixel {
+	var pixels []*Pixel
+	minX, maxX := math.Min(float64(x1), float64(x2))-width, math.Max(float64(x1), float64(x2))+width
+	minY, maxY := math.Min(float64(y1), float64(y2))-width, math.Max(float64(y1), float64(y2))+width
+	a, b := &Pixel{X: x1, Y: y1}, &Pixel{X: x2, Y: y2}
+	for y := int(minY); y <= int(maxY); y++ {
+		for x := int(minX); x <= int(maxX); x++ {
+			if segmentDistance(&Pixel{X: x, Y: y}, a, b) <= width/2 {
+				pixels = append(pixels, &Pixel{X: x, Y: y})
+			}
+		}
+	}
+	return pixels
+}
+
+// points formats the lines as their points, rather than pointers
+func points(lines ...Line) string {
+	var sb strings.Builder
+	for _, line := range lines {
+		sb.WriteString("[")
+		for i, p := range line {
+			if i > 0 {
+				sb.WriteString(" ")
+			}
+			fmt.Fprintf(&sb, "(%d, %d)", p.X, p.Y)
+		}
+		sb.WriteString("]")
+	}
+	return sb.String()
+}
+
+// near checks if p is within d pixels of (x, y)
+func near(p *Pixel, x, y int, d float64) bool {
+	return math.Hypot(float64(p.X-x), float64(p.Y-y)) <= d
+}
+
+func TestVectorizeStraightStroke(t *testing.T) {
+	c := testCanvas()
+	lines := c.Vectorize(stroke(20, 30, 220, 130, 12))
+
+	if len(lines) != 1 {
+		t.Fatalf("Vectorize returned %d lines, want 1: %s", len(lines), points(lines...))
+	}
+	line := lines[0]
+	if len(line) != 2 {
+		t.Fatalf("line has %d points, want 2: %s", len(line), points(line))
+	}
+
+	// The ends should be near the ends of the stroke, either way around.
+	first, last := line[0], line[1]
+	if first.X > last.X {
+		first, last = last, first
+	}
+	if !near(first, 20, 30, 10) || !near(last, 220, 130, 10) {
+		t.Errorf("line runs from %v to %v, want about (20, 30) to (220, 130)", *first, *last)
+	}
+}
+
+func TestVectorizeBentStroke(t *testing.T) {
+	c := testCanvas()
+	a, corner, b := &Pixel{X: 20, Y: 200}, &Pixel{X: 150, Y: 40}, &Pixel{X: 300, Y: 180}
+	pixels := append(stroke(a.X, a.Y, corner.X, corner.Y, 10), stroke(corner.X, corner.Y, b.X, b.Y, 10)...)
+	lines := c.Vectorize(pixels)
+
+	if len(lines) != 1 {
+		t.Fatalf("Vectorize returned %d lines, want 1: %s", len(lines), points(lines...))
+	}
+
+	// The medial axis rounds off the corner a little, so there may be a point
+	// or two extra around it, but every point should be on the bent line.
+	line := lines[0]
+	if len(line) < 3 || len(line) > 5 {
+		t.Errorf("line has %d points, want 3 to 5", len(line))
+	}
+	nearCorner := false
+	for _, p := range line {
+		if d := math.Min(segmentDistance(p, a, corner), segmentDistance(p, corner, b)); d > 6 {
+			t.Errorf("point %v is %.1f pixels off the stroke", *p, d)
+		}
+		nearCorner = nearCorner || near(p, corner.X, corner.Y, 10)
+	}
+	if !nearCorner {
+		t.Errorf("no point near the corner at %v", *corner)
+	}
+}
+
+func TestVectorizeCrossing(t *testing.T) {
+	c := testCanvas()
+	pixels := append(stroke(20, 150, 280, 150, 10), stroke(150, 20, 150, 280, 10)...)
+	lines := c.Vectorize(pixels)
+
+	// Four arms meeting at the junction
+	if len(lines) != 4 {
+		t.Fatalf("Vectorize returned %d lines, want 4: %s", len(lines), points(lines...))
+	}
+	for _, line := range lines {
+		if !near(line[0], 150, 150, 5) && !near(line[len(line)-1], 150, 150, 5) {
+			t.Errorf("line %s doesn't end at the junction", points(line))
+		}
+	}
+}
+
+func TestVectorizeFillsHoles(t *testing.T) {
+	c := testCanvas()
+	var pixels []*Pixel
+	for _, p := range stroke(20, 50, 300, 50, 16) {
+		// Punch holes in the stroke, like a badly scanned highlighter
+		if (p.X/20)%2 == 0 && p.Y > 46 && p.Y < 54 {
+			continue
+		}
+		pixels = append(pixels, p)
+	}
+
+	lines := c.Vectorize(pixels)
+	if len(lines) != 1 || len(lines[0]) != 2 {
+		t.Errorf("Vectorize = %s, want a single straight line", points(lines...))
+	}
+}
+
+func TestVectorizeDropsSpecks(t *testing.T) {
+	c := testCanvas()
+	pixels := stroke(20, 50, 300, 50, 10)
+	pixels = append(pixels, stroke(100, 200, 103, 201, 3)...)
+
+	lines := c.Vectorize(pixels)
+	if len(lines) != 1 {
+		t.Errorf("Vectorize returned %d lines, want 1: %s", len(lines), points(lines...))
+	}
+
+	if lines := c.Vectorize(nil); lines != nil {
+		t.Errorf("Vectorize(nil) = %v, want nil", lines)
+	}
+}
+
+func TestSimplify(t *testing.T) {
+	var line Line
+	for x := 0; x <= 100; x++ {
+		// A gentle wobble that's within tolerance
+		line = append(line, &Pixel{X: x, Y: x % 2})
+	}
+	for y := 1; y <= 50; y++ {
+		line = append(line, &Pixel{X: 100, Y: y})
+	}
+
+	got := simplify(line, simplifyTolerance)
+	want := []Pixel{{0, 0}, {100, 0}, {100, 50}}
+	if len(got) != len(want) {
+		t.Fatalf("simplify = %s, want %v", points(got), want)
+	}
+	for i := range want {
+		if !near(got[i], want[i].X, want[i].Y, 1) {
+			t.Errorf("point %d = %v, want %v", i, *got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,248 @@
+// Package dxf provides the CAD export of a job: the lines drawn on its running
+// asbuilt and the callouts, as a DXF drawing in sheet units with the running
+// asbuilt referenced under them, so drafters can paste the work straight into
+// the source drawing.
+package dxf
+
+import (
+	"caddae/drawing"
+	"caddae/jobdb"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Sheet units
+const (
+	INCHES      = "in"
+	MILLIMETERS = "mm"
+)
+
+// UNDERLAY_LAYER is the layer the running asbuilt is referenced on
+const UNDERLAY_LAYER = "CADDAE_UNDERLAY"
+
+// underlayTypes are the extensions of the images that can be referenced under
+// the work
+var underlayTypes = map[string]bool{
+	".png":  true,
+	".jpg":  true,
+	".jpeg": true,
+}
+
+// layerColors are the AutoCAD color indexes the work performed dates cycle
+// through: red, blue, green, magenta, orange and cyan.
+var layerColors = []int{1, 5, 3, 6, 30, 4}
+
+// Scale returns the sheet units in an inch
+func (s Sheet) Scale() float64 {
+	if s.Units == MILLIMETERS {
+		return 25.4
+	}
+	return 1
+}
+
+// Point returns where the running asbuilt pixel is on the sheet
+func (s Sheet) Point(p drawing.Pixel) Point {
+	return Point{
+		X: float64(p.X) / s.DPI * s.Scale(),
+		Y: float64(s.Height-p.Y) / s.DPI * s.Scale(),
+	}
+}
+
+// Length returns the length of a number of pixels on the sheet
+func (s Sheet) Length(pixels float64) float64 {
+	return pixels / s.DPI * s.Scale()
+}
+
+// LayerName returns the name of the layer the work performed on the date goes
+// on, e.g. "WPD_2021-07-16" for 07/16/2021. Layer names can't have slashes.
+func LayerName(wpd string) string {
+	if parts := strings.Split(wpd, "/"); len(parts) == 3 {
+		return fmt.Sprintf("WPD_%s-%s-%s", parts[2], parts[0], parts[1])
+	}
+	r := strings.NewReplacer("/", "-", `\`, "-", ":", "-", ";", "-", "*", "-", "?", "-", `"`, "-", "<", "-", ">", "-", "|", "-", "=", "-", "`", "-")
+	return "WPD_" + r.Replace(wpd)
+}
+
+// FromRuns makes the drawing of a job's runs: the lines of each run as
+// polylines on a layer for its work performed date, its callout box and text
+// on a callout layer next to it, and the running asbuilt under everything.
+func FromRuns(runs []jobdb.Run, o Options) (*Drawing, error) {
+	if len(runs) == 0 {
+		return nil, jobdb.ErrNoJob
+	}
+	if o.Units == "" {
+		o.Units = INCHES
+	}
+	if _, err := unitsCode(o.Units); err != nil {
+		return nil, err
+	}
+
+	underlay, saved := o.Underlay, image.Point{}
+	if underlay == "" && !o.NoUnderlay {
+		var err error
+		if underlay, saved, err = lastImage(runs); err != nil {
+			return nil, err
+		}
+	}
+	if o.NoUnderlay {
+		underlay = ""
+	}
+	if underlay != "" && !underlayTypes[strings.ToLower(filepath.Ext(underlay))] {
+		return nil, fmt.Errorf("dxf.FromRuns: underlay %s isn't a PNG or JPEG image, which is all CAD can reference", underlay)
+	}
+
+	// Runs recorded before the running asbuilt's size was recorded only
+	// have their lines, so we go by the underlay's size for them. If the
+	// last running asbuilt saved has moved, it's still referenced by the
+	// size it was saved at, for the drafter to find.
+	var fallback image.Point
+	if underlay != "" {
+		size, err := imageSize(underlay)
+		if err != nil && (o.Underlay != "" || saved == image.Point{}) {
+			return nil, err
+		}
+		if err != nil {
+			size = saved
+		}
+		fallback = size
+	}
+
+	d := &Drawing{Units: o.Units}
+	layers := make(map[string]bool)
+	var sheet Sheet
+	for _, r := range runs {
+		var err error
+		if sheet, err = runSheet(r, o, fallback); err != nil {
+			return nil, err
+		}
+
+		layer := LayerName(r.Wpd)
+		if !layers[layer] {
+			color := layerColors[(len(d.Layers)/2)%len(layerColors)]
+			d.Layers = append(d.Layers, Layer{Name: layer, Color: color}, Layer{Name: layer + "_CALLOUT", Color: color})
+			layers[layer] = true
+		}
+
+		for _, l := range r.Lines {
+			if len(l) < 2 {
+				continue
+			}
+			pl := Polyline{Layer: layer}
+			for _, p := range l {
+				pl.Points = append(pl.Points, sheet.Point(p))
+			}
+			d.Polylines = append(d.Polylines, pl)
+		}
+
+		box := r.Callout.Box
+		if box.Empty() {
+			continue
+		}
+		d.Polylines = append(d.Polylines, Polyline{
+			Layer: layer + "_CALLOUT",
+			Points: []Point{
+				sheet.Point(drawing.Pixel{X: box.Min.X, Y: box.Min.Y}),
+				sheet.Point(drawing.Pixel{X: box.Max.X, Y: box.Min.Y}),
+				sheet.Point(drawing.Pixel{X: box.Max.X, Y: box.Max.Y}),
+				sheet.Point(drawing.Pixel{X: box.Min.X, Y: box.Max.Y}),
+			},
+			Closed: true,
+		})
+		if len(r.Callout.Text) == 0 {
+			continue
+		}
+
+		// Text is sized in points, 72 to the inch. Without a size, the
+		// lines share the height of the box.
+		height := r.Callout.Size / 72 * sheet.Scale()
+		if height == 0 {
+			height = sheet.Length(float64(box.Dy()) / float64(len(r.Callout.Text)+1))
+		}
+		d.Texts = append(d.Texts, Text{
+			Layer:  layer + "_CALLOUT",
+			At:     sheet.Point(drawing.Pixel{X: box.Min.X, Y: box.Min.Y}),
+			Height: height,
+			Width:  sheet.Length(float64(box.Dx())),
+			Lines:  r.Callout.Text,
+		})
+	}
+
+	if underlay != "" {
+		path, err := filepath.Abs(underlay)
+		if err != nil {
+			return nil, errors.Wrapf(err, "dxf.FromRuns: underlay %s", underlay)
+		}
+		d.Layers = append(d.Layers, Layer{Name: UNDERLAY_LAYER, Color: 8})
+		d.Image = &Image{
+			Layer:     UNDERLAY_LAYER,
+			Path:      path,
+			Pixels:    fallback,
+			PixelSize: sheet.Length(1),
+		}
+	}
+	return d, nil
+}
+
+// lastImage returns the last running asbuilt the runs saved as an image, and
+// the size it was saved at. Running asbuilts saved as PDF packages are skipped,
+// since CAD can't reference them under the work. It's an error if they all
+// were, and an empty path if none were saved at all.
+func lastImage(runs []jobdb.Run) (string, image.Point, error) {
+	var packages int
+	for i := len(runs) - 1; i >= 0; i-- {
+		r := runs[i]
+		if r.Output == "" {
+			continue
+		}
+		if underlayTypes[strings.ToLower(filepath.Ext(r.Output))] {
+			return r.Output, r.Size, nil
+		}
+		packages++
+	}
+	if packages > 0 {
+		return "", image.Point{}, fmt.Errorf("dxf.FromRuns: the running asbuilts of %s were saved as PDF packages, which CAD can't reference, give an image underlay or leave it out", runs[0].Job)
+	}
+	return "", image.Point{}, nil
+}
+
+// runSheet returns the sheet of the run's running asbuilt, from the size and
+// DPI recorded for the run, the DPI in the options, or the size of the
+// underlay.
+func runSheet(r jobdb.Run, o Options, size image.Point) (Sheet, error) {
+	s := Sheet{DPI: r.DPI, Height: r.Size.Y, Units: o.Units}
+	if o.DPI != 0 {
+		s.DPI = o.DPI
+	}
+	if s.Height == 0 {
+		s.Height = size.Y
+	}
+	if s.DPI == 0 {
+		return s, fmt.Errorf("dxf.FromRuns: %s run %d (%s) has no scan DPI recorded, give the DPI it was scanned at", r.Job, r.ID, r.Wpd)
+	}
+	if s.Height == 0 {
+		return s, fmt.Errorf("dxf.FromRuns: %s run %d (%s) has no running asbuilt size recorded, give an underlay to go by", r.Job, r.ID, r.Wpd)
+	}
+	return s, nil
+}
+
+// imageSize returns the size of the image file in pixels
+func imageSize(path string) (image.Point, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return image.Point{}, errors.Wrapf(err, "dxf: failed to open underlay %s", path)
+	}
+	defer f.Close()
+
+	conf, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return image.Point{}, errors.Wrapf(err, "dxf: failed to read underlay %s", path)
+	}
+	return image.Pt(conf.Width, conf.Height), nil
+}
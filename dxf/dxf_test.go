@@ -0,0 +1,341 @@
+package dxf
+
+import (
+	"bytes"
+	"caddae/drawing"
+	"caddae/jobdb"
+	"image"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// pair is a group code and value read back from a DXF file
+type pair struct {
+	code  int
+	value string
+}
+
+// readPairs reads the group code and value pairs of a DXF file
+func readPairs(t *testing.T, b []byte) []pair {
+	t.Helper()
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	if len(lines)%2 != 0 {
+		t.Fatalf("DXF has %d lines, want pairs", len(lines))
+	}
+	var pairs []pair
+	for i := 0; i < len(lines); i += 2 {
+		code, err := strconv.Atoi(strings.TrimSpace(lines[i]))
+		if err != nil {
+			t.Fatalf("line %d: invalid group code %q", i+1, lines[i])
+		}
+		pairs = append(pairs, pair{code, lines[i+1]})
+	}
+	return pairs
+}
+
+// entity is an entity read back from a DXF file, its pairs by group code
+type entity map[int][]string
+
+// entities returns the entities of the kind in the ENTITIES section
+func entities(pairs []pair, kind string) []entity {
+	var found []entity
+	var cur entity
+	section := ""
+	for i, p := range pairs {
+		if p.code == 2 && i > 0 && pairs[i-1].value == "SECTION" {
+			section = p.value
+		}
+		if p.code == 0 {
+			cur = nil
+			if section == "ENTITIES" && p.value == kind {
+				cur = make(entity)
+				found = append(found, cur)
+			}
+			continue
+		}
+		if cur != nil {
+			cur[p.code] = append(cur[p.code], p.value)
+		}
+	}
+	return found
+}
+
+func float(t *testing.T, s string) float64 {
+	t.Helper()
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		t.Fatalf("invalid number %q", s)
+	}
+	return f
+}
+
+// testRuns returns two runs on a 1000x800 pixel running asbuilt scanned at
+// 100 DPI, 10" by 8".
+func testRuns() []jobdb.Run {
+	size := image.Pt(1000, 800)
+	return []jobdb.Run{
+		{ID: 1, Job: "VZ_LAN_00007054", Wpd: "07/16/2021", Size: size, DPI: 100, Output: "ra_1.png",
+			Lines: []jobdb.Line{{{X: 100, Y: 700}, {X: 300, Y: 700}, {X: 300, Y: 600}}, {{X: 5, Y: 5}}},
+			Callout: jobdb.Callout{
+				Box:  image.Rect(400, 100, 600, 200),
+				Text: []string{"WPD 07/16/2021", "C300-01 = 250'", `{ \ }`},
+				Size: 7.2,
+			}},
+		{ID: 2, Job: "VZ_LAN_00007054", Wpd: "07/19/2021", Size: size, DPI: 100, Output: "ra_2.png",
+			Lines: []jobdb.Line{{{X: 300, Y: 600}, {X: 300, Y: 400}}}},
+	}
+}
+
+func TestSheetPoint(t *testing.T) {
+	s := Sheet{DPI: 100, Height: 800, Units: INCHES}
+	if got := s.Point(drawing.Pixel{X: 250, Y: 800}); got != (Point{2.5, 0}) {
+		t.Errorf("bottom of the sheet = %v, want {2.5 0}", got)
+	}
+	if got := s.Point(drawing.Pixel{X: 0, Y: 0}); got != (Point{0, 8}) {
+		t.Errorf("top of the sheet = %v, want {0 8}", got)
+	}
+	s.Units = MILLIMETERS
+	if got := s.Point(drawing.Pixel{X: 100, Y: 700}); math.Abs(got.X-25.4) > 1e-9 || math.Abs(got.Y-25.4) > 1e-9 {
+		t.Errorf("in millimeters = %v, want {25.4 25.4}", got)
+	}
+}
+
+func TestLayerName(t *testing.T) {
+	for wpd, want := range map[string]string{
+		"07/16/2021": "WPD_2021-07-16",
+		"2021-07-16": "WPD_2021-07-16",
+		"7/16":       "WPD_7-16",
+	} {
+		if got := LayerName(wpd); got != want {
+			t.Errorf("LayerName(%s) = %s, want %s", wpd, got, want)
+		}
+	}
+}
+
+func TestFromRuns(t *testing.T) {
+	d, err := FromRuns(testRuns(), Options{NoUnderlay: true})
+	if err != nil {
+		t.Fatalf("FromRuns: %v", err)
+	}
+	if d.Image != nil {
+		t.Errorf("underlay referenced with NoUnderlay")
+	}
+
+	var names []string
+	for _, l := range d.Layers {
+		names = append(names, l.Name)
+	}
+	want := "WPD_2021-07-16 WPD_2021-07-16_CALLOUT WPD_2021-07-19 WPD_2021-07-19_CALLOUT"
+	if strings.Join(names, " ") != want {
+		t.Errorf("layers = %v, want %s", names, want)
+	}
+	if d.Layers[0].Color == d.Layers[2].Color || d.Layers[0].Color != d.Layers[1].Color {
+		t.Errorf("layer colors = %+v", d.Layers)
+	}
+
+	// Two lines and a callout box, the single pixel line is left out
+	if len(d.Polylines) != 3 {
+		t.Fatalf("%d polylines, want 3", len(d.Polylines))
+	}
+	line := d.Polylines[0]
+	if line.Layer != "WPD_2021-07-16" || len(line.Points) != 3 || line.Points[0] != (Point{1, 1}) || line.Points[2] != (Point{3, 2}) {
+		t.Errorf("line = %+v", line)
+	}
+	box := d.Polylines[1]
+	if !box.Closed || box.Layer != "WPD_2021-07-16_CALLOUT" || box.Points[0] != (Point{4, 7}) || box.Points[2] != (Point{6, 6}) {
+		t.Errorf("callout box = %+v", box)
+	}
+
+	// 7.2pt text is a tenth of an inch high
+	if len(d.Texts) != 1 {
+		t.Fatalf("%d texts, want 1", len(d.Texts))
+	}
+	text := d.Texts[0]
+	if text.At != (Point{4, 7}) || math.Abs(text.Height-0.1) > 1e-9 || text.Width != 2 || len(text.Lines) != 3 {
+		t.Errorf("callout text = %+v", text)
+	}
+
+	if _, err := FromRuns(nil, Options{}); err != jobdb.ErrNoJob {
+		t.Errorf("FromRuns of no runs = %v, want %v", err, jobdb.ErrNoJob)
+	}
+	if _, err := FromRuns(testRuns(), Options{Units: "ft", NoUnderlay: true}); err == nil {
+		t.Errorf("FromRuns in feet succeeded")
+	}
+}
+
+func TestFromRunsWithoutDPI(t *testing.T) {
+	runs := testRuns()
+	runs[0].DPI, runs[0].Size = 0, image.Point{}
+	if _, err := FromRuns(runs, Options{NoUnderlay: true}); err == nil {
+		t.Errorf("FromRuns of a run without a DPI succeeded")
+	}
+
+	// The DPI can be given, and the height taken from the underlay
+	dir := t.TempDir()
+	underlay := filepath.Join(dir, "running.png")
+	f, err := os.Create(underlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	png.Encode(f, image.NewGray(image.Rect(0, 0, 1000, 800)))
+	f.Close()
+
+	d, err := FromRuns(runs, Options{DPI: 100, Underlay: underlay, Units: MILLIMETERS})
+	if err != nil {
+		t.Fatalf("FromRuns: %v", err)
+	}
+	if p := d.Polylines[0].Points[0]; math.Abs(p.X-25.4) > 1e-9 || math.Abs(p.Y-25.4) > 1e-9 {
+		t.Errorf("first point = %v, want {25.4 25.4}", p)
+	}
+	im := d.Image
+	if im == nil || im.Path != underlay || im.Pixels != image.Pt(1000, 800) || math.Abs(im.PixelSize-0.254) > 1e-9 || im.Layer != UNDERLAY_LAYER {
+		t.Errorf("underlay = %+v", im)
+	}
+
+	if _, err := FromRuns(runs, Options{DPI: 100, Underlay: filepath.Join(dir, "missing.png")}); err == nil {
+		t.Errorf("FromRuns with a missing underlay succeeded")
+	}
+}
+
+func TestFromRunsPDFOutputs(t *testing.T) {
+	// The last run saved a PDF package, so the running asbuilt the first run
+	// saved is referenced instead
+	runs := testRuns()
+	runs[0].Size = image.Pt(900, 700)
+	runs[1].Output = "ra_2.pdf"
+	d, err := FromRuns(runs, Options{})
+	if err != nil {
+		t.Fatalf("FromRuns: %v", err)
+	}
+	if im := d.Image; im == nil || filepath.Base(im.Path) != "ra_1.png" || im.Pixels != image.Pt(900, 700) {
+		t.Errorf("underlay = %+v, want ra_1.png", im)
+	}
+
+	runs[0].Output = "ra_1.PDF"
+	if _, err := FromRuns(runs, Options{}); err == nil || !strings.Contains(err.Error(), "PDF packages") {
+		t.Errorf("FromRuns with only PDF packages = %v", err)
+	}
+	if d, err := FromRuns(runs, Options{NoUnderlay: true}); err != nil || d.Image != nil {
+		t.Errorf("FromRuns with only PDF packages and no underlay = %v", err)
+	}
+	if _, err := FromRuns(runs, Options{Underlay: "package.pdf"}); err == nil || !strings.Contains(err.Error(), "PNG or JPEG") {
+		t.Errorf("FromRuns with a PDF underlay = %v", err)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	runs := testRuns()
+	dir := t.TempDir()
+	runs[1].Output = filepath.Join(dir, "missing.png")
+	d, err := FromRuns(runs, Options{})
+	if err != nil {
+		t.Fatalf("FromRuns: %v", err)
+	}
+	path := filepath.Join(dir, "work.dxf")
+	if err := d.Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pairs := readPairs(t, b)
+
+	// Sections in order, each ended, then the end of the file
+	var sections []string
+	open := false
+	for i, p := range pairs {
+		switch {
+		case p.code == 0 && p.value == "SECTION":
+			if open {
+				t.Fatalf("section in section at pair %d", i)
+			}
+			open = true
+			sections = append(sections, pairs[i+1].value)
+		case p.code == 0 && p.value == "ENDSEC":
+			open = false
+		}
+	}
+	if got := strings.Join(sections, " "); got != "HEADER CLASSES TABLES BLOCKS ENTITIES OBJECTS" {
+		t.Errorf("sections = %s", got)
+	}
+	if last := pairs[len(pairs)-1]; last != (pair{0, "EOF"}) {
+		t.Errorf("last pair = %+v, want EOF", last)
+	}
+
+	// Handles are unique and below the handle seed
+	seed := int64(0)
+	seen := make(map[string]bool)
+	for i, p := range pairs {
+		if i > 0 && pairs[i-1].value == "$HANDSEED" {
+			seed, _ = strconv.ParseInt(p.value, 16, 64)
+			continue
+		}
+		if p.code != 5 && p.code != 105 {
+			continue
+		}
+		if seen[p.value] {
+			t.Errorf("handle %s used twice", p.value)
+		}
+		seen[p.value] = true
+		if h, _ := strconv.ParseInt(p.value, 16, 64); h <= 0 || h >= seed {
+			t.Errorf("handle %s isn't below the seed %x", p.value, seed)
+		}
+	}
+
+	polylines := entities(pairs, "LWPOLYLINE")
+	if len(polylines) != 3 {
+		t.Fatalf("%d LWPOLYLINEs, want 3", len(polylines))
+	}
+	pl := polylines[2]
+	if pl[8][0] != "WPD_2021-07-19" || pl[90][0] != "2" || float(t, pl[10][1]) != 3 || float(t, pl[20][1]) != 4 {
+		t.Errorf("second line = %v", pl)
+	}
+	if polylines[1][70][0] != "1" {
+		t.Errorf("callout box isn't closed: %v", polylines[1])
+	}
+
+	mtexts := entities(pairs, "MTEXT")
+	if len(mtexts) != 1 {
+		t.Fatalf("%d MTEXTs, want 1", len(mtexts))
+	}
+	if got, want := mtexts[0][1][0], `WPD 07/16/2021\PC300-01 = 250'\P\{ \\ \}`; got != want {
+		t.Errorf("MTEXT text = %s, want %s", got, want)
+	}
+	if mtexts[0][71][0] != "1" || float(t, mtexts[0][40][0]) != 0.1 {
+		t.Errorf("MTEXT = %v", mtexts[0])
+	}
+
+	// The underlay is referenced where it was saved, even if it's moved
+	images := entities(pairs, "IMAGE")
+	if len(images) != 1 {
+		t.Fatalf("%d IMAGEs, want 1", len(images))
+	}
+	if images[0][8][0] != UNDERLAY_LAYER || float(t, images[0][13][0]) != 1000 || float(t, images[0][11][0]) != 0.01 {
+		t.Errorf("IMAGE = %v", images[0])
+	}
+	if !bytes.Contains(b, []byte(runs[1].Output)) {
+		t.Errorf("IMAGEDEF doesn't reference %s", runs[1].Output)
+	}
+
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind")
+	}
+}
+
+func TestMTextLong(t *testing.T) {
+	d := &Drawing{Texts: []Text{{Layer: "0", Height: 1, Lines: []string{strings.Repeat("x", 300), strings.Repeat("y", 300)}}}}
+	var b bytes.Buffer
+	if err := d.Write(&b); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	m := entities(readPairs(t, b.Bytes()), "MTEXT")[0]
+	if len(m[3]) != 2 || len(m[3][0]) != 250 || strings.Join(m[3], "")+m[1][0] != strings.Repeat("x", 300)+`\P`+strings.Repeat("y", 300) {
+		t.Errorf("long MTEXT = %v", m)
+	}
+}
@@ -0,0 +1,86 @@
+package dxf
+
+import "image"
+
+// Point is a point on the sheet, in sheet units, with Y going up like it does
+// in CAD.
+type Point struct {
+	X, Y float64
+}
+
+// Sheet turns running asbuilt pixels into sheet units: the scan's DPI, and
+// its height in pixels to flip Y, since images count down from the top and
+// drawings count up from the bottom.
+type Sheet struct {
+	DPI    float64
+	Height int
+
+	// Units is INCHES or MILLIMETERS
+	Units string
+}
+
+// Drawing is what goes in a DXF file: the layers, the polylines and text on
+// them, and the running asbuilt referenced under them.
+type Drawing struct {
+	// Units is INCHES or MILLIMETERS
+	Units string
+
+	Layers    []Layer
+	Polylines []Polyline
+	Texts     []Text
+
+	// Image is the raster underlay, if there is one
+	Image *Image
+}
+
+// Layer is a drawing layer, with the AutoCAD color index everything on it is
+// drawn in.
+type Layer struct {
+	Name  string
+	Color int
+}
+
+// Polyline is a LWPOLYLINE through the points. Closed polylines go back to
+// the first point.
+type Polyline struct {
+	Layer  string
+	Points []Point
+	Closed bool
+}
+
+// Text is an MTEXT of the lines, with its top left corner at At. Height is
+// the height of the text and Width the width it wraps at, in sheet units.
+type Text struct {
+	Layer  string
+	At     Point
+	Height float64
+	Width  float64
+	Lines  []string
+}
+
+// Image is a raster image referenced by the drawing, with its bottom left
+// corner at At. Pixels is its size in pixels, and PixelSize the size of a
+// pixel in sheet units.
+type Image struct {
+	Layer     string
+	Path      string
+	At        Point
+	Pixels    image.Point
+	PixelSize float64
+}
+
+// Options for making a drawing out of a job's runs
+type Options struct {
+	// Units is INCHES or MILLIMETERS, INCHES if empty
+	Units string
+
+	// Underlay is the PNG or JPEG image to reference under the work. If
+	// empty, the last running asbuilt saved as an image is used.
+	Underlay string
+
+	// NoUnderlay leaves the underlay out
+	NoUnderlay bool
+
+	// DPI the running asbuilts were scanned at, for runs recorded without one
+	DPI float64
+}
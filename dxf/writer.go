@@ -0,0 +1,586 @@
+package dxf
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// We write AutoCAD 2000 (AC1015) DXF, the oldest version with LWPOLYLINEs
+// and images that every CAD program still reads. Each object has a handle
+// and points at its owner's handle, so the writer hands them out as it goes,
+// and writes the header with the next free handle last.
+
+// writer writes the group code and value pairs of a DXF file
+type writer struct {
+	b      bytes.Buffer
+	handle int
+}
+
+// next returns the next free handle
+func (w *writer) next() string {
+	w.handle++
+	return strconv.FormatInt(int64(w.handle), 16)
+}
+
+// pair writes a group code and its value
+func (w *writer) pair(code int, value string) {
+	fmt.Fprintf(&w.b, "%3d\n%s\n", code, value)
+}
+
+// int writes a group code and an integer value
+func (w *writer) int(code, value int) {
+	w.pair(code, strconv.Itoa(value))
+}
+
+// float writes a group code and a float value
+func (w *writer) float(code int, value float64) {
+	w.pair(code, strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+// point writes a point with the group code of its X, its Y and Z following
+func (w *writer) point(code int, p Point) {
+	w.float(code, p.X)
+	w.float(code+10, p.Y)
+	w.float(code+20, 0)
+}
+
+// handles are the handles of the objects that point at each other, handed
+// out before anything is written.
+type handles struct {
+	blockRecords, modelRecord, paperRecord string
+	modelLayout, paperLayout               string
+	root, groups, layouts                  string
+	imageDict, imageVars, imageDef         string
+	image, imageReactor                    string
+}
+
+// Write writes the drawing to w as a DXF file.
+func (d *Drawing) Write(w io.Writer) error {
+	units, err := unitsCode(d.Units)
+	if err != nil {
+		return err
+	}
+
+	dw := &writer{}
+	h := handles{
+		blockRecords: dw.next(), modelRecord: dw.next(), paperRecord: dw.next(),
+		modelLayout: dw.next(), paperLayout: dw.next(),
+		root: dw.next(), groups: dw.next(), layouts: dw.next(),
+	}
+	if d.Image != nil {
+		h.imageDict, h.imageVars, h.imageDef = dw.next(), dw.next(), dw.next()
+		h.image, h.imageReactor = dw.next(), dw.next()
+	}
+
+	d.classes(dw)
+	d.tables(dw, h)
+	d.blocks(dw, h)
+	d.entities(dw, h)
+	d.objects(dw, h, units)
+	dw.pair(0, "EOF")
+
+	// The header goes first, but it needs the next free handle
+	hw := &writer{}
+	d.header(hw, units, dw.next())
+
+	bw := bufio.NewWriter(w)
+	bw.Write(hw.b.Bytes())
+	bw.Write(dw.b.Bytes())
+	return bw.Flush()
+}
+
+// Save writes the drawing to a DXF file.
+func (d *Drawing) Save(path string) error {
+	// We first write a temporary file, then if everything is OK we rename it,
+	// so CAD never opens half a drawing.
+	newFile := path + ".tmp"
+	f, err := os.Create(newFile)
+	if err != nil {
+		return errors.Wrapf(err, "os.Create(%s): failed to create drawing", newFile)
+	}
+
+	err = d.Write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(newFile)
+		return errors.Wrapf(err, "dxf.Save(%s): failed to write drawing", path)
+	}
+
+	if err := os.Rename(newFile, path); err != nil {
+		return errors.Wrapf(err, "rename(%s, %s)", newFile, path)
+	}
+	return nil
+}
+
+// unitsCode returns the $INSUNITS code of the units
+func unitsCode(units string) (int, error) {
+	switch units {
+	case INCHES, "":
+		return 1, nil
+	case MILLIMETERS:
+		return 4, nil
+	}
+	return 0, fmt.Errorf("dxf: unknown units '%s', must be %s or %s", units, INCHES, MILLIMETERS)
+}
+
+// extents returns the bottom left and top right corners of everything in the
+// drawing
+func (d *Drawing) extents() (Point, Point) {
+	min := Point{math.Inf(1), math.Inf(1)}
+	max := Point{math.Inf(-1), math.Inf(-1)}
+	add := func(p Point) {
+		min.X, min.Y = math.Min(min.X, p.X), math.Min(min.Y, p.Y)
+		max.X, max.Y = math.Max(max.X, p.X), math.Max(max.Y, p.Y)
+	}
+	for _, pl := range d.Polylines {
+		for _, p := range pl.Points {
+			add(p)
+		}
+	}
+	for _, t := range d.Texts {
+		add(t.At)
+		add(Point{t.At.X + t.Width, t.At.Y - t.Height*float64(len(t.Lines))})
+	}
+	if im := d.Image; im != nil {
+		add(im.At)
+		add(Point{im.At.X + float64(im.Pixels.X)*im.PixelSize, im.At.Y + float64(im.Pixels.Y)*im.PixelSize})
+	}
+	if math.IsInf(min.X, 1) {
+		return Point{}, Point{}
+	}
+	return min, max
+}
+
+// header writes the HEADER section
+func (d *Drawing) header(w *writer, units int, seed string) {
+	min, max := d.extents()
+	w.pair(0, "SECTION")
+	w.pair(2, "HEADER")
+	w.pair(9, "$ACADVER")
+	w.pair(1, "AC1015")
+	w.pair(9, "$HANDSEED")
+	w.pair(5, seed)
+	w.pair(9, "$INSUNITS")
+	w.int(70, units)
+	w.pair(9, "$MEASUREMENT")
+	if units == 1 {
+		w.int(70, 0)
+	} else {
+		w.int(70, 1)
+	}
+	w.pair(9, "$EXTMIN")
+	w.point(10, min)
+	w.pair(9, "$EXTMAX")
+	w.point(10, max)
+	w.pair(0, "ENDSEC")
+}
+
+// classes writes the CLASSES section, which only has the classes of the
+// raster image objects
+func (d *Drawing) classes(w *writer) {
+	w.pair(0, "SECTION")
+	w.pair(2, "CLASSES")
+	for _, c := range []struct {
+		name, class string
+		flags       int
+		entity      bool
+	}{
+		{"IMAGE", "AcDbRasterImage", 127, true},
+		{"IMAGEDEF", "AcDbRasterImageDef", 0, false},
+		{"IMAGEDEF_REACTOR", "AcDbRasterImageDefReactor", 1, false},
+		{"RASTERVARIABLES", "AcDbRasterVariables", 0, false},
+	} {
+		w.pair(0, "CLASS")
+		w.pair(1, c.name)
+		w.pair(2, c.class)
+		w.pair(3, "ISM")
+		w.int(90, c.flags)
+		w.int(280, 0)
+		if c.entity {
+			w.int(281, 1)
+		} else {
+			w.int(281, 0)
+		}
+	}
+	w.pair(0, "ENDSEC")
+}
+
+// table writes a table with its records, each written by record after its
+// handle and owner.
+func (w *writer) table(name string, n int, record func(i int, owner string)) {
+	owner := w.next()
+	w.pair(0, "TABLE")
+	w.pair(2, name)
+	w.pair(5, owner)
+	w.pair(330, "0")
+	w.pair(100, "AcDbSymbolTable")
+	w.int(70, n)
+	if name == "DIMSTYLE" {
+		w.pair(100, "AcDbDimStyleTable")
+	}
+	for i := 0; i < n; i++ {
+		record(i, owner)
+	}
+	w.pair(0, "ENDTAB")
+}
+
+// record starts a table record
+func (w *writer) record(kind, owner, handle, subclass, name string) {
+	w.pair(0, kind)
+	if kind == "DIMSTYLE" {
+		w.pair(105, handle)
+	} else {
+		w.pair(5, handle)
+	}
+	w.pair(330, owner)
+	w.pair(100, "AcDbSymbolTableRecord")
+	w.pair(100, subclass)
+	w.pair(2, name)
+	w.int(70, 0)
+}
+
+// tables writes the TABLES section
+func (d *Drawing) tables(w *writer, h handles) {
+	min, max := d.extents()
+	w.pair(0, "SECTION")
+	w.pair(2, "TABLES")
+
+	w.table("VPORT", 1, func(_ int, owner string) {
+		w.record("VPORT", owner, w.next(), "AcDbViewportTableRecord", "*ACTIVE")
+		w.float(10, 0)
+		w.float(20, 0)
+		w.float(11, 1)
+		w.float(21, 1)
+		w.float(12, (min.X+max.X)/2)
+		w.float(22, (min.Y+max.Y)/2)
+		w.float(40, math.Max(max.Y-min.Y, 1))
+		w.float(41, math.Max(max.X-min.X, 1)/math.Max(max.Y-min.Y, 1))
+	})
+
+	ltypes := []string{"ByBlock", "ByLayer", "Continuous"}
+	w.table("LTYPE", len(ltypes), func(i int, owner string) {
+		w.record("LTYPE", owner, w.next(), "AcDbLinetypeTableRecord", ltypes[i])
+		if ltypes[i] == "Continuous" {
+			w.pair(3, "Solid line")
+		} else {
+			w.pair(3, "")
+		}
+		w.int(72, 65)
+		w.int(73, 0)
+		w.float(40, 0)
+	})
+
+	layers := append([]Layer{{Name: "0", Color: 7}}, d.Layers...)
+	w.table("LAYER", len(layers), func(i int, owner string) {
+		w.record("LAYER", owner, w.next(), "AcDbLayerTableRecord", layers[i].Name)
+		w.int(62, layers[i].Color)
+		w.pair(6, "Continuous")
+	})
+
+	w.table("STYLE", 1, func(_ int, owner string) {
+		w.record("STYLE", owner, w.next(), "AcDbTextStyleTableRecord", "Standard")
+		w.float(40, 0)
+		w.float(41, 1)
+		w.float(50, 0)
+		w.int(71, 0)
+		w.float(42, 0.2)
+		w.pair(3, "txt")
+		w.pair(4, "")
+	})
+
+	w.table("VIEW", 0, nil)
+	w.table("UCS", 0, nil)
+
+	w.table("APPID", 1, func(_ int, owner string) {
+		w.record("APPID", owner, w.next(), "AcDbRegAppTableRecord", "ACAD")
+	})
+
+	w.table("DIMSTYLE", 1, func(_ int, owner string) {
+		w.record("DIMSTYLE", owner, w.next(), "AcDbDimStyleTableRecord", "Standard")
+	})
+
+	// The block records have handles handed out already, since the layouts
+	// point at them
+	w.pair(0, "TABLE")
+	w.pair(2, "BLOCK_RECORD")
+	w.pair(5, h.blockRecords)
+	w.pair(330, "0")
+	w.pair(100, "AcDbSymbolTable")
+	w.int(70, 2)
+	w.record("BLOCK_RECORD", h.blockRecords, h.modelRecord, "AcDbBlockTableRecord", "*Model_Space")
+	w.pair(340, h.modelLayout)
+	w.record("BLOCK_RECORD", h.blockRecords, h.paperRecord, "AcDbBlockTableRecord", "*Paper_Space")
+	w.pair(340, h.paperLayout)
+	w.pair(0, "ENDTAB")
+
+	w.pair(0, "ENDSEC")
+}
+
+// blocks writes the BLOCKS section, which only has the model and paper
+// space blocks
+func (d *Drawing) blocks(w *writer, h handles) {
+	w.pair(0, "SECTION")
+	w.pair(2, "BLOCKS")
+	for _, b := range []struct{ name, record string }{
+		{"*Model_Space", h.modelRecord},
+		{"*Paper_Space", h.paperRecord},
+	} {
+		w.pair(0, "BLOCK")
+		w.pair(5, w.next())
+		w.pair(330, b.record)
+		w.pair(100, "AcDbEntity")
+		if b.record == h.paperRecord {
+			w.int(67, 1)
+		}
+		w.pair(8, "0")
+		w.pair(100, "AcDbBlockBegin")
+		w.pair(2, b.name)
+		w.int(70, 0)
+		w.point(10, Point{})
+		w.pair(3, b.name)
+		w.pair(1, "")
+
+		w.pair(0, "ENDBLK")
+		w.pair(5, w.next())
+		w.pair(330, b.record)
+		w.pair(100, "AcDbEntity")
+		if b.record == h.paperRecord {
+			w.int(67, 1)
+		}
+		w.pair(8, "0")
+		w.pair(100, "AcDbBlockEnd")
+	}
+	w.pair(0, "ENDSEC")
+}
+
+// entity starts an entity in model space
+func (w *writer) entity(kind, handle, layer, subclass string, h handles) {
+	w.pair(0, kind)
+	w.pair(5, handle)
+	w.pair(330, h.modelRecord)
+	w.pair(100, "AcDbEntity")
+	w.pair(8, layer)
+	w.pair(100, subclass)
+}
+
+// entities writes the ENTITIES section: the underlay first so it's drawn
+// under everything else, then the polylines and the text.
+func (d *Drawing) entities(w *writer, h handles) {
+	w.pair(0, "SECTION")
+	w.pair(2, "ENTITIES")
+
+	if im := d.Image; im != nil {
+		w.entity("IMAGE", h.image, im.Layer, "AcDbRasterImage", h)
+		w.int(90, 0)
+		w.point(10, im.At)
+		w.point(11, Point{X: im.PixelSize})
+		w.point(12, Point{Y: im.PixelSize})
+		w.float(13, float64(im.Pixels.X))
+		w.float(23, float64(im.Pixels.Y))
+		w.pair(340, h.imageDef)
+		// Show the image, and show it when it isn't aligned with the screen
+		w.int(70, 3)
+		w.int(280, 0)
+		w.int(281, 50)
+		w.int(282, 50)
+		w.int(283, 0)
+		w.pair(360, h.imageReactor)
+		// Clip to the whole image
+		w.int(71, 1)
+		w.int(91, 2)
+		w.float(14, -0.5)
+		w.float(24, -0.5)
+		w.float(14, float64(im.Pixels.X)-0.5)
+		w.float(24, float64(im.Pixels.Y)-0.5)
+	}
+
+	for _, pl := range d.Polylines {
+		w.entity("LWPOLYLINE", w.next(), pl.Layer, "AcDbPolyline", h)
+		w.int(90, len(pl.Points))
+		if pl.Closed {
+			w.int(70, 1)
+		} else {
+			w.int(70, 0)
+		}
+		w.float(43, 0)
+		for _, p := range pl.Points {
+			w.float(10, p.X)
+			w.float(20, p.Y)
+		}
+	}
+
+	for _, t := range d.Texts {
+		w.entity("MTEXT", w.next(), t.Layer, "AcDbMText", h)
+		w.point(10, t.At)
+		w.float(40, t.Height)
+		w.float(41, t.Width)
+		// Attached at the top left, written left to right
+		w.int(71, 1)
+		w.int(72, 1)
+		text := mtext(t.Lines)
+		// Values are at most 250 characters, so long text goes in chunks of
+		// 250 with the last of it in group 1
+		for len(text) > 250 {
+			w.pair(3, text[:250])
+			text = text[250:]
+		}
+		w.pair(1, text)
+		w.pair(7, "Standard")
+	}
+
+	w.pair(0, "ENDSEC")
+}
+
+// mtext returns the lines as MTEXT, escaping the characters MTEXT formats
+// with and breaking the lines with \P.
+func mtext(lines []string) string {
+	r := strings.NewReplacer(`\`, `\\`, "{", `\{`, "}", `\}`)
+	escaped := make([]string, len(lines))
+	for i, l := range lines {
+		escaped[i] = r.Replace(l)
+	}
+	return strings.Join(escaped, `\P`)
+}
+
+// dictionary writes a DICTIONARY of the entries, name then handle
+func (w *writer) dictionary(handle, owner string, entries ...string) {
+	w.pair(0, "DICTIONARY")
+	w.pair(5, handle)
+	w.pair(330, owner)
+	w.pair(100, "AcDbDictionary")
+	w.int(281, 1)
+	for i := 0; i+1 < len(entries); i += 2 {
+		w.pair(3, entries[i])
+		w.pair(350, entries[i+1])
+	}
+}
+
+// layout writes a LAYOUT with the plot settings left at their defaults
+func (w *writer) layout(handle, owner, name string, order int, record string) {
+	w.pair(0, "LAYOUT")
+	w.pair(5, handle)
+	w.pair(330, owner)
+	w.pair(100, "AcDbPlotSettings")
+	w.pair(1, "")
+	w.pair(2, "none_device")
+	w.pair(4, "")
+	w.pair(6, "")
+	for code := 40; code <= 49; code++ {
+		w.float(code, 0)
+	}
+	w.float(140, 0)
+	w.float(141, 0)
+	w.float(142, 1)
+	w.float(143, 1)
+	w.int(70, 688)
+	w.int(72, 0)
+	w.int(73, 0)
+	w.int(74, 5)
+	w.pair(7, "")
+	w.int(75, 16)
+	w.float(147, 1)
+	w.float(148, 0)
+	w.float(149, 0)
+	w.pair(100, "AcDbLayout")
+	w.pair(1, name)
+	w.int(70, 1)
+	w.int(71, order)
+	w.float(10, 0)
+	w.float(20, 0)
+	w.float(11, 12)
+	w.float(21, 9)
+	w.point(12, Point{})
+	w.point(14, Point{})
+	w.point(15, Point{})
+	w.float(146, 0)
+	w.point(13, Point{})
+	w.point(16, Point{X: 1})
+	w.point(17, Point{Y: 1})
+	w.int(76, 0)
+	w.pair(330, record)
+}
+
+// objects writes the OBJECTS section: the dictionaries, the layouts and the
+// underlay's image definition.
+func (d *Drawing) objects(w *writer, h handles, units int) {
+	w.pair(0, "SECTION")
+	w.pair(2, "OBJECTS")
+
+	root := []string{"ACAD_GROUP", h.groups, "ACAD_LAYOUT", h.layouts}
+	if d.Image != nil {
+		root = append(root, "ACAD_IMAGE_DICT", h.imageDict, "ACAD_IMAGE_VARS", h.imageVars)
+	}
+	w.dictionary(h.root, "0", root...)
+	w.dictionary(h.groups, h.root)
+	w.dictionary(h.layouts, h.root, "Model", h.modelLayout, "Layout1", h.paperLayout)
+	w.layout(h.modelLayout, h.layouts, "Model", 0, h.modelRecord)
+	w.layout(h.paperLayout, h.layouts, "Layout1", 1, h.paperRecord)
+
+	if im := d.Image; im != nil {
+		w.dictionary(h.imageDict, h.root, imageName(im.Path), h.imageDef)
+
+		w.pair(0, "IMAGEDEF")
+		w.pair(5, h.imageDef)
+		w.pair(102, "{ACAD_REACTORS")
+		w.pair(330, h.imageDict)
+		w.pair(330, h.imageReactor)
+		w.pair(102, "}")
+		w.pair(330, h.imageDict)
+		w.pair(100, "AcDbRasterImageDef")
+		w.int(90, 0)
+		w.pair(1, im.Path)
+		w.float(10, float64(im.Pixels.X))
+		w.float(20, float64(im.Pixels.Y))
+		w.float(11, im.PixelSize)
+		w.float(21, im.PixelSize)
+		w.int(280, 1)
+		// Resolution units, inches or centimeters
+		if units == 1 {
+			w.int(281, 5)
+		} else {
+			w.int(281, 2)
+		}
+
+		w.pair(0, "IMAGEDEF_REACTOR")
+		w.pair(5, h.imageReactor)
+		w.pair(330, h.image)
+		w.pair(100, "AcDbRasterImageDefReactor")
+		w.int(90, 2)
+		w.pair(330, h.image)
+
+		w.pair(0, "RASTERVARIABLES")
+		w.pair(5, h.imageVars)
+		w.pair(330, h.root)
+		w.pair(100, "AcDbRasterVariables")
+		w.int(90, 0)
+		w.int(70, 0)
+		w.int(71, 1)
+		if units == 1 {
+			w.int(72, 5)
+		} else {
+			w.int(72, 1)
+		}
+	}
+
+	w.pair(0, "ENDSEC")
+}
+
+// imageName returns the name of the image in the drawing, its file name
+// without the extension
+func imageName(path string) string {
+	name := path[strings.LastIndexAny(path, `/\`)+1:]
+	if i := strings.LastIndex(name, "."); i > 0 {
+		name = name[:i]
+	}
+	return name
+}
@@ -13,6 +13,9 @@ require (
 	github.com/jroimartin/gocui v0.5.0
 	github.com/pkg/errors v0.9.1
 	github.com/rs/zerolog v1.26.0
+	go.etcd.io/bbolt v1.3.6
 	golang.org/x/image v0.0.0-20210628002857-a66eb6448b8d
+	golang.org/x/sys v0.10.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 	honnef.co/go/js/dom v0.0.0-20210725211120-f030747120f2 // indirect
 )
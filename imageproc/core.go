@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"image"
 	"os"
+	"strings"
 
 	"github.com/jroimartin/gocui"
 	"github.com/rs/zerolog"
@@ -26,6 +27,9 @@ func New(conf Config, logger *zerolog.Logger) *ImageProc {
 	il.Debug().Msg("Created")
 
 	ra.canvas = drawing.New(&i.log)
+	if len(conf.Ranges) > 0 {
+		ra.canvas.SetRanges(conf.Ranges)
+	}
 	return &i
 }
 
@@ -34,7 +38,7 @@ func (ip *ImageProc) ProcessImages(u types.UI, g *gocui.Gui) error {
 	il := ip.log.With().Str("func", "ProcessImages").Logger()
 	il.Debug().Msg("Processing redline image")
 
-	if u == nil && g == nil {
+	if u == nil || g == nil {
 		il.Debug().Msg("UI logging is not set")
 		ip.ui = false
 	} else {
@@ -52,53 +56,41 @@ func (ip *ImageProc) ProcessImages(u types.UI, g *gocui.Gui) error {
 }
 
 // preProcess gets and changes the blackish and whiteish colors in the image
-func (ip *ImageProc) preProcess(img image.Image, redline bool) (drawing.ColorMap, drawing.ChangeMap, error) {
+func (ip *ImageProc) preProcess(img image.Image, redline bool) (drawing.ColorMap, error) {
 	il := ip.log.With().Str("func", "preProcess").Logger()
 	il.Debug().Bool("redline", redline).Send()
 
 	// We went to get the colors in the image & change any that are "whiteish"
 	// or blackish while we're at it, so let's just make sure those ranges
 	// are to set to replace before we call it.
-	for _, r := range drawing.Ranges {
-		if r.Name == drawing.WHITEISH || r.Name == drawing.BLACKISH {
-			r.Replace = true
-		} else {
-			r.Replace = false
-		}
+	ranges := ip.ra.canvas.Ranges()
+	for i := range ranges {
+		ranges[i].Replace = ranges[i].Meaning == drawing.PAPER || ranges[i].Meaning == drawing.LINEWORK
 	}
 
 	// Now lets get the colors in the image.
-	cm, chm := ip.ra.canvas.GetColors(img, true)
-	return cm, chm, nil
+	cm := ip.ra.canvas.GetColors(img, true)
+	return cm, nil
 }
 
-// preProcessColors gets and changes the yellowish colors in the image
-func (ip *ImageProc) preProcessColors(img image.Image, redline bool) (drawing.ColorMap, error) {
+// preProcessColors changes the colors marking new work in the image (i.e. the
+// yellowish colors) to their replacement color, and returns the pixels that
+// were changed.
+func (ip *ImageProc) preProcessColors(cm drawing.ColorMap, img image.Image, redline bool) ([]*drawing.Pixel, error) {
 	il := ip.log.With().Str("func", "preProcessColors").Logger()
 	il.Debug().Bool("redline", redline).Msg("preProcessColors")
 
-	// We went to get the colors in the image & change any that are "whiteish"
-	// or blackish while we're at it, so let's just make sure those ranges
-	// are to set to replace before we call it.
-	for _, r := range drawing.Ranges {
-		if r.Name == drawing.WHITEISH || r.Name == drawing.BLACKISH {
-			r.Replace = false
-		} else {
-			r.Replace = true
-		}
-	}
-
-	// Now lets get the colors in the image.
-	cm, _ := ip.ra.canvas.GetColors(img, true)
-
-	return cm, nil
+	// ChangeColors only changes the ranges meaning new work, whatever they're
+	// set to replace.
+	_, chm := ip.ra.canvas.ChangeColors(cm, img, drawing.NEW_STRAND)
+	return chm[drawing.NEW_STRAND], nil
 }
 
 // UpdateUI is a useful function to call anytime we want to give the user a
 // messgae on the application log
 func (ip *ImageProc) UpdateUI(msg string) {
 	if !ip.ui {
-		fmt.Fprintf(os.Stdout, msg)
+		fmt.Fprintln(os.Stdout, strings.TrimRight(msg, "\n"))
 		return
 	}
 
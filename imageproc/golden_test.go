@@ -0,0 +1,180 @@
+package imageproc
+
+import (
+	"caddae/drawing"
+	"flag"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden images in testdata/golden")
+
+// Tolerances for comparing output to the golden images. A pixel only counts as
+// mismatched if its color is more than pixelTolerance (delta E) from every
+// pixel around the same spot in the other image, so lines that move by a pixel
+// or come out a little lighter still match.
+const (
+	pixelTolerance = 10.0
+	// maxMismatched is the number of pixels that may be mismatched. The lines
+	// we draw are thin, so even a short line going missing is a few hundred.
+	maxMismatched = 50
+)
+
+// goldenCases are the redlines in testfiles that are run through the whole
+// redline to running process, with the production for the day.
+var goldenCases = []struct {
+	redline string
+	wpd     string
+}{
+	{"VZ_LAN_00007054_07_16_21", "07/16/2021"},
+	{"VZ_LAN_00007054_07_19_21", "07/19/2021"},
+}
+
+// TestGolden runs the fixtures in testfiles through the whole redline to
+// running process, and compares the running asbuilts to the golden images in
+// testdata/golden. Run with -update to update the golden images after an
+// intended change to the output.
+func TestGolden(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping golden images in short mode")
+	}
+
+	for _, tc := range goldenCases {
+		tc := tc
+		t.Run(tc.redline, func(t *testing.T) {
+			// Work on copies, so nothing gets written next to the fixtures.
+			dir := t.TempDir()
+			conf := Config{
+				Rl:           copyFixture(t, dir, tc.redline+".png"),
+				Ra:           copyFixture(t, dir, "VZ_LAN_00007054.png"),
+				Jn:           "VZ_LAN_00007054",
+				Wpd:          tc.wpd,
+				Quantities:   map[string]float64{"C300-01": 100, "C300-04": 1},
+				KeepInMemory: true,
+			}
+
+			ip := testImageProc(conf)
+			if err := ip.ProcessImages(nil, nil); err != nil {
+				t.Fatalf("ProcessImages: %v", err)
+			}
+			got := ip.Running()
+
+			golden := filepath.Join("testdata", "golden", tc.redline+".png")
+			if *update {
+				writePNG(t, golden, got)
+				return
+			}
+
+			want := readPNG(t, golden)
+			if got.Bounds() != want.Bounds() {
+				t.Fatalf("output is %v, want %v", got.Bounds(), want.Bounds())
+			}
+
+			mismatched := compareImages(got, want)
+			t.Logf("%d pixels don't match %s", mismatched, golden)
+			if mismatched > maxMismatched {
+				out := filepath.Join(os.TempDir(), "caddae_golden_"+tc.redline+".png")
+				writePNG(t, out, got)
+				t.Errorf("%d pixels don't match %s, want at most %d. Output saved to %s", mismatched, golden, maxMismatched, out)
+			}
+		})
+	}
+}
+
+// compareImages returns the number of pixels that don't perceptually match
+// between the two images, see pixelTolerance.
+func compareImages(a, b image.Image) int {
+	mismatched := 0
+	bnds := a.Bounds()
+	for y := bnds.Min.Y; y < bnds.Max.Y; y++ {
+		for x := bnds.Min.X; x < bnds.Max.X; x++ {
+			ca, cb := rgba(a, x, y), rgba(b, x, y)
+			if ca == cb || drawing.DeltaE(ca, cb) <= pixelTolerance {
+				continue
+			}
+			if !nearby(b, x, y, ca) || !nearby(a, x, y, cb) {
+				mismatched++
+			}
+		}
+	}
+	return mismatched
+}
+
+// nearby checks if any pixel around (x, y) in the image matches the color
+func nearby(img image.Image, x, y int, col color.RGBA) bool {
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			p := image.Pt(x+dx, y+dy)
+			if !p.In(img.Bounds()) {
+				continue
+			}
+			if drawing.DeltaE(rgba(img, p.X, p.Y), col) <= pixelTolerance {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rgba returns the color of the pixel as a color.RGBA
+func rgba(img image.Image, x, y int) color.RGBA {
+	return color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+}
+
+// copyFixture copies the file from testfiles into dir, and returns its path
+func copyFixture(t *testing.T, dir, name string) string {
+	t.Helper()
+	src, err := os.Open(filepath.Join("..", "testfiles", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	out := filepath.Join(dir, name)
+	dst, err := os.Create(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+
+	if _, err := io.Copy(dst, src); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func readPNG(t *testing.T, path string) image.Image {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("%v (run with -update to create the golden images)", err)
+	}
+	defer f.Close()
+
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func writePNG(t *testing.T, path string, img image.Image) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
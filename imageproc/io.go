@@ -1,6 +1,8 @@
 package imageproc
 
 import (
+	"caddae/jobdb"
+	"caddae/pdf"
 	"errors"
 	"fmt"
 	"image"
@@ -143,23 +145,89 @@ func (ip *ImageProc) SaveRunning(out, format string) error {
 			e := fmt.Sprintf("rename(%s, %s): %s", newFile, out, err)
 			return errors.New(e)
 		}
+	} else if format == "pdf" {
+		return ip.savePackage(out)
+	} else {
+		e := fmt.Sprintf("Error saving file (%s): unknown format '%s', must be png, jpeg or pdf", out, format)
+		return errors.New(e)
 	}
 	return nil
 }
 
-// OpenImage opens the given file.
-func (ip *ImageProc) OpenImage(file string) (image.Image, error) {
-	f, err := os.Open(file)
-	if err != nil {
-		return nil, err
+// format returns the format the updated running asbuilt is saved in
+func (ip *ImageProc) format() string {
+	if ip.conf.Format == "" {
+		return PNG
 	}
+	return ip.conf.Format
+}
 
-	// Attempt to read the image.
-	img, _, err := image.Decode(f)
-	if err != nil {
-		f.Close()
-		return nil, err
+// savePackage saves the updated running asbuilt as a PDF package: a cover
+// sheet with the production placed on the job, the running asbuilt, and the
+// scans of the redlines drawn onto it.
+func (ip *ImageProc) savePackage(out string) error {
+	p := pdf.Package{
+		Job:     ip.conf.Jn,
+		Totals:  ip.packageTotals(),
+		Catalog: ip.conf.Catalog,
+	}
+	p.Sheets = []pdf.Sheet{{
+		Image:   ip.ra.img,
+		DPI:     ip.DPI(),
+		Caption: fmt.Sprintf("%s running asbuilt, updated for WPD %s", ip.conf.Jn, ip.conf.Wpd),
+	}}
+
+	for _, a := range ip.ra.applied {
+		caption := fmt.Sprintf("Redline for WPD %s: %s", a.prod.Date, a.redline)
+		if a.page > 1 {
+			caption += fmt.Sprintf(", page %d", a.page)
+		}
+		img, err := OpenPage(a.redline, a.page)
+		if err != nil {
+			// The package is still worth having without the scan, so it's
+			// only noted as missing.
+			p.Redlines = append(p.Redlines, pdf.Sheet{Caption: caption})
+			continue
+		}
+		p.Redlines = append(p.Redlines, pdf.Sheet{
+			Image:   img,
+			DPI:     ip.conf.Font.ScanDPI(img.Bounds().Dx()),
+			Caption: caption,
+		})
+	}
+
+	size := ip.conf.PageSize
+	if size == (pdf.PageSize{}) {
+		size = pdf.TABLOID
+	}
+
+	// Package.Save writes a temporary file and renames it, like the images
+	if err := p.Save(out, size); err != nil {
+		e := fmt.Sprintf("Error writing file (%s): %s\n", out, err)
+		return errors.New(e)
 	}
-	f.Close()
-	return img, nil
+	return nil
+}
+
+// packageTotals returns the production for the cover sheet of a PDF
+// package: what was placed on the job before, if we know, and the redlines
+// drawn onto this running asbuilt.
+func (ip *ImageProc) packageTotals() jobdb.Summary {
+	s := jobdb.Summarize(ip.conf.Jn, nil)
+	if placed := ip.conf.Placed; placed != nil {
+		s = *placed
+		s.Quantities = make(map[string]float64, len(placed.Quantities))
+		for code, qty := range placed.Quantities {
+			s.Quantities[code] = qty
+		}
+	}
+	for _, a := range ip.ra.applied {
+		s.AddProduction(a.prod)
+	}
+	return s
+}
+
+// OpenImage opens the given file, or its first page if it has several.
+func (ip *ImageProc) OpenImage(file string) (image.Image, error) {
+	return OpenPage(file, 1)
 }
@@ -0,0 +1,144 @@
+package imageproc
+
+import (
+	"caddae/callout"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// placeholders are the parts of an output name template that are filled in
+// for each running asbuilt saved
+var placeholders = map[string]bool{
+	"{job}":       true,
+	"{wpd}":       true,
+	"{timestamp}": true,
+	"{sheet}":     true,
+}
+
+// CheckName checks the output name template only has the placeholders we
+// know, {job}, {wpd}, {timestamp} and {sheet}, and doesn't try to put the file
+// in another folder, which is what the output directory is for.
+func CheckName(tmpl string) error {
+	if strings.TrimSpace(tmpl) == "" {
+		return errors.New("the output name is empty")
+	}
+	if strings.ContainsAny(tmpl, `/\`) {
+		e := fmt.Sprintf("the output name '%s' can't have folders in it, set the output directory instead", tmpl)
+		return errors.New(e)
+	}
+
+	rest := tmpl
+	for {
+		open := strings.Index(rest, "{")
+		if open < 0 {
+			break
+		}
+		end := strings.Index(rest[open:], "}")
+		if end < 0 {
+			e := fmt.Sprintf("the output name '%s' has an unclosed '{'", tmpl)
+			return errors.New(e)
+		}
+		p := rest[open : open+end+1]
+		if !placeholders[p] {
+			e := fmt.Sprintf("the output name '%s' has an unknown placeholder %s, it can have {job}, {wpd}, {timestamp} and {sheet}", tmpl, p)
+			return errors.New(e)
+		}
+		rest = rest[open+end+1:]
+	}
+	return nil
+}
+
+// ExpandName fills in the placeholders of the output name template for the
+// configuration, saved at t:
+//
+//	{job}       the job number
+//	{wpd}       the work performed date, as 2006-01-02
+//	{timestamp} when it's saved, as 2006-01-02T15-04-05
+//	{sheet}     the running asbuilt's file name, without its extension, and
+//	            _p and its page if it isn't the first page of the scan
+//
+// Anything in them that can't go in a file name is replaced with a '-'.
+func ExpandName(tmpl string, conf Config, t time.Time) string {
+	wpd := conf.Wpd
+	if d, err := time.Parse("01/02/2006", wpd); err == nil {
+		wpd = d.Format("2006-01-02")
+	}
+	sheet := stem(conf.Ra)
+	if conf.RunningPage > 1 {
+		sheet += "_p" + strconv.Itoa(conf.RunningPage)
+	}
+
+	r := strings.NewReplacer(
+		"{job}", safeName(conf.Jn),
+		"{wpd}", safeName(wpd),
+		"{timestamp}", t.Format("2006-01-02T15-04-05"),
+		"{sheet}", safeName(sheet),
+	)
+	return r.Replace(tmpl)
+}
+
+// outputDir returns the folder the running asbuilt and the debug images are
+// saved in: the configured one, or the 'edits' folder next to the running
+// asbuilt.
+func (ip *ImageProc) outputDir() string {
+	if ip.conf.OutputDir != "" {
+		return filepath.Clean(ip.conf.OutputDir)
+	}
+	return filepath.Join(filepath.Dir(ip.conf.Ra), "edits")
+}
+
+// debugFile returns the file path of a debug image, named after the redline
+// and what it shows, in the output directory.
+func (ip *ImageProc) debugFile(kind string) string {
+	name := stem(ip.conf.Rl)
+	if ip.conf.Page > 1 {
+		name += "_p" + strconv.Itoa(ip.conf.Page)
+	}
+	return filepath.Join(ip.outputDir(), name+"_"+kind+".png")
+}
+
+// saveDrawing saves the callout's drawing for review, as a debug image of the
+// kind, unless they're skipped. Not being able to save it doesn't stop the
+// run, so it's only logged.
+func (ip *ImageProc) saveDrawing(c *callout.Callout, kind string) {
+	if ip.conf.SkipDebug {
+		return
+	}
+	il := ip.log.With().Str("func", "saveDrawing").Logger()
+
+	f := ip.debugFile(kind)
+	err := makeDir(f)
+	if err == nil {
+		err = c.SaveDrawing(f, c.Drawing())
+	}
+	if err != nil {
+		il.Debug().Err(err).Str("file", f).Msg("failed to save callout drawing")
+	}
+}
+
+// makeDir creates the folder the file goes in, if it isn't there yet.
+func makeDir(file string) error {
+	return os.MkdirAll(filepath.Dir(file), 0755)
+}
+
+// stem returns the file's name without its folder or extension.
+func stem(file string) string {
+	base := filepath.Base(file)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// safeName replaces the characters in s that can't go in a file name.
+func safeName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '-'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,74 @@
+package imageproc
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckName(t *testing.T) {
+	for _, tmpl := range []string{DEFAULT_NAME, "{sheet}_{wpd}", "asbuilt", "{job}-{job}"} {
+		if err := CheckName(tmpl); err != nil {
+			t.Errorf("CheckName(%s): %v", tmpl, err)
+		}
+	}
+	for _, tmpl := range []string{"", " ", "{crew}", "{job", "out/{job}", `out\{job}`} {
+		if err := CheckName(tmpl); err == nil {
+			t.Errorf("CheckName(%q) succeeded", tmpl)
+		}
+	}
+}
+
+func TestExpandName(t *testing.T) {
+	conf := Config{
+		Ra:  "scans/a.b/VZ_LAN_00007054.tif",
+		Jn:  "VZ_LAN_00007054",
+		Wpd: "07/16/2021",
+	}
+	at := time.Date(2021, 7, 16, 14, 5, 9, 0, time.UTC)
+
+	if got, want := ExpandName("{job}_{timestamp}", conf, at), "VZ_LAN_00007054_2021-07-16T14-05-09"; got != want {
+		t.Errorf("ExpandName = %s, want %s", got, want)
+	}
+	if got, want := ExpandName("{sheet}_{wpd}", conf, at), "VZ_LAN_00007054_2021-07-16"; got != want {
+		t.Errorf("ExpandName = %s, want %s", got, want)
+	}
+	conf.RunningPage = 3
+	if got, want := ExpandName("{sheet}", conf, at), "VZ_LAN_00007054_p3"; got != want {
+		t.Errorf("ExpandName of page 3 = %s, want %s", got, want)
+	}
+	conf.Jn = "VZ/LAN:1"
+	if got := ExpandName("{job}", conf, at); got != "VZ-LAN-1" {
+		t.Errorf("ExpandName of an unsafe job = %s", got)
+	}
+}
+
+func TestOutputPaths(t *testing.T) {
+	conf := Config{
+		Rl:     "scans/a.b/VZ_LAN_00007054_07_16_21.png",
+		Ra:     "scans/a.b/VZ_LAN_00007054",
+		Jn:     "VZ_LAN_00007054",
+		Format: JPEG,
+	}
+	ip := testImageProc(conf)
+
+	f := ip.RunningFilePath()
+	if dir := filepath.Dir(f); dir != filepath.Join("scans", "a.b", "edits") {
+		t.Errorf("running saved in %s, want the edits folder next to it", dir)
+	}
+	if base := filepath.Base(f); !strings.HasPrefix(base, "VZ_LAN_00007054_") || filepath.Ext(base) != ".jpg" {
+		t.Errorf("running saved as %s", base)
+	}
+	if got, want := ip.RedlineFilePath(), filepath.Join("scans", "a.b", "edits", "VZ_LAN_00007054_07_16_21_PREPROCESS.png"); got != want {
+		t.Errorf("RedlineFilePath = %s, want %s", got, want)
+	}
+
+	conf.OutputDir = "out/"
+	conf.OutputName = "{sheet}"
+	conf.Format = ""
+	ip = testImageProc(conf)
+	if got, want := ip.RunningFilePath(), filepath.Join("out", "VZ_LAN_00007054.png"); got != want {
+		t.Errorf("RunningFilePath = %s, want %s", got, want)
+	}
+}
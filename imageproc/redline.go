@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"image"
 	"image/color"
-	"strings"
 
 	"github.com/pkg/errors"
 )
@@ -16,44 +15,51 @@ func (ip *ImageProc) redline() error {
 	var err error
 
 	// Open the image
-	ip.rl.img, err = ip.OpenImage(ip.conf.Rl)
+	ip.rl.img, err = OpenPage(ip.conf.Rl, ip.conf.Page)
 	if err != nil {
-		return errors.Wrapf(err, "ip.OpenImage(%s): failed to open image", ip.conf.Rl)
+		return errors.Wrapf(err, "OpenPage(%s, %d): failed to open image", ip.conf.Rl, ip.conf.Page)
 	}
-
-	var chm drawing.ChangeMap
+	ip.rl.img = editable(ip.rl.img)
 
 	// Preprocess the image (change the "whiteish" colors to white, "blackish" colors to black)
-	ip.rl.cm, _, err = ip.preProcess(ip.rl.img, true)
+	ip.rl.cm, err = ip.preProcess(ip.rl.img, true)
 	if err != nil {
 		return err
 	}
 	il.Debug().Int("colorsFound", len(ip.rl.cm)).Send()
 
+	// Change the yellow pixels to blue
 	il.Debug().Msg("Changing yellow pixels to blue")
-	_, err = ip.preProcessColors(ip.rl.img, true)
+	yChange, err := ip.preProcessColors(ip.rl.cm, ip.rl.img, true)
 	if err != nil {
 		return err
 	}
 
-	// Change the yellow pixels to blue
-	_, chm = ip.ra.canvas.ChangeColors(ip.rl.cm, ip.rl.img, drawing.YELLOWISH)
-
 	// Set the running approximate pixel changes equal to the redlines yellow changes
-	ip.rl.yChange = chm[drawing.YELLOWISH]
-	ip.ra.approxChanges = chm[drawing.YELLOWISH]
+	ip.rl.yChange = yChange
+	ip.ra.approxChanges = yChange
 	//il.Debug().Interface("approxChanges", ip.ra.approxChanges).Send()
 
+	if ip.conf.SkipDebug {
+		il.Debug().Msg("Skipping saving the updated redline file")
+		return nil
+	}
+
 	msg := "Saving updated redline file .. \n"
 	ip.UpdateUI(msg)
 
 	f := ip.RedlineFilePath()
-	il.Debug().Str("newRlFile", f)
-	if err := ip.SaveRedline(f, "png"); err != nil {
+	il.Debug().Str("newRlFile", f).Send()
+	err = makeDir(f)
+	if err == nil {
+		err = ip.SaveRedline(f, "png")
+	}
+	if err != nil {
 		il.Debug().Err(err).Msg("failed to save updated redline file")
 
 		msg = fmt.Sprintf("ip.SaveUpdatedRedline(%s, %s): error saving updated redline file - %v", f, "png", err)
 		ip.UpdateUI(msg)
+		return nil
 	}
 
 	msg = fmt.Sprintf("Redline successfully saved as %s!\n", f)
@@ -79,9 +85,9 @@ func (ip *ImageProc) RedlineEdge() *drawing.Pixel {
 	for y := bnds.Max.Y; y > bnds.Min.Y; y-- {
 		for x := bnds.Max.X; x > bnds.Min.X; x-- {
 			r, g, b, a = ip.rl.img.At(x, y).RGBA()
-			col.R, col.G, col.B, col.A = uint8(r), uint8(g), uint8(b), uint8(a)
+			col.R, col.G, col.B, col.A = uint8(r>>8), uint8(g>>8), uint8(b>>8), uint8(a>>8)
 			if v, ok := ip.rl.cm[col]; ok {
-				if v.Range != nil && v.Range.Name == drawing.BLACKISH {
+				if v.Range != nil && v.Range.Meaning == drawing.LINEWORK {
 					return &drawing.Pixel{X: x, Y: y}
 				}
 			}
@@ -90,19 +96,10 @@ func (ip *ImageProc) RedlineEdge() *drawing.Pixel {
 	return &drawing.Pixel{}
 }
 
-// RedlineFilePath returns the new file path for the updated redline image
+// RedlineFilePath returns the new file path for the updated redline image, a
+// debug image in the output directory.
 func (ip *ImageProc) RedlineFilePath() string {
-	file := ip.conf.Rl
-
-	filepath := strings.Split(file, "/")
-	pathname := filepath[len(filepath)-1]
-
-	path := file[:len(pathname)-1]
-	fname := strings.Split(file, ".")
-	name := fname[0]
-
-	n := name[len(pathname)-1:]
-	f := path + "edits/" + n + "_PREPROCESS.png"
+	f := ip.debugFile("PREPROCESS")
 	ip.rl.newFile = f
 	return f
 }
@@ -2,12 +2,14 @@ package imageproc
 
 import (
 	"caddae/callout"
+	"caddae/catalog"
 	"caddae/drawing"
 	"caddae/types"
 	"fmt"
 	"image"
 	"image/color"
-	"strings"
+	"math"
+	"path/filepath"
 	"time"
 
 	"github.com/pkg/errors"
@@ -18,44 +20,83 @@ func (ip *ImageProc) running() error {
 	il := ip.log.With().Str("func", "running").Logger()
 	il.Debug().Msg("starting running asbuilt process")
 
+	// If we're continuing from a previous pass, we already have the running
+	// asbuilt in memory, so we only need to open it on the first pass.
 	var err error
-	ip.ra.img, err = ip.OpenImage(ip.conf.Ra)
-	if err != nil {
-		il.Debug().Err(err).Msg("failed to open image")
-		return errors.Wrapf(err, "ip.OpenImage(%s): failed to open image", ip.conf.Ra)
+	if ip.ra.img == nil {
+		ip.ra.img, err = OpenPage(ip.conf.Ra, ip.conf.RunningPage)
+		if err != nil {
+			il.Debug().Err(err).Msg("failed to open image")
+			return errors.Wrapf(err, "OpenPage(%s, %d): failed to open image", ip.conf.Ra, ip.conf.RunningPage)
+		}
+		ip.ra.img = editable(ip.ra.img)
 	}
 	ip.ra.canvas.SetImage(ip.ra.img)
 
-	ip.ra.cm, _, err = ip.preProcess(ip.ra.img, false)
+	ip.ra.cm, err = ip.preProcess(ip.ra.img, false)
 	if err != nil {
 		il.Debug().Err(err).Msg("failed to preprocess image")
 		return errors.Wrapf(err, "failed to preprocess image")
 	}
 	il.Debug().Int("colorsFound", len(ip.ra.cm)).Send()
 
+	msg := fmt.Sprintf("Drawing blue lines on running asbuilt ..")
+	ip.UpdateUI(msg)
+
+	//il.Debug().Interface("approxChanges", ip.ra.approxChanges)
+	var lines drawing.Lines
+	ip.ra.img, lines = ip.ra.canvas.DrawLines(ip.ra.approxChanges, ip.alignment())
+	ip.ra.lines = lines
+
+	// The callout goes on after the lines, so it can be placed near them
+	// without covering them up.
 	il.Debug().Msg("Creating callout box")
-	msg := fmt.Sprintf("Creating callout box and saving resulting image .. ")
+	msg = fmt.Sprintf("Creating callout box and saving resulting image .. ")
 	ip.UpdateUI(msg)
 
 	prod := ip.CreateProdUnits()
-	c := callout.New(prod, ip.ra.img)
-	c.CreateCallout()
-	c.AddCallout(ip.ra.img)
+	ip.ra.prod = prod
+	ip.ra.applied = append(ip.ra.applied, applied{redline: ip.conf.Rl, page: ip.conf.Page, prod: prod})
 
-	msg = fmt.Sprintf("Drawing blue lines on running asbuilt ..")
-	ip.UpdateUI(msg)
+	// The job totals go in their corner first, so the callout stays clear
+	// of them.
+	if err := ip.stampTotals(prod); err != nil {
+		il.Debug().Err(err).Msg("failed to stamp job totals")
+		return errors.Wrap(err, "ip.stampTotals(): error stamping job totals")
+	}
 
-	//il.Debug().Interface("approxChanges", ip.ra.approxChanges)
-	ip.ra.img = ip.ra.canvas.DrawLines(ip.ra.approxChanges, ip.RedlineEdge(), ip.RunningEdge())
+	c := callout.New(prod, ip.ra.img)
+	if ip.conf.Template != nil {
+		c.SetTemplate(ip.conf.Template)
+	}
+	c.SetFont(ip.conf.Font)
+	c.SetLeader(ip.conf.Leader)
+	if err := c.CreateCallout(); err != nil {
+		il.Debug().Err(err).Msg("failed to create callout")
+		return errors.Wrap(err, "c.CreateCallout(): error creating callout")
+	}
+	ip.saveDrawing(c, "CALLOUT")
+	ip.placeCallout(c, lines)
+	ip.ra.callout = c
+
+	if ip.conf.KeepInMemory {
+		il.Debug().Msg("Keeping updated running asbuilt in memory")
+		ip.UpdateUI(fmt.Sprintf("Finished %s, continuing with the next redline ..", ip.conf.Wpd))
+		return nil
+	}
 
 	il.Debug().Msg("Saving updated running asbuilt")
 	msg = "Saving updated running asbuilt file .."
 	ip.UpdateUI(msg)
 
 	f := ip.RunningFilePath()
-	if err := ip.SaveRunning(f, "png"); err != nil {
-		msg = fmt.Sprintf("ip.SaveUpdatedRunning(%s, %s): error saving updated redline file - %v", f, "png", err)
-		ip.UpdateUI(msg)
+	if err := makeDir(f); err != nil {
+		il.Debug().Err(err).Msg("failed to create the output directory")
+		return errors.Wrapf(err, "makeDir(%s): error creating the output directory", f)
+	}
+	if err := ip.SaveRunning(f, ip.format()); err != nil {
+		il.Debug().Err(err).Msg("failed to save updated running file")
+		return errors.Wrapf(err, "ip.SaveRunning(%s, %s): error saving updated running file", f, ip.format())
 	}
 
 	msg = fmt.Sprintf("Running successfully saved as %s!\nEnd of application process. :)", f)
@@ -68,103 +109,200 @@ func (ip *ImageProc) Running() image.Image {
 	return ip.ra.img
 }
 
-// CreateProdUnits creates & returns the production for the running asbuilt
-func (ip *ImageProc) CreateProdUnits() *types.Production {
-	var p types.Production
-	p.Date = ip.conf.Wpd
+// Lines returns the lines drawn on the running asbuilt for the redline
+func (ip *ImageProc) Lines() drawing.Lines {
+	return ip.ra.lines
+}
 
-	var units []types.Unit
-	if ip.conf.Strand != 0.0 {
-		qty := fmt.Sprintf("%.2f", ip.conf.Strand)
-		str := strings.Split(qty, ".")
-		dec := str[1]
-		if dec == "00" {
-			qty = str[0]
-		}
-		name := "C300-01"
-		txt := name + " = " + qty + "'"
-		unit := types.Unit{
-			Name:  name,
-			Qty:   qty,
-			Text:  txt,
-			Color: drawing.Blue,
-		}
-		units = append(units, unit)
+// Production returns the production shown on the callout for the redline, or
+// nil if the callout hasn't been made.
+func (ip *ImageProc) Production() *types.Production {
+	return ip.ra.prod
+}
+
+// Callout returns the callout added to the running asbuilt for the redline,
+// or nil if it hasn't been added.
+func (ip *ImageProc) Callout() *callout.Callout {
+	return ip.ra.callout
+}
+
+// DPI returns the DPI of the running asbuilt scan, from the font's DPI or the
+// width of the image.
+func (ip *ImageProc) DPI() float64 {
+	if ip.ra.img == nil {
+		return ip.conf.Font.DPI
 	}
+	return ip.conf.Font.ScanDPI(ip.ra.img.Bounds().Dx())
+}
 
-	if ip.conf.Cable != 0.0 {
-		qty := fmt.Sprintf("%.2f", ip.conf.Cable)
-		str := strings.Split(qty, ".")
-		dec := str[1]
-		if dec == "00" {
-			qty = str[0]
-		}
-		name := "C300-02"
-		txt := name + " = " + qty + "'"
-		unit := types.Unit{
-			Name:  name,
-			Qty:   qty,
-			Text:  txt,
-			Color: drawing.Blue,
-		}
-		units = append(units, unit)
-
-		name2 := "C400"
-		txt2 := name2 + " = " + qty + "'"
-		unit2 := types.Unit{
-			Name:  name2,
-			Qty:   qty,
-			Text:  txt2,
-			Color: drawing.Blue,
-		}
-		units = append(units, unit2)
+// RunningFile returns the file the updated running asbuilt was saved to, or
+// an empty string if it hasn't been saved.
+func (ip *ImageProc) RunningFile() string {
+	return ip.ra.newFile
+}
+
+// ContinueFrom sets up the running asbuilt to continue from the result of a
+// previous pass, rather than opening the running asbuilt file again.
+func (ip *ImageProc) ContinueFrom(prev *ImageProc) {
+	ip.ra.img = prev.ra.img
+	ip.ra.callouts = prev.ra.callouts
+	ip.ra.stamp = prev.ra.stamp
+	ip.ra.applied = append([]applied(nil), prev.ra.applied...)
+}
+
+// stampTotals adds the production to the job totals, if there are any, and
+// stamps them in their corner of the running asbuilt. The stamp goes in the
+// same corner every time, covering up the totals stamped by earlier runs.
+func (ip *ImageProc) stampTotals(prod *types.Production) error {
+	il := ip.log.With().Str("func", "stampTotals").Logger()
+	totals := ip.conf.Totals
+	if totals == nil {
+		return nil
 	}
+	totals.AddProduction(prod)
 
-	if ip.conf.Overlash != 0.0 {
-		qty := fmt.Sprintf("%.2f", ip.conf.Overlash)
-		str := strings.Split(qty, ".")
-		dec := str[1]
-		if dec == "00" {
-			qty = str[0]
-		}
-		name := "C300-03"
-		txt := name + " = " + qty + "'"
-		unit := types.Unit{
-			Name:  name,
-			Qty:   qty,
-			Text:  txt,
-			Color: drawing.Blue,
-		}
-		units = append(units, unit)
-
-		name2 := "C400"
-		txt2 := name2 + " = " + qty + "'"
-		unit2 := types.Unit{
-			Name:  name2,
-			Qty:   qty,
-			Text:  txt2,
-			Color: drawing.Blue,
+	cat := ip.conf.Catalog
+	if cat == nil {
+		cat = catalog.DefaultCatalog()
+	}
+	tp := types.Production{
+		Date:  totals.Last,
+		Units: cat.Totals(totals.Quantities, totals.Design),
+		Job:   totals.Job,
+		Crew:  ip.conf.Crew,
+	}
+	if tp.Date == "" {
+		tp.Date = prod.Date
+	}
+
+	ip.UpdateUI("Stamping job totals ..")
+	c := callout.New(&tp, ip.ra.img)
+	tmpl := ip.conf.TotalsTemplate
+	if tmpl == nil {
+		tmpl = callout.TotalsTemplate()
+	}
+	c.SetTemplate(tmpl)
+	c.SetFont(ip.conf.Font)
+	if err := c.CreateCallout(); err != nil {
+		return err
+	}
+	ip.saveDrawing(c, "TOTALS")
+
+	corner := ip.conf.TotalsCorner
+	if corner == "" {
+		corner = callout.CORNER_TOP_LEFT
+	}
+	pt, err := c.Corner(ip.ra.img, corner)
+	if err != nil {
+		return err
+	}
+	c.AddCalloutAt(ip.ra.img, pt)
+	ip.ra.stamp = image.Rectangle{Min: pt, Max: pt.Add(c.Size())}
+	il.Debug().Interface("stamp", ip.ra.stamp).Int("runs", totals.Runs).Msg("stamped job totals")
+	return nil
+}
+
+// placeCallout adds the callout to the running asbuilt, in the emptiest spot
+// near the lines drawn for it, clear of any callouts added by previous passes,
+// with a leader arrow pointing to the lines.
+//
+// If there's nowhere for it to go, it goes in the default position, shifted
+// down below the previous callouts so they don't overlap.
+func (ip *ImageProc) placeCallout(c *callout.Callout, lines drawing.Lines) {
+	il := ip.log.With().Str("func", "placeCallout").Logger()
+
+	avoid := make([]image.Rectangle, len(ip.ra.callouts))
+	for i, r := range ip.ra.callouts {
+		avoid[i] = r.Inset(-calloutGap)
+	}
+	if !ip.ra.stamp.Empty() {
+		avoid = append(avoid, ip.ra.stamp.Inset(-calloutGap))
+	}
+
+	work := workPoints(lines)
+	pt, ok := c.Place(ip.ra.img, work, avoid)
+	r := image.Rectangle{Min: pt, Max: pt.Add(c.Size())}
+	if !ok {
+		il.Debug().Msg("no room for the callout, using the default position")
+		pt = c.Position(ip.ra.img)
+		r = image.Rectangle{Min: pt, Max: pt.Add(c.Size())}
+		for i := 0; i < len(ip.ra.callouts); i++ {
+			if r.Overlaps(ip.ra.callouts[i]) {
+				// Move it below the callout it overlaps and check them all again
+				r = r.Add(image.Pt(0, ip.ra.callouts[i].Max.Y-r.Min.Y+calloutGap))
+				i = -1
+			}
 		}
-		units = append(units, unit2)
-	}
-
-	if ip.conf.Anchors != 0.0 {
-		qty := fmt.Sprintf("%d", int(ip.conf.Anchors))
-		name := "C300-04"
-		txt := name + " = " + qty
-		unit := types.Unit{
-			Name:  name,
-			Qty:   qty,
-			Text:  txt,
-			Color: drawing.Coral,
+	}
+	il.Debug().Interface("callout", r).Msg("placed callout")
+
+	c.AddCalloutAt(ip.ra.img, r.Min)
+	c.AddLeader(ip.ra.img, work)
+	ip.ra.callouts = append(ip.ra.callouts, r)
+}
+
+// workPoints returns points every workStep pixels along the lines, for the
+// callout to be placed near.
+func workPoints(lines drawing.Lines) []image.Point {
+	var points []image.Point
+	for _, line := range lines {
+		for i, p := range line {
+			points = append(points, image.Pt(p.X, p.Y))
+			if i == 0 {
+				continue
+			}
+			prev := line[i-1]
+			n := int(math.Hypot(float64(p.X-prev.X), float64(p.Y-prev.Y)) / workStep)
+			for j := 1; j < n; j++ {
+				t := float64(j) / float64(n)
+				points = append(points, image.Pt(
+					prev.X+int(math.Round(t*float64(p.X-prev.X))),
+					prev.Y+int(math.Round(t*float64(p.Y-prev.Y))),
+				))
+			}
 		}
-		units = append(units, unit)
 	}
+	return points
+}
 
-	p.Units = units
+// CreateProdUnits creates & returns the production for the running asbuilt,
+// from the quantities given for the units of the catalog.
+func (ip *ImageProc) CreateProdUnits() *types.Production {
+	var p types.Production
+	p.Date = ip.conf.Wpd
+	p.Job = ip.conf.Jn
+	p.Crew = ip.conf.Crew
+
+	cat := ip.conf.Catalog
+	if cat == nil {
+		cat = catalog.DefaultCatalog()
+	}
+	p.Units = cat.Production(ip.conf.Quantities)
 	return &p
 }
 
+// alignment returns the transform that moves redline pixels onto the running
+// asbuilt.
+//
+// We register the two images against each other using their shared black
+// linework, and if that fails we fall back to lining up the first black edge
+// pixel of each.
+func (ip *ImageProc) alignment() drawing.Transform {
+	il := ip.log.With().Str("func", "alignment").Logger()
+
+	ip.UpdateUI("Aligning the redline with the running asbuilt ..")
+	t, err := ip.ra.canvas.Register(ip.rl.img, ip.ra.img)
+	if err == nil {
+		il.Debug().Interface("transform", t).Msg("registered images")
+		return t
+	}
+	il.Debug().Err(err).Msg("registration failed, using edge pixels")
+	ip.UpdateUI("Couldn't align the images, using their edges instead ..")
+
+	rlEdge, raEdge := ip.RedlineEdge(), ip.RunningEdge()
+	return drawing.Translation(raEdge.X-rlEdge.X, raEdge.Y-rlEdge.Y)
+}
+
 // RunningEdge returns the first black edge pixel found in the running asbuilt
 //
 // The reason we do this is because the scanned images are slightly off ceneterd
@@ -185,9 +323,9 @@ func (ip *ImageProc) RunningEdge() *drawing.Pixel {
 	for y := bnds.Max.Y; y > bnds.Min.Y; y-- {
 		for x := bnds.Max.X; x > bnds.Min.X; x-- {
 			r, g, b, a = ip.ra.img.At(x, y).RGBA()
-			col.R, col.G, col.B, col.A = uint8(r), uint8(g), uint8(b), uint8(a)
+			col.R, col.G, col.B, col.A = uint8(r>>8), uint8(g>>8), uint8(b>>8), uint8(a>>8)
 			if v, ok := ip.ra.cm[col]; ok {
-				if v.Range != nil && v.Range.Name == drawing.BLACKISH {
+				if v.Range != nil && v.Range.Meaning == drawing.LINEWORK {
 					return &drawing.Pixel{X: x, Y: y}
 				}
 			}
@@ -196,17 +334,19 @@ func (ip *ImageProc) RunningEdge() *drawing.Pixel {
 	return &pixel
 }
 
-// RunningFilePath gets the new file path for the updated running image
+// RunningFilePath gets the new file path for the updated running image, in
+// the output directory, named from the output name template.
 func (ip *ImageProc) RunningFilePath() string {
-	// Sample now value: 2020-04-09 11:24:14.785868848 +0000 UTC m=+0.000187421
-	now := time.Now()
-	ts := now.Format(time.RFC3339)
-
-	file := ip.conf.Ra
-	filepath := strings.Split(file, "/")
-	pathname := filepath[len(filepath)-1]
-	path := file[:len(pathname)]
-	f := path + "/caddae/edits/testfiles/" + ip.conf.Jn + "_" + ts + ".png"
+	tmpl := ip.conf.OutputName
+	if tmpl == "" {
+		tmpl = DEFAULT_NAME
+	}
+
+	ext := ip.format()
+	if ext == JPEG {
+		ext = "jpg"
+	}
+	f := filepath.Join(ip.outputDir(), ExpandName(tmpl, ip.conf, time.Now())+"."+ext)
 	ip.ra.newFile = f
 	return f
 }
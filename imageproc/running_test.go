@@ -0,0 +1,181 @@
+package imageproc
+
+import (
+	"caddae/callout"
+	"caddae/drawing"
+	"caddae/jobdb"
+	"image"
+	"image/draw"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func testImageProc(conf Config) *ImageProc {
+	l := zerolog.Nop()
+	return New(conf, &l)
+}
+
+func TestCreateProdUnits(t *testing.T) {
+	tests := []struct {
+		name string
+		conf Config
+		want []string
+	}{
+		{"strand", Config{Quantities: map[string]float64{"C300-01": 100}}, []string{"C300-01 = 100'"}},
+		{"decimal strand", Config{Quantities: map[string]float64{"C300-01": 100.25}}, []string{"C300-01 = 100.25'"}},
+		{"rounded strand", Config{Quantities: map[string]float64{"C300-01": 100.004}}, []string{"C300-01 = 100'"}},
+		{"cable", Config{Quantities: map[string]float64{"C300-02": 50}}, []string{"C300-02 = 50'", "C400 = 50'"}},
+		{"overlash", Config{Quantities: map[string]float64{"C300-03": 75.5}}, []string{"C300-03 = 75.50'", "C400 = 75.50'"}},
+		{"anchors", Config{Quantities: map[string]float64{"C300-04": 2}}, []string{"C300-04 = 2"}},
+		{"everything", Config{Quantities: map[string]float64{"C300-01": 1, "C300-02": 2, "C300-03": 3, "C300-04": 4}}, []string{
+			"C300-01 = 1'", "C300-02 = 2'", "C300-03 = 3'", "C300-04 = 4", "C400 = 5'",
+		}},
+		{"nothing", Config{}, nil},
+	}
+
+	for _, tt := range tests {
+		tt.conf.Wpd = "07/16/2021"
+		prod := testImageProc(tt.conf).CreateProdUnits()
+
+		if prod.Date != tt.conf.Wpd {
+			t.Errorf("%s: Date = %s, want %s", tt.name, prod.Date, tt.conf.Wpd)
+		}
+		if len(prod.Units) != len(tt.want) {
+			t.Errorf("%s: got %d units, want %d", tt.name, len(prod.Units), len(tt.want))
+			continue
+		}
+		for i, u := range prod.Units {
+			if u.Text != tt.want[i] {
+				t.Errorf("%s: unit %d = %q, want %q", tt.name, i, u.Text, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestPlaceCallout(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 3400, 2200))
+	draw.Draw(img, img.Bounds(), &image.Uniform{drawing.White}, image.Point{}, draw.Src)
+	// Some linework right next to the work
+	draw.Draw(img, image.Rect(1000, 1020, 1400, 1300), &image.Uniform{drawing.Black}, image.Point{}, draw.Src)
+
+	ip := testImageProc(Config{Wpd: "07/16/2021", Quantities: map[string]float64{"C300-01": 100}})
+	ip.ra.img = img
+	ip.ra.canvas.SetImage(img)
+	lines := drawing.Lines{{{X: 800, Y: 1000}, {X: 1600, Y: 1000}}}
+	ip.ra.canvas.DrawAntialiased(*lines[0][0], *lines[0][1], drawing.Blue)
+
+	for i := 0; i < 3; i++ {
+		c := callout.New(ip.CreateProdUnits(), img)
+		c.CreateCallout()
+		ip.placeCallout(c, lines)
+	}
+
+	if len(ip.ra.callouts) != 3 {
+		t.Fatalf("placed %d callouts, want 3", len(ip.ra.callouts))
+	}
+	for i, r := range ip.ra.callouts {
+		for j, o := range ip.ra.callouts[:i] {
+			if r.Overlaps(o.Inset(-calloutGap)) {
+				t.Errorf("callout %d %v is within %d pixels of callout %d %v", i, r, calloutGap, j, o)
+			}
+		}
+		if r.Overlaps(image.Rect(1000, 1020, 1400, 1300)) {
+			t.Errorf("callout %d %v covers the linework", i, r)
+		}
+		if r.Min.Y <= 1000 && r.Max.Y >= 1000 && r.Min.X <= 1600 && r.Max.X >= 800 {
+			t.Errorf("callout %d %v covers the line", i, r)
+		}
+		// Close to the line, rather than off in a corner
+		if r.Max.Y < 700 || r.Min.Y > 1300 || r.Max.X < 500 || r.Min.X > 1900 {
+			t.Errorf("callout %d %v is too far from the line", i, r)
+		}
+	}
+}
+
+func TestPlaceCalloutNoRoom(t *testing.T) {
+	// With the previous callout covering everything, there's nowhere for the
+	// new one to go, so it goes in the default position below it.
+	img := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	ip := testImageProc(Config{Wpd: "07/16/2021", Quantities: map[string]float64{"C300-01": 100}})
+	ip.ra.img = img
+	prev := img.Bounds()
+	ip.ra.callouts = []image.Rectangle{prev}
+
+	c := callout.New(ip.CreateProdUnits(), img)
+	c.CreateCallout()
+	ip.placeCallout(c, nil)
+
+	want := image.Pt(c.Position(img).X, prev.Max.Y+calloutGap)
+	if r := ip.ra.callouts[1]; r.Min != want {
+		t.Errorf("callout placed at %v, want %v", r.Min, want)
+	}
+}
+
+func TestContinueFrom(t *testing.T) {
+	prev := testImageProc(Config{})
+	prev.ra.img = image.NewRGBA(image.Rect(0, 0, 10, 10))
+	prev.ra.callouts = []image.Rectangle{image.Rect(1, 1, 5, 5)}
+
+	ip := testImageProc(Config{})
+	ip.ContinueFrom(prev)
+	if ip.Running() != prev.Running() {
+		t.Error("ContinueFrom didn't keep the previous running asbuilt")
+	}
+	if len(ip.ra.callouts) != 1 {
+		t.Errorf("ContinueFrom kept %d callouts, want 1", len(ip.ra.callouts))
+	}
+}
+
+func TestStampTotals(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 3400, 2200))
+	draw.Draw(img, img.Bounds(), &image.Uniform{drawing.White}, image.Point{}, draw.Src)
+
+	// Two earlier runs have placed 300' of strand, out of 1000'
+	totals := &jobdb.Summary{
+		Job:        "VZ_LAN_00007054",
+		Runs:       2,
+		First:      "07/01/2021",
+		Last:       "07/09/2021",
+		Footage:    300,
+		Quantities: map[string]float64{"C300-01": 300},
+		Design:     map[string]float64{"C300-01": 1000, "C300-04": 4},
+	}
+	ip := testImageProc(Config{
+		Jn:           "VZ_LAN_00007054",
+		Wpd:          "07/16/2021",
+		Quantities:   map[string]float64{"C300-01": 100, "C300-04": 1},
+		Totals:       totals,
+		TotalsCorner: callout.CORNER_TOP_RIGHT,
+		SkipDebug:    true,
+	})
+	ip.ra.img = img
+	ip.ra.canvas.SetImage(img)
+
+	prod := ip.CreateProdUnits()
+	if err := ip.stampTotals(prod); err != nil {
+		t.Fatalf("stampTotals: %v", err)
+	}
+
+	if totals.Runs != 3 || totals.Last != "07/16/2021" || totals.Footage != 400 || totals.Quantities["C300-04"] != 1 {
+		t.Errorf("totals = %+v, want this run added", totals)
+	}
+	if ip.ra.stamp.Empty() || ip.ra.stamp.Min.X < img.Bounds().Dx()/2 || ip.ra.stamp.Min.Y > img.Bounds().Dy()/2 {
+		t.Errorf("stamp = %v, want it in the top right corner", ip.ra.stamp)
+	}
+
+	// The day's callout stays clear of the stamp
+	c := callout.New(prod, img)
+	c.CreateCallout()
+	ip.placeCallout(c, drawing.Lines{{{X: 3000, Y: 150}, {X: 3300, Y: 150}}})
+	if r := ip.ra.callouts[0]; r.Overlaps(ip.ra.stamp) {
+		t.Errorf("callout %v covers the stamp %v", r, ip.ra.stamp)
+	}
+
+	// No totals, no stamp
+	ip = testImageProc(Config{Wpd: "07/16/2021"})
+	ip.ra.img = img
+	if err := ip.stampTotals(ip.CreateProdUnits()); err != nil || !ip.ra.stamp.Empty() {
+		t.Errorf("stampTotals without totals = %v, stamp %v, want nothing", err, ip.ra.stamp)
+	}
+}
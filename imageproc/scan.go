@@ -0,0 +1,183 @@
+package imageproc
+
+import (
+	"bytes"
+	"caddae/pdf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"os"
+
+	"golang.org/x/image/tiff"
+)
+
+// OpenPage opens the page of the given file, counting from 1. TIFF files can
+// have several pages, and the scan on each page of a PDF is the image on it.
+// PNG and JPEG files only have the one page. A page of 0 is the first page.
+func OpenPage(file string, page int) (image.Image, error) {
+	if page == 0 {
+		page = 1
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch kind, err := scanKind(f); {
+	case err != nil:
+		return nil, err
+	case kind == scanTIFF:
+		pages, order, err := tiffPages(f)
+		if err != nil {
+			return nil, err
+		}
+		if page < 1 || page > len(pages) {
+			e := fmt.Sprintf("%s has no page %d, it has %d", file, page, len(pages))
+			return nil, errors.New(e)
+		}
+		return tiff.Decode(&tiffPage{ReaderAt: f, ifd: pages[page-1], order: order})
+	case kind == scanPDF:
+		r, err := readPDF(f)
+		if err != nil {
+			return nil, err
+		}
+		return r.PageImage(page)
+	}
+
+	if page != 1 {
+		e := fmt.Sprintf("%s has no page %d, it only has the one", file, page)
+		return nil, errors.New(e)
+	}
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// PageCount returns the number of pages in the file.
+func PageCount(file string) (int, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	switch kind, err := scanKind(f); {
+	case err != nil:
+		return 0, err
+	case kind == scanTIFF:
+		pages, _, err := tiffPages(f)
+		return len(pages), err
+	case kind == scanPDF:
+		r, err := readPDF(f)
+		if err != nil {
+			return 0, err
+		}
+		return r.NumPages(), nil
+	}
+	return 1, nil
+}
+
+// scanKind returns the kind of scan in the file, from how it starts. A PDF
+// may have some junk before its header, so the first KB is searched for it.
+func scanKind(f io.ReaderAt) (int, error) {
+	head := make([]byte, 1024)
+	n, err := f.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(head, []byte("II*\x00")), bytes.HasPrefix(head, []byte("MM\x00*")):
+		return scanTIFF, nil
+	case bytes.Contains(head, []byte("%PDF-")):
+		return scanPDF, nil
+	}
+	return scanImage, nil
+}
+
+// readPDF reads the PDF in the file
+func readPDF(f *os.File) (*pdf.Reader, error) {
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return pdf.NewReader(b)
+}
+
+// tiffPages returns the offsets of the image file directories of the TIFF,
+// one for each page, and its byte order.
+func tiffPages(r io.ReaderAt) ([]uint32, binary.ByteOrder, error) {
+	var head [8]byte
+	if _, err := r.ReadAt(head[:], 0); err != nil {
+		return nil, nil, err
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if head[0] == 'M' {
+		order = binary.BigEndian
+	}
+
+	// Each directory is a count of its entries, the entries of 12 bytes
+	// each, then the offset of the next directory, or 0 after the last.
+	var pages []uint32
+	seen := make(map[uint32]bool)
+	for ifd := order.Uint32(head[4:]); ifd != 0 && !seen[ifd]; {
+		seen[ifd] = true
+		pages = append(pages, ifd)
+
+		var count [2]byte
+		if _, err := r.ReadAt(count[:], int64(ifd)); err != nil {
+			return nil, nil, errors.New("invalid TIFF image file directory")
+		}
+		var next [4]byte
+		if _, err := r.ReadAt(next[:], int64(ifd)+2+12*int64(order.Uint16(count[:]))); err != nil {
+			// The last directory of some files stops short of the offset
+			break
+		}
+		ifd = order.Uint32(next[:])
+	}
+	if len(pages) == 0 {
+		return nil, nil, errors.New("the TIFF has no pages")
+	}
+	return pages, order, nil
+}
+
+// ReadAt reads from the TIFF, with the header pointing at the page
+func (t *tiffPage) ReadAt(b []byte, off int64) (int, error) {
+	n, err := t.ReaderAt.ReadAt(b, off)
+	var ifd [4]byte
+	t.order.PutUint32(ifd[:], t.ifd)
+	for i := 0; i < n; i++ {
+		if o := off + int64(i); o >= 4 && o < 8 {
+			b[i] = ifd[o-4]
+		}
+	}
+	return n, err
+}
+
+// Read reads the TIFF from the start, with the header pointing at the page
+func (t *tiffPage) Read(b []byte) (int, error) {
+	n, err := t.ReadAt(b, t.off)
+	t.off += int64(n)
+	return n, err
+}
+
+// editable returns the image in a form we can draw on in color. Black and
+// white and gray scans decode to gray images, and JPEGs to YCbCr ones which
+// can't be drawn on at all, so those are copied to RGBA.
+func editable(img image.Image) image.Image {
+	switch img.(type) {
+	case *image.Gray, *image.Gray16, *image.YCbCr, *image.CMYK:
+		b := img.Bounds()
+		rgba := image.NewRGBA(b)
+		draw.Draw(rgba, b, img, b.Min, draw.Src)
+		return rgba
+	}
+	return img
+}
@@ -0,0 +1,151 @@
+package imageproc
+
+import (
+	"bytes"
+	"caddae/pdf"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// tiffImage is a page of a test TIFF: its strip, and whether it's CCITT group
+// 4 or 8 bit gray
+type tiffImage struct {
+	w, h int
+	data []byte
+	g4   bool
+}
+
+// writeTIFF writes a TIFF of the pages, each a single strip
+func writeTIFF(t *testing.T, pages ...tiffImage) string {
+	t.Helper()
+	var b bytes.Buffer
+	le := binary.LittleEndian
+	b.WriteString("II*\x00\x00\x00\x00\x00")
+
+	var link int
+	for _, p := range pages {
+		strip := b.Len()
+		b.Write(p.data)
+		if b.Len()%2 == 1 {
+			b.WriteByte(0)
+		}
+		ifd := b.Len()
+		out := b.Bytes()
+		if link == 0 {
+			le.PutUint32(out[4:], uint32(ifd))
+		} else {
+			le.PutUint32(out[link:], uint32(ifd))
+		}
+
+		compression, photometric, bits := 1, 1, 8
+		if p.g4 {
+			compression, photometric, bits = 4, 0, 1
+		}
+		tags := [][2]int{
+			{256, p.w}, {257, p.h}, {258, bits}, {259, compression}, {262, photometric},
+			{273, strip}, {277, 1}, {278, p.h}, {279, len(p.data)},
+		}
+		binary.Write(&b, le, uint16(len(tags)))
+		for _, tag := range tags {
+			binary.Write(&b, le, uint16(tag[0]))
+			binary.Write(&b, le, uint16(4)) // LONG
+			binary.Write(&b, le, uint32(1))
+			binary.Write(&b, le, uint32(tag[1]))
+		}
+		link = b.Len()
+		b.Write([]byte{0, 0, 0, 0})
+	}
+
+	path := filepath.Join(t.TempDir(), "scan.tif")
+	if err := os.WriteFile(path, b.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestOpenTIFFPages(t *testing.T) {
+	gray := tiffImage{w: 3, h: 2, data: []byte{0, 50, 100, 150, 200, 250}}
+	// 8 by 2 pixels, with black in columns 2 to 5 of each row
+	g4 := tiffImage{w: 8, h: 2, data: []byte{0x2e, 0xfc}, g4: true}
+	path := writeTIFF(t, gray, g4)
+
+	if n, err := PageCount(path); err != nil || n != 2 {
+		t.Fatalf("PageCount = %d, %v, want 2", n, err)
+	}
+
+	img, err := OpenPage(path, 0)
+	if err != nil {
+		t.Fatalf("OpenPage(1): %v", err)
+	}
+	if img.Bounds().Dx() != 3 || color.GrayModel.Convert(img.At(2, 1)).(color.Gray).Y != 250 {
+		t.Errorf("page 1 = %v", img.Bounds())
+	}
+
+	img, err = OpenPage(path, 2)
+	if err != nil {
+		t.Fatalf("OpenPage(2): %v", err)
+	}
+	if img.Bounds().Dx() != 8 {
+		t.Fatalf("page 2 = %v", img.Bounds())
+	}
+	for x, want := range []uint8{255, 255, 0, 0, 0, 0, 255, 255} {
+		if y := color.GrayModel.Convert(img.At(x, 1)).(color.Gray).Y; y != want {
+			t.Errorf("page 2 pixel %d = %d, want %d", x, y, want)
+		}
+	}
+
+	if _, err := OpenPage(path, 3); err == nil {
+		t.Errorf("OpenPage(3) of 2 pages succeeded")
+	}
+}
+
+func TestOpenPDFPages(t *testing.T) {
+	scan := image.NewGray(image.Rect(0, 0, 20, 10))
+	scan.SetGray(4, 5, color.Gray{77})
+	d := pdf.New(pdf.TABLOID)
+	d.AddText([]pdf.Line{{Text: "Cover"}})
+	d.AddImage(scan, 100, "")
+	path := filepath.Join(t.TempDir(), "scan.pdf")
+	if err := d.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := PageCount(path); err != nil || n != 2 {
+		t.Fatalf("PageCount = %d, %v, want 2", n, err)
+	}
+	img, err := OpenPage(path, 2)
+	if err != nil {
+		t.Fatalf("OpenPage(2): %v", err)
+	}
+	if img.Bounds() != scan.Bounds() || color.GrayModel.Convert(img.At(4, 5)).(color.Gray).Y != 77 {
+		t.Errorf("page 2 = %v", img.Bounds())
+	}
+	if _, err := OpenPage(path, 1); err == nil {
+		t.Errorf("OpenPage of a page without a scan succeeded")
+	}
+}
+
+func TestOpenPNGPages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scan.png")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	png.Encode(f, image.NewGray(image.Rect(0, 0, 2, 2)))
+	f.Close()
+
+	if n, err := PageCount(path); err != nil || n != 1 {
+		t.Errorf("PageCount = %d, %v, want 1", n, err)
+	}
+	if _, err := OpenPage(path, 1); err != nil {
+		t.Errorf("OpenPage(1): %v", err)
+	}
+	if _, err := OpenPage(path, 2); err == nil {
+		t.Errorf("OpenPage(2) of a PNG succeeded")
+	}
+}
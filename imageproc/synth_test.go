@@ -0,0 +1,80 @@
+package imageproc
+
+import (
+	"caddae/synth"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// scoreTolerance is how far drawn pixels may be from the ground truth. The
+// drawn lines follow the hand drawn strokes, which wander up to
+// synth.DefaultOptions().Jitter pixels from it, so it's a little more than that.
+const scoreTolerance = 5.0
+
+// TestSynthetic makes synthetic redlines from the sample asbuilt, runs them
+// through the whole redline to running process, and scores the lines drawn
+// on the running asbuilt against what was highlighted.
+func TestSynthetic(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping synthetic redlines in short mode")
+	}
+
+	lines := []synth.Polyline{
+		{{600, 700}, {1500, 720}, {1550, 1400}},
+		{{2000, 400}, {2900, 600}},
+	}
+	asbuilt := readPNG(t, filepath.Join("..", "testfiles", "VZ_LAN_00007054.png"))
+
+	tests := []struct {
+		name  string
+		opts  func(*synth.Options)
+		minF1 float64
+	}{
+		{"defaults", func(o *synth.Options) {}, 0.8},
+		{"straight", func(o *synth.Options) { o.Scan = synth.Scan{Scale: 1}; o.Jitter, o.Noise, o.Blur = 0, 0, 0 }, 0.9},
+		{"crooked", func(o *synth.Options) { o.Scan = synth.Scan{Scale: 1.02, Rotation: -2, ShiftX: -30, ShiftY: 25} }, 0.8},
+		// Heavy noise turns the blurred edges of the linework yellow enough
+		// to be picked up as short dashes, so expect less of it.
+		{"noisy", func(o *synth.Options) { o.Noise, o.Blur = 12, 2 }, 0.7},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			opts := synth.DefaultOptions()
+			tt.opts(&opts)
+			redline, truth := synth.Generate(asbuilt, lines, opts)
+
+			dir := t.TempDir()
+			rl := filepath.Join(dir, "VZ_LAN_00007054_07_16_21.png")
+			f, err := os.Create(rl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := png.Encode(f, redline); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+
+			ip := testImageProc(Config{
+				Rl:           rl,
+				Ra:           copyFixture(t, dir, "VZ_LAN_00007054.png"),
+				Jn:           "VZ_LAN_00007054",
+				Wpd:          "07/16/2021",
+				Quantities:   map[string]float64{"C300-01": 100},
+				KeepInMemory: true,
+			})
+			if err := ip.ProcessImages(nil, nil); err != nil {
+				t.Fatalf("ProcessImages: %v", err)
+			}
+
+			s := synth.Compare(ip.Running(), truth, scoreTolerance)
+			t.Logf("precision %.3f, recall %.3f, F1 %.3f", s.Precision, s.Recall, s.F1)
+			if s.F1 < tt.minF1 {
+				t.Errorf("F1 = %.3f, want at least %.3f", s.F1, tt.minF1)
+			}
+		})
+	}
+}
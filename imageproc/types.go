@@ -1,24 +1,116 @@
 package imageproc
 
 import (
+	"caddae/callout"
+	"caddae/catalog"
 	"caddae/drawing"
+	"caddae/jobdb"
+	"caddae/pdf"
 	"caddae/types"
+	"encoding/binary"
 	"image"
+	"io"
 
 	"github.com/jroimartin/gocui"
 	"github.com/rs/zerolog"
 )
 
+// calloutGap is the space left between callouts, in pixels.
+const calloutGap = 10
+
+// workStep is the spacing, in pixels, of the points along the drawn lines
+// that the callout is placed near.
+const workStep = 10
+
+// Formats the running asbuilt can be saved in
+const (
+	PNG  = "png"
+	JPEG = "jpeg"
+	PDF  = "pdf"
+)
+
+// DEFAULT_NAME is the output name template of the updated running asbuilt,
+// if none is configured. See ExpandName for its placeholders.
+const DEFAULT_NAME = "{job}_{timestamp}"
+
+// Kinds of scan files, by their contents
+const (
+	scanImage = iota
+	scanTIFF
+	scanPDF
+)
+
 // Config for the running asbuilt
 type Config struct {
-	Rl       string
-	Ra       string
-	Jn       string
-	Wpd      string
-	Strand   float64
-	Cable    float64
-	Overlash float64
-	Anchors  float64
+	Rl   string
+	Ra   string
+	Jn   string
+	Wpd  string
+	Crew string
+
+	// Pages of the redline scan and the running asbuilt to use, counting
+	// from 1, for TIFF and PDF scans with several pages. If they're 0, the
+	// first page is used.
+	Page        int
+	RunningPage int
+
+	// Quantities of the production units, by catalog code
+	Quantities map[string]float64
+
+	// Catalog of the production units. If nil, the default catalog is used.
+	Catalog *catalog.Catalog
+
+	// Ranges are the color ranges of the selected color profile. If empty,
+	// the default drawing.Ranges are used.
+	Ranges drawing.ColorRanges
+
+	// Leader is the style of the arrow from each callout to its lines
+	Leader callout.Leader
+
+	// Font is the font of the callout text
+	Font callout.Font
+
+	// Template is the design of the callout. If nil, the default template is
+	// used.
+	Template *callout.Template
+
+	// Totals are the production placed on the job by earlier runs, and its
+	// design quantities. If set, this run's production is added to them, and
+	// they're stamped on the running asbuilt in TotalsCorner (top left if
+	// it's empty) using TotalsTemplate, or the built in totals template if
+	// it's nil.
+	Totals         *jobdb.Summary
+	TotalsCorner   string
+	TotalsTemplate *callout.Template
+
+	// KeepInMemory skips saving the updated running asbuilt, so that another
+	// pass can continue drawing on it with ContinueFrom.
+	KeepInMemory bool
+
+	// Format the updated running asbuilt is saved in, PNG if it's empty. A
+	// PDF is a package with a cover sheet of the production, the running
+	// asbuilt, and the redlines drawn onto it, on pages of PageSize (11x17
+	// if it's empty).
+	Format   string
+	PageSize pdf.PageSize
+
+	// Placed is the production placed on the job by earlier runs, for the
+	// cover sheet of a PDF package. If nil, the cover only has the redlines
+	// drawn onto this running asbuilt.
+	Placed *jobdb.Summary
+
+	// OutputDir is the folder the updated running asbuilt and the debug
+	// images are saved in, created if it isn't there. If it's empty, they're
+	// saved in the 'edits' folder next to the running asbuilt.
+	OutputDir string
+
+	// OutputName is the template the updated running asbuilt's file name is
+	// made from, without its extension, DEFAULT_NAME if it's empty.
+	OutputName string
+
+	// SkipDebug skips saving the debug images, the preprocessed redline and
+	// the drawings of the callouts, next to the running asbuilt.
+	SkipDebug bool
 }
 
 // ImageProc data type for image processing
@@ -49,7 +141,30 @@ type Running struct {
 	img           image.Image
 	cm            drawing.ColorMap
 	approxChanges []*drawing.Pixel
+	callouts      []image.Rectangle
+	stamp         image.Rectangle
+	lines         drawing.Lines
+	prod          *types.Production
+	callout       *callout.Callout
+	applied       []applied
 	bChange       []*drawing.Pixel
 	yChange       []*drawing.Pixel
 	wChange       []*drawing.Pixel
 }
+
+// applied is a redline drawn onto the running asbuilt, by this pass or one it
+// continued from
+type applied struct {
+	redline string
+	page    int
+	prod    *types.Production
+}
+
+// tiffPage reads a TIFF as if the page with the image file directory at ifd
+// was its first, since tiff.Decode only decodes the first page.
+type tiffPage struct {
+	io.ReaderAt
+	ifd   uint32
+	order binary.ByteOrder
+	off   int64
+}
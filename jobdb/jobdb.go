@@ -0,0 +1,366 @@
+// Package jobdb provides the job database: the history of every redline
+// processed onto each job's running asbuilt, so the production placed on a job
+// can be looked up without opening any images.
+package jobdb
+
+import (
+	"caddae/drawing"
+	"caddae/types"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// jobsBucket is the top level bucket, holding a bucket of runs for each job
+var jobsBucket = []byte("jobs")
+
+// designBucket holds the design quantities of each job, by job number
+var designBucket = []byte("design")
+
+// ErrNoJob is returned when a job has no runs recorded
+var ErrNoJob = errors.New("no runs recorded for the job")
+
+// DefaultPath returns where the job database is kept unless we're told
+// otherwise: caddae/jobs.db in the user's config folder, or in the working
+// directory if there isn't one.
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "jobs.db"
+	}
+	return filepath.Join(dir, "caddae", "jobs.db")
+}
+
+// Open opens the job database at path, creating it if it doesn't exist. It
+// waits up to a few seconds for another caddae using the database to finish.
+func Open(path string) (*DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, errors.Wrapf(err, "jobdb.Open(%s): failed to make the database folder", path)
+	}
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, errors.Wrapf(err, "jobdb.Open(%s): failed to open the job database", path)
+	}
+	return &DB{path: path, db: db}, nil
+}
+
+// Close closes the job database
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// Path returns the file of the job database
+func (d *DB) Path() string {
+	return d.path
+}
+
+// jobKey returns the bucket name of the job
+func jobKey(job string) []byte {
+	return []byte(strings.ToUpper(strings.TrimSpace(job)))
+}
+
+// Add records the run in its job's history, setting its ID, and its time if
+// it isn't set.
+func (d *DB) Add(r *Run) error {
+	if strings.TrimSpace(r.Job) == "" {
+		return errors.New("jobdb.Add: run is missing a job number")
+	}
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		jobs, err := tx.CreateBucketIfNotExists(jobsBucket)
+		if err != nil {
+			return err
+		}
+		b, err := jobs.CreateBucketIfNotExists(jobKey(r.Job))
+		if err != nil {
+			return err
+		}
+		if r.ID, err = b.NextSequence(); err != nil {
+			return err
+		}
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		return b.Put(runKey(r.ID), data)
+	})
+	return errors.Wrapf(err, "jobdb.Add(%s): failed to record run", r.Job)
+}
+
+// runKey returns the key of the run with the ID, which sorts in ID order
+func runKey(id uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, id)
+	return k
+}
+
+// Jobs returns the job numbers with runs recorded, in order.
+func (d *DB) Jobs() ([]string, error) {
+	var jobs []string
+	err := d.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(jobsBucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			jobs = append(jobs, string(k))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "jobdb.Jobs: failed to read jobs")
+	}
+	sort.Strings(jobs)
+	return jobs, nil
+}
+
+// Runs returns the runs recorded for the job, in the order they were run.
+func (d *DB) Runs(job string) ([]Run, error) {
+	var runs []Run
+	err := d.db.View(func(tx *bolt.Tx) error {
+		jobs := tx.Bucket(jobsBucket)
+		if jobs == nil {
+			return nil
+		}
+		b := jobs.Bucket(jobKey(job))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var r Run
+			if err := json.Unmarshal(v, &r); err != nil {
+				return fmt.Errorf("run %d: %v", binary.BigEndian.Uint64(k), err)
+			}
+			runs = append(runs, r)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "jobdb.Runs(%s): failed to read runs", job)
+	}
+	return runs, nil
+}
+
+// FindRedline returns the last run of the job for the page of a redline with
+// the hash, or nil if it hasn't been processed onto the job before. Pages are
+// counted from 1, and 0 is the first page.
+func (d *DB) FindRedline(job, sha string, page int) (*Run, error) {
+	if page == 1 {
+		page = 0
+	}
+	runs, err := d.Runs(job)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(runs) - 1; i >= 0; i-- {
+		if runs[i].Redline.SHA256 == sha && runs[i].Redline.Page == page {
+			return &runs[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// SetDesign sets the design quantities of the job, by unit code, replacing
+// any it had. The production placed on the job is compared against them.
+func (d *DB) SetDesign(job string, qty map[string]float64) error {
+	if strings.TrimSpace(job) == "" {
+		return errors.New("jobdb.SetDesign: missing a job number")
+	}
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(designBucket)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(qty)
+		if err != nil {
+			return err
+		}
+		return b.Put(jobKey(job), data)
+	})
+	return errors.Wrapf(err, "jobdb.SetDesign(%s): failed to save design quantities", job)
+}
+
+// Design returns the design quantities of the job, by unit code, or nil if
+// it doesn't have any.
+func (d *DB) Design(job string) (map[string]float64, error) {
+	var qty map[string]float64
+	err := d.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(designBucket)
+		if b == nil {
+			return nil
+		}
+		data := b.Get(jobKey(job))
+		if data == nil {
+			return nil
+		}
+		return json.Unmarshal(data, &qty)
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "jobdb.Design(%s): failed to read design quantities", job)
+	}
+	return qty, nil
+}
+
+// Summarize adds up the production placed on the job over all of its runs,
+// along with its design quantities. Returns ErrNoJob if the job has no runs.
+func (d *DB) Summarize(job string) (Summary, error) {
+	runs, err := d.Runs(job)
+	if err != nil {
+		return Summary{}, err
+	}
+	if len(runs) == 0 {
+		return Summary{}, errors.Wrapf(ErrNoJob, "jobdb.Summarize(%s)", job)
+	}
+	s := Summarize(job, runs)
+	if s.Design, err = d.Design(job); err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+// Totals returns the production placed on the job so far, along with its
+// design quantities, like Summarize. A job with no runs yet has nothing
+// placed, rather than being an error.
+func (d *DB) Totals(job string) (Summary, error) {
+	s, err := d.Summarize(job)
+	if errors.Is(err, ErrNoJob) {
+		s = Summarize(job, nil)
+		s.Design, err = d.Design(job)
+	}
+	return s, err
+}
+
+// Summarize adds up the production placed by the runs.
+func Summarize(job string, runs []Run) Summary {
+	s := Summary{
+		Job:        string(jobKey(job)),
+		Quantities: make(map[string]float64),
+	}
+	for _, r := range runs {
+		s.add(r.Wpd, r.Units, r.Footage)
+	}
+	return s
+}
+
+// AddProduction adds a run's production, that hasn't been recorded yet, to the
+// totals.
+func (s *Summary) AddProduction(prod *types.Production) {
+	if s.Quantities == nil {
+		s.Quantities = make(map[string]float64)
+	}
+	s.add(prod.Date, prod.Units, prod.Footage())
+}
+
+// add adds the production of a run on the work performed date to the totals
+func (s *Summary) add(wpd string, units []types.Unit, footage float64) {
+	s.Runs++
+	s.Footage += footage
+	for _, u := range units {
+		if qty, err := strconv.ParseFloat(u.Qty, 64); err == nil {
+			s.Quantities[u.Name] += qty
+		}
+	}
+
+	date, err := time.Parse("01/02/2006", wpd)
+	if err != nil {
+		return
+	}
+	if first, err := time.Parse("01/02/2006", s.First); err != nil || date.Before(first) {
+		s.First = wpd
+	}
+	if last, err := time.Parse("01/02/2006", s.Last); err != nil || date.After(last) {
+		s.Last = wpd
+	}
+}
+
+// ByWpd returns the runs in the order the work was performed. Runs are kept
+// in the order they were processed, which isn't always the order the work was
+// done in.
+func ByWpd(runs []Run) []Run {
+	sorted := append([]Run(nil), runs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, _ := time.Parse("01/02/2006", sorted[i].Wpd)
+		b, _ := time.Parse("01/02/2006", sorted[j].Wpd)
+		return a.Before(b)
+	})
+	return sorted
+}
+
+// Sheets returns the last run onto each of the job's running asbuilts: the
+// runs whose output wasn't drawn on by another run. Runs replayed onto one
+// running asbuilt share its output, so only the last of them is returned.
+func Sheets(runs []Run) []Run {
+	drawnOn := make(map[string]bool)
+	for _, r := range runs {
+		drawnOn[filepath.Clean(r.Running.Path)] = true
+	}
+
+	var sheets []Run
+	index := make(map[string]int)
+	for _, r := range runs {
+		out := filepath.Clean(r.Output)
+		if r.Output == "" || drawnOn[out] {
+			continue
+		}
+		if i, ok := index[out]; ok {
+			sheets[i] = r
+			continue
+		}
+		index[out] = len(sheets)
+		sheets = append(sheets, r)
+	}
+	return sheets
+}
+
+// Name returns the base name of the file, with its page if it isn't the
+// first, e.g. "VZ_LAN_00007054.pdf#3"
+func (f File) Name() string {
+	name := filepath.Base(f.Path)
+	if f.Page > 1 {
+		name += fmt.Sprintf("#%d", f.Page)
+	}
+	return name
+}
+
+// HashFile returns the file with the SHA-256 hash of its contents
+func HashFile(path string) (File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return File{}, errors.Wrapf(err, "os.Open(%s): failed to open file to hash", path)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return File{}, errors.Wrapf(err, "failed to hash %s", path)
+	}
+	return File{Path: path, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// Lines converts the drawn lines into the lines recorded for a run
+func Lines(lines drawing.Lines) []Line {
+	out := make([]Line, 0, len(lines))
+	for _, line := range lines {
+		l := make(Line, 0, len(line))
+		for _, p := range line {
+			l = append(l, *p)
+		}
+		out = append(out, l)
+	}
+	return out
+}
@@ -0,0 +1,224 @@
+package jobdb
+
+import (
+	"caddae/drawing"
+	"caddae/types"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// openTest opens a job database in a temporary folder
+func openTest(t *testing.T) *DB {
+	t.Helper()
+	db, err := Open(filepath.Join(t.TempDir(), "caddae", "jobs.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// testRun returns a run of the job placing the strand and anchors
+func testRun(job, wpd, sha, strand, anchors string) Run {
+	ft, _ := strconv.ParseFloat(strand, 64)
+	return Run{
+		Job:     job,
+		Wpd:     wpd,
+		Redline: File{Path: wpd + ".png", SHA256: sha},
+		Units: []types.Unit{
+			{Name: "C300-01", Qty: strand, Footage: true},
+			{Name: "C300-04", Qty: anchors},
+		},
+		Footage: ft,
+		User:    "tester",
+	}
+}
+
+func TestAddRuns(t *testing.T) {
+	db := openTest(t)
+
+	// Added out of date order, which is the order they're kept in
+	for _, r := range []Run{
+		testRun("VZ_LAN_00007054", "03/02/2022", "b", "250", "1"),
+		testRun("VZ_LAN_00007054", "02/15/2022", "a", "100", "2"),
+		testRun("vz_lan_00001234", "01/10/2022", "c", "75", "0"),
+	} {
+		r := r
+		if err := db.Add(&r); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+		if r.ID == 0 || r.Time.IsZero() {
+			t.Errorf("Add didn't set the ID and time: %+v", r)
+		}
+	}
+	if err := db.Add(&Run{}); err == nil {
+		t.Errorf("Add of a run without a job succeeded")
+	}
+
+	jobs, err := db.Jobs()
+	if err != nil {
+		t.Fatalf("Jobs: %v", err)
+	}
+	if want := []string{"VZ_LAN_00001234", "VZ_LAN_00007054"}; !reflect.DeepEqual(jobs, want) {
+		t.Errorf("Jobs = %v, want %v", jobs, want)
+	}
+
+	runs, err := db.Runs("vz_lan_00007054")
+	if err != nil {
+		t.Fatalf("Runs: %v", err)
+	}
+	if len(runs) != 2 || runs[0].ID != 1 || runs[1].ID != 2 || runs[0].Wpd != "03/02/2022" {
+		t.Fatalf("Runs = %+v, want the two runs in the order they were added", runs)
+	}
+	if runs[1].User != "tester" || runs[1].Units[0].Qty != "100" {
+		t.Errorf("run didn't round trip: %+v", runs[1])
+	}
+
+	if runs, err := db.Runs("VZ_LAN_00000000"); err != nil || len(runs) != 0 {
+		t.Errorf("Runs of an unknown job = %v, %v, want none", runs, err)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	db := openTest(t)
+	for _, r := range []Run{
+		testRun("VZ_LAN_00007054", "03/02/2022", "b", "250", "1"),
+		testRun("VZ_LAN_00007054", "02/15/2022", "a", "100", "2"),
+		testRun("VZ_LAN_00007054", "12/20/2021", "c", "75", "0"),
+	} {
+		r := r
+		if err := db.Add(&r); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+
+	s, err := db.Summarize("VZ_LAN_00007054")
+	if err != nil {
+		t.Fatalf("Summarize: %v", err)
+	}
+	want := Summary{
+		Job:        "VZ_LAN_00007054",
+		Runs:       3,
+		First:      "12/20/2021",
+		Last:       "03/02/2022",
+		Footage:    425,
+		Quantities: map[string]float64{"C300-01": 425, "C300-04": 3},
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("Summarize = %+v, want %+v", s, want)
+	}
+
+	if _, err := db.Summarize("VZ_LAN_00000000"); !errors.Is(err, ErrNoJob) {
+		t.Errorf("Summarize of an unknown job = %v, want ErrNoJob", err)
+	}
+}
+
+func TestFindRedline(t *testing.T) {
+	db := openTest(t)
+	for _, r := range []Run{
+		testRun("VZ_LAN_00007054", "02/15/2022", "a", "100", "2"),
+		testRun("VZ_LAN_00007054", "03/02/2022", "b", "250", "1"),
+		testRun("VZ_LAN_00007054", "02/15/2022", "a", "100", "2"),
+	} {
+		r := r
+		if err := db.Add(&r); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+
+	prev, err := db.FindRedline("VZ_LAN_00007054", "a", 1)
+	if err != nil {
+		t.Fatalf("FindRedline: %v", err)
+	}
+	if prev == nil || prev.ID != 3 {
+		t.Errorf("FindRedline = %+v, want the last run of the redline", prev)
+	}
+
+	// Only the same job counts
+	if prev, err := db.FindRedline("VZ_LAN_00001234", "a", 0); err != nil || prev != nil {
+		t.Errorf("FindRedline on another job = %+v, %v, want nil", prev, err)
+	}
+
+	// Nor another page of the same scan
+	if prev, err := db.FindRedline("VZ_LAN_00007054", "a", 2); err != nil || prev != nil {
+		t.Errorf("FindRedline of another page = %+v, %v, want nil", prev, err)
+	}
+}
+
+func TestFileName(t *testing.T) {
+	if name := (File{Path: "/scans/VZ_LAN_00007054.pdf"}).Name(); name != "VZ_LAN_00007054.pdf" {
+		t.Errorf("Name = %s", name)
+	}
+	if name := (File{Path: "/scans/VZ_LAN_00007054.pdf", Page: 3}).Name(); name != "VZ_LAN_00007054.pdf#3" {
+		t.Errorf("Name of page 3 = %s", name)
+	}
+}
+
+func TestHashFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "redline.png")
+	if err := os.WriteFile(path, []byte("abc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := HashFile(path)
+	if err != nil {
+		t.Fatalf("HashFile: %v", err)
+	}
+	if want := "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"; f.SHA256 != want || f.Path != path {
+		t.Errorf("HashFile = %+v, want sha256 %s", f, want)
+	}
+	if _, err := HashFile(path + ".missing"); err == nil {
+		t.Errorf("HashFile of a missing file succeeded")
+	}
+}
+
+func TestLines(t *testing.T) {
+	lines := drawing.Lines{
+		{{X: 1, Y: 2}, {X: 3, Y: 4}},
+		{{X: 5, Y: 6}},
+	}
+	want := []Line{
+		{{X: 1, Y: 2}, {X: 3, Y: 4}},
+		{{X: 5, Y: 6}},
+	}
+	if got := Lines(lines); !reflect.DeepEqual(got, want) {
+		t.Errorf("Lines = %v, want %v", got, want)
+	}
+}
+
+func TestByWpd(t *testing.T) {
+	runs := []Run{{ID: 1, Wpd: "07/19/2021"}, {ID: 2, Wpd: "07/16/2021"}, {ID: 3, Wpd: "07/19/2021"}}
+	var ids []uint64
+	for _, r := range ByWpd(runs) {
+		ids = append(ids, r.ID)
+	}
+	if !reflect.DeepEqual(ids, []uint64{2, 1, 3}) {
+		t.Errorf("ByWpd = %v, want [2 1 3]", ids)
+	}
+	if runs[0].ID != 1 {
+		t.Errorf("ByWpd sorted the runs given")
+	}
+}
+
+func TestSheets(t *testing.T) {
+	runs := []Run{
+		// Two days on one sheet, the second drawn on the first's output
+		{ID: 1, Running: File{Path: "a.png"}, Output: "out/a_1.png"},
+		{ID: 2, Running: File{Path: "out/a_1.png"}, Output: "out/a_2.png"},
+		// Two redlines replayed onto another sheet
+		{ID: 3, Running: File{Path: "b.png"}, Output: "out/b_1.png"},
+		{ID: 4, Running: File{Path: "b.png"}, Output: "./out/b_1.png"},
+		// A run that wasn't saved
+		{ID: 5, Running: File{Path: "c.png"}},
+	}
+	var ids []uint64
+	for _, r := range Sheets(runs) {
+		ids = append(ids, r.ID)
+	}
+	if !reflect.DeepEqual(ids, []uint64{2, 4}) {
+		t.Errorf("Sheets = %v, want [2 4]", ids)
+	}
+}
@@ -0,0 +1,102 @@
+package jobdb
+
+import (
+	"caddae/drawing"
+	"caddae/types"
+	"image"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// DB is the job database, a bbolt file with a bucket of runs for each job.
+type DB struct {
+	path string
+	db   *bolt.DB
+}
+
+// Run is a redline that was processed onto a job's running asbuilt.
+type Run struct {
+	// ID of the run, counting up from 1 for each job
+	ID uint64 `json:"id"`
+
+	// Job number and work performed date of the redline
+	Job string `json:"job"`
+	Wpd string `json:"wpd"`
+
+	// Redline and running asbuilt files that went in, and the updated running
+	// asbuilt that came out
+	Redline File   `json:"redline"`
+	Running File   `json:"running"`
+	Output  string `json:"output"`
+
+	// Quantities given for the production units, by catalog code, and the
+	// production units shown on the callout, including derived units
+	Quantities map[string]float64 `json:"quantities"`
+	Units      []types.Unit       `json:"units"`
+
+	// Footage is the total feet of new plant in the production
+	Footage float64 `json:"footage"`
+
+	// Lines drawn on the running asbuilt, in running asbuilt pixels
+	Lines []Line `json:"lines"`
+
+	// Callout added to the running asbuilt for the run
+	Callout Callout `json:"callout"`
+
+	// Size of the running asbuilt in pixels, and the DPI it was scanned at,
+	// to turn pixels into sheet units
+	Size image.Point `json:"size"`
+	DPI  float64     `json:"dpi"`
+
+	// Profile, template and crew used for the run
+	Profile  string `json:"profile,omitempty"`
+	Template string `json:"template,omitempty"`
+	Crew     string `json:"crew,omitempty"`
+
+	// User who ran it, and when
+	User string    `json:"user"`
+	Time time.Time `json:"time"`
+}
+
+// File is an input file and the SHA-256 hash of what was in it. Page is the
+// page of a TIFF or PDF scan that was used, if it wasn't the first.
+type File struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Page   int    `json:"page,omitempty"`
+}
+
+// Callout is where a run's callout went on the running asbuilt, in pixels,
+// and what it says
+type Callout struct {
+	Box  image.Rectangle `json:"box"`
+	Text []string        `json:"text"`
+
+	// Size of the text in points
+	Size float64 `json:"size"`
+}
+
+// Line is a drawn line, as the points of a polyline
+type Line []drawing.Pixel
+
+// Summary is the production placed on a job so far, over all of its runs.
+type Summary struct {
+	Job  string
+	Runs int
+
+	// First and Last are the earliest and latest work performed dates
+	First string
+	Last  string
+
+	// Footage is the total feet of new plant
+	Footage float64
+
+	// Quantities are the totals of each production unit shown on the
+	// callouts, by code, including derived units
+	Quantities map[string]float64
+
+	// Design are the design quantities of the job, by code, that the totals
+	// are compared against. Nil if the job doesn't have any.
+	Design map[string]float64
+}
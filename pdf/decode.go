@@ -0,0 +1,478 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/lzw"
+	"compress/zlib"
+	"encoding/ascii85"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+
+	"github.com/pkg/errors"
+	"golang.org/x/image/ccitt"
+	tifflzw "golang.org/x/image/tiff/lzw"
+)
+
+// image decodes the image stream into an image. Color images are RGBA, and
+// gray or black and white ones Gray.
+func (r *Reader) image(s *stream) (image.Image, error) {
+	data, filter, parms, err := r.decode(s)
+	if err != nil {
+		return nil, err
+	}
+	w, h := r.integer(s.dict["Width"], 0), r.integer(s.dict["Height"], 0)
+	if w <= 0 || h <= 0 {
+		return nil, fmt.Errorf("invalid image size %dx%d", w, h)
+	}
+
+	switch filter {
+	case "":
+		return r.samples(data, s.dict, w, h)
+	case "DCTDecode":
+		return jpeg.Decode(bytes.NewReader(data))
+	case "CCITTFaxDecode":
+		return r.fax(data, s.dict, parms, w, h)
+	}
+	return nil, fmt.Errorf("%s images aren't supported, the page needs to be scanned again as a TIFF, PNG or JPEG", filter)
+}
+
+// decode undoes the filters of the stream. Image filters are left for the
+// image to be decoded with, and are returned with their parameters.
+func (r *Reader) decode(s *stream) (data []byte, filter string, parms dict, err error) {
+	data = s.data
+	filters, params := r.filters(s.dict)
+	for i, f := range filters {
+		switch f {
+		case "FlateDecode", "Fl":
+			if data, err = inflate(data); err != nil {
+				return nil, "", nil, err
+			}
+			if data, err = r.predict(data, params[i]); err != nil {
+				return nil, "", nil, err
+			}
+		case "LZWDecode", "LZW":
+			var lr io.ReadCloser
+			if r.integer(params[i]["EarlyChange"], 1) == 0 {
+				lr = lzw.NewReader(bytes.NewReader(data), lzw.MSB, 8)
+			} else {
+				// PDF's LZW changes code width a code early by default,
+				// like TIFF's does
+				lr = tifflzw.NewReader(bytes.NewReader(data), tifflzw.MSB, 8)
+			}
+			data, err = io.ReadAll(lr)
+			lr.Close()
+			if err != nil {
+				return nil, "", nil, errors.Wrap(err, "LZWDecode")
+			}
+			if data, err = r.predict(data, params[i]); err != nil {
+				return nil, "", nil, err
+			}
+		case "ASCIIHexDecode", "AHx":
+			if end := bytes.IndexByte(data, '>'); end >= 0 {
+				data = data[:end]
+			}
+			if data, err = unhex(data); err != nil {
+				return nil, "", nil, errors.Wrap(err, "ASCIIHexDecode")
+			}
+		case "ASCII85Decode", "A85":
+			data = bytes.TrimSpace(data)
+			data = bytes.TrimPrefix(data, []byte("<~"))
+			if end := bytes.Index(data, []byte("~>")); end >= 0 {
+				data = data[:end]
+			}
+			if data, err = io.ReadAll(ascii85.NewDecoder(bytes.NewReader(data))); err != nil {
+				return nil, "", nil, errors.Wrap(err, "ASCII85Decode")
+			}
+		case "RunLengthDecode", "RL":
+			data = unrunLength(data)
+		case "DCTDecode", "DCT", "CCITTFaxDecode", "CCF", "JBIG2Decode", "JPXDecode":
+			full := map[string]string{"DCT": "DCTDecode", "CCF": "CCITTFaxDecode"}[f]
+			if full == "" {
+				full = f
+			}
+			return data, full, params[i], nil
+		default:
+			return nil, "", nil, fmt.Errorf("unsupported filter %s", f)
+		}
+	}
+	return data, "", nil, nil
+}
+
+// filters returns the names of the filters of the stream, in the order to
+// undo them, and their parameters. Filters without any get an empty dict.
+func (r *Reader) filters(d dict) ([]string, []dict) {
+	var filters []string
+	switch f := r.resolve(d["Filter"]).(type) {
+	case pname:
+		filters = []string{string(f)}
+	case []value:
+		for _, v := range f {
+			if n, ok := r.resolve(v).(pname); ok {
+				filters = append(filters, string(n))
+			}
+		}
+	}
+
+	var params []dict
+	switch p := r.resolve(d["DecodeParms"]).(type) {
+	case dict:
+		params = []dict{p}
+	case []value:
+		for _, v := range p {
+			d, _ := r.resolve(v).(dict)
+			params = append(params, d)
+		}
+	}
+	for len(params) < len(filters) {
+		params = append(params, nil)
+	}
+	for i := range params {
+		if params[i] == nil {
+			params[i] = dict{}
+		}
+	}
+	return filters, params
+}
+
+// inflate undoes FlateDecode. Scanners don't always finish their streams
+// properly, so what could be inflated is kept if the end is missing.
+func inflate(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "FlateDecode")
+	}
+	out, err := io.ReadAll(zr)
+	if err != nil && (len(out) == 0 || (err != io.ErrUnexpectedEOF && err != zlib.ErrChecksum)) {
+		return nil, errors.Wrap(err, "FlateDecode")
+	}
+	return out, nil
+}
+
+// predict undoes the predictor of FlateDecode or LZWDecode data, if it has
+// one
+func (r *Reader) predict(data []byte, parms dict) ([]byte, error) {
+	predictor := r.integer(parms["Predictor"], 1)
+	if predictor == 1 {
+		return data, nil
+	}
+	colors := r.integer(parms["Colors"], 1)
+	bpc := r.integer(parms["BitsPerComponent"], 8)
+	columns := r.integer(parms["Columns"], 1)
+	if colors < 1 || bpc < 1 || columns < 1 {
+		return nil, errors.New("invalid predictor parameters")
+	}
+	bpp := colors * bpc / 8
+	if bpp < 1 {
+		bpp = 1
+	}
+	rowLen := (colors*bpc*columns + 7) / 8
+
+	if predictor == 2 {
+		// TIFF's horizontal differencing
+		if bpc != 8 {
+			return nil, fmt.Errorf("TIFF predictor with %d bits per component isn't supported", bpc)
+		}
+		for row := 0; row+rowLen <= len(data); row += rowLen {
+			for i := row + colors; i < row+rowLen; i++ {
+				data[i] += data[i-colors]
+			}
+		}
+		return data, nil
+	}
+
+	// PNG predictors, with a filter type at the start of each row
+	out := make([]byte, 0, len(data)/(rowLen+1)*rowLen)
+	prev := make([]byte, rowLen)
+	for row := 0; row+rowLen+1 <= len(data); row += rowLen + 1 {
+		ft, cur := data[row], data[row+1:row+1+rowLen]
+		for i := range cur {
+			var left, upLeft byte
+			if i >= bpp {
+				left, upLeft = cur[i-bpp], prev[i-bpp]
+			}
+			up := prev[i]
+			switch ft {
+			case 1:
+				cur[i] += left
+			case 2:
+				cur[i] += up
+			case 3:
+				cur[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				cur[i] += paeth(left, up, upLeft)
+			}
+		}
+		out = append(out, cur...)
+		prev = cur
+	}
+	return out, nil
+}
+
+// paeth is the Paeth predictor of PNG
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// unrunLength undoes RunLengthDecode
+func unrunLength(data []byte) []byte {
+	var out []byte
+	for i := 0; i < len(data); {
+		n := int(data[i])
+		i++
+		switch {
+		case n == 128:
+			return out
+		case n < 128:
+			end := i + n + 1
+			if end > len(data) {
+				end = len(data)
+			}
+			out = append(out, data[i:end]...)
+			i = end
+		case i < len(data):
+			for j := 0; j < 257-n; j++ {
+				out = append(out, data[i])
+			}
+			i++
+		}
+	}
+	return out
+}
+
+// fax decodes a CCITT group 3 or 4 image, which is how most black and white
+// scans are compressed
+func (r *Reader) fax(data []byte, d, parms dict, w, h int) (image.Image, error) {
+	sf := ccitt.Group3
+	switch k := r.integer(parms["K"], 0); {
+	case k < 0:
+		sf = ccitt.Group4
+	case k > 0:
+		return nil, errors.New("mixed one and two dimensional CCITT group 3 images aren't supported")
+	}
+	columns := r.integer(parms["Columns"], 1728)
+	rows := r.integer(parms["Rows"], 0)
+	if rows <= 0 {
+		rows = h
+	}
+
+	// The decoded samples are 0 for black unless BlackIs1, and the image's
+	// Decode array can swap them again.
+	img := image.NewGray(image.Rect(0, 0, columns, rows))
+	opts := &ccitt.Options{
+		Align:  r.resolve(parms["EncodedByteAlign"]) == true,
+		Invert: r.resolve(parms["BlackIs1"]) == true,
+	}
+	if err := ccitt.DecodeIntoGray(img, bytes.NewReader(data), ccitt.MSB, sf, opts); err != nil {
+		return nil, errors.Wrap(err, "CCITTFaxDecode")
+	}
+	if r.inverted(d) {
+		for i := range img.Pix {
+			img.Pix[i] = 255 - img.Pix[i]
+		}
+	}
+	return img, nil
+}
+
+// inverted reports whether the image's Decode array swaps the dark and light
+// ends of its samples, e.g. [1 0]
+func (r *Reader) inverted(d dict) bool {
+	a, ok := r.resolve(d["Decode"]).([]value)
+	if !ok || len(a) < 2 {
+		return false
+	}
+	lo, hi := r.number(a[0]), r.number(a[1])
+	return lo > hi
+}
+
+// number returns the value as a float, or 0 if it isn't a number
+func (r *Reader) number(v value) float64 {
+	switch n := r.resolve(v).(type) {
+	case int:
+		return float64(n)
+	case float64:
+		return n
+	}
+	return 0
+}
+
+// samples makes an image of the raw samples of an image stream
+func (r *Reader) samples(data []byte, d dict, w, h int) (image.Image, error) {
+	bpc := r.integer(d["BitsPerComponent"], 8)
+	cs := colorSpace{comps: 1}
+	if r.resolve(d["ImageMask"]) == true {
+		// A stencil, painted black where its samples are 0
+		bpc = 1
+	} else {
+		var err error
+		if cs, err = r.colorSpace(d["ColorSpace"], 0); err != nil {
+			return nil, err
+		}
+	}
+	switch bpc {
+	case 1, 2, 4, 8, 16:
+	default:
+		return nil, fmt.Errorf("images with %d bits per component aren't supported", bpc)
+	}
+
+	comps := cs.comps
+	if cs.palette != nil {
+		comps = 1
+	}
+	rowLen := (w*comps*bpc + 7) / 8
+	if len(data) < rowLen*h {
+		return nil, fmt.Errorf("the image data is %d bytes short", rowLen*h-len(data))
+	}
+
+	// sample returns the ith sample of the row, scaled to a byte, or as is
+	// for palette indexes
+	max := 1<<uint(bpc) - 1
+	invert := r.inverted(d)
+	sample := func(row []byte, i int) int {
+		var v int
+		switch bpc {
+		case 8:
+			v = int(row[i])
+		case 16:
+			v = int(row[2*i])
+		default:
+			bit := i * bpc
+			v = int(row[bit/8]>>(8-uint(bpc)-uint(bit%8))) & max
+		}
+		if cs.palette != nil {
+			return v
+		}
+		if bpc < 8 {
+			v = v * 255 / max
+		}
+		if invert {
+			v = 255 - v
+		}
+		return v
+	}
+
+	if cs.palette == nil && cs.comps == 1 {
+		img := image.NewGray(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			row := data[y*rowLen:]
+			for x := 0; x < w; x++ {
+				img.Pix[y*img.Stride+x] = uint8(sample(row, x))
+			}
+		}
+		return img, nil
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	c := make([]int, cs.comps)
+	for y := 0; y < h; y++ {
+		row := data[y*rowLen:]
+		for x := 0; x < w; x++ {
+			if cs.palette != nil {
+				i := sample(row, x) * cs.comps
+				for j := range c {
+					if i+j < len(cs.palette) {
+						c[j] = int(cs.palette[i+j])
+					}
+				}
+			} else {
+				for j := range c {
+					c[j] = sample(row, x*comps+j)
+				}
+			}
+			img.SetRGBA(x, y, toRGBA(c))
+		}
+	}
+	return img, nil
+}
+
+// toRGBA returns the gray, RGB or CMYK color as RGBA
+func toRGBA(c []int) color.RGBA {
+	switch len(c) {
+	case 1:
+		return color.RGBA{uint8(c[0]), uint8(c[0]), uint8(c[0]), 255}
+	case 3:
+		return color.RGBA{uint8(c[0]), uint8(c[1]), uint8(c[2]), 255}
+	}
+	r, g, b := color.CMYKToRGB(uint8(c[0]), uint8(c[1]), uint8(c[2]), uint8(c[3]))
+	return color.RGBA{r, g, b, 255}
+}
+
+// colorSpace returns the color space of an image. The device and calibrated
+// gray, RGB and CMYK color spaces are supported, ICC profiles are taken by
+// their number of components, and indexed color spaces on any of those.
+func (r *Reader) colorSpace(v value, depth int) (colorSpace, error) {
+	v = r.resolve(v)
+	if a, ok := v.([]value); ok && len(a) == 1 {
+		v = r.resolve(a[0])
+	}
+	switch cs := v.(type) {
+	case nil:
+		// Only image masks and JPX images may leave it out, and then it's
+		// taken to be gray
+		return colorSpace{comps: 1}, nil
+	case pname:
+		switch cs {
+		case "DeviceGray", "CalGray", "G":
+			return colorSpace{comps: 1}, nil
+		case "DeviceRGB", "CalRGB", "RGB":
+			return colorSpace{comps: 3}, nil
+		case "DeviceCMYK", "CMYK":
+			return colorSpace{comps: 4}, nil
+		}
+		return colorSpace{}, fmt.Errorf("color space %s isn't supported", cs)
+	case []value:
+		family, _ := r.resolve(cs[0]).(pname)
+		switch family {
+		case "CalGray", "CalRGB", "DeviceGray", "DeviceRGB", "DeviceCMYK":
+			return r.colorSpace(family, depth)
+		case "ICCBased":
+			if s, ok := r.resolve(cs[1]).(*stream); ok {
+				switch n := r.integer(s.dict["N"], 0); n {
+				case 1, 3, 4:
+					return colorSpace{comps: n}, nil
+				}
+			}
+			return colorSpace{}, errors.New("invalid ICC based color space")
+		case "Indexed", "I":
+			if len(cs) < 4 || depth > 0 {
+				return colorSpace{}, errors.New("invalid indexed color space")
+			}
+			base, err := r.colorSpace(cs[1], depth+1)
+			if err != nil {
+				return colorSpace{}, err
+			}
+			switch p := r.resolve(cs[3]).(type) {
+			case []byte:
+				base.palette = p
+			case *stream:
+				data, filter, _, err := r.decode(p)
+				if err != nil || filter != "" {
+					return colorSpace{}, errors.New("invalid indexed color space palette")
+				}
+				base.palette = data
+			default:
+				return colorSpace{}, errors.New("invalid indexed color space palette")
+			}
+			return base, nil
+		}
+		return colorSpace{}, fmt.Errorf("color space %s isn't supported", family)
+	}
+	return colorSpace{}, errors.New("invalid color space")
+}
@@ -0,0 +1,97 @@
+package pdf
+
+import (
+	"caddae/catalog"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Document returns the package as a document with pages of the size: the
+// cover sheet, then a page for each running asbuilt, then the redlines.
+func (p *Package) Document(size PageSize) *Document {
+	d := New(size)
+	d.SetTitle(p.Job + " running asbuilt package")
+	d.AddText(p.cover(time.Now()))
+
+	for _, s := range p.Sheets {
+		d.addSheet(s)
+	}
+	if len(p.Redlines) > 0 {
+		d.AddText([]Line{
+			{Text: "Appendix", Font: HELVETICA_BOLD, Size: 24},
+			{Text: "Redline scans", Size: 14},
+		})
+		for _, s := range p.Redlines {
+			d.addSheet(s)
+		}
+	}
+	return d
+}
+
+// Save writes the package to a PDF file with pages of the size.
+func (p *Package) Save(path string, size PageSize) error {
+	return p.Document(size).Save(path)
+}
+
+// addSheet adds the sheet's page, or a note that it's missing if there's no
+// image for it
+func (d *Document) addSheet(s Sheet) {
+	if s.Image == nil {
+		d.AddText([]Line{{Text: "Missing: " + s.Caption}})
+		return
+	}
+	d.AddImage(s.Image, s.DPI, s.Caption)
+}
+
+// cover returns the lines of the cover sheet: the job, its work performed
+// dates, and the production placed on it against its design quantities.
+func (p *Package) cover(now time.Time) []Line {
+	lines := []Line{
+		{Text: p.Job, Font: HELVETICA_BOLD, Size: 28},
+		{Text: "Running Asbuilt Package", Size: 16},
+		{Text: "Prepared " + now.Format("01/02/2006"), Size: 12},
+		{},
+	}
+
+	s := p.Totals
+	if s.Runs == 0 {
+		return append(lines, Line{Text: "No production recorded."})
+	}
+	dates := s.First
+	if s.Last != s.First {
+		dates += " to " + s.Last
+	}
+	runs := "redline"
+	if s.Runs != 1 {
+		runs += "s"
+	}
+	lines = append(lines,
+		Line{Text: fmt.Sprintf("Work performed %s, %d %s", dates, s.Runs, runs), Size: 12},
+		Line{},
+		Line{Text: "Production to " + s.Last, Font: HELVETICA_BOLD, Size: 14},
+	)
+
+	// The standard fonts have no tab stops, so the table is lined up in
+	// Courier.
+	cat := p.Catalog
+	if cat == nil {
+		cat = catalog.DefaultCatalog()
+	}
+	var b strings.Builder
+	tw := tabwriter.NewWriter(&b, 0, 0, 3, ' ', 0)
+	fmt.Fprintf(tw, "UNIT\tDESCRIPTION\tPLACED\tDESIGN\tPLACED %%\n")
+	for _, u := range cat.Totals(s.Quantities, s.Design) {
+		qty := u.Qty
+		if unit, err := cat.Get(u.Name); err == nil && unit.Measure != "" {
+			qty += " " + unit.Measure
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", u.Name, u.Description, qty, u.Design, u.Percent)
+	}
+	tw.Flush()
+	for _, row := range strings.Split(strings.TrimRight(b.String(), "\n"), "\n") {
+		lines = append(lines, Line{Text: strings.TrimRight(row, " "), Font: COURIER, Size: 10})
+	}
+	return lines
+}
@@ -0,0 +1,417 @@
+// Package pdf provides a PDF writer for running asbuilt packages: pages of
+// text in the standard fonts, and pages of scans embedded at their native
+// resolution. It also reads the scans back out of the pages of image-only
+// PDFs, like the redlines that come in from the field.
+package pdf
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Page sizes
+var (
+	ANSI_D  = PageSize{Name: "ANSI D", Width: 22 * 72, Height: 34 * 72}
+	TABLOID = PageSize{Name: "11x17", Width: 11 * 72, Height: 17 * 72}
+)
+
+// Standard fonts, which every PDF reader has so they aren't embedded
+const (
+	HELVETICA      = "Helvetica"
+	HELVETICA_BOLD = "Helvetica-Bold"
+	COURIER        = "Courier"
+)
+
+// fonts are the standard fonts, in the order of their resource names, F1 to F3
+var fonts = []string{HELVETICA, HELVETICA_BOLD, COURIER}
+
+// Page layout, in points
+const (
+	margin      = 36
+	textMargin  = 72
+	captionSize = 10
+	leading     = 1.4
+)
+
+// ParsePageSize returns the page size with the name, e.g. "ansi-d" or
+// "11x17".
+func ParsePageSize(name string) (PageSize, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "ansi-d", "ansi d", "d", "22x34":
+		return ANSI_D, nil
+	case "11x17", "tabloid", "ansi-b", "ansi b", "b":
+		return TABLOID, nil
+	}
+	return PageSize{}, fmt.Errorf("unknown page size '%s', must be ansi-d or 11x17", name)
+}
+
+// New returns an empty document with pages of the size.
+func New(size PageSize) *Document {
+	return &Document{size: size}
+}
+
+// SetTitle sets the title of the document, shown by PDF readers
+func (d *Document) SetTitle(title string) {
+	d.title = title
+}
+
+// Pages returns the number of pages in the document
+func (d *Document) Pages() int {
+	return len(d.pages)
+}
+
+// AddText adds the lines of text, starting a new page, and more pages as the
+// lines fill them.
+func (d *Document) AddText(lines []Line) {
+	p := page{}
+	y := d.size.Height - textMargin
+	for _, l := range lines {
+		if l.Font == "" {
+			l.Font = HELVETICA
+		}
+		if l.Size == 0 {
+			l.Size = 12
+		}
+		if y-l.Size*leading < textMargin && len(p.lines) > 0 {
+			d.pages = append(d.pages, p)
+			p = page{}
+			y = d.size.Height - textMargin
+		}
+		p.lines = append(p.lines, l)
+		y -= l.Size * leading
+	}
+	d.pages = append(d.pages, p)
+}
+
+// AddImage adds a page of the image, with the caption under it. The image is
+// embedded with every pixel, and shown at the size it was scanned at from its
+// DPI, or smaller if that doesn't fit on the page.
+func (d *Document) AddImage(img image.Image, dpi float64, caption string) {
+	d.pages = append(d.pages, page{image: img, dpi: dpi, caption: caption})
+}
+
+// Save writes the document to a PDF file.
+func (d *Document) Save(path string) error {
+	// We first write a temporary file, then if everything is OK we rename it,
+	// so nobody is sent half a package.
+	newFile := path + ".tmp"
+	f, err := os.Create(newFile)
+	if err != nil {
+		return errors.Wrapf(err, "os.Create(%s): failed to create PDF", newFile)
+	}
+
+	err = d.Write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(newFile)
+		return errors.Wrapf(err, "pdf.Save(%s): failed to write PDF", path)
+	}
+
+	if err := os.Rename(newFile, path); err != nil {
+		return errors.Wrapf(err, "rename(%s, %s)", newFile, path)
+	}
+	return nil
+}
+
+// writer writes the objects of a PDF file, keeping where each one starts for
+// the cross reference table
+type writer struct {
+	w       *bufio.Writer
+	n       int64
+	offsets []int64
+	err     error
+}
+
+func (w *writer) printf(format string, args ...interface{}) {
+	if w.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(w.w, format, args...)
+	w.n += int64(n)
+	w.err = err
+}
+
+func (w *writer) write(b []byte) {
+	if w.err != nil {
+		return
+	}
+	n, err := w.w.Write(b)
+	w.n += int64(n)
+	w.err = err
+}
+
+// object starts the numbered object. Objects are numbered from 1.
+func (w *writer) object(num int) {
+	for len(w.offsets) < num {
+		w.offsets = append(w.offsets, 0)
+	}
+	w.offsets[num-1] = w.n
+	w.printf("%d 0 obj\n", num)
+}
+
+// stream writes the numbered object as a stream of the data compressed, with
+// the entries of its dictionary.
+func (w *writer) stream(num int, dict string, data []byte) {
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write(data)
+	zw.Close()
+
+	w.object(num)
+	w.printf("<< %s /Filter /FlateDecode /Length %d >>\nstream\n", dict, z.Len())
+	w.write(z.Bytes())
+	w.printf("\nendstream\nendobj\n")
+}
+
+// Write writes the document to w as a PDF file.
+func (d *Document) Write(out io.Writer) error {
+	w := &writer{w: bufio.NewWriter(out)}
+	w.printf("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+
+	// The catalog, page tree, info and fonts come first, then each page is
+	// its page object, its contents, and its image if it has one.
+	const catalogObj, pagesObj, infoObj, fontObj = 1, 2, 3, 4
+	next := fontObj + len(fonts)
+	var kids []string
+	for _, p := range d.pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", next))
+		next += 2
+		if p.image != nil {
+			next++
+		}
+	}
+
+	w.object(catalogObj)
+	w.printf("<< /Type /Catalog /Pages %d 0 R >>\nendobj\n", pagesObj)
+	w.object(pagesObj)
+	w.printf("<< /Type /Pages /Kids [%s] /Count %d >>\nendobj\n", strings.Join(kids, " "), len(kids))
+	w.object(infoObj)
+	w.printf("<< /Title %s /Producer (caddae) /CreationDate %s >>\nendobj\n",
+		literal(d.title), literal(time.Now().Format("D:20060102150405")))
+
+	var res strings.Builder
+	res.WriteString("/Font <<")
+	for i, name := range fonts {
+		w.object(fontObj + i)
+		w.printf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>\nendobj\n", name)
+		fmt.Fprintf(&res, " /F%d %d 0 R", i+1, fontObj+i)
+	}
+	res.WriteString(" >>")
+
+	num := fontObj + len(fonts)
+	for _, p := range d.pages {
+		pageObj, contentsObj := num, num+1
+		num += 2
+
+		width, height := d.size.Width, d.size.Height
+		var contents []byte
+		resources := res.String()
+		if p.image != nil {
+			imageObj := num
+			num++
+			b := p.image.Bounds()
+			if b.Dx() > b.Dy() {
+				width, height = height, width
+			}
+			contents = imageContents(p, width, height)
+			resources += fmt.Sprintf(" /XObject << /Im1 %d 0 R >>", imageObj)
+			w.writeImage(imageObj, p.image)
+		} else {
+			contents = textContents(p.lines, height)
+		}
+
+		w.object(pageObj)
+		w.printf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %s %s] /Resources << %s >> /Contents %d 0 R >>\nendobj\n",
+			pagesObj, num2(width), num2(height), resources, contentsObj)
+		w.stream(contentsObj, "", contents)
+	}
+
+	xref := w.n
+	w.printf("xref\n0 %d\n0000000000 65535 f \n", len(w.offsets)+1)
+	for _, off := range w.offsets {
+		w.printf("%010d 00000 n \n", off)
+	}
+	w.printf("trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(w.offsets)+1, catalogObj, infoObj, xref)
+
+	if w.err != nil {
+		return w.err
+	}
+	return w.w.Flush()
+}
+
+// textContents returns the content stream of a text page
+func textContents(lines []Line, height float64) []byte {
+	var b bytes.Buffer
+	y := height - textMargin
+	for _, l := range lines {
+		y -= l.Size * leading
+		if l.Text == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "BT /F%d %s Tf %d %s Td %s Tj ET\n", fontIndex(l.Font), num2(l.Size), textMargin, num2(y), literal(l.Text))
+	}
+	return b.Bytes()
+}
+
+// imageContents returns the content stream of an image page: the image at
+// its scanned size, scaled down to fit if it has to be, in the middle of the
+// page over the caption.
+func imageContents(p page, width, height float64) []byte {
+	b := p.image.Bounds()
+	availW := width - 2*margin
+	availH := height - 2*margin
+	if p.caption != "" {
+		availH -= captionSize * 2
+	}
+
+	dpi := p.dpi
+	if dpi <= 0 {
+		dpi = 72
+	}
+	w := float64(b.Dx()) / dpi * 72
+	h := float64(b.Dy()) / dpi * 72
+	if scale := min(availW/w, availH/h); scale < 1 {
+		w, h = w*scale, h*scale
+	}
+	x := (width - w) / 2
+	y := height - margin - (availH+h)/2
+
+	var c bytes.Buffer
+	fmt.Fprintf(&c, "q %s 0 0 %s %s %s cm /Im1 Do Q\n", num2(w), num2(h), num2(x), num2(y))
+	if p.caption != "" {
+		fmt.Fprintf(&c, "BT /F1 %d Tf %d %d Td %s Tj ET\n", captionSize, margin, margin, literal(p.caption))
+	}
+	return c.Bytes()
+}
+
+// writeImage writes the image as the numbered image object, gray if it has no
+// color in it and RGB if it does.
+func (w *writer) writeImage(num int, img image.Image) {
+	b := img.Bounds()
+	at := pixels(img)
+	gray := isGray(img, at)
+	var data []byte
+	if gray {
+		data = make([]byte, 0, b.Dx()*b.Dy())
+	} else {
+		data = make([]byte, 0, b.Dx()*b.Dy()*3)
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl := at(x, y)
+			if gray {
+				data = append(data, r)
+			} else {
+				data = append(data, r, g, bl)
+			}
+		}
+	}
+
+	space := "/DeviceRGB"
+	if gray {
+		space = "/DeviceGray"
+	}
+	w.stream(num, fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent 8", b.Dx(), b.Dy(), space), data)
+}
+
+// pixels returns a function that gets the color of a pixel of the image, on
+// white paper where it's transparent. Scans are millions of pixels, so the
+// usual kinds of image are read directly.
+func pixels(img image.Image) func(x, y int) (r, g, b uint8) {
+	switch m := img.(type) {
+	case *image.Gray:
+		return func(x, y int) (uint8, uint8, uint8) {
+			v := m.Pix[m.PixOffset(x, y)]
+			return v, v, v
+		}
+	case *image.RGBA:
+		return func(x, y int) (uint8, uint8, uint8) {
+			i := m.PixOffset(x, y)
+			a := 255 - m.Pix[i+3]
+			return m.Pix[i] + a, m.Pix[i+1] + a, m.Pix[i+2] + a
+		}
+	}
+	return func(x, y int) (uint8, uint8, uint8) {
+		c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+		return blend(c.R, c.A), blend(c.G, c.A), blend(c.B, c.A)
+	}
+}
+
+// isGray checks if every pixel of the image is a shade of gray
+func isGray(img image.Image, at func(x, y int) (r, g, b uint8)) bool {
+	switch img.(type) {
+	case *image.Gray, *image.Gray16:
+		return true
+	}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if r, g, bl := at(x, y); r != g || g != bl {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// blend returns the value of a color channel with its alpha over white
+func blend(v, a uint8) uint8 {
+	return uint8((int(v)*int(a) + 255*(255-int(a)) + 127) / 255)
+}
+
+// fontIndex returns the number of the font's resource name
+func fontIndex(font string) int {
+	for i, f := range fonts {
+		if f == font {
+			return i + 1
+		}
+	}
+	return 1
+}
+
+// literal returns the text as a PDF string in the WinAnsi encoding of the
+// standard fonts, with characters it doesn't have as question marks.
+func literal(s string) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= ' ' && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// num2 formats a number for a content stream
+func num2(f float64) string {
+	return strconv.FormatFloat(f, 'f', 2, 64)
+}
+
+func min(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,275 @@
+package pdf
+
+import (
+	"bytes"
+	"caddae/jobdb"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// object is an object read back from a PDF file: its dictionary, and its
+// stream decompressed if it has one
+type object struct {
+	dict   string
+	stream []byte
+}
+
+// readPDF checks the cross reference table of the PDF points at each of its
+// objects, and returns them by number.
+func readPDF(t *testing.T, b []byte) map[int]object {
+	t.Helper()
+	if !bytes.HasPrefix(b, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(b, []byte("%%EOF\n")) {
+		t.Fatalf("not a PDF file")
+	}
+	m := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(b)
+	if m == nil {
+		t.Fatalf("no startxref")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	if !bytes.HasPrefix(b[xref:], []byte("xref\n0 ")) {
+		t.Fatalf("startxref %d isn't the cross reference table", xref)
+	}
+
+	var count int
+	fmt.Sscanf(string(b[xref:]), "xref\n0 %d\n", &count)
+	table := b[xref+len(fmt.Sprintf("xref\n0 %d\n", count)):]
+	objects := make(map[int]object)
+	for i := 1; i < count; i++ {
+		entry := string(table[i*20 : i*20+20])
+		off, _ := strconv.Atoi(entry[:10])
+		head := fmt.Sprintf("%d 0 obj\n", i)
+		if !bytes.HasPrefix(b[off:], []byte(head)) {
+			t.Fatalf("object %d isn't at offset %d", i, off)
+		}
+		body := b[off+len(head):]
+		body = body[:bytes.Index(body, []byte("endobj"))]
+
+		var o object
+		if i := bytes.Index(body, []byte("\nstream\n")); i >= 0 {
+			o.dict = string(body[:i])
+			var length int
+			fmt.Sscanf(regexp.MustCompile(`/Length \d+`).FindString(o.dict), "/Length %d", &length)
+			zr, err := zlib.NewReader(bytes.NewReader(body[i+8 : i+8+length]))
+			if err != nil {
+				t.Fatalf("object %d: %v", i, err)
+			}
+			o.stream, _ = io.ReadAll(zr)
+		} else {
+			o.dict = string(body)
+		}
+		objects[i] = o
+	}
+	if !strings.Contains(string(b[xref:]), fmt.Sprintf("/Size %d ", count)) {
+		t.Errorf("trailer size isn't %d", count)
+	}
+	return objects
+}
+
+// pages returns the page objects of the PDF, in page order
+func pages(t *testing.T, objects map[int]object) []object {
+	t.Helper()
+	kids := regexp.MustCompile(`/Kids \[([^\]]*)\]`).FindStringSubmatch(objects[2].dict)
+	var found []object
+	for _, ref := range regexp.MustCompile(`(\d+) 0 R`).FindAllStringSubmatch(kids[1], -1) {
+		n, _ := strconv.Atoi(ref[1])
+		found = append(found, objects[n])
+	}
+	return found
+}
+
+// ref returns the object the entry of the dictionary refers to
+func ref(t *testing.T, objects map[int]object, dict, entry string) object {
+	t.Helper()
+	m := regexp.MustCompile(entry + ` (\d+) 0 R`).FindStringSubmatch(dict)
+	if m == nil {
+		t.Fatalf("no %s in %s", entry, dict)
+	}
+	n, _ := strconv.Atoi(m[1])
+	return objects[n]
+}
+
+func write(t *testing.T, d *Document) map[int]object {
+	t.Helper()
+	var b bytes.Buffer
+	if err := d.Write(&b); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	return readPDF(t, b.Bytes())
+}
+
+func TestParsePageSize(t *testing.T) {
+	for name, want := range map[string]PageSize{"ansi-d": ANSI_D, "ANSI D": ANSI_D, "11x17": TABLOID, "tabloid": TABLOID} {
+		if got, err := ParsePageSize(name); err != nil || got != want {
+			t.Errorf("ParsePageSize(%s) = %v, %v", name, got, err)
+		}
+	}
+	if _, err := ParsePageSize("a4"); err == nil {
+		t.Errorf("ParsePageSize(a4) succeeded")
+	}
+	if ANSI_D.Width != 22*72 || TABLOID.Height != 17*72 {
+		t.Errorf("page sizes = %v, %v", ANSI_D, TABLOID)
+	}
+}
+
+func TestImages(t *testing.T) {
+	// A landscape color scan at 100 DPI, 4" by 2", and a portrait gray one
+	rgb := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	rgb.Set(0, 0, color.RGBA{255, 0, 0, 255})
+	rgb.Set(399, 199, color.RGBA{0, 0, 255, 255})
+	gray := image.NewGray(image.Rect(0, 0, 30, 60))
+	gray.Set(1, 0, color.Gray{128})
+
+	d := New(TABLOID)
+	d.AddImage(rgb, 100, "Color (scan) \\ 1")
+	d.AddImage(gray, 0, "")
+	objects := write(t, d)
+	ps := pages(t, objects)
+	if len(ps) != 2 {
+		t.Fatalf("%d pages, want 2", len(ps))
+	}
+
+	// The landscape scan is on a landscape page, at its scanned size of
+	// 288 by 144 points, in the middle of the page over the caption
+	if !strings.Contains(ps[0].dict, "/MediaBox [0 0 1224.00 792.00]") {
+		t.Errorf("landscape page = %s", ps[0].dict)
+	}
+	contents := string(ref(t, objects, ps[0].dict, "/Contents").stream)
+	if !strings.Contains(contents, "q 288.00 0 0 144.00 468.00 334.00 cm /Im1 Do Q") || !strings.Contains(contents, `(Color \(scan\) \\ 1) Tj`) {
+		t.Errorf("landscape page contents = %s", contents)
+	}
+	im := ref(t, objects, ps[0].dict, "/Im1")
+	if !strings.Contains(im.dict, "/Width 400 /Height 200 /ColorSpace /DeviceRGB") {
+		t.Errorf("image = %s", im.dict)
+	}
+	if len(im.stream) != 400*200*3 || !bytes.Equal(im.stream[:6], []byte{255, 0, 0, 255, 255, 255}) || !bytes.Equal(im.stream[len(im.stream)-3:], []byte{0, 0, 255}) {
+		t.Errorf("image pixels aren't the scan's")
+	}
+
+	if !strings.Contains(ps[1].dict, "/MediaBox [0 0 792.00 1224.00]") {
+		t.Errorf("portrait page = %s", ps[1].dict)
+	}
+	im = ref(t, objects, ps[1].dict, "/Im1")
+	if !strings.Contains(im.dict, "/ColorSpace /DeviceGray") || len(im.stream) != 30*60 || im.stream[1] != 128 {
+		t.Errorf("gray image = %s", im.dict)
+	}
+}
+
+func TestImageFitsPage(t *testing.T) {
+	// 17" by 11" at 200 DPI doesn't fit inside the margins of an 11x17 page,
+	// so it's scaled down, but every pixel is kept
+	img := image.NewGray(image.Rect(0, 0, 3400, 2200))
+	d := New(TABLOID)
+	d.AddImage(img, 200, "")
+	objects := write(t, d)
+	page := pages(t, objects)[0]
+	m := regexp.MustCompile(`q ([\d.]+) 0 0 ([\d.]+) `).FindStringSubmatch(string(ref(t, objects, page.dict, "/Contents").stream))
+	w, _ := strconv.ParseFloat(m[1], 64)
+	h, _ := strconv.ParseFloat(m[2], 64)
+	if w > 17*72-2*margin || h != 11*72-2*margin || w/h < 3400.0/2200-0.01 {
+		t.Errorf("image is %vx%v points", w, h)
+	}
+	if im := ref(t, objects, page.dict, "/Im1"); !strings.Contains(im.dict, "/Width 3400 /Height 2200") {
+		t.Errorf("image = %s", im.dict)
+	}
+
+	// On an ANSI D page it fits at its scanned size
+	d = New(ANSI_D)
+	d.AddImage(img, 200, "")
+	objects = write(t, d)
+	page = pages(t, objects)[0]
+	if c := string(ref(t, objects, page.dict, "/Contents").stream); !strings.HasPrefix(c, "q 1224.00 0 0 792.00 ") {
+		t.Errorf("ANSI D contents = %s", c)
+	}
+}
+
+func TestAddText(t *testing.T) {
+	d := New(TABLOID)
+	var lines []Line
+	for i := 0; i < 100; i++ {
+		lines = append(lines, Line{Text: fmt.Sprintf("line %d", i)})
+	}
+	d.AddText(lines)
+	if d.Pages() != 2 {
+		t.Fatalf("100 lines took %d pages, want 2", d.Pages())
+	}
+
+	d.SetTitle("VZ_LAN_00007054 ½")
+	objects := write(t, d)
+	ps := pages(t, objects)
+	first := string(ref(t, objects, ps[0].dict, "/Contents").stream)
+	second := string(ref(t, objects, ps[1].dict, "/Contents").stream)
+	if !strings.Contains(first, "BT /F1 12.00 Tf 72 1135.20 Td (line 0) Tj ET") || strings.Contains(first, "(line 99)") || !strings.Contains(second, "(line 99)") {
+		t.Errorf("first page = %.200s", first)
+	}
+	if !strings.Contains(objects[3].dict, `/Title (VZ_LAN_00007054 \275)`) {
+		t.Errorf("info = %s", objects[3].dict)
+	}
+	if !strings.Contains(ps[0].dict, "/Font << /F1 4 0 R /F2 5 0 R /F3 6 0 R >>") {
+		t.Errorf("page resources = %s", ps[0].dict)
+	}
+}
+
+func TestPackage(t *testing.T) {
+	totals := jobdb.Summary{
+		Job: "VZ_LAN_00007054", Runs: 2, First: "07/16/2021", Last: "07/19/2021",
+		Quantities: map[string]float64{"C300-01": 250, "C300-04": 2},
+		Design:     map[string]float64{"C300-01": 1000},
+	}
+	scan := image.NewGray(image.Rect(0, 0, 170, 110))
+	p := Package{
+		Job:      "VZ_LAN_00007054",
+		Totals:   totals,
+		Sheets:   []Sheet{{Image: scan, DPI: 10, Caption: "running"}},
+		Redlines: []Sheet{{Image: scan, DPI: 10, Caption: "07/16"}, {Caption: "07/19.png"}},
+	}
+
+	lines := p.cover(time.Date(2021, 7, 20, 0, 0, 0, 0, time.UTC))
+	var text []string
+	for _, l := range lines {
+		text = append(text, l.Text)
+	}
+	all := strings.Join(text, "\n")
+	for _, want := range []string{"VZ_LAN_00007054", "Prepared 07/20/2021", "Work performed 07/16/2021 to 07/19/2021, 2 redlines", "Production to 07/19/2021"} {
+		if !strings.Contains(all, want) {
+			t.Errorf("cover is missing %q:\n%s", want, all)
+		}
+	}
+	if !regexp.MustCompile(`C300-01 +\S.* +250 ft +1000 +25%`).MatchString(all) {
+		t.Errorf("cover production:\n%s", all)
+	}
+
+	// Cover, the running asbuilt, the appendix title, a redline and the
+	// missing one
+	path := filepath.Join(t.TempDir(), "package.pdf")
+	if err := p.Save(path, ANSI_D); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	b, _ := os.ReadFile(path)
+	objects := readPDF(t, b)
+	ps := pages(t, objects)
+	if len(ps) != 5 {
+		t.Fatalf("%d pages, want 5", len(ps))
+	}
+	if c := string(ref(t, objects, ps[4].dict, "/Contents").stream); !strings.Contains(c, "(Missing: 07/19.png)") {
+		t.Errorf("missing redline page = %s", c)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind")
+	}
+
+	// No production
+	p.Totals = jobdb.Summary{Job: p.Job}
+	if lines := p.cover(time.Now()); lines[len(lines)-1].Text != "No production recorded." {
+		t.Errorf("empty cover = %+v", lines)
+	}
+}
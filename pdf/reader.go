@@ -0,0 +1,557 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// objHeader starts each indirect object, e.g. "12 0 obj"
+var objHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+// NewReader reads the PDF file in b.
+//
+// The objects are found by scanning the file rather than through its cross
+// reference table, which scanners and the tools after them often get wrong.
+// A later object of the same number replaces an earlier one, like the
+// incremental updates of the file would.
+func NewReader(b []byte) (*Reader, error) {
+	head := b
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	if !bytes.Contains(head, []byte("%PDF-")) {
+		return nil, errors.New("pdf.NewReader: not a PDF file")
+	}
+
+	r := &Reader{b: b, objects: make(map[int]value)}
+	// Streams with their length in another object, and where their data
+	// starts
+	type pending struct {
+		s     *stream
+		start int
+	}
+	var lengths []pending
+	for pos := 0; ; {
+		m := objHeader.FindSubmatchIndex(b[pos:])
+		if m == nil {
+			break
+		}
+		num, _ := strconv.Atoi(string(b[pos+m[2] : pos+m[3]]))
+		p := &parser{b: b, pos: pos + m[1]}
+		v, err := p.value(0)
+		if err != nil {
+			// Not an object after all, keep looking past it
+			pos += m[1]
+			continue
+		}
+
+		p.skip()
+		if d, ok := v.(dict); ok && bytes.HasPrefix(b[p.pos:], []byte("stream")) {
+			start := streamStart(b, p.pos+len("stream"))
+			s := &stream{dict: d}
+			s.data, p.pos = r.streamData(d, start)
+			if _, ok := d["Length"].(reference); ok {
+				// Its length is another object, which may come after it,
+				// so it's found again once every object has been read.
+				lengths = append(lengths, pending{s, start})
+			}
+			v = s
+		}
+		r.objects[num] = v
+		pos = p.pos
+	}
+
+	for _, l := range lengths {
+		l.s.data, _ = r.streamData(l.s.dict, l.start)
+	}
+	r.unpack()
+
+	root, ok := r.root()
+	if !ok {
+		return nil, errors.New("pdf.NewReader: no document catalog")
+	}
+	if pages, ok := r.resolve(root["Pages"]).(dict); ok {
+		r.walk(pages, nil, 0)
+	}
+	if len(r.pages) == 0 {
+		return nil, errors.New("pdf.NewReader: the PDF has no pages")
+	}
+	return r, nil
+}
+
+// NumPages returns the number of pages in the PDF
+func (r *Reader) NumPages() int {
+	return len(r.pages)
+}
+
+// PageImage returns the scan on the page, counting from 1: the largest image
+// drawn on it.
+func (r *Reader) PageImage(page int) (image.Image, error) {
+	if page < 1 || page > len(r.pages) {
+		return nil, fmt.Errorf("pdf.PageImage: there's no page %d, the PDF has %d", page, len(r.pages))
+	}
+	s := r.largestImage(r.pages[page-1], 0)
+	if s == nil {
+		return nil, fmt.Errorf("pdf.PageImage: page %d has no scanned image on it", page)
+	}
+	img, err := r.image(s)
+	if err != nil {
+		return nil, errors.Wrapf(err, "pdf.PageImage: failed to decode the image on page %d", page)
+	}
+	return img, nil
+}
+
+// largestImage returns the largest image among the resources, including
+// those of the forms drawn with them, or nil if there are none.
+func (r *Reader) largestImage(resources dict, depth int) *stream {
+	xobjects, _ := r.resolve(resources["XObject"]).(dict)
+	keys := make([]string, 0, len(xobjects))
+	for k := range xobjects {
+		keys = append(keys, string(k))
+	}
+	sort.Strings(keys)
+
+	var largest *stream
+	var area int
+	for _, k := range keys {
+		s, ok := r.resolve(xobjects[pname(k)]).(*stream)
+		if !ok {
+			continue
+		}
+		switch s.dict["Subtype"] {
+		case pname("Image"):
+			if a := r.integer(s.dict["Width"], 0) * r.integer(s.dict["Height"], 0); a > area {
+				largest, area = s, a
+			}
+		case pname("Form"):
+			if depth >= 4 {
+				continue
+			}
+			res, _ := r.resolve(s.dict["Resources"]).(dict)
+			if f := r.largestImage(res, depth+1); f != nil {
+				if a := r.integer(f.dict["Width"], 0) * r.integer(f.dict["Height"], 0); a > area {
+					largest, area = f, a
+				}
+			}
+		}
+	}
+	return largest
+}
+
+// walk adds the pages under the node of the page tree, in order, with the
+// resources they inherit from it
+func (r *Reader) walk(node dict, resources dict, depth int) {
+	if depth > 32 {
+		return
+	}
+	if res, ok := r.resolve(node["Resources"]).(dict); ok {
+		resources = res
+	}
+	kids, ok := r.resolve(node["Kids"]).([]value)
+	if !ok {
+		r.pages = append(r.pages, resources)
+		return
+	}
+	for _, kid := range kids {
+		if d, ok := r.resolve(kid).(dict); ok {
+			r.walk(d, resources, depth+1)
+		}
+	}
+}
+
+// root returns the document catalog: the root of the last trailer, or of a
+// cross reference stream for files without one, or failing those any catalog.
+func (r *Reader) root() (dict, bool) {
+	if i := bytes.LastIndex(r.b, []byte("trailer")); i >= 0 {
+		p := &parser{b: r.b, pos: i + len("trailer")}
+		if v, err := p.value(0); err == nil {
+			if trailer, ok := v.(dict); ok {
+				if root, ok := r.resolve(trailer["Root"]).(dict); ok {
+					return root, true
+				}
+			}
+		}
+	}
+
+	nums := r.numbers()
+	for _, num := range nums {
+		if s, ok := r.objects[num].(*stream); ok && s.dict["Type"] == pname("XRef") {
+			if root, ok := r.resolve(s.dict["Root"]).(dict); ok {
+				return root, true
+			}
+		}
+	}
+	for _, num := range nums {
+		if d, ok := r.objects[num].(dict); ok && d["Type"] == pname("Catalog") {
+			return d, true
+		}
+	}
+	return nil, false
+}
+
+// unpack adds the objects in object streams, which PDF 1.5 files keep most of
+// their objects in. Objects outside of them take precedence.
+func (r *Reader) unpack() {
+	direct := make(map[int]bool, len(r.objects))
+	for num := range r.objects {
+		direct[num] = true
+	}
+	for _, num := range r.numbers() {
+		s, ok := r.objects[num].(*stream)
+		if !ok || s.dict["Type"] != pname("ObjStm") {
+			continue
+		}
+		data, filter, _, err := r.decode(s)
+		if err != nil || filter != "" {
+			continue
+		}
+
+		n, first := r.integer(s.dict["N"], 0), r.integer(s.dict["First"], 0)
+		p := &parser{b: data}
+		for i := 0; i < n; i++ {
+			// Each object is listed by its number and its offset
+			// after first
+			v, err := p.value(0)
+			if err != nil {
+				break
+			}
+			w, err := p.value(0)
+			if err != nil {
+				break
+			}
+			obj, ok1 := v.(int)
+			off, ok2 := w.(int)
+			if !ok1 || !ok2 || direct[obj] || off < 0 || first+off >= len(data) {
+				continue
+			}
+			op := &parser{b: data, pos: first + off}
+			if v, err := op.value(0); err == nil {
+				r.objects[obj] = v
+			}
+		}
+	}
+}
+
+// numbers returns the numbers of the objects, in order
+func (r *Reader) numbers() []int {
+	nums := make([]int, 0, len(r.objects))
+	for num := range r.objects {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	return nums
+}
+
+// resolve returns the object the value refers to, if it's a reference
+func (r *Reader) resolve(v value) value {
+	for i := 0; i < 32; i++ {
+		rf, ok := v.(reference)
+		if !ok {
+			return v
+		}
+		v = r.objects[rf.num]
+	}
+	return nil
+}
+
+// integer returns the value as an integer, or def if it isn't a number
+func (r *Reader) integer(v value, def int) int {
+	switch n := r.resolve(v).(type) {
+	case int:
+		return n
+	case float64:
+		return int(n)
+	}
+	return def
+}
+
+// streamStart returns where the data of a stream starts, after the end of
+// line that follows the stream keyword at pos
+func streamStart(b []byte, pos int) int {
+	if bytes.HasPrefix(b[pos:], []byte("\r\n")) {
+		return pos + 2
+	}
+	if pos < len(b) && (b[pos] == '\n' || b[pos] == '\r') {
+		return pos + 1
+	}
+	return pos
+}
+
+// streamData returns the data of a stream that starts at start, and where
+// its endstream keyword ends. The length is taken from its dictionary if it's
+// right, since a scan can contain anything, and otherwise by looking for the
+// endstream keyword.
+func (r *Reader) streamData(d dict, start int) ([]byte, int) {
+	if n, ok := r.resolve(d["Length"]).(int); ok && n >= 0 && start+n <= len(r.b) {
+		p := &parser{b: r.b, pos: start + n}
+		p.skip()
+		if bytes.HasPrefix(r.b[p.pos:], []byte("endstream")) {
+			return r.b[start : start+n : start+n], p.pos + len("endstream")
+		}
+	}
+
+	i := bytes.Index(r.b[start:], []byte("endstream"))
+	if i < 0 {
+		return r.b[start:], len(r.b)
+	}
+	end := start + i
+	if bytes.HasSuffix(r.b[start:end], []byte("\r\n")) {
+		end -= 2
+	} else if end > start && (r.b[end-1] == '\n' || r.b[end-1] == '\r') {
+		end--
+	}
+	return r.b[start:end:end], start + i + len("endstream")
+}
+
+// isSpace reports whether c is PDF white space
+func isSpace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+// isDelim reports whether c is a PDF delimiter
+func isDelim(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+// skip skips white space and comments
+func (p *parser) skip() {
+	for p.pos < len(p.b) {
+		switch c := p.b[p.pos]; {
+		case isSpace(c):
+			p.pos++
+		case c == '%':
+			for p.pos < len(p.b) && p.b[p.pos] != '\n' && p.b[p.pos] != '\r' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// word reads a run of regular characters: a number or a keyword
+func (p *parser) word() string {
+	start := p.pos
+	for p.pos < len(p.b) && !isSpace(p.b[p.pos]) && !isDelim(p.b[p.pos]) {
+		p.pos++
+	}
+	return string(p.b[start:p.pos])
+}
+
+// value reads the next object
+func (p *parser) value(depth int) (value, error) {
+	if depth > 64 {
+		return nil, errors.New("objects are nested too deeply")
+	}
+	p.skip()
+	if p.pos >= len(p.b) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	switch c := p.b[p.pos]; {
+	case c == '/':
+		p.pos++
+		return pname(unescapeName(p.word())), nil
+	case c == '(':
+		return p.literal()
+	case c == '<' && p.pos+1 < len(p.b) && p.b[p.pos+1] == '<':
+		p.pos += 2
+		d := make(dict)
+		for {
+			p.skip()
+			if bytes.HasPrefix(p.b[p.pos:], []byte(">>")) {
+				p.pos += 2
+				return d, nil
+			}
+			k, err := p.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			key, ok := k.(pname)
+			if !ok {
+				return nil, fmt.Errorf("dictionary key at %d isn't a name", p.pos)
+			}
+			v, err := p.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			d[key] = v
+		}
+	case c == '<':
+		return p.hex()
+	case c == '[':
+		p.pos++
+		a := []value{}
+		for {
+			p.skip()
+			if p.pos < len(p.b) && p.b[p.pos] == ']' {
+				p.pos++
+				return a, nil
+			}
+			v, err := p.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+	case isDelim(c):
+		return nil, fmt.Errorf("unexpected '%c' at %d", c, p.pos)
+	}
+
+	w := p.word()
+	switch w {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	if n, err := strconv.Atoi(w); err == nil {
+		// An integer may be the start of a reference, e.g. "12 0 R"
+		save := p.pos
+		p.skip()
+		if gen, err := strconv.Atoi(p.word()); err == nil {
+			p.skip()
+			if p.word() == "R" {
+				return reference{n, gen}, nil
+			}
+		}
+		p.pos = save
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(w, 64); err == nil {
+		return f, nil
+	}
+	return nil, fmt.Errorf("unexpected '%s' at %d", w, p.pos)
+}
+
+// literal reads a literal string, e.g. "(a \(b\))"
+func (p *parser) literal() (value, error) {
+	p.pos++
+	var s []byte
+	for depth := 1; p.pos < len(p.b); {
+		c := p.b[p.pos]
+		p.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return s, nil
+			}
+		case '\\':
+			if p.pos >= len(p.b) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			c = p.b[p.pos]
+			p.pos++
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n':
+				// A line continuation
+				if c == '\r' && p.pos < len(p.b) && p.b[p.pos] == '\n' {
+					p.pos++
+				}
+				continue
+			case '0', '1', '2', '3', '4', '5', '6', '7':
+				n := int(c - '0')
+				for i := 0; i < 2 && p.pos < len(p.b) && p.b[p.pos] >= '0' && p.b[p.pos] <= '7'; i++ {
+					n = n*8 + int(p.b[p.pos]-'0')
+					p.pos++
+				}
+				c = byte(n)
+			}
+		}
+		s = append(s, c)
+	}
+	return nil, io.ErrUnexpectedEOF
+}
+
+// hex reads a hexadecimal string, e.g. "<4142>"
+func (p *parser) hex() (value, error) {
+	p.pos++
+	end := bytes.IndexByte(p.b[p.pos:], '>')
+	if end < 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	s, err := unhex(p.b[p.pos : p.pos+end])
+	p.pos += end + 1
+	return s, err
+}
+
+// unhex decodes hexadecimal digits, ignoring white space. A missing last digit
+// is taken to be 0.
+func unhex(b []byte) ([]byte, error) {
+	var s []byte
+	var digits int
+	var c byte
+	for _, d := range b {
+		var v byte
+		switch {
+		case d >= '0' && d <= '9':
+			v = d - '0'
+		case d >= 'a' && d <= 'f':
+			v = d - 'a' + 10
+		case d >= 'A' && d <= 'F':
+			v = d - 'A' + 10
+		case isSpace(d):
+			continue
+		default:
+			return nil, fmt.Errorf("invalid hex digit '%c'", d)
+		}
+		c = c<<4 | v
+		if digits++; digits%2 == 0 {
+			s = append(s, c)
+			c = 0
+		}
+	}
+	if digits%2 == 1 {
+		s = append(s, c<<4)
+	}
+	return s, nil
+}
+
+// unescapeName decodes the #xx escapes of a name
+func unescapeName(s string) string {
+	if strings.IndexByte(s, '#') < 0 {
+		return s
+	}
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] == '#' && i+2 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+				b = append(b, byte(v))
+				i += 2
+				continue
+			}
+		}
+		b = append(b, s[i])
+	}
+	return string(b)
+}
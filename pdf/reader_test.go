@@ -0,0 +1,221 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"strings"
+	"testing"
+)
+
+// build makes a PDF file of the objects, numbered from 1, and the trailer.
+// Like the PDFs some scanners write, it has no cross reference table.
+func build(trailer string, objects ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.5\n%\xe2\xe3\xcf\xd3\n")
+	for i, o := range objects {
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+	b.WriteString(trailer)
+	b.WriteString("\n%%EOF\n")
+	return b.Bytes()
+}
+
+// streamObject returns a stream object of the data with the dictionary
+// entries
+func streamObject(entries string, data []byte) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", entries, len(data), data)
+}
+
+func deflate(b []byte) []byte {
+	var z bytes.Buffer
+	w := zlib.NewWriter(&z)
+	w.Write(b)
+	w.Close()
+	return z.Bytes()
+}
+
+func TestReadWrittenPDF(t *testing.T) {
+	rgb := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	rgb.Set(3, 4, color.RGBA{255, 0, 0, 255})
+	gray := image.NewGray(image.Rect(0, 0, 30, 60))
+	gray.Set(29, 59, color.Gray{128})
+
+	d := New(TABLOID)
+	d.AddText([]Line{{Text: "Cover"}})
+	d.AddImage(rgb, 100, "color")
+	d.AddImage(gray, 100, "gray")
+	var b bytes.Buffer
+	if err := d.Write(&b); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	r, err := NewReader(b.Bytes())
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	if r.NumPages() != 3 {
+		t.Fatalf("%d pages, want 3", r.NumPages())
+	}
+	if _, err := r.PageImage(1); err == nil {
+		t.Errorf("PageImage of the cover succeeded")
+	}
+	if _, err := r.PageImage(4); err == nil {
+		t.Errorf("PageImage(4) succeeded")
+	}
+
+	img, err := r.PageImage(2)
+	if err != nil {
+		t.Fatalf("PageImage(2): %v", err)
+	}
+	if img.Bounds() != rgb.Bounds() || img.At(3, 4) != (color.RGBA{255, 0, 0, 255}) || img.At(0, 0) != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("page 2 = %v, %v", img.Bounds(), img.At(3, 4))
+	}
+	img, err = r.PageImage(3)
+	if err != nil {
+		t.Fatalf("PageImage(3): %v", err)
+	}
+	if g, ok := img.(*image.Gray); !ok || g.GrayAt(29, 59).Y != 128 || g.GrayAt(0, 0).Y != 0 {
+		t.Errorf("page 3 = %T", img)
+	}
+}
+
+func TestReadObjectStreams(t *testing.T) {
+	// A JPEG scan in a form, next to a smaller image, with the catalog and
+	// page tree in an object stream, and the scan's length after it
+	scan := image.NewGray(image.Rect(0, 0, 16, 8))
+	for i := range scan.Pix {
+		scan.Pix[i] = 200
+	}
+	var jpg bytes.Buffer
+	if err := jpeg.Encode(&jpg, scan, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	packed := []string{
+		"<< /Type /Catalog /Pages 3 0 R >>",
+		"<< /Type /Pages /Kids [4 0 R] /Count 1 /Resources << /XObject << /Fm1 5 0 R /Im0 6 0 R >> >> >>",
+	}
+	var header, body string
+	for i, o := range packed {
+		header += fmt.Sprintf("%d %d ", i+2, len(body))
+		body += o + "\n"
+	}
+	objStm := streamObject(fmt.Sprintf("/Type /ObjStm /N 2 /First %d /Filter /FlateDecode", len(header)), deflate([]byte(header+body)))
+
+	b := build("",
+		objStm,
+		"<< /Type /XRef /Size 10 >>",
+		"<< /Type /Pages /Count 0 >>",
+		"<< /Type /Page /Parent 3 0 R /MediaBox [0 0 612 792] >>",
+		streamObject("/Type /XObject /Subtype /Form /Resources << /XObject << /Im1 7 0 R >> >>", nil),
+		streamObject("/Subtype /Image /Width 1 /Height 1 /BitsPerComponent 8 /ColorSpace /DeviceGray", []byte{0}),
+		fmt.Sprintf("<< /Subtype /Image /Width 16 /Height 8 /BitsPerComponent 8 /ColorSpace [/DeviceGray] /Filter [/DCTDecode] /Length 8 0 R >>\nstream\n%s\nendstream", jpg.Bytes()),
+		fmt.Sprint(jpg.Len()),
+	)
+	// The cross reference stream is the trailer, and the objects 2 and 3 of
+	// the object stream are overridden by ones outside of it
+	b = bytes.Replace(b, []byte("<< /Type /XRef /Size 10 >>"), []byte("<< /Type /XRef /Size 10 /Root 9 0 R >>"), 1)
+	b = append(b, []byte("9 0 obj\n<< /Type /Catalog /Pages 10 0 R >>\nendobj\n10 0 obj\n<< /Type /Pages /Kids [4 0 R] /Count 1 /Resources << /XObject << /Fm1 5 0 R /Im0 6 0 R >> >> >>\nendobj\n")...)
+
+	r, err := NewReader(b)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	if r.NumPages() != 1 {
+		t.Fatalf("%d pages, want 1", r.NumPages())
+	}
+	img, err := r.PageImage(1)
+	if err != nil {
+		t.Fatalf("PageImage: %v", err)
+	}
+	if img.Bounds().Dx() != 16 {
+		t.Fatalf("page image is %v, want the scan", img.Bounds())
+	}
+	if y := color.GrayModel.Convert(img.At(5, 5)).(color.Gray).Y; y < 195 || y > 205 {
+		t.Errorf("scan pixel = %d, want 200", y)
+	}
+
+	// Without the override, the catalog in the object stream is used
+	b = append(build("trailer\n<< /Root 2 0 R >>", objStm), "4 0 obj\n<< /Type /Page >>\nendobj\n"...)
+	if r, err := NewReader(b); err != nil || r.NumPages() != 1 {
+		t.Errorf("NewReader with a packed catalog: %v", err)
+	}
+}
+
+func TestReadImageFormats(t *testing.T) {
+	pages := []string{
+		// CCITT group 4, 8 by 2 pixels, with black in columns 2 to 5 of
+		// each row
+		streamObject("/Subtype /Image /Width 8 /Height 2 /BitsPerComponent 1 /ColorSpace /DeviceGray /Filter /CCITTFaxDecode /DecodeParms << /K -1 /Columns 8 /Rows 2 >>", []byte{0x2e, 0xfc}),
+		// 1 bit gray
+		streamObject("/Subtype /Image /Width 3 /Height 1 /BitsPerComponent 1 /ColorSpace /DeviceGray", []byte{0x40}),
+		// Indexed, with a PNG predictor
+		streamObject("/Subtype /Image /Width 2 /Height 1 /BitsPerComponent 8 /ColorSpace [/Indexed /DeviceRGB 1 <FF0000 0000FF>] /Filter /FlateDecode /DecodeParms << /Predictor 15 /Columns 2 >>", deflate([]byte{1, 0, 1})),
+		// Inverted gray, hex encoded
+		streamObject("/Subtype /Image /Width 2 /Height 1 /BitsPerComponent 8 /ColorSpace /DeviceGray /Decode [1 0] /Filter /ASCIIHexDecode", []byte("00 4>")),
+		// JPEG 2000 isn't supported
+		streamObject("/Subtype /Image /Width 2 /Height 1 /Filter /JPXDecode", []byte{0}),
+	}
+
+	objects := []string{"<< /Type /Catalog /Pages 2 0 R >>", ""}
+	var kids []string
+	for _, p := range pages {
+		page := len(objects) + 1
+		kids = append(kids, fmt.Sprintf("%d 0 R", page))
+		objects = append(objects, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /Resources << /XObject << /Im0 %d 0 R >> >> >>", page+1), p)
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids))
+	r, err := NewReader(build("trailer\n<< /Size 13 /Root 1 0 R >>", objects...))
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	if r.NumPages() != len(pages) {
+		t.Fatalf("%d pages, want %d", r.NumPages(), len(pages))
+	}
+
+	grays := func(page int) []uint8 {
+		t.Helper()
+		img, err := r.PageImage(page)
+		if err != nil {
+			t.Fatalf("PageImage(%d): %v", page, err)
+		}
+		g, ok := img.(*image.Gray)
+		if !ok {
+			t.Fatalf("page %d is %T, want gray", page, img)
+		}
+		return g.Pix
+	}
+
+	if got, want := grays(1), []uint8{255, 255, 0, 0, 0, 0, 255, 255}; !bytes.Equal(got[:8], want) || !bytes.Equal(got[8:], want) {
+		t.Errorf("CCITT pixels = %v", got)
+	}
+	if got := grays(2); !bytes.Equal(got, []uint8{0, 255, 0}) {
+		t.Errorf("1 bit pixels = %v", got)
+	}
+	img, err := r.PageImage(3)
+	if err != nil {
+		t.Fatalf("PageImage(3): %v", err)
+	}
+	if img.At(0, 0) != (color.RGBA{255, 0, 0, 255}) || img.At(1, 0) != (color.RGBA{0, 0, 255, 255}) {
+		t.Errorf("indexed pixels = %v, %v", img.At(0, 0), img.At(1, 0))
+	}
+	if got := grays(4); !bytes.Equal(got, []uint8{255, 255 - 0x40}) {
+		t.Errorf("inverted pixels = %v", got)
+	}
+	if _, err := r.PageImage(5); err == nil || !strings.Contains(err.Error(), "JPXDecode") {
+		t.Errorf("JPX page: %v", err)
+	}
+}
+
+func TestNotPDF(t *testing.T) {
+	if _, err := NewReader([]byte("\x89PNG\r\n")); err == nil {
+		t.Errorf("NewReader of a PNG succeeded")
+	}
+	if _, err := NewReader(build("")); err == nil {
+		t.Errorf("NewReader of a PDF without pages succeeded")
+	}
+}
@@ -0,0 +1,110 @@
+package pdf
+
+import (
+	"caddae/catalog"
+	"caddae/jobdb"
+	"image"
+)
+
+// PageSize is the size of the pages of a document, in points, portrait. Pages
+// of images are turned to landscape for landscape images.
+type PageSize struct {
+	Name          string
+	Width, Height float64
+}
+
+// Document is a PDF document of text and image pages, all the same size.
+type Document struct {
+	size  PageSize
+	title string
+	pages []page
+}
+
+// page is a page of a document: lines of text from the top left, or an image
+// with a caption under it.
+type page struct {
+	lines   []Line
+	image   image.Image
+	dpi     float64
+	caption string
+}
+
+// Line is a line of text on a text page, in one of the standard fonts
+// (HELVETICA, HELVETICA_BOLD or COURIER), with its size in points. An empty
+// line leaves a gap.
+type Line struct {
+	Text string
+	Font string
+	Size float64
+}
+
+// Package is a running asbuilt package for a client: a cover sheet with the
+// job's production, the updated running asbuilts, and the redlines they were
+// drawn from as an appendix.
+type Package struct {
+	Job string
+
+	// Totals of the production placed on the job, for the cover sheet, and
+	// the catalog to show them with. If Catalog is nil, the default catalog
+	// is used.
+	Totals  jobdb.Summary
+	Catalog *catalog.Catalog
+
+	// Sheets are the updated running asbuilts, and Redlines the scans they
+	// were drawn from
+	Sheets   []Sheet
+	Redlines []Sheet
+}
+
+// Sheet is a scanned sheet in a package, with the DPI it was scanned at and
+// a caption to go under it. A sheet without an image is noted as missing.
+type Sheet struct {
+	Image   image.Image
+	DPI     float64
+	Caption string
+}
+
+// Reader reads the scans out of the pages of a PDF file. Scanners save each
+// page as a single image, so that image is the page.
+type Reader struct {
+	b       []byte
+	objects map[int]value
+
+	// pages are the resources of each page, in page order
+	pages []dict
+}
+
+// value is an object read from a PDF file: nil, bool, int, float64, pname,
+// []byte for a string, []value, dict, reference or *stream
+type value interface{}
+
+// pname is a PDF name, without its slash
+type pname string
+
+// dict is a PDF dictionary, by the names of its keys
+type dict map[pname]value
+
+// reference is a reference to an indirect object
+type reference struct {
+	num, gen int
+}
+
+// stream is a stream object: its dictionary and its data, still encoded
+type stream struct {
+	dict dict
+	data []byte
+}
+
+// parser reads PDF objects from the bytes of a file, starting at pos
+type parser struct {
+	b   []byte
+	pos int
+}
+
+// colorSpace is the color space of an image: the number of components of each
+// color, and the palette of an indexed color space, with a color for each
+// index of the base color space
+type colorSpace struct {
+	comps   int
+	palette []byte
+}
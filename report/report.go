@@ -0,0 +1,187 @@
+// Package report provides the production report: the quantities placed on
+// jobs, a row per production unit of each run in the job database, written as
+// CSV or XLSX for the office to bill from.
+package report
+
+import (
+	"caddae/catalog"
+	"caddae/jobdb"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Report formats
+const (
+	CSV  = "csv"
+	XLSX = "xlsx"
+)
+
+// dateLayout is the layout of work performed dates
+const dateLayout = "01/02/2006"
+
+// Header is the header row of the report
+var Header = []string{"Job Number", "WPD", "Unit", "Quantity", "UOM", "Redline", "Output"}
+
+// ParseDate parses a work performed date given for a Filter, e.g.
+// "07/16/2021". An empty date is the zero time, leaving that end of the range
+// open.
+func ParseDate(s string) (time.Time, error) {
+	if strings.TrimSpace(s) == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(dateLayout, strings.TrimSpace(s))
+	if err != nil {
+		return t, fmt.Errorf("invalid date '%s', must be MM/DD/YYYY", s)
+	}
+	return t, nil
+}
+
+// Load returns the report rows of the runs in the job database the filter
+// picks, in job and then work performed date order. The catalog gives the
+// units of measure.
+func Load(db *jobdb.DB, f Filter, cat *catalog.Catalog) ([]Row, error) {
+	jobs := f.Jobs
+	if len(jobs) == 0 {
+		var err error
+		if jobs, err = db.Jobs(); err != nil {
+			return nil, err
+		}
+	}
+
+	var rows []Row
+	for _, job := range jobs {
+		runs, err := db.Runs(job)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range jobdb.ByWpd(runs) {
+			if !f.includes(r.Wpd) {
+				continue
+			}
+			redline := r.Redline.Path
+			if r.Redline.Page > 1 {
+				redline += fmt.Sprintf("#%d", r.Redline.Page)
+			}
+			for _, u := range r.Units {
+				qty, err := strconv.ParseFloat(u.Qty, 64)
+				if err != nil {
+					return nil, errors.Wrapf(err, "report.Load: %s run %d has an invalid quantity for %s", r.Job, r.ID, u.Name)
+				}
+				row := Row{
+					Job:     r.Job,
+					Wpd:     r.Wpd,
+					Unit:    u.Name,
+					Qty:     qty,
+					Redline: redline,
+					Output:  r.Output,
+				}
+				if unit, err := cat.Get(u.Name); err == nil {
+					row.Measure = unit.Measure
+				}
+				rows = append(rows, row)
+			}
+		}
+	}
+	return rows, nil
+}
+
+// includes checks if the work performed date is in the filter's date range.
+// Runs with dates that don't parse are only included without a date range.
+func (f Filter) includes(wpd string) bool {
+	if f.From.IsZero() && f.To.IsZero() {
+		return true
+	}
+	date, err := time.Parse(dateLayout, wpd)
+	if err != nil {
+		return false
+	}
+	if !f.From.IsZero() && date.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && date.After(f.To) {
+		return false
+	}
+	return true
+}
+
+// record returns the row as the fields of a CSV record
+func (r Row) record() []string {
+	return []string{
+		r.Job,
+		r.Wpd,
+		r.Unit,
+		strconv.FormatFloat(r.Qty, 'f', -1, 64),
+		r.Measure,
+		r.Redline,
+		r.Output,
+	}
+}
+
+// WriteCSV writes the report rows as CSV, with a header row.
+func WriteCSV(w io.Writer, rows []Row) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(Header); err != nil {
+		return err
+	}
+	for _, r := range rows {
+		if err := cw.Write(r.record()); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// FormatOf returns the report format for the file, from its extension.
+func FormatOf(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return CSV, nil
+	case ".xlsx":
+		return XLSX, nil
+	}
+	return "", fmt.Errorf("report.FormatOf(%s): reports must be .csv or .xlsx", path)
+}
+
+// Write writes the report rows to the file, as CSV or XLSX by its extension.
+func Write(path string, rows []Row) error {
+	format, err := FormatOf(path)
+	if err != nil {
+		return err
+	}
+
+	// We first write a temporary file, then if everything is OK we rename it,
+	// so a spreadsheet that's open somewhere never sees half a report.
+	newFile := path + ".tmp"
+	f, err := os.Create(newFile)
+	if err != nil {
+		return errors.Wrapf(err, "os.Create(%s): failed to create report", newFile)
+	}
+
+	if format == XLSX {
+		err = WriteXLSX(f, rows)
+	} else {
+		err = WriteCSV(f, rows)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(newFile)
+		return errors.Wrapf(err, "report.Write(%s): failed to write report", path)
+	}
+
+	if err := os.Rename(newFile, path); err != nil {
+		return errors.Wrapf(err, "rename(%s, %s)", newFile, path)
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package report
+
+import (
+	"archive/zip"
+	"bytes"
+	"caddae/catalog"
+	"caddae/jobdb"
+	"caddae/types"
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testDB returns a job database with two jobs, their runs added out of date
+// order
+func testDB(t *testing.T) *jobdb.DB {
+	t.Helper()
+	db, err := jobdb.Open(filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, r := range []jobdb.Run{
+		{Job: "VZ_LAN_00007054", Wpd: "07/19/2021", Redline: jobdb.File{Path: "rl_07_19.png"}, Output: "ra_2.png",
+			Units: []types.Unit{{Name: "C300-02", Qty: "85.50"}, {Name: "C400", Qty: "85.50"}}},
+		{Job: "VZ_LAN_00007054", Wpd: "07/16/2021", Redline: jobdb.File{Path: "rl_07_16.png"}, Output: "ra_1.png",
+			Units: []types.Unit{{Name: "C300-01", Qty: "250"}, {Name: "C300-04", Qty: "2"}}},
+		{Job: "VZ_LAN_00001234", Wpd: "08/02/2021", Redline: jobdb.File{Path: "rl, \"other\".png"}, Output: "ra.png",
+			Units: []types.Unit{{Name: "C300-09", Qty: "3"}}},
+	} {
+		r := r
+		if err := db.Add(&r); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	return db
+}
+
+func date(s string) time.Time {
+	t, _ := ParseDate(s)
+	return t
+}
+
+func TestLoad(t *testing.T) {
+	db := testDB(t)
+	cat := catalog.DefaultCatalog()
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{"everything", Filter{}, []string{
+			"VZ_LAN_00001234 08/02/2021 C300-09",
+			"VZ_LAN_00007054 07/16/2021 C300-01",
+			"VZ_LAN_00007054 07/16/2021 C300-04",
+			"VZ_LAN_00007054 07/19/2021 C300-02",
+			"VZ_LAN_00007054 07/19/2021 C400",
+		}},
+		{"one job", Filter{Jobs: []string{"vz_lan_00001234"}}, []string{
+			"VZ_LAN_00001234 08/02/2021 C300-09",
+		}},
+		{"from", Filter{From: date("07/17/2021")}, []string{
+			"VZ_LAN_00001234 08/02/2021 C300-09",
+			"VZ_LAN_00007054 07/19/2021 C300-02",
+			"VZ_LAN_00007054 07/19/2021 C400",
+		}},
+		{"to", Filter{Jobs: []string{"VZ_LAN_00007054"}, To: date("07/16/2021")}, []string{
+			"VZ_LAN_00007054 07/16/2021 C300-01",
+			"VZ_LAN_00007054 07/16/2021 C300-04",
+		}},
+		{"nothing", Filter{From: date("01/01/2022")}, nil},
+	}
+
+	for _, tt := range tests {
+		rows, err := Load(db, tt.filter, cat)
+		if err != nil {
+			t.Fatalf("%s: Load: %v", tt.name, err)
+		}
+		var got []string
+		for _, r := range rows {
+			got = append(got, r.Job+" "+r.Wpd+" "+r.Unit)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Load = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	rows, _ := Load(db, Filter{Jobs: []string{"VZ_LAN_00007054"}}, cat)
+	want := Row{Job: "VZ_LAN_00007054", Wpd: "07/19/2021", Unit: "C300-02", Qty: 85.5, Measure: catalog.FEET, Redline: "rl_07_19.png", Output: "ra_2.png"}
+	if rows[2] != want {
+		t.Errorf("row = %+v, want %+v", rows[2], want)
+	}
+	if rows[1].Measure != catalog.EACH {
+		t.Errorf("anchors measured in %q, want %q", rows[1].Measure, catalog.EACH)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	rows, err := Load(testDB(t), Filter{}, catalog.DefaultCatalog())
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	var b bytes.Buffer
+	if err := WriteCSV(&b, rows); err != nil {
+		t.Fatalf("WriteCSV: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	want := []string{
+		"Job Number,WPD,Unit,Quantity,UOM,Redline,Output",
+		`VZ_LAN_00001234,08/02/2021,C300-09,3,,"rl, ""other"".png",ra.png`,
+		"VZ_LAN_00007054,07/16/2021,C300-01,250,ft,rl_07_16.png,ra_1.png",
+	}
+	for i, w := range want {
+		if lines[i] != w {
+			t.Errorf("line %d = %s, want %s", i, lines[i], w)
+		}
+	}
+	if len(lines) != len(rows)+1 {
+		t.Errorf("wrote %d lines, want %d", len(lines), len(rows)+1)
+	}
+}
+
+func TestWriteXLSX(t *testing.T) {
+	rows, err := Load(testDB(t), Filter{}, catalog.DefaultCatalog())
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "report.xlsx")
+	if err := Write(path, rows); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatalf("zip.OpenReader: %v", err)
+	}
+	defer zr.Close()
+
+	parts := make(map[string][]byte)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[f.Name], _ = io.ReadAll(rc)
+		rc.Close()
+
+		// Every part has to be well formed XML for a spreadsheet to open it
+		d := xml.NewDecoder(bytes.NewReader(parts[f.Name]))
+		for {
+			if _, err := d.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s isn't valid XML: %v", f.Name, err)
+			}
+		}
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("missing part %s", name)
+		}
+	}
+
+	// Read the cells back
+	var ws struct {
+		Rows []struct {
+			R     int `xml:"r,attr"`
+			Cells []struct {
+				R string `xml:"r,attr"`
+				S int    `xml:"s,attr"`
+				T string `xml:"t,attr"`
+				V string `xml:"v"`
+				I string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := xml.Unmarshal(parts["xl/worksheets/sheet1.xml"], &ws); err != nil {
+		t.Fatalf("sheet1.xml: %v", err)
+	}
+	if len(ws.Rows) != len(rows)+1 {
+		t.Fatalf("sheet has %d rows, want %d", len(ws.Rows), len(rows)+1)
+	}
+
+	header := ws.Rows[0].Cells
+	if header[0].I != "Job Number" || header[0].S != styleHeader || header[6].R != "G1" {
+		t.Errorf("header = %+v", header)
+	}
+
+	// 07/16/2021 is day 44393 in Excel, and the quantity is a number
+	row := ws.Rows[2].Cells
+	if row[0].I != "VZ_LAN_00007054" || row[1].V != "44393" || row[1].S != styleDate || row[3].V != "250" || row[3].T != "" || row[4].I != "ft" {
+		t.Errorf("row 3 = %+v", row)
+	}
+	// Empty cells are left out, like the unit of measure of a unit that's
+	// not in the catalog
+	for _, c := range ws.Rows[1].Cells {
+		if c.R == "E2" {
+			t.Errorf("E2 = %+v, want it left out", c)
+		}
+		if c.R == "F2" && c.I != `rl, "other".png` {
+			t.Errorf("redline = %q, want it unescaped", c.I)
+		}
+	}
+}
+
+func TestWriteFormat(t *testing.T) {
+	dir := t.TempDir()
+	if err := Write(filepath.Join(dir, "report.pdf"), nil); err == nil {
+		t.Errorf("Write of a .pdf succeeded")
+	}
+
+	path := filepath.Join(dir, "REPORT.CSV")
+	if err := Write(path, nil); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	b, _ := os.ReadFile(path)
+	if strings.TrimSpace(string(b)) != strings.Join(Header, ",") {
+		t.Errorf("empty report = %q, want just the header", b)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind")
+	}
+}
+
+func TestColumn(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 6: "G", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		if got := column(i); got != want {
+			t.Errorf("column(%d) = %s, want %s", i, got, want)
+		}
+	}
+}
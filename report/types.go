@@ -0,0 +1,32 @@
+package report
+
+import "time"
+
+// Row is a line of the production report: the quantity of one production unit
+// placed by a run.
+type Row struct {
+	Job string
+	Wpd string
+
+	// Unit is the catalog code of the production unit, Qty its quantity and
+	// Measure its unit of measure, e.g. "ft". Measure is empty if the unit
+	// isn't in the catalog anymore.
+	Unit    string
+	Qty     float64
+	Measure string
+
+	// Redline processed by the run, and the running asbuilt it was saved to
+	Redline string
+	Output  string
+}
+
+// Filter picks the runs that go in the report.
+type Filter struct {
+	// Jobs to report on. If empty, every job in the database is.
+	Jobs []string
+
+	// From and To are the first and last work performed dates to report on.
+	// Either can be zero to leave that end open.
+	From time.Time
+	To   time.Time
+}
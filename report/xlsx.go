@@ -0,0 +1,174 @@
+package report
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// An XLSX file is a zip of SpreadsheetML parts. The report only needs a single
+// sheet, so we write the few parts it takes ourselves: the workbook, the
+// sheet, and the styles for the bold header and the dates.
+
+// sheetName is the name of the report's sheet
+const sheetName = "Production"
+
+// Styles of the cells, by their index in xlsxStyles' cellXfs
+const (
+	styleNormal = 0
+	styleHeader = 1
+	styleDate   = 2
+)
+
+// excelEpoch is the day Excel counts dates from
+var excelEpoch = time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC)
+
+// columnWidths are the widths of the report's columns, in characters
+var columnWidths = []int{20, 12, 10, 10, 6, 40, 40}
+
+const xlsxContentTypes = xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+	`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+	`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+	`</Types>`
+
+const xlsxRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+const xlsxWorkbookRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+	`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+	`</Relationships>`
+
+const xlsxStyles = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="1"><numFmt numFmtId="164" formatCode="mm/dd/yyyy"/></numFmts>` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="3">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`</cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`</styleSheet>`
+
+// WriteXLSX writes the report rows as an XLSX workbook with a single sheet,
+// with a frozen header row to filter on. Quantities are numbers, and work
+// performed dates are dates, so they add up and sort in a spreadsheet.
+func WriteXLSX(w io.Writer, rows []Row) error {
+	last := fmt.Sprintf("$%s$%d", column(len(Header)-1), len(rows)+1)
+	workbook := xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="` + sheetName + `" sheetId="1" r:id="rId1"/></sheets>` +
+		`<definedNames><definedName name="_xlnm._FilterDatabase" localSheetId="0" hidden="1">` + sheetName + `!$A$1:` + last + `</definedName></definedNames>` +
+		`</workbook>`
+
+	parts := []struct {
+		name string
+		data []byte
+	}{
+		{"[Content_Types].xml", []byte(xlsxContentTypes)},
+		{"_rels/.rels", []byte(xlsxRels)},
+		{"xl/workbook.xml", []byte(workbook)},
+		{"xl/_rels/workbook.xml.rels", []byte(xlsxWorkbookRels)},
+		{"xl/styles.xml", []byte(xlsxStyles)},
+		{"xl/worksheets/sheet1.xml", sheet(rows)},
+	}
+
+	zw := zip.NewWriter(w)
+	now := time.Now()
+	for _, p := range parts {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: p.name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(p.data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// sheet returns the SpreadsheetML of the report's sheet
+func sheet(rows []Row) []byte {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	b.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+
+	b.WriteString(`<cols>`)
+	for i, width := range columnWidths {
+		fmt.Fprintf(&b, `<col min="%d" max="%d" width="%d" customWidth="1"/>`, i+1, i+1, width)
+	}
+	b.WriteString(`</cols>`)
+
+	b.WriteString(`<sheetData>`)
+	b.WriteString(`<row r="1">`)
+	for i, h := range Header {
+		stringCell(&b, i, 1, h, styleHeader)
+	}
+	b.WriteString(`</row>`)
+
+	for i, r := range rows {
+		n := i + 2
+		fmt.Fprintf(&b, `<row r="%d">`, n)
+		stringCell(&b, 0, n, r.Job, styleNormal)
+		if date, err := time.Parse(dateLayout, r.Wpd); err == nil {
+			numberCell(&b, 1, n, date.Sub(excelEpoch).Hours()/24, styleDate)
+		} else {
+			stringCell(&b, 1, n, r.Wpd, styleNormal)
+		}
+		stringCell(&b, 2, n, r.Unit, styleNormal)
+		numberCell(&b, 3, n, r.Qty, styleNormal)
+		stringCell(&b, 4, n, r.Measure, styleNormal)
+		stringCell(&b, 5, n, r.Redline, styleNormal)
+		stringCell(&b, 6, n, r.Output, styleNormal)
+		b.WriteString(`</row>`)
+	}
+	b.WriteString(`</sheetData>`)
+
+	fmt.Fprintf(&b, `<autoFilter ref="A1:%s%d"/>`, column(len(Header)-1), len(rows)+1)
+	b.WriteString(`</worksheet>`)
+	return b.Bytes()
+}
+
+// stringCell writes a cell with the text in it, leaving empty text out
+func stringCell(b *bytes.Buffer, col, row int, text string, style int) {
+	if text == "" {
+		return
+	}
+	fmt.Fprintf(b, `<c r="%s%d" t="inlineStr"`, column(col), row)
+	if style != styleNormal {
+		fmt.Fprintf(b, ` s="%d"`, style)
+	}
+	b.WriteString(`><is><t xml:space="preserve">`)
+	xml.EscapeText(b, []byte(text))
+	b.WriteString(`</t></is></c>`)
+}
+
+// numberCell writes a cell with the number in it
+func numberCell(b *bytes.Buffer, col, row int, v float64, style int) {
+	fmt.Fprintf(b, `<c r="%s%d"`, column(col), row)
+	if style != styleNormal {
+		fmt.Fprintf(b, ` s="%d"`, style)
+	}
+	fmt.Fprintf(b, `><v>%s</v></c>`, strconv.FormatFloat(v, 'f', -1, 64))
+}
+
+// column returns the letters of the column with the index, e.g. "A" for 0
+// and "AA" for 26.
+func column(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
@@ -0,0 +1,290 @@
+// Package svg provides the SVG overlay of a job's runs: the running asbuilt
+// embedded as an image, with the lines and callouts of each work performed
+// date as vectors on their own layer over it. Reviewers can nudge a callout
+// or fix a line in Inkscape or any SVG editor, instead of editing the pixels
+// of the running asbuilt.
+package svg
+
+import (
+	"bufio"
+	"bytes"
+	"caddae/drawing"
+	"caddae/imageproc"
+	"caddae/jobdb"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Style of the work, to match how it's drawn on the running asbuilt
+const (
+	lineWidth     = 1
+	calloutBorder = 2
+	fontFamily    = "Go, Helvetica, Arial, sans-serif"
+	lineSpacing   = 1.25
+)
+
+// Write writes the SVG overlay of the runs to w.
+func Write(w io.Writer, runs []jobdb.Run, o Options) error {
+	if len(runs) == 0 {
+		return jobdb.ErrNoJob
+	}
+
+	underlay, page := o.Underlay, 1
+	if underlay == "" {
+		underlay, page = runs[0].Running.Path, runs[0].Running.Page
+	}
+	var img []byte
+	var mime string
+	if !o.NoUnderlay {
+		var err error
+		if img, mime, err = readImage(underlay, page); err != nil {
+			return err
+		}
+	}
+
+	size, err := sheetSize(runs, img)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprint(bw, xml.Header)
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" `+
+		`xmlns:inkscape="http://www.inkscape.org/namespaces/inkscape" xmlns:sodipodi="http://sodipodi.sourceforge.net/DTD/sodipodi-0.dtd" `+
+		`width="%s" height="%s" viewBox="0 0 %d %d">`+"\n",
+		sheetLength(size.X, runs), sheetLength(size.Y, runs), size.X, size.Y)
+	fmt.Fprintf(bw, "<title>%s</title>\n", escape(runs[0].Job))
+
+	// The running asbuilt is locked, so clicking on the work doesn't grab
+	// the image under it.
+	if img != nil {
+		fmt.Fprint(bw, `<g id="running-asbuilt" inkscape:groupmode="layer" inkscape:label="Running asbuilt" sodipodi:insensitive="true">`+"\n")
+		fmt.Fprintf(bw, `<image x="0" y="0" width="%d" height="%d" preserveAspectRatio="none" xlink:href="data:%s;base64,`, size.X, size.Y, mime)
+		enc := base64.NewEncoder(base64.StdEncoding, bw)
+		enc.Write(img)
+		enc.Close()
+		fmt.Fprint(bw, `"/>`+"\n</g>\n")
+	}
+
+	for _, l := range layers(runs) {
+		writeLayer(bw, l)
+	}
+	fmt.Fprint(bw, "</svg>\n")
+	return bw.Flush()
+}
+
+// Save writes the SVG overlay of the runs to a file.
+func Save(path string, runs []jobdb.Run, o Options) error {
+	// We first write a temporary file, then if everything is OK we rename it,
+	// so an editor never opens half an overlay.
+	newFile := path + ".tmp"
+	f, err := os.Create(newFile)
+	if err != nil {
+		return errors.Wrapf(err, "os.Create(%s): failed to create overlay", newFile)
+	}
+
+	err = Write(f, runs, o)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(newFile)
+		return errors.Wrapf(err, "svg.Save(%s): failed to write overlay", path)
+	}
+
+	if err := os.Rename(newFile, path); err != nil {
+		return errors.Wrapf(err, "rename(%s, %s)", newFile, path)
+	}
+	return nil
+}
+
+// Path returns the file the SVG overlay of a running asbuilt goes in: next
+// to it, with an .svg extension.
+func Path(running string) string {
+	ext := strings.LastIndex(running, ".")
+	if ext <= strings.LastIndexAny(running, `/\`) {
+		return running + ".svg"
+	}
+	return running[:ext] + ".svg"
+}
+
+// readImage reads the image to embed, and its MIME type. PNGs and JPEGs are
+// embedded as they are, but browsers can't show a TIFF or PDF, so the page of
+// those is decoded and embedded as a PNG instead.
+func readImage(path string, page int) ([]byte, string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "svg: failed to read underlay %s", path)
+	}
+	mime := http.DetectContentType(b)
+	if mime == "image/png" || mime == "image/jpeg" {
+		return b, mime, nil
+	}
+
+	img, err := imageproc.OpenPage(path, page)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "svg: underlay %s must be a PNG, JPEG, TIFF or PDF", path)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, "", errors.Wrapf(err, "svg: failed to encode page %d of underlay %s", page, path)
+	}
+	return buf.Bytes(), "image/png", nil
+}
+
+// sheetSize returns the size of the running asbuilt in pixels, from the
+// image if there is one or else the runs.
+func sheetSize(runs []jobdb.Run, img []byte) (image.Point, error) {
+	if img != nil {
+		conf, _, err := image.DecodeConfig(bytes.NewReader(img))
+		if err != nil {
+			return image.Point{}, errors.Wrap(err, "svg: failed to read underlay")
+		}
+		return image.Pt(conf.Width, conf.Height), nil
+	}
+	for _, r := range runs {
+		if r.Size != (image.Point{}) {
+			return r.Size, nil
+		}
+	}
+	return image.Point{}, fmt.Errorf("svg: %s has no running asbuilt size recorded, give an underlay to go by", runs[0].Job)
+}
+
+// sheetLength returns the length of the pixels on the sheet in inches, from
+// the DPI the runs were scanned at, or in pixels if we don't know it.
+func sheetLength(pixels int, runs []jobdb.Run) string {
+	for _, r := range runs {
+		if r.DPI != 0 {
+			return strconv.FormatFloat(float64(pixels)/r.DPI, 'f', 3, 64) + "in"
+		}
+	}
+	return strconv.Itoa(pixels)
+}
+
+// layers returns the runs as a layer for each work performed date, in the
+// order the dates first come up.
+func layers(runs []jobdb.Run) []*layer {
+	var ls []*layer
+	byWpd := make(map[string]*layer)
+	for _, r := range runs {
+		l, ok := byWpd[r.Wpd]
+		if !ok {
+			l = &layer{wpd: r.Wpd, id: layerID(r.Wpd)}
+			byWpd[r.Wpd] = l
+			ls = append(ls, l)
+		}
+		l.runs = append(l.runs, r)
+	}
+	return ls
+}
+
+// layerID returns the id of the layer of the work performed date, e.g.
+// "wpd-2021-07-16" for 07/16/2021
+func layerID(wpd string) string {
+	if parts := strings.Split(wpd, "/"); len(parts) == 3 {
+		return fmt.Sprintf("wpd-%s-%s-%s", parts[2], parts[0], parts[1])
+	}
+	id := []byte("wpd-")
+	for _, c := range []byte(strings.ToLower(wpd)) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+			id = append(id, c)
+		} else {
+			id = append(id, '-')
+		}
+	}
+	return string(id)
+}
+
+// writeLayer writes the layer of a work performed date: a group of its lines
+// and a group of its callouts, each callout its own group of a box and text
+// so it can be moved as one.
+func writeLayer(w io.Writer, l *layer) {
+	fmt.Fprintf(w, `<g id="%s" inkscape:groupmode="layer" inkscape:label="WPD %s">`+"\n", l.id, escape(l.wpd))
+
+	blue := drawing.Blue
+	fmt.Fprintf(w, `<g id="%s-lines" inkscape:label="Lines" fill="none" stroke="#%02x%02x%02x" stroke-width="%d" stroke-linecap="round" stroke-linejoin="round">`+"\n",
+		l.id, blue.R, blue.G, blue.B, lineWidth)
+	for _, r := range l.runs {
+		for _, line := range r.Lines {
+			if len(line) < 2 {
+				continue
+			}
+			points := make([]string, len(line))
+			for i, p := range line {
+				points[i] = fmt.Sprintf("%d,%d", p.X, p.Y)
+			}
+			fmt.Fprintf(w, `<polyline points="%s"/>`+"\n", strings.Join(points, " "))
+		}
+	}
+	fmt.Fprint(w, "</g>\n")
+
+	fmt.Fprintf(w, `<g id="%s-callouts" inkscape:label="Callouts">`+"\n", l.id)
+	n := 0
+	for _, r := range l.runs {
+		box := r.Callout.Box
+		if box.Empty() {
+			continue
+		}
+		n++
+		fmt.Fprintf(w, `<g id="%s-callout-%d" inkscape:label="Callout %d">`+"\n", l.id, n, n)
+		fmt.Fprintf(w, `<rect x="%d" y="%d" width="%d" height="%d" fill="#ffffff" stroke="#000000" stroke-width="%d"/>`+"\n",
+			box.Min.X, box.Min.Y, box.Dx(), box.Dy(), calloutBorder)
+		if len(r.Callout.Text) > 0 {
+			writeText(w, r)
+		}
+		fmt.Fprint(w, "</g>\n")
+	}
+	fmt.Fprint(w, "</g>\n")
+
+	fmt.Fprint(w, "</g>\n")
+}
+
+// writeText writes the text of a run's callout, a line at a time, in the
+// callout's box
+func writeText(w io.Writer, r jobdb.Run) {
+	box := r.Callout.Box
+	lines := r.Callout.Text
+
+	// Text is sized in points, 72 to the inch. Without a size or a DPI, the
+	// lines share the height of the box.
+	size := r.Callout.Size / 72 * r.DPI
+	if size == 0 {
+		size = float64(box.Dy()) / (float64(len(lines)) * lineSpacing)
+	}
+	step := size * lineSpacing
+	top := float64(box.Min.Y) + (float64(box.Dy())-step*float64(len(lines)))/2
+
+	fmt.Fprintf(w, `<text x="%d" y="%s" font-family="%s" font-size="%s" fill="#000000" text-anchor="middle" xml:space="preserve">`,
+		box.Min.X+box.Dx()/2, num(top+size), fontFamily, num(size))
+	for i, t := range lines {
+		if i == 0 {
+			fmt.Fprintf(w, `<tspan x="%d">%s</tspan>`, box.Min.X+box.Dx()/2, escape(t))
+		} else {
+			fmt.Fprintf(w, `<tspan x="%d" dy="%s">%s</tspan>`, box.Min.X+box.Dx()/2, num(step), escape(t))
+		}
+	}
+	fmt.Fprint(w, "</text>\n")
+}
+
+// num formats a number for an attribute
+func num(f float64) string {
+	return strconv.FormatFloat(f, 'f', 2, 64)
+}
+
+// escape escapes the text for XML
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
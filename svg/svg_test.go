@@ -0,0 +1,260 @@
+package svg
+
+import (
+	"bytes"
+	"caddae/jobdb"
+	"encoding/base64"
+	"encoding/xml"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/tiff"
+)
+
+// testRuns returns three runs over two work performed dates, drawn on the
+// running asbuilt at ra
+func testRuns(ra string) []jobdb.Run {
+	size := image.Pt(400, 300)
+	return []jobdb.Run{
+		{ID: 1, Job: "VZ_LAN_00007054", Wpd: "07/16/2021", Size: size, DPI: 100, Running: jobdb.File{Path: ra},
+			Lines: []jobdb.Line{{{X: 10, Y: 20}, {X: 30, Y: 20}, {X: 30, Y: 50}}, {{X: 1, Y: 1}}},
+			Callout: jobdb.Callout{
+				Box:  image.Rect(200, 100, 300, 150),
+				Text: []string{"07/16/2021", "C300-01 = 250' & <more>"},
+				Size: 7.2,
+			}},
+		{ID: 2, Job: "VZ_LAN_00007054", Wpd: "07/19/2021", Size: size, DPI: 100, Running: jobdb.File{Path: "ra_1.png"},
+			Lines: []jobdb.Line{{{X: 30, Y: 50}, {X: 30, Y: 90}}}},
+		{ID: 3, Job: "VZ_LAN_00007054", Wpd: "07/16/2021", Size: size, DPI: 100, Running: jobdb.File{Path: "ra_2.png"},
+			Lines:   []jobdb.Line{{{X: 50, Y: 50}, {X: 60, Y: 60}}},
+			Callout: jobdb.Callout{Box: image.Rect(10, 200, 110, 250), Text: []string{"07/16/2021"}}},
+	}
+}
+
+// writePNG writes a blank PNG of the size and returns its path
+func writePNG(t *testing.T, size image.Point) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "running.png")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, image.NewGray(image.Rectangle{Max: size})); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// node is an element of the SVG read back, with its attributes and children
+type node struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Nodes   []node     `xml:",any"`
+	Text    string     `xml:",chardata"`
+}
+
+func (n node) attr(name string) string {
+	for _, a := range n.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// find returns the elements under n with the name, depth first
+func (n node) find(name string) []node {
+	var found []node
+	for _, c := range n.Nodes {
+		if c.XMLName.Local == name {
+			found = append(found, c)
+		}
+		found = append(found, c.find(name)...)
+	}
+	return found
+}
+
+func parse(t *testing.T, b []byte) node {
+	t.Helper()
+	var root node
+	if err := xml.Unmarshal(b, &root); err != nil {
+		t.Fatalf("overlay isn't valid XML: %v", err)
+	}
+	return root
+}
+
+func TestWrite(t *testing.T) {
+	ra := writePNG(t, image.Pt(400, 300))
+	var b bytes.Buffer
+	if err := Write(&b, testRuns(ra), Options{}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	root := parse(t, b.Bytes())
+
+	if root.attr("viewBox") != "0 0 400 300" || root.attr("width") != "4.000in" || root.attr("height") != "3.000in" {
+		t.Errorf("svg = %+v", root.Attrs)
+	}
+
+	// After the title, the running asbuilt the first run was drawn on is
+	// embedded, locked
+	base, layers := root.Nodes[1], root.Nodes[2:]
+	if base.attr("id") != "running-asbuilt" || base.attr("insensitive") != "true" {
+		t.Fatalf("first layer = %+v", base.Attrs)
+	}
+	href := base.Nodes[0].attr("href")
+	want, _ := os.ReadFile(ra)
+	if !strings.HasPrefix(href, "data:image/png;base64,") {
+		t.Fatalf("image href = %.40s", href)
+	}
+	if got, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(href, "data:image/png;base64,")); !bytes.Equal(got, want) {
+		t.Errorf("embedded image isn't the running asbuilt")
+	}
+
+	// A layer for each work performed date, with the runs of 07/16 together
+	var ids []string
+	for _, l := range layers {
+		ids = append(ids, l.attr("id")+" "+l.attr("label"))
+	}
+	if got := strings.Join(ids, ", "); got != "wpd-2021-07-16 WPD 07/16/2021, wpd-2021-07-19 WPD 07/19/2021" {
+		t.Fatalf("layers = %s", got)
+	}
+	first := layers[0]
+	polylines := first.find("polyline")
+	if len(polylines) != 2 || polylines[0].attr("points") != "10,20 30,20 30,50" {
+		t.Errorf("07/16 lines = %+v", polylines)
+	}
+	callouts := first.Nodes[1].Nodes
+	if len(callouts) != 2 || callouts[0].attr("id") != "wpd-2021-07-16-callout-1" {
+		t.Fatalf("07/16 callouts = %+v", callouts)
+	}
+
+	rect := callouts[0].find("rect")[0]
+	if rect.attr("x") != "200" || rect.attr("y") != "100" || rect.attr("width") != "100" || rect.attr("height") != "50" {
+		t.Errorf("callout box = %+v", rect.Attrs)
+	}
+	// 7.2pt is a tenth of an inch, 10 pixels at 100 DPI
+	text := callouts[0].find("text")[0]
+	spans := text.find("tspan")
+	if text.attr("font-size") != "10.00" || len(spans) != 2 || spans[1].Text != "C300-01 = 250' & <more>" {
+		t.Errorf("callout text = %+v", text)
+	}
+	// Without a size, the text fills the box
+	if size := callouts[1].find("text")[0].attr("font-size"); size != "40.00" {
+		t.Errorf("unsized callout text is %s pixels, want 40.00", size)
+	}
+}
+
+func TestWriteTIFFUnderlay(t *testing.T) {
+	ra := filepath.Join(t.TempDir(), "running.tif")
+	f, err := os.Create(ra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tiff.Encode(f, image.NewGray(image.Rect(0, 0, 400, 300)), nil)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runs := testRuns(ra)
+	runs[0].Running.Page = 1
+	var b bytes.Buffer
+	if err := Write(&b, runs, Options{}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	// The TIFF is embedded as a PNG browsers can show
+	href := parse(t, b.Bytes()).find("image")[0].attr("href")
+	if !strings.HasPrefix(href, "data:image/png;base64,") {
+		t.Fatalf("image href = %.40s", href)
+	}
+	data, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(href, "data:image/png;base64,"))
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("embedded image isn't a PNG: %v", err)
+	}
+	if size := img.Bounds().Size(); size != image.Pt(400, 300) {
+		t.Errorf("embedded image is %v, want the running asbuilt's 400x300", size)
+	}
+
+	runs[0].Running.Page = 2
+	if err := Write(io.Discard, runs, Options{}); err == nil {
+		t.Errorf("Write of a page the TIFF doesn't have succeeded")
+	}
+}
+
+func TestWriteWithoutUnderlay(t *testing.T) {
+	runs := testRuns("missing.png")
+	if err := Write(io.Discard, runs, Options{}); err == nil {
+		t.Errorf("Write with a missing underlay succeeded")
+	}
+
+	var b bytes.Buffer
+	if err := Write(&b, runs, Options{NoUnderlay: true}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	root := parse(t, b.Bytes())
+	if len(root.find("image")) != 0 {
+		t.Errorf("image embedded with NoUnderlay")
+	}
+	if root.attr("viewBox") != "0 0 400 300" {
+		t.Errorf("viewBox = %s, want the recorded size", root.attr("viewBox"))
+	}
+
+	runs[0].Size, runs[1].Size, runs[2].Size = image.Point{}, image.Point{}, image.Point{}
+	if err := Write(io.Discard, runs, Options{NoUnderlay: true}); err == nil {
+		t.Errorf("Write without a size succeeded")
+	}
+	if err := Write(io.Discard, nil, Options{}); err != jobdb.ErrNoJob {
+		t.Errorf("Write of no runs = %v, want %v", err, jobdb.ErrNoJob)
+	}
+
+	notImage := filepath.Join(t.TempDir(), "running.txt")
+	os.WriteFile(notImage, []byte("not an image"), 0644)
+	if err := Write(io.Discard, runs, Options{Underlay: notImage}); err == nil {
+		t.Errorf("Write with a text underlay succeeded")
+	}
+}
+
+func TestSave(t *testing.T) {
+	ra := writePNG(t, image.Pt(400, 300))
+	path := Path(filepath.Join(t.TempDir(), "VZ_LAN_00007054.png"))
+	if err := Save(path, testRuns(ra), Options{}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parse(t, b)
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind")
+	}
+}
+
+func TestPath(t *testing.T) {
+	for running, want := range map[string]string{
+		"out/VZ_LAN_00007054.png":  "out/VZ_LAN_00007054.svg",
+		"VZ.v2/running":            "VZ.v2/running.svg",
+		`C:\jobs\VZ_LAN.jpeg`:      `C:\jobs\VZ_LAN.svg`,
+		"VZ_LAN_00007054.2021.png": "VZ_LAN_00007054.2021.svg",
+	} {
+		if got := Path(running); got != want {
+			t.Errorf("Path(%s) = %s, want %s", running, got, want)
+		}
+	}
+}
+
+func TestLayerID(t *testing.T) {
+	for wpd, want := range map[string]string{"07/16/2021": "wpd-2021-07-16", "Jul 16": "wpd-jul-16"} {
+		if got := layerID(wpd); got != want {
+			t.Errorf("layerID(%s) = %s, want %s", wpd, got, want)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package svg
+
+import "caddae/jobdb"
+
+// Options for the SVG overlay of a job's runs
+type Options struct {
+	// Underlay is the image embedded under the work. If empty, the running
+	// asbuilt the first run was drawn on is used, so the work on it is only
+	// the editable vectors. The page of a TIFF or PDF is embedded as a PNG.
+	Underlay string
+
+	// NoUnderlay leaves the image out, for just the vectors
+	NoUnderlay bool
+}
+
+// layer is the work performed on a date: the lines and callouts of its runs
+type layer struct {
+	wpd  string
+	id   string
+	runs []jobdb.Run
+}
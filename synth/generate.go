@@ -0,0 +1,245 @@
+package synth
+
+import (
+	"caddae/drawing"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"math/rand"
+)
+
+// DefaultOptions returns options that make a redline a lot like the sample
+// scans: a yellow highlighter on off-white paper, scanned a little crooked.
+func DefaultOptions() Options {
+	return Options{
+		Color:       color.RGBA{0xf5, 0xf8, 0x6c, 0xff},
+		Opacity:     0.9,
+		StrokeWidth: 14,
+		Jitter:      3,
+		Scan:        Scan{Scale: 1, Rotation: 0.5, ShiftX: 15, ShiftY: -10},
+		Noise:       6,
+		Blur:        1,
+		Tint:        color.RGBA{0xfa, 0xf8, 0xf0, 0xff},
+		Seed:        1,
+	}
+}
+
+// Generate makes a synthetic redline from the clean asbuilt by highlighting
+// the lines on a copy of it, then "scanning" the copy: tinting the paper,
+// moving it on the page, blurring it and adding noise.
+//
+// The returned ground truth holds the lines and the options they were drawn
+// with, so the pipeline's output can be scored against it.
+func Generate(asbuilt image.Image, lines []Polyline, opts Options) (*image.RGBA, Truth) {
+	r := rand.New(rand.NewSource(opts.Seed))
+	bnds := asbuilt.Bounds()
+
+	// The printed redline, on tinted paper
+	page := image.NewRGBA(image.Rect(0, 0, bnds.Dx(), bnds.Dy()))
+	draw.Draw(page, page.Bounds(), asbuilt, bnds.Min, draw.Src)
+	multiply(page, page.Bounds(), opts.Tint, 1)
+
+	// Highlight the lines. Work out all the covered pixels first, so strokes
+	// that cross aren't highlighted twice.
+	covered := make([]bool, page.Bounds().Dx()*page.Bounds().Dy())
+	for _, line := range lines {
+		stamp(covered, page.Bounds(), wobble(line, opts.Jitter, r), opts.StrokeWidth/2)
+	}
+	for i, c := range covered {
+		if c {
+			x, y := i%page.Bounds().Dx(), i/page.Bounds().Dx()
+			multiply(page, image.Rect(x, y, x+1, y+1), opts.Color, opts.Opacity)
+		}
+	}
+
+	// Scan it
+	redline := scan(page, opts.Scan, opts.Tint)
+	blur(redline, opts.Blur)
+	noise(redline, opts.Noise, r)
+
+	scn := opts.Scan
+	return redline, Truth{
+		StrokeWidth: opts.StrokeWidth,
+		Scan:        &scn,
+		Lines:       lines,
+	}
+}
+
+// multiply blends the color into the image over the rectangle, the way ink
+// on paper darkens whatever is under it. The strength is 0 to 1.
+func multiply(img *image.RGBA, rect image.Rectangle, clr color.RGBA, strength float64) {
+	k := [3]float64{
+		1 - strength + strength*float64(clr.R)/0xff,
+		1 - strength + strength*float64(clr.G)/0xff,
+		1 - strength + strength*float64(clr.B)/0xff,
+	}
+	rect = rect.Intersect(img.Bounds())
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			c := img.RGBAAt(x, y)
+			img.SetRGBA(x, y, color.RGBA{
+				R: uint8(math.Round(float64(c.R) * k[0])),
+				G: uint8(math.Round(float64(c.G) * k[1])),
+				B: uint8(math.Round(float64(c.B) * k[2])),
+				A: 0xff,
+			})
+		}
+	}
+}
+
+// wobble samples the polyline every pixel, moving each sample sideways by a
+// smooth random amount of up to jitter pixels, like a hand drawn stroke.
+func wobble(line Polyline, jitter float64, r *rand.Rand) [][2]float64 {
+	// Two sine waves with random wavelengths and phases make the wander
+	// smooth, but not regular.
+	long, short := 150+r.Float64()*250, 40+r.Float64()*50
+	p1, p2 := r.Float64()*2*math.Pi, r.Float64()*2*math.Pi
+
+	return along(line, func(dist float64) float64 {
+		return jitter * (0.6*math.Sin(2*math.Pi*dist/long+p1) + 0.4*math.Sin(2*math.Pi*dist/short+p2))
+	})
+}
+
+// along samples the polyline every pixel. If sideways isn't nil, each sample
+// is moved that many pixels to the side of the line, given how far along the
+// line the sample is.
+func along(line Polyline, sideways func(dist float64) float64) [][2]float64 {
+	var samples [][2]float64
+	dist := 0.0
+	for i := 1; i < len(line); i++ {
+		a, b := line[i-1], line[i]
+		dx, dy := b[0]-a[0], b[1]-a[1]
+		length := math.Hypot(dx, dy)
+		if length == 0 {
+			continue
+		}
+		// The unit normal of the segment
+		nx, ny := -dy/length, dx/length
+
+		for s := 0.0; s < length; s++ {
+			off := 0.0
+			if sideways != nil {
+				off = sideways(dist + s)
+			}
+			t := s / length
+			samples = append(samples, [2]float64{a[0] + dx*t + nx*off, a[1] + dy*t + ny*off})
+		}
+		dist += length
+	}
+	if len(line) > 0 {
+		samples = append(samples, line[len(line)-1])
+	}
+	return samples
+}
+
+// stamp marks every pixel within radius of the samples as covered
+func stamp(covered []bool, bnds image.Rectangle, samples [][2]float64, radius float64) {
+	w := bnds.Dx()
+	for _, s := range samples {
+		minX, maxX := int(math.Floor(s[0]-radius)), int(math.Ceil(s[0]+radius))
+		minY, maxY := int(math.Floor(s[1]-radius)), int(math.Ceil(s[1]+radius))
+		for y := minY; y <= maxY; y++ {
+			for x := minX; x <= maxX; x++ {
+				if !(image.Point{x, y}).In(bnds) {
+					continue
+				}
+				if math.Hypot(float64(x)-s[0], float64(y)-s[1]) <= radius {
+					covered[(y-bnds.Min.Y)*w+x-bnds.Min.X] = true
+				}
+			}
+		}
+	}
+}
+
+// scan moves the page the way the scanner would, sampling it with bilinear
+// interpolation. Anything that comes from off the page is paper colored.
+func scan(page *image.RGBA, s Scan, paper color.RGBA) *image.RGBA {
+	bnds := page.Bounds()
+	t := s.Transform(bnds.Dx(), bnds.Dy())
+
+	out := image.NewRGBA(bnds)
+	for y := bnds.Min.Y; y < bnds.Max.Y; y++ {
+		for x := bnds.Min.X; x < bnds.Max.X; x++ {
+			sx, sy := t.Apply(drawing.Pixel{X: x, Y: y})
+			out.SetRGBA(x, y, sample(page, sx, sy, paper))
+		}
+	}
+	return out
+}
+
+// sample returns the color of the image at (x, y), interpolated between the
+// four pixels around it.
+func sample(img *image.RGBA, x, y float64, paper color.RGBA) color.RGBA {
+	x0, y0 := int(math.Floor(x)), int(math.Floor(y))
+	fx, fy := x-float64(x0), y-float64(y0)
+
+	at := func(px, py int) color.RGBA {
+		if !(image.Point{px, py}).In(img.Bounds()) {
+			return paper
+		}
+		return img.RGBAAt(px, py)
+	}
+	c00, c10, c01, c11 := at(x0, y0), at(x0+1, y0), at(x0, y0+1), at(x0+1, y0+1)
+	mix := func(a, b, c, d uint8) uint8 {
+		top := float64(a)*(1-fx) + float64(b)*fx
+		bottom := float64(c)*(1-fx) + float64(d)*fx
+		return uint8(math.Round(top*(1-fy) + bottom*fy))
+	}
+	return color.RGBA{
+		R: mix(c00.R, c10.R, c01.R, c11.R),
+		G: mix(c00.G, c10.G, c01.G, c11.G),
+		B: mix(c00.B, c10.B, c01.B, c11.B),
+		A: 0xff,
+	}
+}
+
+// blur box blurs the image with the given radius, first across then down.
+func blur(img *image.RGBA, radius int) {
+	if radius <= 0 {
+		return
+	}
+	bnds := img.Bounds()
+	w, h := bnds.Dx(), bnds.Dy()
+	pass := func(n, lines int, at func(line, i int) int) {
+		buf := make([]uint8, n*4)
+		for line := 0; line < lines; line++ {
+			for i := 0; i < n; i++ {
+				copy(buf[i*4:i*4+4], img.Pix[at(line, i):at(line, i)+4])
+			}
+			for i := 0; i < n; i++ {
+				var sum [3]int
+				count := 0
+				for j := i - radius; j <= i+radius; j++ {
+					if j < 0 || j >= n {
+						continue
+					}
+					sum[0] += int(buf[j*4])
+					sum[1] += int(buf[j*4+1])
+					sum[2] += int(buf[j*4+2])
+					count++
+				}
+				o := at(line, i)
+				img.Pix[o] = uint8(sum[0] / count)
+				img.Pix[o+1] = uint8(sum[1] / count)
+				img.Pix[o+2] = uint8(sum[2] / count)
+			}
+		}
+	}
+	pass(w, h, func(y, x int) int { return img.PixOffset(bnds.Min.X+x, bnds.Min.Y+y) })
+	pass(h, w, func(x, y int) int { return img.PixOffset(bnds.Min.X+x, bnds.Min.Y+y) })
+}
+
+// noise adds gaussian noise with the given standard deviation to every
+// channel of every pixel.
+func noise(img *image.RGBA, stddev float64, r *rand.Rand) {
+	if stddev <= 0 {
+		return
+	}
+	for i := 0; i < len(img.Pix); i += 4 {
+		for j := 0; j < 3; j++ {
+			v := float64(img.Pix[i+j]) + r.NormFloat64()*stddev
+			img.Pix[i+j] = uint8(math.Max(0, math.Min(0xff, math.Round(v))))
+		}
+	}
+}
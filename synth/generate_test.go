@@ -0,0 +1,128 @@
+package synth
+
+import (
+	"bytes"
+	"caddae/drawing"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+)
+
+// testAsbuilt returns a white image with a black line across the middle
+func testAsbuilt() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	draw.Draw(img, img.Bounds(), &image.Uniform{drawing.White}, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 149, 400, 152), &image.Uniform{drawing.Black}, image.Point{}, draw.Src)
+	return img
+}
+
+// isStrand checks if the default ranges would pick the color up as new strand
+func isStrand(c color.RGBA) bool {
+	for i := range drawing.Ranges {
+		if drawing.Ranges[i].Meaning == drawing.NEW_STRAND && drawing.Ranges[i].Matches(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanOptions are the default options without any of the scanning
+func cleanOptions() Options {
+	opts := DefaultOptions()
+	opts.Scan = Scan{Scale: 1}
+	opts.Jitter, opts.Noise, opts.Blur = 0, 0, 0
+	return opts
+}
+
+func TestGenerateHighlights(t *testing.T) {
+	lines := []Polyline{{{50, 100}, {350, 100}}}
+	img, truth := Generate(testAsbuilt(), lines, cleanOptions())
+
+	if c := img.RGBAAt(200, 100); !isStrand(c) {
+		t.Errorf("pixel on the line = %v, want it picked up as new strand", c)
+	}
+	if c := img.RGBAAt(200, 100+6); !isStrand(c) {
+		t.Errorf("pixel at the edge of the stroke = %v, want it picked up as new strand", c)
+	}
+	if c := img.RGBAAt(200, 200); c != cleanOptions().Tint {
+		t.Errorf("paper pixel = %v, want the tint %v", c, cleanOptions().Tint)
+	}
+	if c := img.RGBAAt(200, 150); c != drawing.Black {
+		t.Errorf("linework pixel = %v, want %v", c, drawing.Black)
+	}
+
+	if len(truth.Lines) != 1 || truth.StrokeWidth != 14 || truth.Scan == nil {
+		t.Errorf("ground truth = %+v, want the line, stroke width and scan", truth)
+	}
+}
+
+func TestGenerateScan(t *testing.T) {
+	lines := []Polyline{{{50, 60}, {350, 60}, {350, 250}}}
+	opts := cleanOptions()
+	opts.Scan = Scan{Scale: 1.05, Rotation: 4, ShiftX: 20, ShiftY: -15}
+	img, truth := Generate(testAsbuilt(), lines, opts)
+	tr := truth.Scan.Transform(400, 300)
+
+	// Every highlighted pixel on the redline should map back onto the stroke
+	found := 0
+	for y := 0; y < 300; y++ {
+		for x := 0; x < 400; x++ {
+			if !isStrand(img.RGBAAt(x, y)) {
+				continue
+			}
+			found++
+			ax, ay := tr.Apply(drawing.Pixel{X: x, Y: y})
+			if d := lineDistance(lines[0], ax, ay); d > opts.StrokeWidth/2+2 {
+				t.Fatalf("highlighted pixel (%d, %d) maps to (%.1f, %.1f), %.1f pixels from the line", x, y, ax, ay, d)
+			}
+		}
+	}
+	if found < 300*10 {
+		t.Errorf("found %d highlighted pixels, want a stroke's worth", found)
+	}
+}
+
+func TestGenerateSeed(t *testing.T) {
+	lines := []Polyline{{{50, 100}, {350, 120}}}
+	a, _ := Generate(testAsbuilt(), lines, DefaultOptions())
+	b, _ := Generate(testAsbuilt(), lines, DefaultOptions())
+	if !bytes.Equal(a.Pix, b.Pix) {
+		t.Error("the same seed made different redlines")
+	}
+
+	opts := DefaultOptions()
+	opts.Seed++
+	c, _ := Generate(testAsbuilt(), lines, opts)
+	if bytes.Equal(a.Pix, c.Pix) {
+		t.Error("different seeds made the same redline")
+	}
+}
+
+func TestScanTransform(t *testing.T) {
+	s := Scan{Scale: 1.1, Rotation: 3, ShiftX: 10, ShiftY: -5}
+	tr := s.Transform(400, 300)
+
+	// Scan the point the way the scanner would, then map it back
+	sin, cos := math.Sincos(s.Rotation * math.Pi / 180)
+	for _, p := range []drawing.Pixel{{X: 0, Y: 0}, {X: 200, Y: 150}, {X: 390, Y: 20}, {X: 35, Y: 280}} {
+		vx, vy := float64(p.X)-200, float64(p.Y)-150
+		qx := s.Scale*(cos*vx-sin*vy) + 200 + s.ShiftX
+		qy := s.Scale*(sin*vx+cos*vy) + 150 + s.ShiftY
+
+		x, y := tr.Apply(drawing.Pixel{X: int(math.Round(qx)), Y: int(math.Round(qy))})
+		if math.Hypot(x-float64(p.X), y-float64(p.Y)) > 1 {
+			t.Errorf("%v scans to (%.1f, %.1f), which maps back to (%.1f, %.1f)", p, qx, qy, x, y)
+		}
+	}
+}
+
+// lineDistance returns how far (x, y) is from the polyline
+func lineDistance(line Polyline, x, y float64) float64 {
+	d := math.Inf(1)
+	for _, s := range along(line, nil) {
+		d = math.Min(d, math.Hypot(s[0]-x, s[1]-y))
+	}
+	return d
+}
@@ -0,0 +1,39 @@
+package synth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// LoadTruth loads a ground truth (or lines) JSON file.
+func LoadTruth(path string) (Truth, error) {
+	var t Truth
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return t, errors.Wrapf(err, "os.ReadFile(%s): failed to read ground truth", path)
+	}
+	if err := json.Unmarshal(b, &t); err != nil {
+		return t, errors.Wrapf(err, "LoadTruth(%s): failed to decode ground truth", path)
+	}
+	for i, line := range t.Lines {
+		if len(line) < 2 {
+			return t, fmt.Errorf("LoadTruth(%s): line %d needs at least 2 points", path, i+1)
+		}
+	}
+	return t, nil
+}
+
+// SaveTruth writes the ground truth to a JSON file.
+func SaveTruth(path string, t Truth) error {
+	b, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return errors.Wrapf(err, "SaveTruth(%s): failed to encode ground truth", path)
+	}
+	if err := os.WriteFile(path, append(b, '\n'), 0644); err != nil {
+		return errors.Wrapf(err, "os.WriteFile(%s): failed to write ground truth", path)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package synth
+
+import (
+	"caddae/drawing"
+	"image"
+	"image/color"
+	"math"
+)
+
+// drawnTolerance is how far (delta E) a pixel's color may be from the color
+// the pipeline draws lines with and still count as drawn.
+const drawnTolerance = 10.0
+
+// DrawnColor is the color the pipeline draws the new lines with.
+var DrawnColor = drawing.Blue
+
+// Compare scores the lines drawn on the running asbuilt against the ground
+// truth. A drawn pixel is correct if it's within tolerance pixels of a ground
+// truth line, and a ground truth line is found where there's a drawn pixel
+// within tolerance pixels of it.
+//
+// Solid blocks of the drawn color, like the production boxes on the callouts,
+// aren't counted as drawn.
+func Compare(running image.Image, truth Truth, tolerance float64) Score {
+	bnds := running.Bounds()
+	drawn := drawnPixels(running)
+
+	// Every pixel along the ground truth lines
+	var onTruth []image.Point
+	seen := make(map[image.Point]bool)
+	for _, line := range truth.Lines {
+		for _, s := range along(line, nil) {
+			p := image.Pt(int(math.Round(s[0])), int(math.Round(s[1])))
+			if p.In(bnds) && !seen[p] {
+				seen[p] = true
+				onTruth = append(onTruth, p)
+			}
+		}
+	}
+
+	var s Score
+	s.Drawn, s.Truth = len(drawn), len(onTruth)
+
+	nearTruth := dilate(onTruth, bnds, tolerance)
+	for _, p := range drawn {
+		if nearTruth[offset(p, bnds)] {
+			s.Correct++
+		}
+	}
+	nearDrawn := dilate(drawn, bnds, tolerance)
+	for _, p := range onTruth {
+		if nearDrawn[offset(p, bnds)] {
+			s.Found++
+		}
+	}
+
+	if s.Drawn > 0 {
+		s.Precision = float64(s.Correct) / float64(s.Drawn)
+	}
+	if s.Truth > 0 {
+		s.Recall = float64(s.Found) / float64(s.Truth)
+	}
+	if s.Precision+s.Recall > 0 {
+		s.F1 = 2 * s.Precision * s.Recall / (s.Precision + s.Recall)
+	}
+	return s
+}
+
+// drawnPixels returns the pixels of the image that are the drawn color, less
+// any solid blocks of it.
+func drawnPixels(img image.Image) []image.Point {
+	bnds := img.Bounds()
+	w, h := bnds.Dx(), bnds.Dy()
+	isDrawn := make([]bool, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBAModel.Convert(img.At(bnds.Min.X+x, bnds.Min.Y+y)).(color.RGBA)
+			isDrawn[y*w+x] = drawing.DeltaE(c, DrawnColor) <= drawnTolerance
+		}
+	}
+
+	// A pixel is part of a solid block if the 5x5 square around it, or one
+	// next to it, is all the drawn color. The lines we draw are never more
+	// than a few pixels wide, so they don't have any.
+	solid := func(x, y int) bool {
+		for dy := -2; dy <= 2; dy++ {
+			for dx := -2; dx <= 2; dx++ {
+				nx, ny := x+dx, y+dy
+				if nx < 0 || ny < 0 || nx >= w || ny >= h || !isDrawn[ny*w+nx] {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	block := make([]bool, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if !isDrawn[y*w+x] || !solid(x, y) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					block[(y+dy)*w+x+dx] = true
+				}
+			}
+		}
+	}
+
+	var pixels []image.Point
+	for i, d := range isDrawn {
+		if d && !block[i] {
+			pixels = append(pixels, image.Pt(bnds.Min.X+i%w, bnds.Min.Y+i/w))
+		}
+	}
+	return pixels
+}
+
+// dilate returns a mask of every pixel within radius of one of the points
+func dilate(points []image.Point, bnds image.Rectangle, radius float64) []bool {
+	mask := make([]bool, bnds.Dx()*bnds.Dy())
+	r := int(math.Ceil(radius))
+	for _, p := range points {
+		for dy := -r; dy <= r; dy++ {
+			for dx := -r; dx <= r; dx++ {
+				q := p.Add(image.Pt(dx, dy))
+				if q.In(bnds) && math.Hypot(float64(dx), float64(dy)) <= radius {
+					mask[offset(q, bnds)] = true
+				}
+			}
+		}
+	}
+	return mask
+}
+
+// offset returns the index of the point in a mask of the bounds
+func offset(p image.Point, bnds image.Rectangle) int {
+	return (p.Y-bnds.Min.Y)*bnds.Dx() + p.X - bnds.Min.X
+}
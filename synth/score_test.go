@@ -0,0 +1,107 @@
+package synth
+
+import (
+	"caddae/drawing"
+	"image"
+	"image/draw"
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+// drawTruth returns a white image with the lines drawn on it, moved d pixels
+// right and down, the way the pipeline draws them.
+func drawTruth(lines []Polyline, d int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	draw.Draw(img, img.Bounds(), &image.Uniform{drawing.White}, image.Point{}, draw.Src)
+
+	l := zerolog.Nop()
+	c := drawing.New(&l)
+	c.SetImage(img)
+	for _, line := range lines {
+		for i := 1; i < len(line); i++ {
+			a := drawing.Pixel{X: int(line[i-1][0]) + d, Y: int(line[i-1][1]) + d}
+			b := drawing.Pixel{X: int(line[i][0]) + d, Y: int(line[i][1]) + d}
+			c.DrawAntialiased(a, b, drawing.Blue)
+		}
+	}
+	return img
+}
+
+func TestCompare(t *testing.T) {
+	truth := Truth{Lines: []Polyline{{{50, 60}, {350, 80}, {360, 250}}}}
+
+	tests := []struct {
+		name      string
+		d         int
+		precision float64
+		recall    float64
+	}{
+		{"exact", 0, 1, 1},
+		{"within tolerance", 3, 1, 1},
+		{"off the line", 20, 0, 0},
+	}
+	for _, tt := range tests {
+		s := Compare(drawTruth(truth.Lines, tt.d), truth, 5)
+		if s.Drawn == 0 {
+			t.Errorf("%s: no drawn pixels found", tt.name)
+			continue
+		}
+		// The ends of the lines don't quite line up when they're moved, so
+		// allow a little either way.
+		if math.Abs(s.Precision-tt.precision) > 0.05 || math.Abs(s.Recall-tt.recall) > 0.05 {
+			t.Errorf("%s: precision %.3f, recall %.3f, want about %.0f and %.0f", tt.name, s.Precision, s.Recall, tt.precision, tt.recall)
+		}
+	}
+}
+
+func TestCompareIgnoresBoxes(t *testing.T) {
+	truth := Truth{Lines: []Polyline{{{50, 60}, {350, 60}}}}
+	img := drawTruth(truth.Lines, 0)
+	without := Compare(img, truth, 5)
+
+	// A callout's production box
+	draw.Draw(img, image.Rect(100, 150, 260, 180), &image.Uniform{drawing.Blue}, image.Point{}, draw.Src)
+	with := Compare(img, truth, 5)
+
+	if with.Drawn != without.Drawn || with.Precision != without.Precision {
+		t.Errorf("with a box: %d drawn, precision %.3f, want %d and %.3f", with.Drawn, with.Precision, without.Drawn, without.Precision)
+	}
+}
+
+func TestCompareNothingDrawn(t *testing.T) {
+	truth := Truth{Lines: []Polyline{{{50, 60}, {350, 60}}}}
+	s := Compare(drawTruth(nil, 0), truth, 5)
+	if s.Drawn != 0 || s.Recall != 0 || s.F1 != 0 {
+		t.Errorf("Compare of a blank image = %+v, want nothing drawn or found", s)
+	}
+}
+
+func TestTruthFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "truth.json")
+	want := Truth{
+		Asbuilt:     "asbuilt.png",
+		StrokeWidth: 14,
+		Scan:        &Scan{Scale: 1, Rotation: 0.5},
+		Lines:       []Polyline{{{1, 2}, {3, 4}}},
+	}
+	if err := SaveTruth(path, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadTruth(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Asbuilt != want.Asbuilt || *got.Scan != *want.Scan || len(got.Lines) != 1 || got.Lines[0][1] != want.Lines[0][1] {
+		t.Errorf("LoadTruth = %+v, want %+v", got, want)
+	}
+
+	if err := SaveTruth(path, Truth{Lines: []Polyline{{{1, 2}}}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadTruth(path); err == nil {
+		t.Error("LoadTruth of a line with 1 point didn't return an error")
+	}
+}
@@ -0,0 +1,106 @@
+package synth
+
+import (
+	"caddae/drawing"
+	"image/color"
+	"math"
+)
+
+// Polyline is a list of [x, y] points on the asbuilt, joined by straight
+// segments.
+type Polyline [][2]float64
+
+// Truth is the ground truth for a synthetic redline: the lines that were
+// highlighted, in the asbuilt's coordinates, and how the redline was made.
+//
+// The same file format is used for the lines given to the generator, where
+// only the lines are needed.
+type Truth struct {
+	// The clean asbuilt and the synthetic redline made from it
+	Asbuilt string `json:"asbuilt,omitempty"`
+	Redline string `json:"redline,omitempty"`
+
+	// Width of the highlighter strokes, in pixels
+	StrokeWidth float64 `json:"stroke_width,omitempty"`
+
+	// How the asbuilt was moved on the fake scan
+	Scan *Scan `json:"scan,omitempty"`
+
+	// The highlighted lines, on the asbuilt
+	Lines []Polyline `json:"lines"`
+}
+
+// Scan is how the asbuilt was scaled, rotated (in degrees, about the center
+// of the image) and shifted when it was "scanned" into the redline.
+type Scan struct {
+	Scale    float64 `json:"scale"`
+	Rotation float64 `json:"rotation"`
+	ShiftX   float64 `json:"shift_x"`
+	ShiftY   float64 `json:"shift_y"`
+}
+
+// Transform returns the transform that maps pixels on the redline back onto
+// the asbuilt, which is what drawing.Register should find for the redline.
+// The width and height are the size of the image.
+func (s Scan) Transform(width, height int) drawing.Transform {
+	scale := s.Scale
+	if scale == 0 {
+		scale = 1
+	}
+	cx, cy := float64(width)/2, float64(height)/2
+
+	// The scan maps p to scale * R(theta) * (p - c) + c + shift, so going back
+	// is R(-theta) * (q - c - shift) / scale + c.
+	rot := -s.Rotation * math.Pi / 180
+	sin, cos := math.Sincos(rot)
+	vx, vy := (cx+s.ShiftX)/scale, (cy+s.ShiftY)/scale
+	return drawing.Transform{
+		Scale:    1 / scale,
+		Rotation: rot,
+		TX:       cx - (cos*vx - sin*vy),
+		TY:       cy - (sin*vx + cos*vy),
+	}
+}
+
+// Options for generating a synthetic redline
+type Options struct {
+	// Color of the highlighter, and how strongly it shows (0 to 1)
+	Color   color.RGBA
+	Opacity float64
+
+	// Width of the highlighter strokes, in pixels
+	StrokeWidth float64
+
+	// How far, in pixels, the hand drawn strokes wander from the lines
+	Jitter float64
+
+	// How the asbuilt is moved on the scan
+	Scan Scan
+
+	// Standard deviation of the scanner noise, in 8 bit levels
+	Noise float64
+
+	// Radius of the box blur, in pixels. 0 doesn't blur.
+	Blur int
+
+	// Color of the paper the redline was printed on
+	Tint color.RGBA
+
+	// Seed for the random jitter and noise, so a redline can be made again
+	Seed int64
+}
+
+// Score is how well the lines drawn on a running asbuilt match the ground
+// truth.
+type Score struct {
+	// Number of drawn pixels, and how many are within the tolerance of a
+	// ground truth line
+	Drawn, Correct int
+
+	// Number of pixels along the ground truth lines, and how many are within
+	// the tolerance of a drawn pixel
+	Truth, Found int
+
+	// Correct / Drawn, Found / Truth, and their harmonic mean
+	Precision, Recall, F1 float64
+}
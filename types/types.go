@@ -1,6 +1,9 @@
 package types
 
-import "image/color"
+import (
+	"image/color"
+	"strconv"
+)
 
 // Package to help us avoid import cycles in Go.
 
@@ -15,12 +18,41 @@ type UI interface {
 type Production struct {
 	Date  string
 	Units []Unit
+
+	// Job the work was done for, and the crew that did it
+	Job  string
+	Crew string
 }
 
 // Unit details for the production box
 type Unit struct {
-	Name  string
-	Qty   string
-	Text  string
-	Color color.RGBA
+	Name        string
+	Description string
+	Qty         string
+	Text        string
+	Color       color.RGBA
+
+	// Whether the quantity is feet of new plant that counts towards the
+	// production's footage. Labor units for the same feet (like C400) don't.
+	Footage bool
+
+	// Design quantity of the unit for the whole job, and how much of it has
+	// been placed, e.g. "5000" and "9%". Only set on job totals, and empty if
+	// the job has no design quantity for the unit.
+	Design  string
+	Percent string
+}
+
+// Footage returns the total feet of new plant in the production
+func (p Production) Footage() float64 {
+	var total float64
+	for _, u := range p.Units {
+		if !u.Footage {
+			continue
+		}
+		if qty, err := strconv.ParseFloat(u.Qty, 64); err == nil {
+			total += qty
+		}
+	}
+	return total
 }
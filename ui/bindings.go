@@ -25,6 +25,10 @@ func (u *UI) keybindings() error {
 		}
 	}
 
+	if err := u.prodKeybindings(); err != nil {
+		return err
+	}
+
 	onDown := func(g *gocui.Gui, v *gocui.View) error {
 		cx, cy := v.Cursor()
 
@@ -74,11 +74,12 @@ func (e *editor) Edit(v *gocui.View, key gocui.Key, ch rune, mod gocui.Modifier)
 		}
 	}
 	e.editor.Edit(v, key, ch, mod)
+	e.ui.checkField(v.Name())
 }
 
 // isEditableView returns whether or not the view is editable.
 func (u *UI) isEditableView(name string) bool {
-	for key, view := range panelViews {
+	for key, view := range u.panels {
 		if key == name {
 			return view.edit
 		}
@@ -88,7 +89,7 @@ func (u *UI) isEditableView(name string) bool {
 
 // getViewCache gets the specified views cache.
 func (u *UI) getViewCache(name string) []byte {
-	for key, view := range panelViews {
+	for key, view := range u.panels {
 		if key == name {
 			if view.cache == nil {
 				break
@@ -101,7 +102,7 @@ func (u *UI) getViewCache(name string) []byte {
 
 // setViewCache sets the view cache value.
 func (u *UI) setViewCache(name string, cache []byte) {
-	for key, view := range panelViews {
+	for key, view := range u.panels {
 		if key == name {
 			view.cache = cache
 		}
@@ -2,6 +2,8 @@ package ui
 
 import (
 	"caddae/app"
+	"caddae/imageproc"
+	"caddae/report"
 	"fmt"
 	"image"
 	"image/draw"
@@ -37,35 +39,24 @@ func (u *UI) checkUserInput() error {
 		return err
 	}
 
-	strand, err := u.readEditView(C300_01_PANEL)
-	if err != nil {
-		return err
-	}
-
-	cable, err := u.readEditView(C300_02_PANEL)
-	if err != nil {
-		return err
-	}
-
-	overlash, err := u.readEditView(C300_03_PANEL)
-	if err != nil {
-		return err
-	}
-
-	anchors, err := u.readEditView(C300_04_PANEL)
-	if err != nil {
-		return err
-	}
-
 	in := app.UserInput{
 		Rl:       redline,
 		Ra:       running,
 		Jn:       job,
 		Wpd:      wpd,
-		Strand:   strand,
-		Cable:    cable,
-		Overlash: overlash,
-		Anchors:  anchors,
+		Profile:  u.defaults.Profile,
+		Template: u.defaults.Template,
+		Crew:     u.defaults.Crew,
+	}
+
+	for _, f := range u.fields {
+		qty, err := u.readEditView(f.name)
+		if err != nil {
+			return err
+		}
+		if qty != "" {
+			in.SetQuantity(f.unit.Code, qty)
+		}
 	}
 
 	u.a.SetUserInput(in)
@@ -92,6 +83,7 @@ func (u *UI) createRunning(g *gocui.Gui, v *gocui.View) error {
 	}
 
 	u.ClearLog()
+	u.logPages()
 
 	go func() {
 		err := u.a.Start(u, g)
@@ -135,3 +127,47 @@ func (u *UI) createRunning(g *gocui.Gui, v *gocui.View) error {
 
 	return nil
 }
+
+// logPages lets the user know when the redline or running asbuilt has more
+// than one page, since there's nowhere to pick the page in the UI and only the
+// first one is used.
+func (u *UI) logPages() {
+	for _, panel := range []string{REDLINE_PANEL, RUNNING_PANEL} {
+		file, err := u.readEditView(panel)
+		if err != nil || file == "" {
+			continue
+		}
+		pages, err := imageproc.PageCount(file)
+		if err != nil || pages < 2 {
+			continue
+		}
+		u.Log(fmt.Sprintf("%s has %d pages, only the first is used. Use caddae create -page or -running-page for another.", file, pages))
+	}
+}
+
+// exportReport is triggered by pressing Ctrl+e. It writes the production
+// report of the job entered, or of every job if none is, from the job
+// database to an XLSX file in the working directory. There's nowhere to enter
+// a date range in the UI, so that's left to 'caddae export'.
+func exportReport(u *UI, wrap bool) ClosureFn {
+	return func(*gocui.Gui, *gocui.View) error {
+		job, err := u.readEditView(JOB_PANEL)
+		if err != nil {
+			return err
+		}
+		job = strings.ToUpper(strings.TrimSpace(job))
+
+		var f report.Filter
+		file := "production.xlsx"
+		if job != "" {
+			f.Jobs = []string{job}
+			file = job + "_production.xlsx"
+		}
+
+		n, err := u.a.ExportReport(file, f)
+		if err != nil {
+			return u.LogErr(fmt.Sprintf("%v", err))
+		}
+		return u.Log(fmt.Sprintf("Exported %d production rows to %s", n, file))
+	}
+}
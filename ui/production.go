@@ -0,0 +1,231 @@
+package ui
+
+import (
+	"caddae/catalog"
+	"fmt"
+	"strings"
+
+	"github.com/jroimartin/gocui"
+)
+
+// initProduction adds a field to the production panel for each unit of the
+// app's catalog that's given a quantity, after the production panel in the
+// order of the views.
+func (u *UI) initProduction() {
+	u.panels = make(map[string]Panel, len(panelViews))
+	for name, p := range panelViews {
+		u.panels[name] = p
+	}
+
+	var names []string
+	for _, unit := range u.a.Catalog().Inputs() {
+		f := prodField{
+			name: UNIT_PANEL_PREFIX + strings.ToLower(unit.Code),
+			unit: unit,
+		}
+		u.fields = append(u.fields, f)
+		u.panels[f.name] = Panel{
+			title:  unit.Code,
+			body:   "",
+			edit:   true,
+			cursor: true,
+		}
+		names = append(names, f.name)
+	}
+
+	u.views = nil
+	for _, view := range views {
+		u.views = append(u.views, view)
+		if view == PRODUCTION_PANEL {
+			u.views = append(u.views, names...)
+		}
+	}
+	u.scrollProduction(0)
+}
+
+// findField returns the index of the production unit field with the view
+// name, or -1 if the view isn't one.
+func (u *UI) findField(name string) int {
+	for i, f := range u.fields {
+		if f.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// prodRows returns the number of rows of fields that fit in the production
+// panel.
+func (u *UI) prodRows() int {
+	p := panelViews[PRODUCTION_PANEL]
+	rows := (p.y2-p.y1-fieldTop-fieldHeight-1)/fieldRowGap + 1
+	if rows < 1 {
+		return 1
+	}
+	return rows
+}
+
+// scrollProduction shows the rows of fields starting at row, moving the rows
+// that don't fit off the screen, where they keep what was entered in them.
+func (u *UI) scrollProduction(row int) {
+	total := (len(u.fields) + fieldCols - 1) / fieldCols
+	if max := total - u.prodRows(); row > max {
+		row = max
+	}
+	if row < 0 {
+		row = 0
+	}
+	u.prodRow = row
+
+	p := panelViews[PRODUCTION_PANEL]
+	for i, f := range u.fields {
+		fp := u.panels[f.name]
+		r, c := i/fieldCols-u.prodRow, i%fieldCols
+		if r < 0 || r >= u.prodRows() {
+			fp.x1, fp.y1 = -fieldWidth-1, 0
+		} else {
+			fp.x1 = p.x1 + fieldLeft + c*fieldColGap
+			fp.y1 = p.y1 + fieldTop + r*fieldRowGap
+		}
+		fp.x2, fp.y2 = fp.x1+fieldWidth, fp.y1+fieldHeight
+		u.panels[f.name] = fp
+	}
+}
+
+// showField scrolls the production panel so the field with the view name is
+// shown, if it's one of the production unit fields.
+func (u *UI) showField(name string) {
+	i := u.findField(name)
+	if i < 0 {
+		return
+	}
+	switch row := i / fieldCols; {
+	case row < u.prodRow:
+		u.scrollProduction(row)
+	case row >= u.prodRow+u.prodRows():
+		u.scrollProduction(row - u.prodRows() + 1)
+	}
+}
+
+// prodTitle returns the title of the production panel, with which of the
+// fields are shown when they don't all fit.
+func (u *UI) prodTitle() string {
+	title := panelViews[PRODUCTION_PANEL].title
+	if len(u.fields) <= u.prodRows()*fieldCols {
+		return title
+	}
+
+	first := u.prodRow*fieldCols + 1
+	last := first + u.prodRows()*fieldCols - 1
+	if last > len(u.fields) {
+		last = len(u.fields)
+	}
+	title = fmt.Sprintf("%s (%d-%d of %d)", title, first, last, len(u.fields))
+	if first > 1 {
+		title += " ▲"
+	}
+	if last < len(u.fields) {
+		title += " ▼"
+	}
+	return title
+}
+
+// prodKeybindings lets the mouse wheel and arrow keys scroll the production
+// panel, and Tab move on from the production unit fields.
+func (u *UI) prodKeybindings() error {
+	up := func(g *gocui.Gui, v *gocui.View) error {
+		u.scrollProduction(u.prodRow - 1)
+		return nil
+	}
+	down := func(g *gocui.Gui, v *gocui.View) error {
+		u.scrollProduction(u.prodRow + 1)
+		return nil
+	}
+
+	names := []string{PRODUCTION_PANEL}
+	for _, f := range u.fields {
+		names = append(names, f.name)
+		if err := u.g.SetKeybinding(f.name, gocui.KeyTab, gocui.ModNone, nextPanel(u, true)); err != nil {
+			return err
+		}
+	}
+	for _, name := range names {
+		if err := u.g.SetKeybinding(name, gocui.MouseWheelUp, gocui.ModNone, up); err != nil {
+			return err
+		}
+		if err := u.g.SetKeybinding(name, gocui.MouseWheelDown, gocui.ModNone, down); err != nil {
+			return err
+		}
+	}
+	if err := u.g.SetKeybinding(PRODUCTION_PANEL, gocui.KeyArrowUp, gocui.ModNone, up); err != nil {
+		return err
+	}
+	return u.g.SetKeybinding(PRODUCTION_PANEL, gocui.KeyArrowDown, gocui.ModNone, down)
+}
+
+// checkField checks the quantity entered in the production unit field with
+// the view name, coloring it red if it can't be used, and shows a hint for
+// it on the production panel.
+func (u *UI) checkField(name string) error {
+	i := u.findField(name)
+	if i < 0 {
+		return nil
+	}
+	f := &u.fields[i]
+
+	v, err := u.g.View(name)
+	if err != nil {
+		return err
+	}
+	qty := strings.TrimSpace(strings.Split(v.Buffer(), "\n")[0])
+
+	hint := fieldHint(f, qty)
+	v.FgColor = gocui.ColorDefault
+	if f.invalid {
+		v.FgColor = gocui.ColorRed
+	}
+	return u.setHint(hint)
+}
+
+// fieldHint returns the hint for the quantity entered in the field, and sets
+// whether it's invalid.
+func fieldHint(f *prodField, qty string) string {
+	unit := f.unit
+	measure := "each"
+	example := "2"
+	if unit.Measure == catalog.FEET {
+		measure = "in feet"
+		example = "100 or 85.25"
+	} else if unit.Measure != catalog.EACH {
+		measure = "in " + unit.Measure
+	}
+	if unit.Decimals == 0 {
+		example = strings.Fields(example)[0]
+	}
+
+	f.invalid = false
+	if qty == "" {
+		return fmt.Sprintf("%s: %s, %s, e.g. %s", unit.Code, unit.Description, measure, example)
+	}
+	q, err := unit.ParseQty(qty)
+	if err != nil {
+		f.invalid = true
+		return fmt.Sprintf("%s: '%s' isn't a quantity", unit.Code, qty)
+	}
+	if unit.Round(q) != q {
+		return fmt.Sprintf("%s: %s will be rounded to %s", unit.Code, qty, unit.FormatQty(q))
+	}
+	return fmt.Sprintf("%s: %s, %s", unit.Code, unit.Description, measure)
+}
+
+// setHint replaces the first line of the production panel with the hint
+func (u *UI) setHint(hint string) error {
+	v, err := u.g.View(PRODUCTION_PANEL)
+	if err != nil {
+		return err
+	}
+	lines := strings.SplitN(prodText, "\n", 2)
+	v.Clear()
+	fmt.Fprint(v, hint+"\n"+lines[1])
+	return nil
+}
@@ -2,6 +2,7 @@ package ui
 
 import (
 	"caddae/app"
+	"caddae/catalog"
 	"sync"
 	"time"
 
@@ -32,6 +33,7 @@ var handlers = []handler{
 	{nil, gocui.KeyCtrlC, "Ctrl+c", "Quit", quit},
 	{nil, gocui.KeyCtrlX, "Ctrl+x", "Clear editor content", nil},
 	{nil, gocui.KeyCtrlZ, "Ctrl+z", "Restore editor content", nil},
+	{nil, gocui.KeyCtrlE, "Ctrl+e", "Export production report", exportReport},
 }
 
 // END bindings.go Types }}}
@@ -64,16 +66,21 @@ the requested information
 Redline
 -------
 Enter the full path name of the redline file you wish to
-digitally recreate.
+digitally recreate. Only the first page of a TIFF or PDF
+scan is used, the log says how many pages it has when
+there are more. To use another page, run caddae create
+with -page.
 
-Format: .png
+Format: .png | .jpg | .tif | .pdf
 
 Running AsBuilt
 ---------------
 Enter the full path name of the original asbuilt file
-that is to be updated.
+that is to be updated. As with the redline, only the
+first page is used, caddae create -running-page picks
+another.
 
-Format: .png
+Format: .png | .jpg | .tif | .pdf
 
 DYEA/VZ
 -------
@@ -90,9 +97,22 @@ Format: MM/DD/YYYY
 Production
 -----------
 Enter the each applicable production units quantities.
+Units that don't fit in the panel are reached with Tab,
+or by scrolling the panel. The first line of the panel
+says what each unit is, and what's wrong with a quantity
+shown in red.
 
 Format: 100 | 85.25
 
+Production Report
+-----------------
+Press Ctrl+e to export the production placed on the job
+entered in DYEA/VZ, or on every job if it's empty, to
+JOB_production.xlsx in the working directory. It has
+every date, a range of work performed dates can only be
+exported on the command line, with caddae export -from
+and -to.
+
 Keybindings
 ===========
 `
@@ -132,15 +152,21 @@ type UI struct {
 	g       *gocui.Gui
 	l       zerolog.Logger
 	mu      sync.Mutex
-	cv      int         // The currently active panel
-	nv      int         // The next panel in the array
-	cm      string      // The currently active modal
-	c       Cursors     // Tracking for cursor positions in each views
-	dt      *time.Timer // Timer for displaying the diagram
-	lt      *time.Timer // Timer for logging the recreation process
-	lm      []string    // Array of log messages
-	started bool        // Whether or not the process has been started.
-	views   []string    // Array of views
+	cv      int              // The currently active panel
+	nv      int              // The next panel in the array
+	cm      string           // The currently active modal
+	c       Cursors          // Tracking for cursor positions in each views
+	dt      *time.Timer      // Timer for displaying the diagram
+	lt      *time.Timer      // Timer for logging the recreation process
+	lm      []string         // Array of log messages
+	started bool             // Whether or not the process has been started.
+	views   []string         // Array of views
+	panels  map[string]Panel // Panel of each view
+	fields  []prodField      // Production unit fields, in catalog order
+	prodRow int              // First row of production unit fields shown
+
+	// Profile, template and crew of each running asbuilt created
+	defaults app.UserInput
 }
 
 // END ui.go Types }}}
@@ -152,7 +178,7 @@ const aboutText = `This application is meant to read a *simple* aerial redline f
 Please fill out the boxes below and hit 'Create Running AsBuilt! when you're ready to begin.
 After that, you can view what's happening during the process in the 'Log' panel.
 
-Upon completion, it will save the running asbuilt in the 'edits' folder for your review.
+Upon completion, it will save the running asbuilt in the 'edits' folder next to it, or the -output-dir folder, for your review.
 
 Press Ctrl+H to toggle the help modal.
 `
@@ -199,10 +225,6 @@ const (
 	JOB_PANEL        = "job"
 	WPD_PANEL        = "wpd"
 	PRODUCTION_PANEL = "prod"
-	C300_01_PANEL    = "c300_01"
-	C300_02_PANEL    = "c300_02"
-	C300_03_PANEL    = "c300_03"
-	C300_04_PANEL    = "c300_04"
 	DIAGRAM_MODAL    = "diagram"
 	PROGRESS_MODAL   = "progress"
 	LOG_PANEL        = "log"
@@ -217,10 +239,6 @@ var views = []string{
 	JOB_PANEL,
 	WPD_PANEL,
 	PRODUCTION_PANEL,
-	C300_01_PANEL,
-	C300_02_PANEL,
-	C300_03_PANEL,
-	C300_04_PANEL,
 	CREATE_BUTTON,
 	LOG_PANEL,
 }
@@ -287,46 +305,6 @@ var panelViews = map[string]Panel{
 		edit:   false,
 		cursor: true,
 	},
-	C300_01_PANEL: {
-		title:  "C300-01",
-		body:   "",
-		x1:     3,
-		y1:     19,
-		x2:     23,
-		y2:     21,
-		edit:   true,
-		cursor: true,
-	},
-	C300_02_PANEL: {
-		title:  "C300-02",
-		body:   "",
-		x1:     25,
-		y1:     19,
-		x2:     45,
-		y2:     21,
-		edit:   true,
-		cursor: true,
-	},
-	C300_03_PANEL: {
-		title:  "C300-03",
-		body:   "",
-		x1:     3,
-		y1:     23,
-		x2:     23,
-		y2:     25,
-		edit:   true,
-		cursor: true,
-	},
-	C300_04_PANEL: {
-		title:  "C300-04",
-		body:   "",
-		x1:     25,
-		y1:     23,
-		x2:     45,
-		y2:     25,
-		edit:   true,
-		cursor: true,
-	},
 	LOG_PANEL: {
 		title:  "Application Log",
 		body:   "",
@@ -350,3 +328,29 @@ var panelViews = map[string]Panel{
 }
 
 // END views.go Types }}}
+
+// BEGIN production.go Types {{{
+
+// UNIT_PANEL_PREFIX is the start of the view name of each production unit
+// field, followed by the unit's code.
+const UNIT_PANEL_PREFIX = "unit_"
+
+// Layout of the production unit fields inside the production panel
+const (
+	fieldTop    = 3  // Rows from the top of the production panel to the first field
+	fieldLeft   = 3  // Columns from the left of the production panel to the first field
+	fieldWidth  = 20 // Width of a field
+	fieldHeight = 2  // Height of a field, from its top border to its bottom border
+	fieldRowGap = 4  // Rows from the top of one row of fields to the next
+	fieldColGap = 22 // Columns from the left of one column of fields to the next
+	fieldCols   = 2  // Fields on each row
+)
+
+// prodField is the field a production unit's quantity is entered in
+type prodField struct {
+	name    string        // View name
+	unit    *catalog.Unit // Unit the quantity is for
+	invalid bool          // Whether the quantity entered can't be used
+}
+
+// END production.go Types }}}
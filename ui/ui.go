@@ -22,14 +22,22 @@ func New(a *app.App, logger *zerolog.Logger) *UI {
 		g:       g,
 		l:       logger.With().Str("module", "ui").Logger(),
 		started: false,
-		views:   views,
 	}
+	ui.initProduction()
 
 	fl := ui.l.With().Str("func", "New").Logger()
 	fl.Debug().Msg("Created")
 	return &ui
 }
 
+// SetDefaults sets the color profile, callout template and crew used for
+// each running asbuilt created, since the UI doesn't ask for them.
+func (u *UI) SetDefaults(in app.UserInput) {
+	fl := u.l.With().Str("func", "SetDefaults").Logger()
+	fl.Debug().Str("profile", in.Profile).Str("template", in.Template).Str("crew", in.Crew).Send()
+	u.defaults = in
+}
+
 // StartUI initializes the interfaces values, creates keybindings and
 // starts the UI's main loop
 func (u *UI) StartUI() {
@@ -80,13 +88,14 @@ func (u *UI) Layout(g *gocui.Gui) error {
 			}
 			u.cv = u.findView(v.Name())
 			u.setPanelView(v.Name())
-			view := panelViews[v.Name()]
+			view := u.panels[v.Name()]
 			u.g.Cursor = view.cursor
+			u.checkField(v.Name())
 		}
 		return nil
 	}
 
-	for _, view := range views {
+	for _, view := range u.views {
 		if view == CREATE_BUTTON {
 			if err := u.g.SetKeybinding(view, gocui.KeyEnter, gocui.ModNone, u.createRunning); err != nil {
 				return err
@@ -103,12 +112,17 @@ func (u *UI) Layout(g *gocui.Gui) error {
 			}
 		}
 
-		v := panelViews[view]
+		v := u.panels[view]
 		if _, err := u.createPanelView(view, v.x1, v.y1, v.x2, v.y2); err != nil {
 			return err
 		}
 	}
 
+	// Show which of the production unit fields are in view
+	if v, err := u.g.View(PRODUCTION_PANEL); err == nil {
+		v.Title = u.prodTitle()
+	}
+
 	// Activate the first panel on first run
 	if v := u.g.CurrentView(); v == nil {
 		_, err := u.g.SetCurrentView(REDLINE_PANEL)
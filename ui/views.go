@@ -1,6 +1,7 @@
 package ui
 
 import (
+	"caddae/catalog"
 	"errors"
 	"fmt"
 	"github.com/jroimartin/gocui"
@@ -14,7 +15,7 @@ func (u *UI) createPanelView(name string, x1, y1, x2, y2 int) (*gocui.View, erro
 		return nil, err
 	}
 
-	p := panelViews[name]
+	p := u.panels[name]
 	v.Title = p.title
 	v.Editable = p.edit
 
@@ -35,22 +36,6 @@ func (u *UI) createPanelView(name string, x1, y1, x2, y2 int) (*gocui.View, erro
 		v.Wrap = true
 		v.Editor = newEditor(u, &staticViewEditor{})
 		break
-	case C300_01_PANEL:
-		fallthrough
-	case C300_02_PANEL:
-		fallthrough
-	case C300_03_PANEL:
-		v.Highlight = true
-		v.Autoscroll = false
-		v.Editor = newEditor(u, nil)
-		v.SelFgColor = gocui.ColorGreen
-		break
-	case C300_04_PANEL:
-		v.Highlight = true
-		v.Autoscroll = false
-		v.Editor = newEditor(u, nil)
-		v.SelFgColor = gocui.ColorMagenta
-		break
 	default:
 		v.Highlight = true
 		v.Autoscroll = false
@@ -62,23 +47,23 @@ func (u *UI) createPanelView(name string, x1, y1, x2, y2 int) (*gocui.View, erro
 
 // aactivatePanelView ctivates the view defined by id.
 func (u *UI) activatePanelView(id int) error {
+	u.showField(u.views[id])
 	if err := u.setPanelView(u.views[id]); err != nil {
 		return err
 	}
-	v := panelViews[u.views[id]]
-	switch v.title {
-	case C300_01_PANEL:
-		fallthrough
-	case C300_02_PANEL:
-		fallthrough
-	case C300_03_PANEL:
-		u.g.SelFgColor = gocui.ColorGreen
-		break
-	case C300_04_PANEL:
-		u.g.SelFgColor = gocui.ColorYellow
-		break
-	default:
-		u.g.SelFgColor = gocui.ColorCyan
+	v := u.panels[u.views[id]]
+
+	// Production unit fields are highlighted green for feet, and magenta for
+	// everything else.
+	u.g.SelFgColor = gocui.ColorCyan
+	if i := u.findField(u.views[id]); i >= 0 {
+		u.g.SelFgColor = gocui.ColorMagenta
+		if u.fields[i].unit.Measure == catalog.FEET {
+			u.g.SelFgColor = gocui.ColorGreen
+		}
+		if err := u.checkField(u.views[id]); err != nil {
+			return err
+		}
 	}
 	u.g.Cursor = v.cursor
 	u.cv = id
@@ -124,7 +109,7 @@ func (u *UI) write(name, text string) error {
 func (u *UI) readEditView(name string) (string, error) {
 	// Make sure the panel that's being requested to read from is actually
 	// editable first
-	p := panelViews[name]
+	p := u.panels[name]
 	if !p.edit {
 		e := fmt.Sprintf("u.readView(%s): No content to retrieve; view is not editable!", name)
 		return "", errors.New(e)
@@ -172,14 +157,14 @@ func (u *UI) updateView(v *gocui.View, buffer string) error {
 func (u *UI) nextView(wrap bool) error {
 	var index int
 	index = u.cv + 1
-	if index > len(panelViews)-1 {
+	if index > len(u.views)-1 {
 		if wrap {
 			index = 0
 		} else {
 			return nil
 		}
 	}
-	u.cv = index % len(panelViews)
+	u.cv = index % len(u.views)
 	return u.activatePanelView(u.cv)
 }
 
@@ -189,12 +174,12 @@ func (u *UI) prevView(wrap bool) error {
 	index = u.cv - 1
 	if index < 0 {
 		if wrap {
-			index = len(panelViews) - 1
+			index = len(u.views) - 1
 		} else {
 			return nil
 		}
 	}
-	u.cv = index % len(panelViews)
+	u.cv = index % len(u.views)
 	return u.activatePanelView(u.cv)
 }
 